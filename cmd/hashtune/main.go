@@ -0,0 +1,45 @@
+// cmd/hashtune/main.go
+//
+// hashtune picks password hashing parameters for the machine it runs on.
+// Run it on the production hardware and copy the printed settings into
+// the server's environment:
+//
+//	go run ./cmd/hashtune -target 250ms -memory 65536 -threads 2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+)
+
+func main() {
+	target := flag.Duration("target", 250*time.Millisecond, "time one password hash should take")
+	memory := flag.Uint("memory", uint(auth.DefaultArgon2Params.Memory), "argon2id memory in KiB")
+	threads := flag.Uint("threads", uint(auth.DefaultArgon2Params.Threads), "argon2id lanes")
+	flag.Parse()
+
+	params, took, err := auth.TuneArgon2id(*target, uint32(*memory), uint8(*threads))
+	if err != nil {
+		log.Fatalf("tuning argon2id: %v", err)
+	}
+	fmt.Printf("# argon2id: %v per hash\n", took.Round(time.Millisecond))
+	fmt.Printf("PASSWORD_HASH=argon2id\nARGON2_MEMORY_KIB=%d\nARGON2_TIME=%d\nARGON2_THREADS=%d\n",
+		params.Memory, params.Time, params.Threads)
+
+	// bcrypt's cost is a power of two, so report the first one that
+	// reaches the target for deployments that stay on bcrypt.
+	for cost := 10; cost <= 16; cost++ {
+		took, err := auth.TimePasswordHash(auth.NewBcryptPasswordHasher(cost), 1)
+		if err != nil {
+			log.Fatalf("timing bcrypt: %v", err)
+		}
+		if took >= *target || cost == 16 {
+			fmt.Printf("# bcrypt: %v per hash\nBCRYPT_COST=%d\n", took.Round(time.Millisecond), cost)
+			break
+		}
+	}
+}
@@ -2,15 +2,29 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
+	// The server image has no zoneinfo; embed it so profile time zones
+	// validate.
+	_ "time/tzdata"
 
 	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
 	"github.com/whiterabbit0809/overengineered-calculator/internal/calculator"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/geometry"
 	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
 	httpserver "github.com/whiterabbit0809/overengineered-calculator/internal/http"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numbertheory"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/preferences"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/probability"
 	"github.com/whiterabbit0809/overengineered-calculator/internal/storage"
 )
 
@@ -24,28 +38,161 @@ func main() {
 
 	// --- Auth: repo + service + token service + handler ---
 	userRepo := auth.NewPostgresUserRepository(db)
-	hasher := auth.NewBcryptPasswordHasher()
-	authService := auth.NewAuthService(userRepo, hasher)
+	hasher := auth.NewLimitedPasswordHasher(passwordHasher(), intEnv("PASSWORD_HASH_CONCURRENCY", runtime.NumCPU()))
+	policy := passwordPolicy()
+	authService := auth.NewAuthService(userRepo, hasher, policy)
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET is not set")
+	// --- Access tokens: RS256/EdDSA keys from JWT_KEYS_DIR, else HS256 with JWT_SECRET ---
+	accessTTL := durationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	var tokenService auth.TokenService
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		keySet, err := auth.LoadKeySet(keysDir, accessTTL, durationEnv("JWT_KEYS_RELOAD_INTERVAL", auth.DefaultKeyReloadInterval))
+		if err != nil {
+			log.Fatalf("failed to load signing keys: %v", err)
+		}
+		tokenService = auth.NewKeySetTokenService(keySet, "overengineered-calculator", accessTTL)
+	} else {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			log.Fatal("JWT_KEYS_DIR or JWT_SECRET must be set")
+		}
+		tokenService = auth.NewJWTTokenService(jwtSecret, "overengineered-calculator", accessTTL)
 	}
-	tokenService := auth.NewJWTTokenService(jwtSecret, "overengineered-calculator", 24*time.Hour)
 
-	authHandler := auth.NewHandler(authService, tokenService)
+	refreshTTL := durationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	revocationCacheTTL := durationEnv("REVOCATION_CACHE_TTL", auth.DefaultRevocationCacheTTL)
+
+	revocationRepo := auth.NewPostgresRevocationRepository(db)
+	revocationService := auth.NewRevocationService(revocationRepo, revocationCacheTTL)
+
+	sessionRepo := auth.NewPostgresSessionRepository(db)
+	sessionService := auth.NewSessionService(sessionRepo, refreshTTL, revocationCacheTTL)
+
+	refreshRepo := auth.NewPostgresRefreshTokenRepository(db)
+	refreshService := auth.NewRefreshService(refreshRepo, sessionService, refreshTTL)
+
+	// --- Mail: SMTP when SMTP_HOST is set, else written to MAIL_LOG_FILE or stdout ---
+	// Sent in the background, so responses do not wait for the mail server
+	// or reveal, by their timing, which addresses have accounts.
+	mailer := mail.NewQueue(newMailer(), intEnv("MAIL_QUEUE_SIZE", 100))
+
+	// APP_URL is the public address used in links sent by email.
+	appURL := getEnv("APP_URL", "http://localhost:8080")
+
+	// --- Brute-force protection: per-account and per-IP backoff, then lockout ---
+	loginAttemptRepo := auth.NewPostgresLoginAttemptRepository(db)
+	loginGuard := auth.NewLoginGuard(loginAttemptRepo, auth.LockoutConfig{
+		Threshold:   intEnv("LOCKOUT_THRESHOLD", auth.DefaultLockoutThreshold),
+		IPThreshold: intEnv("LOCKOUT_IP_THRESHOLD", auth.DefaultIPLockoutThreshold),
+		Duration:    durationEnv("LOCKOUT_DURATION", auth.DefaultLockoutDuration),
+		BackoffBase: durationEnv("LOGIN_BACKOFF_BASE", auth.DefaultLoginBackoffBase),
+		BackoffMax:  durationEnv("LOGIN_BACKOFF_MAX", auth.DefaultLoginBackoffMax),
+		Window:      durationEnv("LOGIN_FAILURE_WINDOW", auth.DefaultLoginFailureWindow),
+	})
+
+	resetRepo := auth.NewPostgresPasswordResetRepository(db)
+	passwordService := auth.NewPasswordService(userRepo, resetRepo, hasher, policy, mailer, sessionService, revocationService, loginGuard, auth.PasswordResetConfig{
+		TTL:      durationEnv("PASSWORD_RESET_TTL", auth.DefaultPasswordResetTTL),
+		ResetURL: appURL + "/reset-password",
+	})
+
+	// --- Email verification; REQUIRE_VERIFIED_LOGIN / REQUIRE_VERIFIED_CALC gate unverified users ---
+	verificationRepo := auth.NewPostgresEmailVerificationRepository(db)
+	verificationService := auth.NewVerificationService(userRepo, verificationRepo, mailer, auth.VerificationConfig{
+		TTL:             durationEnv("VERIFICATION_TTL", auth.DefaultVerificationTTL),
+		ResendInterval:  durationEnv("VERIFICATION_RESEND_INTERVAL", auth.DefaultVerificationResend),
+		VerifyURL:       appURL + "/verify-email",
+		RequireForLogin: boolEnv("REQUIRE_VERIFIED_LOGIN"),
+	})
+	requireVerifiedForCalc := boolEnv("REQUIRE_VERIFIED_CALC")
+
+	// --- Two-factor authentication (TOTP); MFA_ISSUER names the account in authenticator apps ---
+	mfaRepo := auth.NewPostgresMFARepository(db)
+	mfaService := auth.NewMFAService(mfaRepo, userRepo, hasher, loginGuard, auth.MFAConfig{
+		Issuer:       getEnv("MFA_ISSUER", "Overengineered Calculator"),
+		ChallengeTTL: durationEnv("MFA_CHALLENGE_TTL", auth.DefaultMFAChallengeTTL),
+	})
+
+	// --- Roles: ADMIN_EMAILS (comma-separated) are promoted to admin at startup ---
+	adminService := auth.NewAdminService(userRepo, revocationService, sessionService, refreshService, loginGuard)
+	promoteAdmins(userRepo, os.Getenv("ADMIN_EMAILS"))
+
+	// --- API keys for scripts (Authorization: ApiKey <key>) ---
+	apiKeyRepo := auth.NewPostgresAPIKeyRepository(db)
+	apiKeyService := auth.NewAPIKeyService(apiKeyRepo, userRepo)
+
+	// --- Sign-in with OpenID Connect providers listed in OIDC_PROVIDERS ---
+	oidcRepo := auth.NewPostgresOIDCRepository(db)
+	oidcService := auth.NewOIDCService(oidcRepo, userRepo, hasher, auth.OIDCConfig{
+		Providers: oidcProviders(appURL),
+		StateTTL:  auth.DefaultOIDCStateTTL,
+	})
+
+	// --- OAuth 2.0 for partner apps acting on behalf of users ---
+	oauthRepo := auth.NewPostgresOAuthRepository(db)
+	oauthService := auth.NewOAuthService(oauthRepo, userRepo, tokenService, sessionService, revocationService, auth.OAuthConfig{
+		AccessTTL:  accessTTL,
+		RefreshTTL: refreshTTL,
+		CodeTTL:    durationEnv("OAUTH_CODE_TTL", auth.DefaultOAuthCodeTTL),
+		CacheTTL:   revocationCacheTTL,
+	})
+
+	// --- Account: email change, and deletion purged after ACCOUNT_DELETION_GRACE ---
+	emailChangeRepo := auth.NewPostgresEmailChangeRepository(db)
+	accountService := auth.NewAccountService(userRepo, emailChangeRepo, hasher, mailer, revocationService, sessionService, refreshService, auth.AccountConfig{
+		EmailChangeTTL:      durationEnv("EMAIL_CHANGE_TTL", auth.DefaultEmailChangeTTL),
+		ConfirmEmailURL:     appURL + "/confirm-email",
+		DeletionGracePeriod: durationEnv("ACCOUNT_DELETION_GRACE", auth.DefaultDeletionGracePeriod),
+	})
+	go purgeDeletedAccounts(accountService, durationEnv("ACCOUNT_PURGE_INTERVAL", time.Hour))
+
+	// TRUSTED_PROXIES lists the reverse proxies whose X-Forwarded-For
+	// header names the client, for per-IP login limits and session info.
+	proxies, err := auth.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	authHandler := auth.NewHandler(authService, tokenService, refreshService, revocationService, sessionService, passwordService, verificationService, mfaService, loginGuard, adminService, apiKeyService, oidcService, appURL+"/", oauthService, accountService, proxies)
+
+	// --- Special values (+Inf/-Inf/NaN): "reject" (default) or "string" ---
+	specialValues, err := numeric.ParseSpecialValuePolicy(os.Getenv("SPECIAL_VALUES"))
+	if err != nil {
+		log.Fatalf("invalid SPECIAL_VALUES: %v", err)
+	}
 
 	// --- History: repo + service + handler ---
-	historyRepo := history.NewPostgresRepository(db)
+	historyRepo := history.NewPostgresRepository(db, specialValues)
 	historyService := history.NewService(historyRepo)
 	historyHandler := history.NewHandler(historyService)
 
+	// --- Preferences: repo + service + handler ---
+	prefsRepo := preferences.NewPostgresRepository(db)
+	prefsService := preferences.NewService(prefsRepo)
+	prefsHandler := preferences.NewHandler(prefsService)
+
 	// --- Calculator: service + handler ---
-	calcService := calculator.NewService(historyService)
+	// MAX_EVAL_STEPS bounds the work of one expression, series terms included.
+	maxEvalSteps := intEnv("MAX_EVAL_STEPS", calculator.DefaultMaxEvalSteps)
+	calcService := calculator.NewService(historyService, prefsService, calculator.Config{
+		SpecialValues: specialValues,
+		MaxEvalSteps:  maxEvalSteps,
+	})
 	calcHandler := calculator.NewHandler(calcService)
 
+	// --- Probability: service + handler ---
+	probService := probability.NewService(historyService)
+	probHandler := probability.NewHandler(probService)
+
+	// --- Number theory (big integers): service + handler ---
+	bigintService := numbertheory.NewService(historyService)
+	bigintHandler := numbertheory.NewHandler(bigintService)
+
+	// --- Geometry: service + handler ---
+	geometryService := geometry.NewService(historyService, prefsService)
+	geometryHandler := geometry.NewHandler(geometryService)
+
 	// --- Router ---
-	router := httpserver.NewRouter(authHandler, tokenService, calcHandler, historyHandler)
+	router := httpserver.NewRouter(authHandler, tokenService, revocationService, sessionService, apiKeyService, oauthService, calcHandler, historyHandler, prefsHandler, probHandler, bigintHandler, geometryHandler, requireVerifiedForCalc)
 
 	// --- HTTP server ---
 	port := os.Getenv("PORT")
@@ -58,3 +205,196 @@ func main() {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// passwordHasher hashes new passwords with PASSWORD_HASH (argon2id by
+// default, or bcrypt) and still accepts hashes of the other algorithm,
+// which are replaced at the user's next login.
+func passwordHasher() auth.PasswordHasher {
+	bcryptHasher := auth.NewBcryptPasswordHasher(intEnv("BCRYPT_COST", 0))
+	argon2Hasher, err := auth.NewArgon2idPasswordHasher(auth.Argon2Params{
+		Memory:  uint32(intEnv("ARGON2_MEMORY_KIB", int(auth.DefaultArgon2Params.Memory))),
+		Time:    uint32(intEnv("ARGON2_TIME", int(auth.DefaultArgon2Params.Time))),
+		Threads: uint8(intEnv("ARGON2_THREADS", int(auth.DefaultArgon2Params.Threads))),
+	})
+	if err != nil {
+		log.Fatalf("invalid argon2id settings: %v", err)
+	}
+
+	switch alg := getEnv("PASSWORD_HASH", "argon2id"); alg {
+	case "argon2id":
+		return auth.NewUpgradingPasswordHasher(argon2Hasher, bcryptHasher)
+	case "bcrypt":
+		return auth.NewUpgradingPasswordHasher(bcryptHasher, argon2Hasher)
+	default:
+		log.Fatalf("invalid PASSWORD_HASH: %q", alg)
+		return nil
+	}
+}
+
+// passwordPolicy builds the rules for new passwords from PASSWORD_*
+// settings; BREACHED_PASSWORDS_DIR adds the breached-password check.
+func passwordPolicy() auth.PasswordPolicy {
+	cfg := auth.DefaultPasswordPolicyConfig
+	cfg.MinLength = intEnv("PASSWORD_MIN_LENGTH", cfg.MinLength)
+	cfg.MaxLength = intEnv("PASSWORD_MAX_LENGTH", cfg.MaxLength)
+	cfg.RequireMixedCase = boolEnv("PASSWORD_REQUIRE_MIXED_CASE")
+	cfg.RequireSymbol = boolEnv("PASSWORD_REQUIRE_SYMBOL")
+	if v := os.Getenv("PASSWORD_MIN_STRENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 4 {
+			log.Fatalf("invalid PASSWORD_MIN_STRENGTH: %q", v)
+		}
+		cfg.MinStrength = n
+	}
+
+	var breached auth.BreachedPasswords
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		var err error
+		if breached, err = auth.NewBreachedPasswordDir(dir); err != nil {
+			log.Fatalf("invalid BREACHED_PASSWORDS_DIR: %v", err)
+		}
+	}
+	return auth.NewPasswordPolicy(cfg, breached)
+}
+
+// durationEnv reads a time.ParseDuration value such as "15m", or returns
+// fallback when the variable is unset.
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("invalid %s: %q", key, v)
+	}
+	return d
+}
+
+// intEnv reads a positive integer, or returns fallback when unset.
+func intEnv(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid %s: %q", key, v)
+	}
+	return n
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// promoteAdmins gives the admin role to each listed account that exists,
+// so a fresh deployment has someone who can manage the others.
+func promoteAdmins(users auth.UserRepository, emails string) {
+	ctx := context.Background()
+	for _, email := range strings.Split(emails, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		user, err := users.FindByEmail(ctx, email)
+		if err != nil {
+			log.Printf("ADMIN_EMAILS: %s: %v", email, err)
+			continue
+		}
+		if user.Role == auth.RoleAdmin {
+			continue
+		}
+		if err := users.SetRole(ctx, user.ID, auth.RoleAdmin); err != nil {
+			log.Fatalf("ADMIN_EMAILS: promote %s: %v", email, err)
+		}
+		log.Printf("ADMIN_EMAILS: promoted %s to admin", email)
+	}
+}
+
+// purgeDeletedAccounts deletes accounts whose deletion grace period has
+// ended, once at startup and then every interval.
+func purgeDeletedAccounts(account auth.AccountService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := account.Purge(context.Background())
+		if err != nil {
+			log.Printf("purge deleted accounts: %v", err)
+		} else if n > 0 {
+			log.Printf("purged %d deleted accounts", n)
+		}
+		<-ticker.C
+	}
+}
+
+// oidcProviders reads OIDC_PROVIDERS, a comma-separated list of names, and
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and optional _SCOPES for
+// each. Providers redirect back to APP_URL/api/v1/auth/oidc/<name>/callback.
+func oidcProviders(appURL string) []auth.OIDCProviderConfig {
+	var providers []auth.OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := auth.OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  appURL + "/api/v1/auth/oidc/" + url.PathEscape(name) + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Fatalf("OIDC_PROVIDERS: %sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// newMailer picks the mail transport from the environment.
+func newMailer() mail.Mailer {
+	from := getEnv("MAIL_FROM", "no-reply@localhost")
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port, err := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+		if err != nil {
+			log.Fatalf("invalid SMTP_PORT: %v", err)
+		}
+		return mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	}
+
+	if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("open MAIL_LOG_FILE: %v", err)
+		}
+		return mail.NewLogMailer(f, from)
+	}
+	return mail.NewLogMailer(os.Stdout, from)
+}
+
+// boolEnv reads a strconv.ParseBool value; unset means false.
+func boolEnv(key string) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %q", key, v)
+	}
+	return b
+}
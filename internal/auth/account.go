@@ -0,0 +1,331 @@
+// internal/auth/account.go
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+)
+
+var (
+	ErrInvalidEmailChange = errors.New("invalid or expired email change link")
+	ErrEmailUnchanged     = errors.New("new email is the current email")
+	// ErrAccountPendingDeletion refuses API keys and OAuth clients of an
+	// account in its deletion grace period.
+	ErrAccountPendingDeletion = errors.New("account scheduled for deletion")
+)
+
+const (
+	// DefaultEmailChangeTTL is how long the link sent to a new address
+	// stays valid.
+	DefaultEmailChangeTTL = 24 * time.Hour
+	// DefaultDeletionGracePeriod is how long a deleted account can still
+	// be recovered by logging in.
+	DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+)
+
+// EmailChange is a pending change of a user's address. Like reset tokens
+// only the SHA-256 of the link token is kept.
+type EmailChange struct {
+	ID        string
+	UserID    string
+	NewEmail  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type EmailChangeRepository interface {
+	Create(ctx context.Context, c EmailChange) error
+	// FindByHash returns ErrInvalidEmailChange for unknown hashes.
+	FindByHash(ctx context.Context, hash string) (EmailChange, error)
+	// MarkUsed reports false if the change was already used.
+	MarkUsed(ctx context.Context, id string, at time.Time) (bool, error)
+	// InvalidateUser marks all of the user's unused changes as used.
+	InvalidateUser(ctx context.Context, userID string, at time.Time) error
+}
+
+type AccountConfig struct {
+	EmailChangeTTL time.Duration
+	// ConfirmEmailURL is the page that accepts the token; it is sent as
+	// ConfirmEmailURL?token=<token>.
+	ConfirmEmailURL string
+	// DeletionGracePeriod is how long a deleted account is kept before
+	// Purge removes it.
+	DeletionGracePeriod time.Duration
+}
+
+type AccountService interface {
+	// RequestEmailChange checks the password and mails a confirmation link
+	// to newEmail. The address only changes once the link is followed.
+	RequestEmailChange(ctx context.Context, userID, password, newEmail string) error
+	// ConfirmEmailChange switches the account to the new, now verified,
+	// address and tells the old one. Access tokens carrying the old
+	// address are revoked; a refresh picks up the new one.
+	ConfirmEmailChange(ctx context.Context, token string) error
+	// RequestDeletion checks the password, schedules the account for
+	// deletion and logs it out everywhere. It returns when the account
+	// will be purged; logging in before then cancels the deletion.
+	RequestDeletion(ctx context.Context, userID, password string) (time.Time, error)
+	// CancelDeletion keeps an account that was scheduled for deletion.
+	CancelDeletion(ctx context.Context, userID string) error
+	// Purge deletes the accounts whose grace period has ended, together
+	// with their history, and returns how many it removed.
+	Purge(ctx context.Context) (int, error)
+}
+
+type accountService struct {
+	users       UserRepository
+	changes     EmailChangeRepository
+	hasher      PasswordHasher
+	mailer      mail.Mailer
+	revocations RevocationService
+	sessions    SessionService
+	refresh     RefreshService
+	cfg         AccountConfig
+	now         func() time.Time
+}
+
+func NewAccountService(
+	users UserRepository,
+	changes EmailChangeRepository,
+	hasher PasswordHasher,
+	mailer mail.Mailer,
+	revocations RevocationService,
+	sessions SessionService,
+	refresh RefreshService,
+	cfg AccountConfig,
+) AccountService {
+	if cfg.EmailChangeTTL <= 0 {
+		cfg.EmailChangeTTL = DefaultEmailChangeTTL
+	}
+	if cfg.DeletionGracePeriod <= 0 {
+		cfg.DeletionGracePeriod = DefaultDeletionGracePeriod
+	}
+	return &accountService{
+		users:       users,
+		changes:     changes,
+		hasher:      hasher,
+		mailer:      mailer,
+		revocations: revocations,
+		sessions:    sessions,
+		refresh:     refresh,
+		cfg:         cfg,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// checkPassword loads the user and confirms the password.
+func (s *accountService) checkPassword(ctx context.Context, userID, password string) (User, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.hasher.CheckPassword(ctx, user.Password, password); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *accountService) RequestEmailChange(ctx context.Context, userID, password, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if err := validateEmail(newEmail); err != nil {
+		return err
+	}
+	user, err := s.checkPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailUnchanged
+	}
+	// Checked again when the change is confirmed; this only saves
+	// sending a link that cannot work.
+	if _, err := s.users.FindByEmail(ctx, newEmail); err == nil {
+		return ErrEmailAlreadyExists
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	// Only the newest link works.
+	if err := s.changes.InvalidateUser(ctx, user.ID, now); err != nil {
+		return err
+	}
+	err = s.changes.Create(ctx, EmailChange{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.EmailChangeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.ConfirmEmailURL + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Someone asked to use this address for their calculator account.\n\n"+
+			"Open this link within %s to confirm it:\n%s\n\n"+
+			"If it wasn't you, ignore this email.\n",
+			s.cfg.EmailChangeTTL, link),
+	})
+}
+
+func (s *accountService) ConfirmEmailChange(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidEmailChange
+	}
+	change, err := s.changes.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if change.UsedAt != nil || !now.Before(change.ExpiresAt) {
+		return ErrInvalidEmailChange
+	}
+	user, err := s.users.FindByID(ctx, change.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidEmailChange
+		}
+		return err
+	}
+	ok, err := s.changes.MarkUsed(ctx, change.ID, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidEmailChange
+	}
+
+	if err := s.users.ChangeEmail(ctx, user.ID, change.NewEmail); err != nil {
+		return err
+	}
+	if err := s.revocations.RevokeAll(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("The email address of your calculator account is now %s.\n\n"+
+			"If you did not make this change, reset your password and contact support.\n",
+			change.NewEmail),
+	})
+}
+
+func (s *accountService) RequestDeletion(ctx context.Context, userID, password string) (time.Time, error) {
+	user, err := s.checkPassword(ctx, userID, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := s.now()
+	if user.DeletionRequestedAt != nil {
+		now = *user.DeletionRequestedAt
+	} else if err := s.users.SetDeletionRequested(ctx, user.ID, &now); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.revocations.RevokeAll(ctx, user.ID); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.sessions.RevokeAll(ctx, user.ID); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.refresh.RevokeAll(ctx, user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	purgeAt := now.Add(s.cfg.DeletionGracePeriod)
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("Your calculator account and its history will be deleted on %s.\n\n"+
+			"To keep it, log in before then.\n",
+			purgeAt.Format("2 January 2006 15:04 MST")),
+	})
+	return purgeAt, err
+}
+
+func (s *accountService) CancelDeletion(ctx context.Context, userID string) error {
+	return s.users.SetDeletionRequested(ctx, userID, nil)
+}
+
+func (s *accountService) Purge(ctx context.Context) (int, error) {
+	return s.users.DeletePendingBefore(ctx, s.now().Add(-s.cfg.DeletionGracePeriod))
+}
+
+type postgresEmailChangeRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresEmailChangeRepository(db *sql.DB) EmailChangeRepository {
+	return &postgresEmailChangeRepository{db: db}
+}
+
+func (r *postgresEmailChangeRepository) Create(ctx context.Context, c EmailChange) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO email_changes (id, user_id, new_email, token_hash, created_at, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+		c.ID, c.UserID, c.NewEmail, c.TokenHash, c.CreatedAt, c.ExpiresAt,
+	)
+	return err
+}
+
+func (r *postgresEmailChangeRepository) FindByHash(ctx context.Context, hash string) (EmailChange, error) {
+	var c EmailChange
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, new_email, token_hash, created_at, expires_at, used_at
+         FROM email_changes WHERE token_hash = $1`,
+		hash,
+	).Scan(&c.ID, &c.UserID, &c.NewEmail, &c.TokenHash, &c.CreatedAt, &c.ExpiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return EmailChange{}, ErrInvalidEmailChange
+		}
+		return EmailChange{}, err
+	}
+	if usedAt.Valid {
+		c.UsedAt = &usedAt.Time
+	}
+	return c, nil
+}
+
+func (r *postgresEmailChangeRepository) MarkUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE email_changes SET used_at = $2 WHERE id = $1 AND used_at IS NULL`,
+		id, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresEmailChangeRepository) InvalidateUser(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE email_changes SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`,
+		userID, at,
+	)
+	return err
+}
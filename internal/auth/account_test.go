@@ -0,0 +1,225 @@
+// internal/auth/account_test.go
+package auth
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+)
+
+// fakeEmailChangeRepo keeps email changes in memory, keyed by hash.
+type fakeEmailChangeRepo struct {
+	changes map[string]*EmailChange
+}
+
+func (f *fakeEmailChangeRepo) Create(ctx context.Context, c EmailChange) error {
+	f.changes[c.TokenHash] = &c
+	return nil
+}
+
+func (f *fakeEmailChangeRepo) FindByHash(ctx context.Context, hash string) (EmailChange, error) {
+	c, ok := f.changes[hash]
+	if !ok {
+		return EmailChange{}, ErrInvalidEmailChange
+	}
+	return *c, nil
+}
+
+func (f *fakeEmailChangeRepo) MarkUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	for _, c := range f.changes {
+		if c.ID == id && c.UsedAt == nil {
+			c.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeEmailChangeRepo) InvalidateUser(ctx context.Context, userID string, at time.Time) error {
+	for _, c := range f.changes {
+		if c.UserID == userID && c.UsedAt == nil {
+			c.UsedAt = &at
+		}
+	}
+	return nil
+}
+
+type accountFixture struct {
+	svc         *accountService
+	users       *fakeUserRepo
+	sessions    SessionService
+	refresh     RefreshService
+	revocations RevocationService
+	outbox      *bytes.Buffer
+	now         time.Time
+}
+
+func newAccountFixture(t *testing.T) *accountFixture {
+	t.Helper()
+	users := &fakeUserRepo{createdUsers: []User{
+		{ID: "user-1", Email: "a@example.com", Password: "HASHED:Password123"},
+		{ID: "user-2", Email: "b@example.com", Password: "HASHED:Password123"},
+	}}
+	sessions := NewSessionService(newFakeSessionRepo(), time.Hour, time.Minute)
+	refresh := NewRefreshService(newFakeRefreshRepo(users), sessions, time.Hour)
+	revocations := NewRevocationService(newFakeRevocationRepo(), time.Minute)
+	outbox := &bytes.Buffer{}
+	svc := NewAccountService(users, &fakeEmailChangeRepo{changes: map[string]*EmailChange{}}, &fakeHasher{},
+		mail.NewLogMailer(outbox, "calc@example.com"), revocations, sessions, refresh,
+		AccountConfig{
+			EmailChangeTTL:      time.Hour,
+			ConfirmEmailURL:     "https://calc.example.com/confirm-email",
+			DeletionGracePeriod: 7 * 24 * time.Hour,
+		}).(*accountService)
+
+	f := &accountFixture{
+		svc:         svc,
+		users:       users,
+		sessions:    sessions,
+		refresh:     refresh,
+		revocations: revocations,
+		outbox:      outbox,
+		now:         time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	svc.now = func() time.Time { return f.now }
+	return f
+}
+
+var confirmEmailLink = regexp.MustCompile(`confirm-email\?token=([A-Za-z0-9_-]+)`)
+
+// mailedToken returns the token from the last confirmation email.
+func (f *accountFixture) mailedToken(t *testing.T) string {
+	t.Helper()
+	all := confirmEmailLink.FindAllStringSubmatch(f.outbox.String(), -1)
+	require.NotEmpty(t, all, "no confirmation link was mailed")
+	return all[len(all)-1][1]
+}
+
+// TestEmailChange_ConfirmsNewAddress
+// ----------------------------------
+// The link goes to the new address and the account keeps the old one
+// until it is followed; then the new address is verified, the old one is
+// told, access tokens are revoked and the link is spent.
+func TestEmailChange_ConfirmsNewAddress(t *testing.T) {
+	f := newAccountFixture(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, f.svc.RequestEmailChange(ctx, "user-1", "Wrong1234", "new@example.com"), ErrInvalidCredentials)
+	assert.ErrorIs(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", "not an email"), ErrInvalidEmailFormat)
+	assert.ErrorIs(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", "A@example.com"), ErrEmailUnchanged)
+	assert.ErrorIs(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", "b@example.com"), ErrEmailAlreadyExists)
+	assert.Empty(t, f.outbox.String())
+
+	require.NoError(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", " new@example.com "))
+	assert.Contains(t, f.outbox.String(), "To: new@example.com")
+	assert.Equal(t, "a@example.com", f.users.createdUsers[0].Email)
+	token := f.mailedToken(t)
+
+	require.NoError(t, f.svc.ConfirmEmailChange(ctx, token))
+	assert.Equal(t, "new@example.com", f.users.createdUsers[0].Email)
+	assert.True(t, f.users.createdUsers[0].EmailVerified)
+	assert.Contains(t, f.outbox.String(), "To: a@example.com")
+	assert.ErrorIs(t, f.revocations.Check(ctx, &TokenClaims{UserID: "user-1"}), ErrTokenRevoked)
+
+	assert.ErrorIs(t, f.svc.ConfirmEmailChange(ctx, token), ErrInvalidEmailChange)
+}
+
+// TestEmailChange_InvalidLinks
+// ----------------------------
+// Only the newest link works, and only until it expires; an address taken
+// in the meantime is refused at confirmation.
+func TestEmailChange_InvalidLinks(t *testing.T) {
+	f := newAccountFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", "first@example.com"))
+	first := f.mailedToken(t)
+	require.NoError(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", "second@example.com"))
+	second := f.mailedToken(t)
+	assert.ErrorIs(t, f.svc.ConfirmEmailChange(ctx, first), ErrInvalidEmailChange)
+	assert.ErrorIs(t, f.svc.ConfirmEmailChange(ctx, ""), ErrInvalidEmailChange)
+
+	f.now = f.now.Add(2 * time.Hour)
+	assert.ErrorIs(t, f.svc.ConfirmEmailChange(ctx, second), ErrInvalidEmailChange)
+
+	require.NoError(t, f.svc.RequestEmailChange(ctx, "user-1", "Password123", "third@example.com"))
+	third := f.mailedToken(t)
+	require.NoError(t, f.users.Create(ctx, User{ID: "user-3", Email: "third@example.com"}))
+	assert.ErrorIs(t, f.svc.ConfirmEmailChange(ctx, third), ErrEmailAlreadyExists)
+	assert.Equal(t, "a@example.com", f.users.createdUsers[0].Email)
+}
+
+// TestDeleteAccount_GracePeriod
+// -----------------------------
+// Requesting deletion logs the account out everywhere and mails the purge
+// date. Purge leaves it alone during the grace period, and a cancelled
+// deletion is never purged.
+func TestDeleteAccount_GracePeriod(t *testing.T) {
+	f := newAccountFixture(t)
+	ctx := context.Background()
+
+	s, err := f.sessions.Start(ctx, "user-1", "laptop", "10.0.0.1")
+	require.NoError(t, err)
+	refreshToken, err := f.refresh.Issue(ctx, "user-1", s.ID)
+	require.NoError(t, err)
+	claims := &TokenClaims{UserID: "user-1", SessionID: s.ID}
+
+	_, err = f.svc.RequestDeletion(ctx, "user-1", "Wrong1234")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	purgeAt, err := f.svc.RequestDeletion(ctx, "user-1", "Password123")
+	require.NoError(t, err)
+	assert.Equal(t, f.now.Add(7*24*time.Hour), purgeAt)
+	assert.Equal(t, f.now, *f.users.createdUsers[0].DeletionRequestedAt)
+	assert.Contains(t, f.outbox.String(), "To: a@example.com")
+	assert.Contains(t, f.outbox.String(), "8 March 2026")
+	assert.ErrorIs(t, f.revocations.Check(ctx, claims), ErrTokenRevoked)
+	assert.ErrorIs(t, f.sessions.Check(ctx, claims), ErrSessionRevoked)
+	_, err = f.refresh.Rotate(ctx, refreshToken)
+	assert.Error(t, err)
+
+	// Asking again keeps the original purge date.
+	f.now = f.now.Add(time.Hour)
+	again, err := f.svc.RequestDeletion(ctx, "user-1", "Password123")
+	require.NoError(t, err)
+	assert.Equal(t, purgeAt, again)
+
+	f.now = purgeAt.Add(-time.Minute)
+	n, err := f.svc.Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	f.now = purgeAt
+	n, err = f.svc.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = f.users.FindByID(ctx, "user-1")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = f.users.FindByID(ctx, "user-2")
+	assert.NoError(t, err)
+}
+
+// TestDeleteAccount_Cancel
+// ------------------------
+// Cancelling clears the request, so the account outlives the grace period.
+func TestDeleteAccount_Cancel(t *testing.T) {
+	f := newAccountFixture(t)
+	ctx := context.Background()
+
+	_, err := f.svc.RequestDeletion(ctx, "user-1", "Password123")
+	require.NoError(t, err)
+	require.NoError(t, f.svc.CancelDeletion(ctx, "user-1"))
+	assert.Nil(t, f.users.createdUsers[0].DeletionRequestedAt)
+
+	f.now = f.now.Add(30 * 24 * time.Hour)
+	n, err := f.svc.Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
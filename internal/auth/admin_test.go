@@ -0,0 +1,115 @@
+// internal/auth/admin_test.go
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAdminID = "00000000-0000-0000-0000-00000000000a"
+	testUserID  = "00000000-0000-0000-0000-000000000001"
+)
+
+type adminFixture struct {
+	svc         AdminService
+	users       *fakeUserRepo
+	sessions    SessionService
+	refresh     RefreshService
+	revocations RevocationService
+	guard       LoginGuard
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	users := &fakeUserRepo{createdUsers: []User{
+		{ID: testAdminID, Email: "admin@example.com", Role: RoleAdmin},
+		{ID: testUserID, Email: "a@example.com", Role: RoleUser},
+	}}
+	revRepo := newFakeRevocationRepo()
+	revRepo.versions[testUserID] = 0
+	revocations := NewRevocationService(revRepo, time.Minute)
+	sessions := NewSessionService(newFakeSessionRepo(), time.Hour, time.Minute)
+	refresh := NewRefreshService(newFakeRefreshRepo(users), sessions, time.Hour)
+	guard := NewLoginGuard(newFakeLoginAttemptRepo(), LockoutConfig{Threshold: 1})
+	return &adminFixture{
+		svc:         NewAdminService(users, revocations, sessions, refresh, guard),
+		users:       users,
+		sessions:    sessions,
+		refresh:     refresh,
+		revocations: revocations,
+		guard:       guard,
+	}
+}
+
+// TestAdmin_DisableEndsEverything
+// -------------------------------
+// Disabling an account revokes its access tokens, sessions and refresh
+// tokens; enabling it clears the flag.
+func TestAdmin_DisableEndsEverything(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+
+	s, err := f.sessions.Start(ctx, testUserID, "laptop", "10.0.0.1")
+	require.NoError(t, err)
+	refreshToken, err := f.refresh.Issue(ctx, testUserID, s.ID)
+	require.NoError(t, err)
+	claims := &TokenClaims{UserID: testUserID, SessionID: s.ID}
+
+	require.NoError(t, f.svc.SetDisabled(ctx, testAdminID, testUserID, true))
+	assert.NotNil(t, f.users.createdUsers[1].DisabledAt)
+	assert.ErrorIs(t, f.revocations.Check(ctx, claims), ErrTokenRevoked)
+	assert.ErrorIs(t, f.sessions.Check(ctx, claims), ErrSessionRevoked)
+	_, err = f.refresh.Rotate(ctx, refreshToken)
+	assert.Error(t, err)
+
+	require.NoError(t, f.svc.SetDisabled(ctx, testAdminID, testUserID, false))
+	assert.Nil(t, f.users.createdUsers[1].DisabledAt)
+}
+
+// TestAdmin_NotSelf
+// -----------------
+// Admins cannot disable or demote themselves.
+func TestAdmin_NotSelf(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, f.svc.SetDisabled(ctx, testAdminID, testAdminID, true), ErrCannotModifySelf)
+	assert.ErrorIs(t, f.svc.SetRole(ctx, testAdminID, testAdminID, RoleUser), ErrCannotModifySelf)
+	assert.Equal(t, RoleAdmin, f.users.createdUsers[0].Role)
+}
+
+// TestAdmin_SetRole
+// -----------------
+// Role changes are validated and revoke the user's current access tokens.
+func TestAdmin_SetRole(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, f.svc.SetRole(ctx, testAdminID, testUserID, "root"), ErrInvalidRole)
+	assert.ErrorIs(t, f.svc.SetRole(ctx, testAdminID, "not-a-uuid", RoleAuditor), ErrUserNotFound)
+
+	require.NoError(t, f.svc.SetRole(ctx, testAdminID, testUserID, RoleAuditor))
+	assert.Equal(t, RoleAuditor, f.users.createdUsers[1].Role)
+	assert.ErrorIs(t, f.revocations.Check(ctx, &TokenClaims{UserID: testUserID}), ErrTokenRevoked)
+}
+
+// TestAdmin_Unlock
+// ----------------
+// An admin can lift a login lockout.
+func TestAdmin_Unlock(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	_, err := f.guard.Check(ctx, "a@example.com", "")
+	require.ErrorIs(t, err, ErrLoginThrottled)
+
+	require.NoError(t, f.svc.Unlock(ctx, testAdminID, testUserID))
+	_, err = f.guard.Check(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,330 @@
+// internal/auth/apikey.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidAPIKey     = errors.New("invalid or expired api key")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrInvalidAPIKeyName = errors.New("api key name must be 1 to 100 characters")
+	ErrInvalidScope      = errors.New("invalid scope")
+	ErrInvalidExpiry     = errors.New("expiry must be in the future")
+)
+
+const (
+	// apiKeyTag starts every key so leaked keys are easy to recognise.
+	apiKeyTag = "ocak_"
+	// apiKeyPrefixLen is the length of the hex lookup prefix after the tag.
+	apiKeyPrefixLen = 12
+	maxAPIKeyName   = 100
+)
+
+// APIKeyScopes are the permissions a key may carry. Account and admin
+// endpoints stay behind interactive login.
+var APIKeyScopes = []Permission{PermCalcWrite, PermHistoryRead}
+
+// APIKey is a personal key for scripts. The key itself is shown once at
+// creation; only its lookup prefix and SHA-256 are stored.
+type APIKey struct {
+	ID         string       `json:"id"`
+	UserID     string       `json:"-"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"-"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	ExpiresAt  *time.Time   `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time   `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time   `json:"-"`
+}
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key APIKey) error
+	// FindByPrefix returns ErrInvalidAPIKey for unknown prefixes.
+	FindByPrefix(ctx context.Context, prefix string) (APIKey, error)
+	// ListByUser returns the user's unrevoked keys, newest first.
+	ListByUser(ctx context.Context, userID string) ([]APIKey, error)
+	// Revoke reports false when the user has no such unrevoked key.
+	Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error)
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+type APIKeyService interface {
+	// Create returns the key, which cannot be retrieved later. No scopes
+	// means all of APIKeyScopes; a nil expiry means the key does not
+	// expire.
+	Create(ctx context.Context, userID, name string, scopes []Permission, expiresAt *time.Time) (string, APIKey, error)
+	List(ctx context.Context, userID string) ([]APIKey, error)
+	Revoke(ctx context.Context, userID, id string) error
+	// Authenticate turns a key into claims for its owner, limited to the
+	// key's scopes. Revoked and expired keys and disabled owners yield
+	// ErrInvalidAPIKey.
+	Authenticate(ctx context.Context, key string) (*TokenClaims, error)
+}
+
+type apiKeyService struct {
+	repo  APIKeyRepository
+	users UserRepository
+	now   func() time.Time
+}
+
+func NewAPIKeyService(repo APIKeyRepository, users UserRepository) APIKeyService {
+	return &apiKeyService{
+		repo:  repo,
+		users: users,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *apiKeyService) Create(ctx context.Context, userID, name string, scopes []Permission, expiresAt *time.Time) (string, APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyName {
+		return "", APIKey{}, ErrInvalidAPIKeyName
+	}
+	scopes, err := normalizeScopes(scopes, APIKeyScopes)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	now := s.now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return "", APIKey{}, ErrInvalidExpiry
+	}
+
+	prefix, secret, err := newAPIKeyParts()
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	raw := apiKeyTag + prefix + "_" + secret
+
+	key := APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(raw),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return "", APIKey{}, err
+	}
+	return raw, key, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, userID string) ([]APIKey, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrAPIKeyNotFound
+	}
+	ok, err := s.repo.Revoke(ctx, userID, id, s.now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, raw string) (*TokenClaims, error) {
+	prefix, ok := parseAPIKey(raw)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.repo.FindByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashToken(raw))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := s.now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.users.FindByID(ctx, key.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if user.DisabledAt != nil || user.DeletionRequestedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= sessionTouchInterval {
+		if err := s.repo.Touch(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return &TokenClaims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		TokenVersion:  user.TokenVersion,
+		Role:          user.Role,
+		Scopes:        key.Scopes,
+	}, nil
+}
+
+// normalizeScopes validates and de-duplicates scopes against allowed,
+// defaulting to all of allowed. The result is in the order of allowed.
+func normalizeScopes(scopes, allowed []Permission) ([]Permission, error) {
+	if len(scopes) == 0 {
+		return slices.Clone(allowed), nil
+	}
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, ErrInvalidScope
+		}
+	}
+	var out []Permission
+	for _, p := range allowed {
+		if slices.Contains(scopes, p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// newAPIKeyParts returns a hex lookup prefix and a random secret.
+func newAPIKeyParts() (prefix, secret string, err error) {
+	b := make([]byte, apiKeyPrefixLen/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret, err = newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b), secret, nil
+}
+
+// parseAPIKey extracts the lookup prefix of "ocak_<prefix>_<secret>".
+func parseAPIKey(raw string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, apiKeyTag)
+	if !ok || len(rest) <= apiKeyPrefixLen+1 || rest[apiKeyPrefixLen] != '_' {
+		return "", false
+	}
+	return rest[:apiKeyPrefixLen], true
+}
+
+type postgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &postgresAPIKeyRepository{db: db}
+}
+
+func (r *postgresAPIKeyRepository) Create(ctx context.Context, k APIKey) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash, pq.Array(permissionStrings(k.Scopes)), k.CreatedAt, k.ExpiresAt,
+	)
+	return err
+}
+
+const selectAPIKey = `
+SELECT id, user_id, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+FROM api_keys`
+
+func (r *postgresAPIKeyRepository) FindByPrefix(ctx context.Context, prefix string) (APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, selectAPIKey+` WHERE prefix = $1`, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return k, err
+}
+
+func (r *postgresAPIKeyRepository) ListByUser(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		selectAPIKey+` WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (APIKey, error) {
+	var k APIKey
+	var scopes []string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&scopes),
+		&k.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	for _, s := range scopes {
+		k.Scopes = append(k.Scopes, Permission(s))
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return k, nil
+}
+
+func (r *postgresAPIKeyRepository) Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresAPIKeyRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, at)
+	return err
+}
+
+func permissionStrings(perms []Permission) []string {
+	out := make([]string, len(perms))
+	for i, p := range perms {
+		out[i] = string(p)
+	}
+	return out
+}
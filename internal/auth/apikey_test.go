@@ -0,0 +1,194 @@
+// internal/auth/apikey_test.go
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPIKeyRepo keeps keys in memory, in creation order.
+type fakeAPIKeyRepo struct {
+	keys    []*APIKey
+	touches int
+}
+
+func (f *fakeAPIKeyRepo) Create(ctx context.Context, k APIKey) error {
+	f.keys = append(f.keys, &k)
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (APIKey, error) {
+	for _, k := range f.keys {
+		if k.Prefix == prefix {
+			return *k, nil
+		}
+	}
+	return APIKey{}, ErrInvalidAPIKey
+}
+
+func (f *fakeAPIKeyRepo) ListByUser(ctx context.Context, userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+	for i := len(f.keys) - 1; i >= 0; i-- {
+		if k := f.keys[i]; k.UserID == userID && k.RevokedAt == nil {
+			keys = append(keys, *k)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeAPIKeyRepo) Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error) {
+	for _, k := range f.keys {
+		if k.ID == id && k.UserID == userID && k.RevokedAt == nil {
+			k.RevokedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeAPIKeyRepo) Touch(ctx context.Context, id string, at time.Time) error {
+	f.touches++
+	for _, k := range f.keys {
+		if k.ID == id {
+			k.LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+type apiKeyFixture struct {
+	svc   *apiKeyService
+	repo  *fakeAPIKeyRepo
+	users *fakeUserRepo
+	now   time.Time
+}
+
+func newAPIKeyFixture(t *testing.T) *apiKeyFixture {
+	t.Helper()
+	f := &apiKeyFixture{
+		repo:  &fakeAPIKeyRepo{},
+		users: &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Role: RoleUser}}},
+		now:   time.Unix(1_700_000_000, 0).UTC(),
+	}
+	f.svc = NewAPIKeyService(f.repo, f.users).(*apiKeyService)
+	f.svc.now = func() time.Time { return f.now }
+	return f
+}
+
+// TestAPIKey_CreateAndAuthenticate
+// --------------------------------
+// The key is returned once, stored only as a hash, and authenticates as
+// its owner with its scopes.
+func TestAPIKey_CreateAndAuthenticate(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+
+	raw, key, err := f.svc.Create(ctx, "user-1", " ci ", []Permission{PermHistoryRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "ocak_"+key.Prefix+"_"))
+	assert.Equal(t, "ci", key.Name)
+	assert.NotContains(t, f.repo.keys[0].KeyHash, raw)
+
+	claims, err := f.svc.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.Equal(t, "a@example.com", claims.Email)
+	assert.True(t, claims.Permits(PermHistoryRead))
+	assert.False(t, claims.Permits(PermCalcWrite))
+
+	// A guess that reuses a real prefix still fails.
+	_, err = f.svc.Authenticate(ctx, "ocak_"+key.Prefix+"_guess")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = f.svc.Authenticate(ctx, "not-a-key")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+// TestAPIKey_DefaultScopes
+// ------------------------
+// Without scopes a key gets every API key scope, but never more than the
+// owner's role.
+func TestAPIKey_DefaultScopes(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+
+	raw, key, err := f.svc.Create(ctx, "user-1", "all", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, APIKeyScopes, key.Scopes)
+
+	f.users.createdUsers[0].Role = RoleAuditor
+	claims, err := f.svc.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.True(t, claims.Permits(PermHistoryRead))
+	assert.False(t, claims.Permits(PermCalcWrite))
+	assert.False(t, claims.Permits(PermHistoryReadAny))
+
+	_, _, err = f.svc.Create(ctx, "user-1", "admin", []Permission{PermUsersWrite}, nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	_, _, err = f.svc.Create(ctx, "user-1", "", nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyName)
+}
+
+// TestAPIKey_ExpiryRevokeDisable
+// ------------------------------
+// Expired and revoked keys stop working, as do keys of disabled users.
+func TestAPIKey_ExpiryRevokeDisable(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+
+	past := f.now.Add(-time.Minute)
+	_, _, err := f.svc.Create(ctx, "user-1", "old", nil, &past)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+
+	expires := f.now.Add(time.Hour)
+	expiring, _, err := f.svc.Create(ctx, "user-1", "expiring", nil, &expires)
+	require.NoError(t, err)
+	revoked, key, err := f.svc.Create(ctx, "user-1", "revoked", nil, nil)
+	require.NoError(t, err)
+	disabled, _, err := f.svc.Create(ctx, "user-1", "disabled", nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, f.svc.Revoke(ctx, "user-1", key.ID))
+	assert.ErrorIs(t, f.svc.Revoke(ctx, "user-2", key.ID), ErrAPIKeyNotFound)
+	_, err = f.svc.Authenticate(ctx, revoked)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	keys, err := f.svc.List(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	f.now = expires
+	_, err = f.svc.Authenticate(ctx, expiring)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	_, err = f.svc.Authenticate(ctx, disabled)
+	require.NoError(t, err)
+	f.users.createdUsers[0].DisabledAt = &f.now
+	_, err = f.svc.Authenticate(ctx, disabled)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+// TestAPIKey_TouchThrottled
+// -------------------------
+// Last use is written at most once per touch interval.
+func TestAPIKey_TouchThrottled(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	ctx := context.Background()
+
+	raw, _, err := f.svc.Create(ctx, "user-1", "ci", nil, nil)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = f.svc.Authenticate(ctx, raw)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, f.repo.touches)
+
+	f.now = f.now.Add(sessionTouchInterval)
+	_, err = f.svc.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, 2, f.repo.touches)
+}
@@ -9,6 +9,7 @@ type contextKey string
 const (
 	ctxKeyUserID contextKey = "userID"
 	ctxKeyEmail  contextKey = "email"
+	ctxKeyClaims contextKey = "claims"
 )
 
 // ContextWithUser stores userID and email in the context.
@@ -29,3 +30,15 @@ func UserFromContext(ctx context.Context) (userID, email string, ok bool) {
 	}
 	return uid, em, true
 }
+
+// ContextWithClaims stores the verified access token claims, for handlers
+// such as logout that act on the token itself.
+func ContextWithClaims(ctx context.Context, claims *TokenClaims) context.Context {
+	return context.WithValue(ctx, ctxKeyClaims, claims)
+}
+
+// ClaimsFromContext returns the claims stored by ContextWithClaims.
+func ClaimsFromContext(ctx context.Context) (*TokenClaims, bool) {
+	claims, ok := ctx.Value(ctxKeyClaims).(*TokenClaims)
+	return claims, ok
+}
@@ -2,15 +2,53 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"html/template"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
-func NewHandler(service AuthService, tokenService TokenService) *Handler {
+func NewHandler(
+	service AuthService,
+	tokenService TokenService,
+	refreshService RefreshService,
+	revocations RevocationService,
+	sessions SessionService,
+	passwords PasswordService,
+	verification VerificationService,
+	mfa MFAService,
+	guard LoginGuard,
+	admin AdminService,
+	apiKeys APIKeyService,
+	oidc OIDCService,
+	oidcReturnURL string,
+	oauth OAuthService,
+	account AccountService,
+	proxies TrustedProxies,
+) *Handler {
 	return &Handler{
-		service:      service,
-		tokenService: tokenService,
+		service:        service,
+		tokenService:   tokenService,
+		refreshService: refreshService,
+		revocations:    revocations,
+		sessions:       sessions,
+		passwords:      passwords,
+		verification:   verification,
+		mfa:            mfa,
+		guard:          guard,
+		admin:          admin,
+		apiKeys:        apiKeys,
+		oidc:           oidc,
+		oidcReturnURL:  oidcReturnURL,
+		oauth:          oauth,
+		account:        account,
+		proxies:        proxies,
 	}
 }
 
@@ -39,6 +77,7 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 	if err := h.service.SignUp(r.Context(), req.Email, req.Password); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 
+		passwordMsg, isPasswordErr := passwordMessage(err)
 		switch {
 		case errors.Is(err, ErrInvalidEmailFormat):
 			w.WriteHeader(http.StatusBadRequest)
@@ -47,19 +86,12 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 				Field:   "email",
 				Message: "invalid email format",
 			})
-		case errors.Is(err, ErrPasswordTooShort):
+		case isPasswordErr:
 			w.WriteHeader(http.StatusBadRequest)
 			_ = json.NewEncoder(w).Encode(signUpResponse{
 				Status:  "failed",
 				Field:   "password",
-				Message: "password must be at least 8 characters",
-			})
-		case errors.Is(err, ErrPasswordTooWeak):
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(signUpResponse{
-				Status:  "failed",
-				Field:   "password",
-				Message: "password must contain at least one letter and one digit",
+				Message: passwordMsg,
 			})
 		case errors.Is(err, ErrEmailAlreadyExists):
 			w.WriteHeader(http.StatusBadRequest)
@@ -80,6 +112,12 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The account exists either way; a failed send can be retried through
+	// the resend endpoint.
+	if err := h.verification.Send(r.Context(), req.Email); err != nil {
+		log.Printf("send verification email: %v", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(signUpResponse{
 		Status: "ok",
@@ -98,33 +136,1416 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The guard keys on the address whether or not it has an account, so
+	// throttled responses do not reveal which ones exist either.
+	ip := h.proxies.ClientIP(r)
+	if wait, err := h.guard.Check(r.Context(), req.Email, ip); err != nil {
+		if errors.Is(err, ErrLoginThrottled) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(loginResponse{Status: "failed", Message: err.Error()})
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
 	ok, err := h.service.Login(r.Context(), req.Email, req.Password)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	resp := loginResponse{Status: "failed"}
+	if !ok {
+		if err := h.guard.Fail(r.Context(), req.Email, ip); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(loginResponse{Status: "failed"})
+		return
+	}
+	// Load the user (we know they exist & password was correct)
+	user, err := h.service.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 
-	if ok {
-		// Load the user (we know they exist & password was correct)
-		user, err := h.service.GetUserByEmail(r.Context(), req.Email)
-		if err != nil {
+	status, resp, err := h.loginResult(r, user)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	// With two-factor authentication the counters are only cleared once
+	// the code is accepted too.
+	if resp.Status == "passed" {
+		if err := h.guard.Succeed(r.Context(), req.Email); err != nil {
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
 
-		// Generate JWT token
-		token, err := h.tokenService.GenerateToken(user)
+// loginResult finishes a login once the user has proven who they are:
+// disabled accounts, and unverified ones where that is required, are
+// refused; two-factor accounts get a challenge; everyone else gets tokens.
+func (h *Handler) loginResult(r *http.Request, user *User) (int, loginResponse, error) {
+	if user.DisabledAt != nil {
+		return http.StatusForbidden, loginResponse{Status: "failed", Message: ErrAccountDisabled.Error()}, nil
+	}
+
+	if err := h.verification.CheckLogin(user); err != nil {
+		return http.StatusForbidden, loginResponse{Status: "failed", Message: err.Error()}, nil
+	}
+
+	enabled, err := h.mfa.Enabled(r.Context(), user.ID)
+	if err != nil {
+		return 0, loginResponse{}, err
+	}
+	if enabled {
+		mfaToken, err := h.mfa.StartChallenge(r.Context(), user.ID)
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			return 0, loginResponse{}, err
+		}
+		return http.StatusOK, loginResponse{Status: "mfa_required", MFAToken: mfaToken}, nil
+	}
+
+	resp, err := h.issueTokens(r, user)
+	if err != nil {
+		return 0, loginResponse{}, err
+	}
+	return http.StatusOK, resp, nil
+}
+
+// LoginMFA handles POST /api/v1/auth/login/mfa: the second step of a
+// login for users with two-factor authentication.
+func (h *Handler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req mfaLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.mfa.CompleteChallenge(r.Context(), req.MFAToken, req.Code, h.proxies.ClientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFAToken):
+			http.Error(w, `{"error":"invalid or expired mfa token"}`, http.StatusUnauthorized)
+		case errors.Is(err, ErrInvalidMFACode):
+			writeFieldError(w, http.StatusUnauthorized, "code", err.Error())
+		case errors.Is(err, ErrAccountDisabled):
+			http.Error(w, `{"error":"account disabled"}`, http.StatusForbidden)
+		default:
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// oidcStateCookie binds a provider login to the browser that started it,
+// so a victim cannot be made to complete an attacker's login.
+const oidcStateCookie = "oidc_state"
+
+// OIDCProviders handles GET /api/v1/auth/oidc: the configured providers.
+func (h *Handler) OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(oidcProvidersResponse{Providers: h.oidc.Providers()})
+}
+
+// OIDCStart handles GET /api/v1/auth/oidc/{provider}/start: it redirects
+// the browser to the provider's login page.
+func (h *Handler) OIDCStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider := r.PathValue("provider")
+	authURL, state, err := h.oidc.Start(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, ErrUnknownOIDCProvider) {
+			http.Error(w, `{"error":"unknown identity provider"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("start oidc login with %s: %v", provider, err)
+		http.Error(w, `{"error":"identity provider unavailable"}`, http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/oidc/",
+		MaxAge:   int(DefaultOIDCStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		// Lax still sends it on the provider's top-level redirect back.
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback handles GET /api/v1/auth/oidc/{provider}/callback, where
+// the provider sends the browser back. The result goes to the frontend in
+// the URL fragment, as the fields of a login response.
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/auth/oidc/", MaxAge: -1})
+
+	if e := q.Get("error"); e != "" {
+		h.oidcRedirect(w, r, loginResponse{Status: "failed", Message: e})
+		return
+	}
+	if err != nil || cookie.Value == "" || cookie.Value != q.Get("state") {
+		h.oidcRedirect(w, r, loginResponse{Status: "failed", Message: ErrInvalidOIDCState.Error()})
+		return
+	}
+
+	provider := r.PathValue("provider")
+	user, err := h.oidc.Complete(r.Context(), provider, q.Get("state"), q.Get("code"))
+	if err != nil {
+		// Token and exchange failures are logged rather than shown.
+		msg := "sign-in failed"
+		switch {
+		case errors.Is(err, ErrInvalidOIDCState), errors.Is(err, ErrUnknownOIDCProvider),
+			errors.Is(err, ErrOIDCEmailUnverified), errors.Is(err, ErrOIDCAccountUnverified):
+			msg = err.Error()
+		default:
+			log.Printf("oidc login with %s: %v", provider, err)
+		}
+		h.oidcRedirect(w, r, loginResponse{Status: "failed", Message: msg})
+		return
+	}
+
+	_, resp, err := h.loginResult(r, user)
+	if err != nil {
+		log.Printf("oidc login with %s: %v", provider, err)
+		resp = loginResponse{Status: "failed", Message: "internal error"}
+	}
+	h.oidcRedirect(w, r, resp)
+}
+
+// oidcRedirect sends the browser to the frontend with resp in the URL
+// fragment, which is not sent to servers or kept in their logs.
+func (h *Handler) oidcRedirect(w http.ResponseWriter, r *http.Request, resp loginResponse) {
+	v := url.Values{"status": {resp.Status}}
+	for key, value := range map[string]string{
+		"message":      resp.Message,
+		"token":        resp.Token,
+		"refreshToken": resp.RefreshToken,
+		"mfaToken":     resp.MFAToken,
+	} {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, h.oidcReturnURL+"#"+v.Encode(), http.StatusFound)
+}
+
+// completeLogin starts a session for an authenticated user and writes
+// the access and refresh tokens.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, user *User) {
+	resp, err := h.issueTokens(r, user)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// issueTokens starts a session and returns its access and refresh tokens.
+// Logging in to an account scheduled for deletion keeps it.
+func (h *Handler) issueTokens(r *http.Request, user *User) (loginResponse, error) {
+	var notice string
+	if user.DeletionRequestedAt != nil {
+		if err := h.account.CancelDeletion(r.Context(), user.ID); err != nil {
+			return loginResponse{}, err
+		}
+		user.DeletionRequestedAt = nil
+		notice = "account deletion cancelled"
+	}
+
+	session, err := h.sessions.Start(r.Context(), user.ID, r.UserAgent(), h.proxies.ClientIP(r))
+	if err != nil {
+		return loginResponse{}, err
+	}
+
+	// Generate JWT token
+	token, err := h.tokenService.GenerateToken(user, session.ID)
+	if err != nil {
+		return loginResponse{}, err
+	}
+
+	refreshToken, err := h.refreshService.Issue(r.Context(), user.ID, session.ID)
+	if err != nil {
+		return loginResponse{}, err
+	}
+
+	return loginResponse{
+		Status:       "passed",
+		Message:      notice,
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token; the presented one cannot be used again.
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	rotation, err := h.refreshService.Rotate(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			http.Error(w, `{"error":"invalid refresh token"}`, http.StatusUnauthorized)
 			return
 		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.tokenService.GenerateToken(rotation.User, rotation.SessionID)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResponse{
+		Status:       "passed",
+		Token:        token,
+		RefreshToken: rotation.RefreshToken,
+	})
+}
+
+// Logout revokes the access token it is called with and ends its session,
+// along with the refresh token if one is given. With "everywhere" it bumps
+// the user's token version and ends all their sessions instead.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional.
+	var req logoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.logout(r.Context(), claims, req); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (h *Handler) logout(ctx context.Context, claims *TokenClaims, req logoutRequest) error {
+	if req.Everywhere {
+		if err := h.revocations.RevokeAll(ctx, claims.UserID); err != nil {
+			return err
+		}
+		if err := h.sessions.RevokeAll(ctx, claims.UserID); err != nil {
+			return err
+		}
+		return h.refreshService.RevokeAll(ctx, claims.UserID)
+	}
+
+	if err := h.revocations.Revoke(ctx, claims); err != nil {
+		return err
+	}
+	if claims.SessionID != "" {
+		err := h.sessions.Revoke(ctx, claims.UserID, claims.SessionID)
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	if req.RefreshToken != "" {
+		return h.refreshService.Revoke(ctx, claims.UserID, req.RefreshToken)
+	}
+	return nil
+}
+
+// Sessions handles GET /api/v1/auth/sessions: the caller's active logins.
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.sessions.List(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
 
-		resp.Status = "passed"
-		resp.Token = token
+	resp := make([]sessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = sessionResponse{Session: s, Current: s.ID == claims.SessionID}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
 }
+
+// RevokeSession handles DELETE /api/v1/auth/sessions/{id}. Access tokens
+// of the session stop working and its refresh token cannot be rotated.
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.sessions.Revoke(r.Context(), userID, r.PathValue("id")); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			http.Error(w, `{"error":"session not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword handles POST /api/v1/auth/password. Other sessions of
+// the user are ended; the one making the request stays logged in.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.passwords.Change(r.Context(), claims.UserID, claims.SessionID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			writeFieldError(w, http.StatusForbidden, "currentPassword", "current password is incorrect")
+			return
+		}
+		if msg, ok := passwordMessage(err); ok {
+			writeFieldError(w, http.StatusBadRequest, "newPassword", msg)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ForgotPassword handles POST /api/v1/auth/password/forgot. It answers
+// 202 whether or not the email belongs to an account.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.passwords.RequestReset(r.Context(), req.Email); err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ResetPassword handles POST /api/v1/auth/password/reset with the token
+// from the reset email.
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.passwords.Reset(r.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, ErrInvalidResetToken) {
+			writeFieldError(w, http.StatusBadRequest, "token", err.Error())
+			return
+		}
+		if msg, ok := passwordMessage(err); ok {
+			writeFieldError(w, http.StatusBadRequest, "newPassword", msg)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// VerifyEmail handles POST /api/v1/auth/verify-email with either the
+// link token or the address and code. Tokens issued before verification
+// still say unverified; a refresh picks up the new state.
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Token != "" {
+		err = h.verification.VerifyToken(r.Context(), req.Token)
+	} else {
+		err = h.verification.VerifyCode(r.Context(), req.Email, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidVerification) {
+			http.Error(w, `{"error":"invalid or expired verification code"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ResendVerification handles POST /api/v1/auth/verify-email/resend. It
+// answers 202 for unknown addresses too, and 429 within the resend
+// interval.
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req resendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verification.Send(r.Context(), req.Email); err != nil {
+		if errors.Is(err, ErrVerificationThrottled) {
+			http.Error(w, `{"error":"verification email sent recently, try again later"}`, http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ChangeEmail handles POST /api/v1/auth/email. The new address gets a
+// confirmation link; the account keeps its current address until the
+// link is followed.
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req changeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.account.RequestEmailChange(r.Context(), userID, req.Password, req.NewEmail); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			writeFieldError(w, http.StatusForbidden, "password", "password is incorrect")
+		case errors.Is(err, ErrInvalidEmailFormat), errors.Is(err, ErrEmailUnchanged):
+			writeFieldError(w, http.StatusBadRequest, "newEmail", err.Error())
+		case errors.Is(err, ErrEmailAlreadyExists):
+			writeFieldError(w, http.StatusConflict, "newEmail", err.Error())
+		default:
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ConfirmEmailChange handles POST /api/v1/auth/email/confirm with the
+// token from the link sent to the new address. Tokens issued before the
+// change are revoked; a refresh gets ones with the new address.
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req confirmEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.account.ConfirmEmailChange(r.Context(), req.Token); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidEmailChange):
+			writeFieldError(w, http.StatusBadRequest, "token", err.Error())
+		case errors.Is(err, ErrEmailAlreadyExists):
+			http.Error(w, `{"error":"email already exists"}`, http.StatusConflict)
+		default:
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteAccount handles POST /api/v1/auth/account/delete. The account is
+// logged out everywhere and purged, history included, after the grace
+// period unless the user logs in again before then.
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req deleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	purgeAt, err := h.account.RequestDeletion(r.Context(), userID, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			writeFieldError(w, http.StatusForbidden, "password", "password is incorrect")
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(deleteAccountResponse{Status: "scheduled", PurgeAt: purgeAt})
+}
+
+// JWKS handles GET /.well-known/jwks.json: the public keys that verify
+// access tokens. Caches may keep it briefly; new keys are published before
+// they start signing.
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(h.tokenService.JWKS())
+}
+
+// APIKeys handles /api/v1/auth/api-keys: GET lists the caller's keys,
+// POST creates one and returns it, once.
+func (h *Handler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := h.apiKeys.List(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(keys)
+
+	case http.MethodPost:
+		var req createAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+			return
+		}
+
+		raw, key, err := h.apiKeys.Create(r.Context(), userID, req.Name, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidAPIKeyName):
+				writeFieldError(w, http.StatusBadRequest, "name", err.Error())
+			case errors.Is(err, ErrInvalidScope):
+				writeFieldError(w, http.StatusBadRequest, "scopes", err.Error())
+			case errors.Is(err, ErrInvalidExpiry):
+				writeFieldError(w, http.StatusBadRequest, "expiresAt", err.Error())
+			default:
+				http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(createAPIKeyResponse{Key: raw, APIKey: key})
+
+	default:
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// RevokeAPIKey handles DELETE /api/v1/auth/api-keys/{id}.
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.apiKeys.Revoke(r.Context(), userID, r.PathValue("id")); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			http.Error(w, `{"error":"api key not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OAuthClients handles /api/v1/oauth/clients: GET lists the caller's
+// client applications, POST registers one and returns its secret, once.
+func (h *Handler) OAuthClients(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		clients, err := h.oauth.ListClients(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(clients)
+
+	case http.MethodPost:
+		var req registerOAuthClientRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+			return
+		}
+
+		client, secret, err := h.oauth.RegisterClient(r.Context(), userID, OAuthClientRegistration{
+			Name:         req.Name,
+			RedirectURIs: req.RedirectURIs,
+			Scopes:       req.Scopes,
+			Confidential: req.Confidential,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidClientName):
+				writeFieldError(w, http.StatusBadRequest, "name", err.Error())
+			case errors.Is(err, ErrInvalidRedirectURI):
+				writeFieldError(w, http.StatusBadRequest, "redirectUris", err.Error())
+			case errors.Is(err, ErrInvalidScope):
+				writeFieldError(w, http.StatusBadRequest, "scopes", err.Error())
+			default:
+				http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(registerOAuthClientResponse{ClientSecret: secret, Client: client})
+
+	default:
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// DeleteOAuthClient handles DELETE /api/v1/oauth/clients/{id}. Every
+// grant made to the client is revoked with it.
+func (h *Handler) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.oauth.DeleteClient(r.Context(), userID, r.PathValue("id")); err != nil {
+		if errors.Is(err, ErrOAuthClientNotFound) {
+			http.Error(w, `{"error":"client not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// consentPage asks the signed-in user to approve a client. The browser
+// holds the user's token, so the page posts the decision to
+// /api/v1/oauth/authorize and follows the redirect it gets back.
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Authorize {{.Client}}</title>
+</head>
+<body>
+  <h1>Authorize {{.Client}}</h1>
+  <p><strong>{{.Client}}</strong> wants to use your calculator account to:</p>
+  <ul>
+    {{range .Scopes}}<li>{{.}}</li>{{end}}
+  </ul>
+  <p>It will not see your password.</p>
+  <button id="approve">Allow</button>
+  <button id="deny">Deny</button>
+  <p id="result"></p>
+  <script>
+    const request = {{.Request}};
+    const token = localStorage.getItem('authToken');
+    if (!token) {
+      // Sign in on the main page, which brings the user back here.
+      sessionStorage.setItem('oauthReturn', location.href);
+      location.href = '/';
+    }
+
+    async function decide(approved) {
+      const res = await fetch('/api/v1/oauth/authorize', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + token },
+        body: JSON.stringify({ ...request, approved }),
+      });
+      if (res.status === 401) {
+        sessionStorage.setItem('oauthReturn', location.href);
+        location.href = '/';
+        return;
+      }
+      const data = await res.json();
+      if (!res.ok) {
+        document.getElementById('result').innerText = data.error || 'failed';
+        return;
+      }
+      location.href = data.redirectTo;
+    }
+    document.getElementById('approve').onclick = () => decide(true);
+    document.getElementById('deny').onclick = () => decide(false);
+  </script>
+</body>
+</html>
+`))
+
+// scopeDescriptions are what the consent page shows for each scope.
+var scopeDescriptions = map[Permission]string{
+	PermCalcWrite:   "run calculations",
+	PermHistoryRead: "read your calculation history",
+}
+
+// OAuthAuthorize handles GET /oauth/authorize, the authorization
+// endpoint, with the consent page. Requests that name an unknown client
+// or redirect URI get an error page; other invalid requests are sent
+// back to the client.
+func (h *Handler) OAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	req := AuthorizationRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+	client, scopes, err := h.oauth.ValidateAuthorization(r.Context(), req)
+	if err != nil {
+		var oauthErr *OAuthError
+		switch {
+		case errors.Is(err, ErrOAuthClientNotFound), errors.Is(err, ErrInvalidRedirectURI):
+			http.Error(w, "invalid authorization request: "+err.Error(), http.StatusBadRequest)
+		case errors.As(err, &oauthErr):
+			http.Redirect(w, r, AuthorizationErrorRedirect(req, err), http.StatusFound)
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	descriptions := make([]string, len(scopes))
+	for i, s := range scopes {
+		descriptions[i] = scopeDescriptions[s]
+	}
+
+	// The page must not be framed, or a client could click "Allow" for
+	// the user.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	err = consentPage.Execute(w, map[string]any{
+		"Client": client.Name,
+		"Scopes": descriptions,
+		"Request": oauthConsentRequest{
+			ResponseType:        req.ResponseType,
+			ClientID:            req.ClientID,
+			RedirectURI:         req.RedirectURI,
+			Scope:               scopeString(scopes),
+			State:               req.State,
+			CodeChallenge:       req.CodeChallenge,
+			CodeChallengeMethod: req.CodeChallengeMethod,
+		},
+	})
+	if err != nil {
+		log.Printf("oauth: rendering consent page: %v", err)
+	}
+}
+
+// OAuthConsent handles POST /api/v1/oauth/authorize, where the consent
+// page records the signed-in user's decision, and returns the URL to
+// send the browser back to the client with.
+func (h *Handler) OAuthConsent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req oauthConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	redirectTo, err := h.oauth.Authorize(r.Context(), userID, AuthorizationRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}, req.Approved)
+	if err != nil {
+		if errors.Is(err, ErrOAuthClientNotFound) || errors.Is(err, ErrInvalidRedirectURI) {
+			http.Error(w, `{"error":"invalid authorization request"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(oauthConsentResponse{RedirectTo: redirectTo})
+}
+
+// OAuthToken handles POST /oauth/token, the token endpoint, for the
+// authorization_code, refresh_token and client_credentials grants.
+func (h *Handler) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidRequest, "method not allowed"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidRequest, "invalid form body"))
+		return
+	}
+
+	clientID, secret, ok := oauthClientCredentials(r)
+	if !ok {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidClient, "invalid Authorization header"))
+		return
+	}
+	resp, err := h.oauth.Token(r.Context(), TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: secret,
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// OAuthIntrospect handles POST /oauth/introspect (RFC 7662) for
+// confidential clients.
+func (h *Handler) OAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidRequest, "method not allowed"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidRequest, "invalid form body"))
+		return
+	}
+
+	clientID, secret, ok := oauthClientCredentials(r)
+	if !ok {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidClient, "invalid Authorization header"))
+		return
+	}
+	resp, err := h.oauth.Introspect(r.Context(), clientID, secret, r.PostForm.Get("token"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// OAuthRevoke handles POST /oauth/revoke (RFC 7009). It answers 200 for
+// tokens it does not know, as the RFC requires.
+func (h *Handler) OAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidRequest, "method not allowed"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidRequest, "invalid form body"))
+		return
+	}
+
+	clientID, secret, ok := oauthClientCredentials(r)
+	if !ok {
+		writeOAuthError(w, oauthError(ErrOAuthInvalidClient, "invalid Authorization header"))
+		return
+	}
+	if err := h.oauth.Revoke(r.Context(), clientID, secret, r.PostForm.Get("token")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// oauthClientCredentials reads client_secret_basic credentials, whose
+// parts are form-encoded (RFC 6749 §2.3.1), or else client_id and
+// client_secret from the form.
+func oauthClientCredentials(r *http.Request) (id, secret string, ok bool) {
+	user, pass, basic := r.BasicAuth()
+	if !basic {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), true
+	}
+	id, err := url.QueryUnescape(user)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err = url.QueryUnescape(pass)
+	if err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// writeOAuthError writes an RFC 6749 §5.2 error response.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Printf("oauth: %v", err)
+		oauthErr = &OAuthError{Code: "server_error"}
+	}
+
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case ErrOAuthInvalidClient.Code:
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+
+	body := map[string]string{"error": oauthErr.Code}
+	if oauthErr.Description != "" {
+		body["error_description"] = oauthErr.Description
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// EnrollMFA handles POST /api/v1/auth/mfa/enroll. The returned secret
+// and otpauth URI (for a QR code) start a pending enrollment that
+// ConfirmMFA turns on.
+func (h *Handler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, email, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.mfa.Enroll(r.Context(), userID, email)
+	if err != nil {
+		if errors.Is(err, ErrMFAAlreadyEnabled) {
+			http.Error(w, `{"error":"two-factor authentication is already enabled"}`, http.StatusConflict)
+			return
+		}
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmMFA handles POST /api/v1/auth/mfa/confirm with the first code
+// from the authenticator app. The recovery codes are only shown here.
+func (h *Handler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfa.Confirm(r.Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFACode):
+			writeFieldError(w, http.StatusBadRequest, "code", err.Error())
+		case errors.Is(err, ErrMFANotEnabled):
+			http.Error(w, `{"error":"enroll first"}`, http.StatusBadRequest)
+		case errors.Is(err, ErrMFAAlreadyEnabled):
+			http.Error(w, `{"error":"two-factor authentication is already enabled"}`, http.StatusConflict)
+		default:
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "recoveryCodes": codes})
+}
+
+// DisableMFA handles POST /api/v1/auth/mfa/disable. It needs the
+// password and a current TOTP or recovery code.
+func (h *Handler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req disableMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfa.Disable(r.Context(), userID, req.Password, req.Code); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			writeFieldError(w, http.StatusForbidden, "password", "password is incorrect")
+		case errors.Is(err, ErrInvalidMFACode):
+			writeFieldError(w, http.StatusForbidden, "code", err.Error())
+		case errors.Is(err, ErrMFANotEnabled):
+			http.Error(w, `{"error":"two-factor authentication is not enabled"}`, http.StatusBadRequest)
+		default:
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// AdminListUsers handles GET /api/v1/admin/users?limit=&offset=
+// (users:read).
+func (h *Handler) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+
+	users, err := h.admin.ListUsers(r.Context(), limit, offset)
+	if err != nil {
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]adminUserResponse, len(users))
+	for i, u := range users {
+		resp[i] = adminUserResponse{
+			ID:                  u.ID,
+			Email:               u.Email,
+			Role:                u.Role,
+			EmailVerified:       u.EmailVerified,
+			CreatedAt:           u.CreatedAt,
+			DisabledAt:          u.DisabledAt,
+			DeletionRequestedAt: u.DeletionRequestedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// AdminDisableUser handles POST /api/v1/admin/users/{id}/disable
+// (users:write). The user is logged out everywhere.
+func (h *Handler) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminSetDisabled(w, r, true)
+}
+
+// AdminEnableUser handles POST /api/v1/admin/users/{id}/enable
+// (users:write).
+func (h *Handler) AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminSetDisabled(w, r, false)
+}
+
+func (h *Handler) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	err := h.admin.SetDisabled(r.Context(), adminID, r.PathValue("id"), disabled)
+	writeAdminResult(w, err)
+}
+
+// AdminSetRole handles PUT /api/v1/admin/users/{id}/role (users:write)
+// with {"role": "user" | "admin" | "auditor"}.
+func (h *Handler) AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.admin.SetRole(r.Context(), adminID, r.PathValue("id"), req.Role)
+	if errors.Is(err, ErrInvalidRole) {
+		writeFieldError(w, http.StatusBadRequest, "role", err.Error())
+		return
+	}
+	writeAdminResult(w, err)
+}
+
+// AdminUnlockUser handles POST /api/v1/admin/users/{id}/unlock
+// (users:write): it lifts a login lockout.
+func (h *Handler) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, _, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	err := h.admin.Unlock(r.Context(), adminID, r.PathValue("id"))
+	writeAdminResult(w, err)
+}
+
+func writeAdminResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, `{"error":"user not found"}`, http.StatusNotFound)
+	case errors.Is(err, ErrCannotModifySelf):
+		http.Error(w, `{"error":"admins cannot change their own account this way"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+	}
+}
+
+// passwordMessage is the user-facing message for a password rule
+// violation, as worded by the policy with its configured limits.
+func passwordMessage(err error) (string, bool) {
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Message, true
+	}
+	return "", false
+}
+
+func writeFieldError(w http.ResponseWriter, status int, field, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg, "field": field})
+}
@@ -0,0 +1,336 @@
+// internal/auth/keyset.go
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no active signing key")
+	ErrUnknownKey   = errors.New("unknown or retired signing key")
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	// DefaultKeyReloadInterval is how often the key directory is re-read,
+	// so keys dropped in later are picked up without a restart.
+	DefaultKeyReloadInterval = time.Hour
+	// keyRetentionLeeway covers clock skew between instances.
+	keyRetentionLeeway = time.Minute
+	minRSABits         = 2048
+	// keyDateLayout is the activation date every key file name starts with.
+	keyDateLayout = "2006-01-02"
+)
+
+// SigningKey is one private key, named by its kid. It signs from
+// ActiveFrom until the next key becomes active.
+type SigningKey struct {
+	ID         string
+	Alg        string
+	Private    crypto.Signer
+	ActiveFrom time.Time
+}
+
+// JWK is the public half of a SigningKey as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the body of /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet schedules signing keys by activation date. The newest active key
+// signs; a key it replaced stays valid for verification until tokens it
+// signed have expired; keys not yet active are published ahead of time.
+type KeySet interface {
+	// Signer returns the key to sign with now.
+	Signer() (SigningKey, error)
+	// PublicKey returns the verification key for kid, or ErrUnknownKey.
+	PublicKey(kid string) (crypto.PublicKey, string, error)
+	// JWKS lists every key that is still valid for verification.
+	JWKS() JWKSet
+}
+
+type keySet struct {
+	dir       string
+	retention time.Duration
+	reload    time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	keys     []SigningKey // by ActiveFrom
+	loadedAt time.Time
+}
+
+// NewKeySet returns a fixed KeySet. retention should be the access token
+// TTL.
+func NewKeySet(keys []SigningKey, retention time.Duration) (KeySet, error) {
+	s := &keySet{
+		retention: retention + keyRetentionLeeway,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+	if err := s.set(keys); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadKeySet reads every *.pem file in dir and re-reads the directory
+// every reloadInterval. Files hold a PKCS#8 or PKCS#1 private key (RSA of
+// at least 2048 bits, or Ed25519) and are named "<YYYY-MM-DD>[-name].pem":
+// the date is when the key starts signing (00:00 UTC) and the file name
+// without ".pem" is its kid.
+func LoadKeySet(dir string, retention, reloadInterval time.Duration) (KeySet, error) {
+	if reloadInterval <= 0 {
+		reloadInterval = DefaultKeyReloadInterval
+	}
+	s := &keySet{
+		dir:       dir,
+		retention: retention + keyRetentionLeeway,
+		reload:    reloadInterval,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+	keys, err := loadKeyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.set(keys); err != nil {
+		return nil, err
+	}
+	if _, err := s.Signer(); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return s, nil
+}
+
+func (s *keySet) Signer() (SigningKey, error) {
+	keys, now := s.current()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !now.Before(keys[i].ActiveFrom) {
+			return keys[i], nil
+		}
+	}
+	return SigningKey{}, ErrNoSigningKey
+}
+
+func (s *keySet) PublicKey(kid string) (crypto.PublicKey, string, error) {
+	keys, now := s.current()
+	for i, k := range keys {
+		if k.ID == kid && s.valid(keys, i, now) {
+			return k.Private.Public(), k.Alg, nil
+		}
+	}
+	return nil, "", ErrUnknownKey
+}
+
+func (s *keySet) JWKS() JWKSet {
+	keys, now := s.current()
+	set := JWKSet{Keys: []JWK{}}
+	for i, k := range keys {
+		if s.valid(keys, i, now) {
+			set.Keys = append(set.Keys, publicJWK(k))
+		}
+	}
+	return set
+}
+
+// valid reports whether keys[i] may still verify tokens: until the key
+// after it has been active for the retention period.
+func (s *keySet) valid(keys []SigningKey, i int, now time.Time) bool {
+	if i+1 == len(keys) {
+		return true
+	}
+	return now.Before(keys[i+1].ActiveFrom.Add(s.retention))
+}
+
+// current returns the keys, re-reading the directory when it is due. A
+// failed reload keeps the previous keys.
+func (s *keySet) current() ([]SigningKey, time.Time) {
+	now := s.now()
+	s.mu.Lock()
+	due := s.dir != "" && now.Sub(s.loadedAt) >= s.reload
+	if due {
+		// Claim the reload so concurrent callers keep the old keys.
+		s.loadedAt = now
+	}
+	keys := s.keys
+	s.mu.Unlock()
+
+	if due {
+		loaded, err := loadKeyDir(s.dir)
+		if err == nil {
+			err = s.set(loaded)
+		}
+		if err != nil {
+			log.Printf("reload signing keys: %v", err)
+		} else {
+			s.mu.Lock()
+			keys = s.keys
+			s.mu.Unlock()
+		}
+	}
+	return keys, now
+}
+
+func (s *keySet) set(keys []SigningKey) error {
+	if len(keys) == 0 {
+		return ErrNoSigningKey
+	}
+	sorted := append([]SigningKey(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ActiveFrom.Before(sorted[j].ActiveFrom) })
+	seen := map[string]bool{}
+	for _, k := range sorted {
+		if seen[k.ID] {
+			return fmt.Errorf("duplicate kid %q", k.ID)
+		}
+		seen[k.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = sorted
+	s.loadedAt = s.now()
+	return nil
+}
+
+func loadKeyDir(dir string) ([]SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []SigningKey
+	for _, path := range paths {
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func loadKeyFile(path string) (SigningKey, error) {
+	kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+	if len(kid) < len(keyDateLayout) {
+		return SigningKey{}, errors.New("file name must start with the activation date (YYYY-MM-DD)")
+	}
+	activeFrom, err := time.Parse(keyDateLayout, kid[:len(keyDateLayout)])
+	if err != nil {
+		return SigningKey{}, errors.New("file name must start with the activation date (YYYY-MM-DD)")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	signer, alg, err := parsePrivateKey(data)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: kid, Alg: alg, Private: signer, ActiveFrom: activeFrom}, nil
+}
+
+// parsePrivateKey accepts a PEM "PRIVATE KEY" (PKCS#8) or "RSA PRIVATE
+// KEY" (PKCS#1) block.
+func parsePrivateKey(data []byte) (crypto.Signer, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", errors.New("no PEM block found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, "", fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+		return k, AlgRS256, nil
+	case ed25519.PrivateKey:
+		return k, AlgEdDSA, nil
+	}
+	return nil, "", fmt.Errorf("unsupported key type %T", key)
+}
+
+func publicJWK(k SigningKey) JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Alg}
+	switch pub := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// PublicKey decodes an RSA or Ed25519 JWK, as published by this server or
+// an identity provider, and returns the key with the algorithm it signs.
+func (k JWK) PublicKey() (crypto.PublicKey, string, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, "", fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, "", fmt.Errorf("jwk %q: invalid exponent", k.Kid)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits {
+			return nil, "", fmt.Errorf("jwk %q: RSA key must be at least %d bits", k.Kid, minRSABits)
+		}
+		return pub, AlgRS256, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", fmt.Errorf("jwk %q: invalid Ed25519 key", k.Kid)
+		}
+		return ed25519.PublicKey(x), AlgEdDSA, nil
+	}
+	return nil, "", fmt.Errorf("jwk %q: unsupported key type %s", k.Kid, k.Kty)
+}
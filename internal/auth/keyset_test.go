@@ -0,0 +1,221 @@
+// internal/auth/keyset_test.go
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testRSAKey, _        = rsa.GenerateKey(rand.Reader, 2048)
+	_, testEd25519Key, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+// writeKey stores key as PEM in dir/name.
+func writeKey(t *testing.T, dir, name string, key any) {
+	t.Helper()
+	var block *pem.Block
+	if k, ok := key.(*rsa.PrivateKey); ok {
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600))
+}
+
+func kids(set JWKSet) []string {
+	var out []string
+	for _, k := range set.Keys {
+		out = append(out, k.Kid)
+	}
+	return out
+}
+
+// TestLoadKeySet_SignsAndVerifies
+// ----
+// Keys load from a directory of PEM files; the newest active key signs
+// and names itself in the kid header.
+func TestLoadKeySet_SignsAndVerifies(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01-01-rsa.pem", testRSAKey)
+	writeKey(t, dir, "2024-06-01-ed.pem", testEd25519Key)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0o600))
+
+	keys, err := LoadKeySet(dir, 15*time.Minute, time.Hour)
+	require.NoError(t, err)
+	tokens := NewKeySetTokenService(keys, "test", 15*time.Minute)
+
+	raw, err := tokens.GenerateToken(&User{ID: "u1", Email: "a@example.com", Role: RoleUser}, "s1")
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(raw, &TokenClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06-01-ed", parsed.Header["kid"])
+	assert.Equal(t, AlgEdDSA, parsed.Header["alg"])
+
+	claims, err := tokens.ParseToken(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims.UserID)
+	assert.Equal(t, "s1", claims.SessionID)
+}
+
+// TestKeySetTokenService_RS256
+// ----
+// RSA keys sign with RS256 and publish their modulus and exponent.
+func TestKeySetTokenService_RS256(t *testing.T) {
+	keys, err := NewKeySet([]SigningKey{{ID: "rsa", Alg: AlgRS256, Private: testRSAKey}}, time.Minute)
+	require.NoError(t, err)
+	tokens := NewKeySetTokenService(keys, "test", time.Minute)
+
+	raw, err := tokens.GenerateToken(&User{ID: "u1"}, "s1")
+	require.NoError(t, err)
+	claims, err := tokens.ParseToken(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims.UserID)
+
+	jwks := tokens.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, AlgRS256, jwks.Keys[0].Alg)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.NotEmpty(t, jwks.Keys[0].N)
+}
+
+// TestKeySetTokenService_RejectsForeignTokens
+// ----
+// Tokens without a known kid, signed by another key, or using an
+// algorithm other than the key's are rejected.
+func TestKeySetTokenService_RejectsForeignTokens(t *testing.T) {
+	keys, err := NewKeySet([]SigningKey{{ID: "ed", Alg: AlgEdDSA, Private: testEd25519Key}}, time.Minute)
+	require.NoError(t, err)
+	tokens := NewKeySetTokenService(keys, "test", time.Minute)
+	claims := newTokenClaims(&User{ID: "u1"}, "s1", "test", time.Minute)
+
+	// No kid.
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(testEd25519Key)
+	require.NoError(t, err)
+	_, err = tokens.ParseToken(raw)
+	assert.Error(t, err)
+
+	// Right kid, wrong key.
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "ed"
+	raw, err = token.SignedString(other)
+	require.NoError(t, err)
+	_, err = tokens.ParseToken(raw)
+	assert.Error(t, err)
+
+	// HS256 keyed with the public key.
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "ed"
+	raw, err = token.SignedString([]byte(testEd25519Key.Public().(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = tokens.ParseToken(raw)
+	assert.Error(t, err)
+}
+
+// TestKeySet_Rotation
+// ----
+// A scheduled key is published before it signs; the key it replaces keeps
+// verifying for the retention period and is then retired.
+func TestKeySet_Rotation(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := start.Add(24 * time.Hour)
+	ks, err := NewKeySet([]SigningKey{
+		{ID: "new", Alg: AlgEdDSA, Private: testEd25519Key, ActiveFrom: next},
+		{ID: "old", Alg: AlgRS256, Private: testRSAKey, ActiveFrom: start},
+	}, 15*time.Minute)
+	require.NoError(t, err)
+	s := ks.(*keySet)
+
+	s.now = func() time.Time { return next.Add(-time.Hour) }
+	signer, err := s.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, "old", signer.ID)
+	assert.Equal(t, []string{"old", "new"}, kids(s.JWKS()))
+
+	s.now = func() time.Time { return next.Add(10 * time.Minute) }
+	signer, err = s.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, "new", signer.ID)
+	_, _, err = s.PublicKey("old")
+	assert.NoError(t, err)
+
+	s.now = func() time.Time { return next.Add(15*time.Minute + keyRetentionLeeway) }
+	_, _, err = s.PublicKey("old")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Equal(t, []string{"new"}, kids(s.JWKS()))
+}
+
+// TestKeySet_NoActiveKey
+// ----
+// Loading fails when every key is scheduled for the future.
+func TestKeySet_NoActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, time.Now().AddDate(0, 0, 2).Format(keyDateLayout)+".pem", testEd25519Key)
+
+	_, err := LoadKeySet(dir, time.Minute, time.Hour)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+}
+
+// TestLoadKeySet_RejectsBadFiles
+// ----
+// File names must start with the activation date and RSA keys must be at
+// least 2048 bits.
+func TestLoadKeySet_RejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "main.pem", testEd25519Key)
+	_, err := LoadKeySet(dir, time.Minute, time.Hour)
+	assert.ErrorContains(t, err, "activation date")
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	dir = t.TempDir()
+	writeKey(t, dir, "2024-01-01.pem", small)
+	_, err = LoadKeySet(dir, time.Minute, time.Hour)
+	assert.ErrorContains(t, err, "2048")
+}
+
+// TestLoadKeySet_Reloads
+// ----
+// Keys added to the directory are picked up at the next reload; a broken
+// directory keeps the keys already loaded.
+func TestLoadKeySet_Reloads(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01-01.pem", testRSAKey)
+	ks, err := LoadKeySet(dir, time.Minute, time.Hour)
+	require.NoError(t, err)
+	s := ks.(*keySet)
+	now := time.Now().UTC()
+
+	writeKey(t, dir, "2024-02-01.pem", testEd25519Key)
+	s.now = func() time.Time { return now.Add(30 * time.Minute) }
+	signer, err := s.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01", signer.ID, "not due yet")
+
+	s.now = func() time.Time { return now.Add(2 * time.Hour) }
+	signer, err = s.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02-01", signer.ID)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2024-03-01.pem"), []byte("garbage"), 0o600))
+	s.now = func() time.Time { return now.Add(4 * time.Hour) }
+	signer, err = s.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02-01", signer.ID)
+}
@@ -0,0 +1,362 @@
+// internal/auth/lockout.go
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrLoginThrottled = errors.New("too many failed login attempts, try again later")
+
+const (
+	// LockoutScopeAccount counters are keyed by the normalised email, so
+	// addresses without an account are throttled exactly like real ones.
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+)
+
+const (
+	DefaultLockoutThreshold   = 10
+	DefaultIPLockoutThreshold = 100
+	DefaultLockoutDuration    = 15 * time.Minute
+	DefaultLoginBackoffBase   = 500 * time.Millisecond
+	DefaultLoginBackoffMax    = time.Minute
+	DefaultLoginFailureWindow = time.Hour
+)
+
+// LoginFailures is the failure counter of one account or IP.
+type LoginFailures struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LockoutEvent records one lockout; UnlockedAt is set when it was lifted
+// early.
+type LockoutEvent struct {
+	ID          string
+	Scope       string
+	Key         string
+	LockedAt    time.Time
+	LockedUntil time.Time
+	UnlockedAt  *time.Time
+	UnlockedBy  string
+}
+
+type LoginAttemptRepository interface {
+	// Get returns a zero LoginFailures when the key has no failures.
+	Get(ctx context.Context, scope, key string) (LoginFailures, error)
+	// RecordFailure increments the counter, restarting it when the last
+	// failure is before windowStart, and returns the new state.
+	RecordFailure(ctx context.Context, scope, key string, at, windowStart time.Time) (LoginFailures, error)
+	// ClaimAttempt moves the key's last failure time to at, provided the
+	// counter still reads seen. It reports false when another attempt
+	// changed it first.
+	ClaimAttempt(ctx context.Context, scope, key string, seen LoginFailures, at time.Time) (bool, error)
+	// Lock resets the counter, locks the key until the event's LockedUntil
+	// and records the event.
+	Lock(ctx context.Context, event LockoutEvent) error
+	// Reset forgets the key's failures and any lock.
+	Reset(ctx context.Context, scope, key string) error
+	// Unlock is Reset that also closes open lockout events; it reports
+	// whether the key was locked.
+	Unlock(ctx context.Context, scope, key, by string, at time.Time) (bool, error)
+}
+
+type LockoutConfig struct {
+	// Threshold failures within Window lock an account for Duration;
+	// IPThreshold does the same for a client IP.
+	Threshold   int
+	IPThreshold int
+	Duration    time.Duration
+	// After the n-th failure the next attempt waits BackoffBase*2^(n-1),
+	// at most BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	Window      time.Duration
+}
+
+// LoginGuard limits password guessing. The handler asks Check before
+// verifying a password and reports the outcome with Fail or Succeed.
+type LoginGuard interface {
+	// Check returns ErrLoginThrottled and how long to wait while the
+	// account or the IP is backing off or locked. An attempt it lets
+	// through starts the backoff again, so parallel guesses cannot all
+	// pass before the first of them fails.
+	Check(ctx context.Context, email, ip string) (time.Duration, error)
+	Fail(ctx context.Context, email, ip string) error
+	// Succeed clears the account's counter; the IP's keeps counting so a
+	// valid login does not launder guesses against other accounts.
+	Succeed(ctx context.Context, email string) error
+	// Unlock lifts an account lockout; by is recorded on the event.
+	Unlock(ctx context.Context, email, by string) error
+}
+
+type loginGuard struct {
+	repo LoginAttemptRepository
+	cfg  LockoutConfig
+	now  func() time.Time
+}
+
+func NewLoginGuard(repo LoginAttemptRepository, cfg LockoutConfig) LoginGuard {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultLockoutThreshold
+	}
+	if cfg.IPThreshold <= 0 {
+		cfg.IPThreshold = DefaultIPLockoutThreshold
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = DefaultLockoutDuration
+	}
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = DefaultLoginBackoffBase
+	}
+	if cfg.BackoffMax <= 0 {
+		cfg.BackoffMax = DefaultLoginBackoffMax
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultLoginFailureWindow
+	}
+	return &loginGuard{
+		repo: repo,
+		cfg:  cfg,
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (g *loginGuard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := g.now()
+	keys := g.keys(email, ip)
+	seen := make([]LoginFailures, len(keys))
+	var wait time.Duration
+	for i, k := range keys {
+		f, err := g.repo.Get(ctx, k.scope, k.key)
+		if err != nil {
+			return 0, err
+		}
+		seen[i] = f
+		wait = max(wait, g.wait(f, now))
+	}
+	if wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+
+	// Claim the attempt against what was read; of several attempts that
+	// read the same counter only the first gets through. Keys without
+	// failures have no backoff to claim.
+	for i, k := range keys {
+		if seen[i].Failures == 0 {
+			continue
+		}
+		ok, err := g.repo.ClaimAttempt(ctx, k.scope, k.key, seen[i], now)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return g.backoff(seen[i].Failures), ErrLoginThrottled
+		}
+	}
+	return 0, nil
+}
+
+func (g *loginGuard) Fail(ctx context.Context, email, ip string) error {
+	now := g.now()
+	for _, k := range g.keys(email, ip) {
+		f, err := g.repo.RecordFailure(ctx, k.scope, k.key, now, now.Add(-g.cfg.Window))
+		if err != nil {
+			return err
+		}
+		threshold := g.cfg.Threshold
+		if k.scope == LockoutScopeIP {
+			threshold = g.cfg.IPThreshold
+		}
+		if f.Failures < threshold {
+			continue
+		}
+		err = g.repo.Lock(ctx, LockoutEvent{
+			ID:          uuid.NewString(),
+			Scope:       k.scope,
+			Key:         k.key,
+			LockedAt:    now,
+			LockedUntil: now.Add(g.cfg.Duration),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *loginGuard) Succeed(ctx context.Context, email string) error {
+	return g.repo.Reset(ctx, LockoutScopeAccount, normalizeEmail(email))
+}
+
+func (g *loginGuard) Unlock(ctx context.Context, email, by string) error {
+	_, err := g.repo.Unlock(ctx, LockoutScopeAccount, normalizeEmail(email), by, g.now())
+	return err
+}
+
+// wait is how long the key must wait before its next attempt.
+func (g *loginGuard) wait(f LoginFailures, now time.Time) time.Duration {
+	if f.LockedUntil != nil && now.Before(*f.LockedUntil) {
+		return f.LockedUntil.Sub(now)
+	}
+	if f.Failures == 0 || now.Sub(f.LastFailureAt) >= g.cfg.Window {
+		return 0
+	}
+	next := f.LastFailureAt.Add(g.backoff(f.Failures))
+	if now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func (g *loginGuard) backoff(failures int) time.Duration {
+	d := g.cfg.BackoffBase
+	for i := 1; i < failures && d < g.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.BackoffMax)
+}
+
+type lockoutKey struct {
+	scope, key string
+}
+
+func (g *loginGuard) keys(email, ip string) []lockoutKey {
+	keys := []lockoutKey{{LockoutScopeAccount, normalizeEmail(email)}}
+	if ip != "" {
+		keys = append(keys, lockoutKey{LockoutScopeIP, ip})
+	}
+	return keys
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type postgresLoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptRepository(db *sql.DB) LoginAttemptRepository {
+	return &postgresLoginAttemptRepository{db: db}
+}
+
+func (r *postgresLoginAttemptRepository) Get(ctx context.Context, scope, key string) (LoginFailures, error) {
+	f, err := r.scan(r.db.QueryRowContext(ctx,
+		`SELECT failures, last_failure_at, locked_until FROM login_failures WHERE scope = $1 AND key = $2`,
+		scope, key,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginFailures{}, nil
+	}
+	return f, err
+}
+
+func (r *postgresLoginAttemptRepository) RecordFailure(ctx context.Context, scope, key string, at, windowStart time.Time) (LoginFailures, error) {
+	return r.scan(r.db.QueryRowContext(ctx,
+		`INSERT INTO login_failures (scope, key, failures, last_failure_at)
+         VALUES ($1, $2, 1, $3)
+         ON CONFLICT (scope, key) DO UPDATE
+            SET failures = CASE WHEN login_failures.last_failure_at < $4 THEN 1
+                                ELSE login_failures.failures + 1 END,
+                last_failure_at = EXCLUDED.last_failure_at
+         RETURNING failures, last_failure_at, locked_until`,
+		scope, key, at, windowStart,
+	))
+}
+
+func (r *postgresLoginAttemptRepository) ClaimAttempt(ctx context.Context, scope, key string, seen LoginFailures, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE login_failures SET last_failure_at = $5
+         WHERE scope = $1 AND key = $2 AND failures = $3 AND last_failure_at = $4`,
+		scope, key, seen.Failures, seen.LastFailureAt, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresLoginAttemptRepository) scan(row *sql.Row) (LoginFailures, error) {
+	var f LoginFailures
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&f.Failures, &f.LastFailureAt, &lockedUntil); err != nil {
+		return LoginFailures{}, err
+	}
+	if lockedUntil.Valid {
+		f.LockedUntil = &lockedUntil.Time
+	}
+	return f, nil
+}
+
+func (r *postgresLoginAttemptRepository) Lock(ctx context.Context, e LockoutEvent) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE login_failures SET failures = 0, locked_until = $3 WHERE scope = $1 AND key = $2`,
+		e.Scope, e.Key, e.LockedUntil,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO lockout_events (id, scope, key, locked_at, locked_until) VALUES ($1, $2, $3, $4, $5)`,
+		e.ID, e.Scope, e.Key, e.LockedAt, e.LockedUntil,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresLoginAttemptRepository) Reset(ctx context.Context, scope, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_failures WHERE scope = $1 AND key = $2`, scope, key)
+	return err
+}
+
+func (r *postgresLoginAttemptRepository) Unlock(ctx context.Context, scope, key, by string, at time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM login_failures WHERE scope = $1 AND key = $2 AND locked_until > $3`,
+		scope, key, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	// Unlocked keys may still carry a backoff.
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM login_failures WHERE scope = $1 AND key = $2`, scope, key,
+	); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE lockout_events SET unlocked_at = $3, unlocked_by = $4
+         WHERE scope = $1 AND key = $2 AND unlocked_at IS NULL AND locked_until > $3`,
+		scope, key, at, by,
+	); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,206 @@
+// internal/auth/lockout_test.go
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLoginAttemptRepo keeps counters and lockout events in memory.
+type fakeLoginAttemptRepo struct {
+	failures map[lockoutKey]*LoginFailures
+	events   []*LockoutEvent
+}
+
+func newFakeLoginAttemptRepo() *fakeLoginAttemptRepo {
+	return &fakeLoginAttemptRepo{failures: map[lockoutKey]*LoginFailures{}}
+}
+
+func (f *fakeLoginAttemptRepo) Get(ctx context.Context, scope, key string) (LoginFailures, error) {
+	if lf, ok := f.failures[lockoutKey{scope, key}]; ok {
+		return *lf, nil
+	}
+	return LoginFailures{}, nil
+}
+
+func (f *fakeLoginAttemptRepo) RecordFailure(ctx context.Context, scope, key string, at, windowStart time.Time) (LoginFailures, error) {
+	lf, ok := f.failures[lockoutKey{scope, key}]
+	if !ok {
+		lf = &LoginFailures{}
+		f.failures[lockoutKey{scope, key}] = lf
+	}
+	if lf.LastFailureAt.Before(windowStart) {
+		lf.Failures = 0
+	}
+	lf.Failures++
+	lf.LastFailureAt = at
+	return *lf, nil
+}
+
+func (f *fakeLoginAttemptRepo) ClaimAttempt(ctx context.Context, scope, key string, seen LoginFailures, at time.Time) (bool, error) {
+	lf, ok := f.failures[lockoutKey{scope, key}]
+	if !ok || lf.Failures != seen.Failures || !lf.LastFailureAt.Equal(seen.LastFailureAt) {
+		return false, nil
+	}
+	lf.LastFailureAt = at
+	return true, nil
+}
+
+func (f *fakeLoginAttemptRepo) Lock(ctx context.Context, e LockoutEvent) error {
+	lf := f.failures[lockoutKey{e.Scope, e.Key}]
+	lf.Failures = 0
+	lf.LockedUntil = &e.LockedUntil
+	f.events = append(f.events, &e)
+	return nil
+}
+
+func (f *fakeLoginAttemptRepo) Reset(ctx context.Context, scope, key string) error {
+	delete(f.failures, lockoutKey{scope, key})
+	return nil
+}
+
+func (f *fakeLoginAttemptRepo) Unlock(ctx context.Context, scope, key, by string, at time.Time) (bool, error) {
+	lf, ok := f.failures[lockoutKey{scope, key}]
+	locked := ok && lf.LockedUntil != nil && at.Before(*lf.LockedUntil)
+	delete(f.failures, lockoutKey{scope, key})
+	for _, e := range f.events {
+		if e.Scope == scope && e.Key == key && e.UnlockedAt == nil && at.Before(e.LockedUntil) {
+			e.UnlockedAt = &at
+			e.UnlockedBy = by
+		}
+	}
+	return locked, nil
+}
+
+type guardFixture struct {
+	guard *loginGuard
+	repo  *fakeLoginAttemptRepo
+	now   time.Time
+}
+
+func newGuardFixture(cfg LockoutConfig) *guardFixture {
+	f := &guardFixture{repo: newFakeLoginAttemptRepo(), now: time.Unix(1_700_000_000, 0).UTC()}
+	f.guard = NewLoginGuard(f.repo, cfg).(*loginGuard)
+	f.guard.now = func() time.Time { return f.now }
+	return f
+}
+
+// TestLoginGuard_Backoff
+// ----------------------
+// Each failure doubles the wait before the next attempt, up to the cap.
+func TestLoginGuard_Backoff(t *testing.T) {
+	f := newGuardFixture(LockoutConfig{BackoffBase: time.Second, BackoffMax: 4 * time.Second})
+	ctx := context.Background()
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		require.NoError(t, f.guard.Fail(ctx, "a@example.com", "10.0.0.1"))
+		wait, err := f.guard.Check(ctx, "A@Example.com ", "10.0.0.2")
+		assert.ErrorIs(t, err, ErrLoginThrottled)
+		assert.Equal(t, want, wait)
+
+		f.now = f.now.Add(want)
+		_, err = f.guard.Check(ctx, "a@example.com", "10.0.0.2")
+		assert.NoError(t, err)
+	}
+}
+
+// TestLoginGuard_ParallelAttempts
+// --------------------------------
+// Once the backoff has passed only one attempt gets through; the others,
+// and any claim made against a counter that has since changed, are
+// throttled until that attempt's own backoff is over.
+func TestLoginGuard_ParallelAttempts(t *testing.T) {
+	f := newGuardFixture(LockoutConfig{BackoffBase: time.Second, BackoffMax: time.Minute})
+	ctx := context.Background()
+
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", "10.0.0.1"))
+	f.now = f.now.Add(time.Second)
+	seen, err := f.repo.Get(ctx, LockoutScopeAccount, "a@example.com")
+	require.NoError(t, err)
+
+	_, err = f.guard.Check(ctx, "a@example.com", "10.0.0.2")
+	require.NoError(t, err)
+	wait, err := f.guard.Check(ctx, "a@example.com", "10.0.0.3")
+	assert.ErrorIs(t, err, ErrLoginThrottled)
+	assert.Equal(t, time.Second, wait)
+
+	ok, err := f.repo.ClaimAttempt(ctx, LockoutScopeAccount, "a@example.com", seen, f.now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	f.now = f.now.Add(time.Second)
+	_, err = f.guard.Check(ctx, "a@example.com", "10.0.0.3")
+	assert.NoError(t, err)
+}
+
+// TestLoginGuard_Lockout
+// ----------------------
+// Reaching the threshold locks the account for the lockout duration and
+// records the event; a success clears the counter.
+func TestLoginGuard_Lockout(t *testing.T) {
+	f := newGuardFixture(LockoutConfig{Threshold: 3, BackoffBase: time.Millisecond, Duration: time.Hour})
+	ctx := context.Background()
+
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	require.NoError(t, f.guard.Succeed(ctx, "a@example.com"))
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	assert.Empty(t, f.repo.events)
+
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	require.Len(t, f.repo.events, 1)
+	assert.Equal(t, LockoutScopeAccount, f.repo.events[0].Scope)
+
+	f.now = f.now.Add(59 * time.Minute)
+	wait, err := f.guard.Check(ctx, "a@example.com", "")
+	assert.ErrorIs(t, err, ErrLoginThrottled)
+	assert.Equal(t, time.Minute, wait)
+
+	f.now = f.now.Add(time.Minute)
+	_, err = f.guard.Check(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+}
+
+// TestLoginGuard_IP
+// -----------------
+// Failures against many accounts from one IP lock the IP, and a valid
+// login from it does not reset that counter.
+func TestLoginGuard_IP(t *testing.T) {
+	f := newGuardFixture(LockoutConfig{IPThreshold: 3, BackoffBase: time.Millisecond})
+	ctx := context.Background()
+
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", "10.0.0.1"))
+	require.NoError(t, f.guard.Fail(ctx, "b@example.com", "10.0.0.1"))
+	require.NoError(t, f.guard.Succeed(ctx, "c@example.com"))
+	require.NoError(t, f.guard.Fail(ctx, "d@example.com", "10.0.0.1"))
+
+	f.now = f.now.Add(time.Second)
+	_, err := f.guard.Check(ctx, "e@example.com", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrLoginThrottled)
+	_, err = f.guard.Check(ctx, "e@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+}
+
+// TestLoginGuard_Unlock
+// ---------------------
+// Unlocking lifts the lock at once and closes the event.
+func TestLoginGuard_Unlock(t *testing.T) {
+	f := newGuardFixture(LockoutConfig{Threshold: 1})
+	ctx := context.Background()
+
+	require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	_, err := f.guard.Check(ctx, "a@example.com", "")
+	require.ErrorIs(t, err, ErrLoginThrottled)
+
+	require.NoError(t, f.guard.Unlock(ctx, "A@example.com", "admin"))
+	_, err = f.guard.Check(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+	require.Len(t, f.repo.events, 1)
+	assert.NotNil(t, f.repo.events[0].UnlockedAt)
+	assert.Equal(t, "admin", f.repo.events[0].UnlockedBy)
+}
@@ -0,0 +1,485 @@
+// internal/auth/mfa.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+)
+
+const (
+	// DefaultMFAChallengeTTL is how long the "mfa pending" token from the
+	// password step stays valid.
+	DefaultMFAChallengeTTL = 5 * time.Minute
+	// maxMFAAttempts is how many wrong codes end a login challenge.
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+// MFA is a user's TOTP enrollment. It is pending until Enabled, which
+// happens once the first code has been confirmed.
+type MFA struct {
+	UserID       string
+	Secret       string // base32
+	Enabled      bool
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// MFAChallenge is the server side of an "mfa pending" token, stored hashed.
+type MFAChallenge struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	ExpiresAt time.Time
+	Attempts  int
+	UsedAt    *time.Time
+}
+
+// MFAEnrollment is returned once by Enroll; URI is the QR code payload.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+type MFARepository interface {
+	// Get returns ErrMFANotEnabled when the user has no enrollment at all.
+	Get(ctx context.Context, userID string) (MFA, error)
+	// SavePending stores a new secret unless MFA is already enabled.
+	SavePending(ctx context.Context, m MFA) error
+	// Enable turns MFA on and replaces the recovery codes.
+	Enable(ctx context.Context, userID string, step int64, recoveryHashes []string, at time.Time) error
+	// UseStep records a TOTP step; false if it (or a later one) was used.
+	UseStep(ctx context.Context, userID string, step int64) (bool, error)
+	// UseRecoveryCode spends a code; false if unknown or already used.
+	UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) (bool, error)
+	// Delete removes the enrollment and its recovery codes.
+	Delete(ctx context.Context, userID string) error
+
+	CreateChallenge(ctx context.Context, c MFAChallenge) error
+	// FindChallenge returns ErrInvalidMFAToken for unknown hashes.
+	FindChallenge(ctx context.Context, hash string) (MFAChallenge, error)
+	// AddChallengeAttempt counts an attempt unless the challenge already
+	// had max; it reports whether the attempt may go ahead.
+	AddChallengeAttempt(ctx context.Context, id string, max int) (bool, error)
+	UseChallenge(ctx context.Context, id string, at time.Time) (bool, error)
+}
+
+type MFAConfig struct {
+	// Issuer names the account in authenticator apps.
+	Issuer       string
+	ChallengeTTL time.Duration
+}
+
+type MFAService interface {
+	// Enroll starts (or restarts) enrollment with a fresh secret.
+	Enroll(ctx context.Context, userID, email string) (MFAEnrollment, error)
+	// Confirm enables MFA with a first valid code and returns the
+	// recovery codes, which are not shown again.
+	Confirm(ctx context.Context, userID, code string) ([]string, error)
+	// Disable needs the password and a TOTP or recovery code.
+	Disable(ctx context.Context, userID, password, code string) error
+	Enabled(ctx context.Context, userID string) (bool, error)
+	// StartChallenge returns the "mfa pending" token handed out after the
+	// password step.
+	StartChallenge(ctx context.Context, userID string) (string, error)
+	// CompleteChallenge redeems the pending token with a TOTP or recovery
+	// code and returns the user to log in. Wrong codes count as failed
+	// logins of the account and ip; only a completed login clears them.
+	// Accounts disabled since the password step get ErrAccountDisabled.
+	CompleteChallenge(ctx context.Context, token, code, ip string) (*User, error)
+}
+
+type mfaService struct {
+	repo   MFARepository
+	users  UserRepository
+	hasher PasswordHasher
+	guard  LoginGuard
+	cfg    MFAConfig
+	now    func() time.Time
+}
+
+func NewMFAService(repo MFARepository, users UserRepository, hasher PasswordHasher, guard LoginGuard, cfg MFAConfig) MFAService {
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = DefaultMFAChallengeTTL
+	}
+	return &mfaService{
+		repo:   repo,
+		users:  users,
+		hasher: hasher,
+		guard:  guard,
+		cfg:    cfg,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *mfaService) Enroll(ctx context.Context, userID, email string) (MFAEnrollment, error) {
+	existing, err := s.repo.Get(ctx, userID)
+	if err != nil && !errors.Is(err, ErrMFANotEnabled) {
+		return MFAEnrollment{}, err
+	}
+	if existing.Enabled {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	err = s.repo.SavePending(ctx, MFA{UserID: userID, Secret: secret, CreatedAt: s.now()})
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	return MFAEnrollment{Secret: secret, URI: otpauthURI(s.cfg.Issuer, email, secret)}, nil
+}
+
+func (s *mfaService) Confirm(ctx context.Context, userID, code string) ([]string, error) {
+	m, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	now := s.now()
+	step, ok := verifyTOTP(m.Secret, code, now)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(userID, codes[i])
+	}
+	if err := s.repo.Enable(ctx, userID, step, hashes, now); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) Disable(ctx context.Context, userID, password, code string) error {
+	m, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !m.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.hasher.CheckPassword(ctx, user.Password, password); err != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.verify(ctx, m, code); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, userID)
+}
+
+func (s *mfaService) Enabled(ctx context.Context, userID string) (bool, error) {
+	m, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, ErrMFANotEnabled) {
+		return false, nil
+	}
+	return m.Enabled, err
+}
+
+func (s *mfaService) StartChallenge(ctx context.Context, userID string) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateChallenge(ctx, MFAChallenge{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: s.now().Add(s.cfg.ChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *mfaService) CompleteChallenge(ctx context.Context, token, code, ip string) (*User, error) {
+	if token == "" {
+		return nil, ErrInvalidMFAToken
+	}
+	c, err := s.repo.FindChallenge(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if c.UsedAt != nil || !now.Before(c.ExpiresAt) {
+		return nil, ErrInvalidMFAToken
+	}
+	// Count the attempt before checking the code, so parallel guesses
+	// cannot get past the limit.
+	ok, err := s.repo.AddChallengeAttempt(ctx, c.ID, maxMFAAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFAToken
+	}
+
+	m, err := s.repo.Get(ctx, c.UserID)
+	if err != nil {
+		if errors.Is(err, ErrMFANotEnabled) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+	user, err := s.users.FindByID(ctx, c.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	if err := s.verify(ctx, m, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.guard.Fail(ctx, user.Email, ip); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	ok, err = s.repo.UseChallenge(ctx, c.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := s.guard.Succeed(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// verify accepts a current TOTP code that has not been used yet, or an
+// unused recovery code.
+func (s *mfaService) verify(ctx context.Context, m MFA, code string) error {
+	if step, ok := verifyTOTP(m.Secret, code, s.now()); ok {
+		fresh, err := s.repo.UseStep(ctx, m.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	ok, err := s.repo.UseRecoveryCode(ctx, m.UserID, hashRecoveryCode(m.UserID, code), s.now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// newRecoveryCode returns a code such as "k7dq2-mx9ta" (about 49 bits).
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for i, v := range b {
+		if i == 5 {
+			sb.WriteByte('-')
+		}
+		// 256 is not a multiple of 30; the bias is negligible here.
+		sb.WriteByte(recoveryAlphabet[int(v)%len(recoveryAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// hashRecoveryCode normalises case and separators before hashing, so
+// "K7DQ2 MX9TA" matches "k7dq2-mx9ta".
+func hashRecoveryCode(userID, code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashToken(userID + ":" + code)
+}
+
+type postgresMFARepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMFARepository(db *sql.DB) MFARepository {
+	return &postgresMFARepository{db: db}
+}
+
+func (r *postgresMFARepository) Get(ctx context.Context, userID string) (MFA, error) {
+	var m MFA
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id, secret, enabled, last_used_step, created_at FROM user_mfa WHERE user_id = $1`,
+		userID,
+	).Scan(&m.UserID, &m.Secret, &m.Enabled, &m.LastUsedStep, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MFA{}, ErrMFANotEnabled
+	}
+	return m, err
+}
+
+func (r *postgresMFARepository) SavePending(ctx context.Context, m MFA) error {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_mfa (user_id, secret, enabled, created_at)
+         VALUES ($1, $2, FALSE, $3)
+         ON CONFLICT (user_id) DO UPDATE
+            SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = 0
+          WHERE user_mfa.enabled = FALSE`,
+		m.UserID, m.Secret, m.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return err
+}
+
+func (r *postgresMFARepository) Enable(ctx context.Context, userID string, step int64, recoveryHashes []string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_mfa SET enabled = TRUE, confirmed_at = $2, last_used_step = $3
+         WHERE user_id = $1 AND enabled = FALSE`,
+		userID, at, step,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+		return ErrMFAAlreadyEnabled
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, h,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *postgresMFARepository) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	return r.affectedOne(r.db.ExecContext(ctx,
+		`UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`,
+		userID, step,
+	))
+}
+
+func (r *postgresMFARepository) UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) (bool, error) {
+	return r.affectedOne(r.db.ExecContext(ctx,
+		`UPDATE mfa_recovery_codes SET used_at = $3
+         WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, hash, at,
+	))
+}
+
+func (r *postgresMFARepository) Delete(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresMFARepository) CreateChallenge(ctx context.Context, c MFAChallenge) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO mfa_challenges (id, user_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)`,
+		c.ID, c.UserID, c.TokenHash, c.ExpiresAt,
+	)
+	return err
+}
+
+func (r *postgresMFARepository) FindChallenge(ctx context.Context, hash string) (MFAChallenge, error) {
+	var c MFAChallenge
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, token_hash, expires_at, attempts, used_at FROM mfa_challenges WHERE token_hash = $1`,
+		hash,
+	).Scan(&c.ID, &c.UserID, &c.TokenHash, &c.ExpiresAt, &c.Attempts, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return MFAChallenge{}, ErrInvalidMFAToken
+		}
+		return MFAChallenge{}, err
+	}
+	if usedAt.Valid {
+		c.UsedAt = &usedAt.Time
+	}
+	return c, nil
+}
+
+func (r *postgresMFARepository) AddChallengeAttempt(ctx context.Context, id string, max int) (bool, error) {
+	return r.affectedOne(r.db.ExecContext(ctx,
+		`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1 AND attempts < $2`,
+		id, max,
+	))
+}
+
+func (r *postgresMFARepository) UseChallenge(ctx context.Context, id string, at time.Time) (bool, error) {
+	return r.affectedOne(r.db.ExecContext(ctx,
+		`UPDATE mfa_challenges SET used_at = $2 WHERE id = $1 AND used_at IS NULL`,
+		id, at,
+	))
+}
+
+func (r *postgresMFARepository) affectedOne(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
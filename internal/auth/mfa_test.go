@@ -0,0 +1,308 @@
+// internal/auth/mfa_test.go
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMFARepo keeps enrollments, recovery codes and challenges in memory.
+type fakeMFARepo struct {
+	mfa        map[string]*MFA
+	recovery   map[string]map[string]bool // user -> hash -> used
+	challenges []*MFAChallenge
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{mfa: map[string]*MFA{}, recovery: map[string]map[string]bool{}}
+}
+
+func (f *fakeMFARepo) Get(ctx context.Context, userID string) (MFA, error) {
+	m, ok := f.mfa[userID]
+	if !ok {
+		return MFA{}, ErrMFANotEnabled
+	}
+	return *m, nil
+}
+
+func (f *fakeMFARepo) SavePending(ctx context.Context, m MFA) error {
+	if existing, ok := f.mfa[m.UserID]; ok && existing.Enabled {
+		return ErrMFAAlreadyEnabled
+	}
+	f.mfa[m.UserID] = &m
+	return nil
+}
+
+func (f *fakeMFARepo) Enable(ctx context.Context, userID string, step int64, hashes []string, at time.Time) error {
+	m := f.mfa[userID]
+	m.Enabled = true
+	m.LastUsedStep = step
+	f.recovery[userID] = map[string]bool{}
+	for _, h := range hashes {
+		f.recovery[userID][h] = false
+	}
+	return nil
+}
+
+func (f *fakeMFARepo) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	m := f.mfa[userID]
+	if m.LastUsedStep >= step {
+		return false, nil
+	}
+	m.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeMFARepo) UseRecoveryCode(ctx context.Context, userID, hash string, at time.Time) (bool, error) {
+	used, ok := f.recovery[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	f.recovery[userID][hash] = true
+	return true, nil
+}
+
+func (f *fakeMFARepo) Delete(ctx context.Context, userID string) error {
+	delete(f.mfa, userID)
+	delete(f.recovery, userID)
+	return nil
+}
+
+func (f *fakeMFARepo) CreateChallenge(ctx context.Context, c MFAChallenge) error {
+	f.challenges = append(f.challenges, &c)
+	return nil
+}
+
+func (f *fakeMFARepo) FindChallenge(ctx context.Context, hash string) (MFAChallenge, error) {
+	for _, c := range f.challenges {
+		if c.TokenHash == hash {
+			return *c, nil
+		}
+	}
+	return MFAChallenge{}, ErrInvalidMFAToken
+}
+
+func (f *fakeMFARepo) AddChallengeAttempt(ctx context.Context, id string, max int) (bool, error) {
+	for _, c := range f.challenges {
+		if c.ID == id && c.Attempts < max {
+			c.Attempts++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeMFARepo) UseChallenge(ctx context.Context, id string, at time.Time) (bool, error) {
+	for _, c := range f.challenges {
+		if c.ID == id && c.UsedAt == nil {
+			c.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type mfaFixture struct {
+	svc   *mfaService
+	repo  *fakeMFARepo
+	users *fakeUserRepo
+	guard LoginGuard
+	now   time.Time
+}
+
+func newMFAFixture(t *testing.T) *mfaFixture {
+	t.Helper()
+	f := &mfaFixture{
+		repo:  newFakeMFARepo(),
+		users: &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Password: "HASHED:secret123"}}},
+		guard: NewLoginGuard(newFakeLoginAttemptRepo(), LockoutConfig{}),
+		now:   time.Unix(1_700_000_000, 0).UTC(),
+	}
+	svc := NewMFAService(f.repo, f.users, &fakeHasher{}, f.guard, MFAConfig{Issuer: "Calc"}).(*mfaService)
+	svc.now = func() time.Time { return f.now }
+	f.svc = svc
+	return f
+}
+
+// code returns the TOTP code for the fixture's clock, offset by steps.
+func (f *mfaFixture) code(t *testing.T, steps int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(f.repo.mfa["user-1"].Secret)
+	require.NoError(t, err)
+	return hotp(key, totpStep(f.now)+steps, totpDigits)
+}
+
+// enable enrolls and confirms user-1, returning the recovery codes.
+func (f *mfaFixture) enable(t *testing.T) []string {
+	t.Helper()
+	ctx := context.Background()
+	_, err := f.svc.Enroll(ctx, "user-1", "a@example.com")
+	require.NoError(t, err)
+	codes, err := f.svc.Confirm(ctx, "user-1", f.code(t, 0))
+	require.NoError(t, err)
+	f.now = f.now.Add(totpPeriod * time.Second)
+	return codes
+}
+
+// TestMFA_EnrollConfirm
+// ---------------------
+// Enrollment stays pending until a valid code is confirmed, and cannot be
+// restarted once enabled.
+func TestMFA_EnrollConfirm(t *testing.T) {
+	f := newMFAFixture(t)
+	ctx := context.Background()
+
+	enrollment, err := f.svc.Enroll(ctx, "user-1", "a@example.com")
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	enabled, err := f.svc.Enabled(ctx, "user-1")
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	_, err = f.svc.Confirm(ctx, "user-1", "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	codes, err := f.svc.Confirm(ctx, "user-1", f.code(t, 0))
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	enabled, err = f.svc.Enabled(ctx, "user-1")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	_, err = f.svc.Enroll(ctx, "user-1", "a@example.com")
+	assert.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+}
+
+// TestMFA_ChallengeTOTP
+// ---------------------
+// A challenge is redeemed once with a current code; the same code cannot
+// be replayed on a second challenge.
+func TestMFA_ChallengeTOTP(t *testing.T) {
+	f := newMFAFixture(t)
+	f.enable(t)
+	ctx := context.Background()
+
+	token, err := f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	code := f.code(t, 0)
+
+	user, err := f.svc.CompleteChallenge(ctx, token, code, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+
+	_, err = f.svc.CompleteChallenge(ctx, token, code, "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidMFAToken)
+
+	again, err := f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	_, err = f.svc.CompleteChallenge(ctx, again, code, "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+}
+
+// TestMFA_ChallengeLimits
+// -----------------------
+// Challenges expire, and burn after too many wrong codes.
+func TestMFA_ChallengeLimits(t *testing.T) {
+	f := newMFAFixture(t)
+	f.enable(t)
+	ctx := context.Background()
+
+	token, err := f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err = f.svc.CompleteChallenge(ctx, token, "000000", "10.0.0.1")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	_, err = f.svc.CompleteChallenge(ctx, token, f.code(t, 0), "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidMFAToken)
+
+	token, err = f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	f.now = f.now.Add(DefaultMFAChallengeTTL)
+	_, err = f.svc.CompleteChallenge(ctx, token, f.code(t, 0), "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidMFAToken)
+}
+
+// TestMFA_ChallengeFailuresReachGuard
+// -----------------------------------
+// Wrong codes count as failed logins of the account, so new challenges
+// do not reset the guessing budget; completing the login clears them.
+func TestMFA_ChallengeFailuresReachGuard(t *testing.T) {
+	f := newMFAFixture(t)
+	f.enable(t)
+	ctx := context.Background()
+
+	token, err := f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	_, err = f.svc.CompleteChallenge(ctx, token, "000000", "10.0.0.1")
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+	_, err = f.guard.Check(ctx, "a@example.com", "")
+	assert.ErrorIs(t, err, ErrLoginThrottled)
+
+	_, err = f.svc.CompleteChallenge(ctx, token, f.code(t, 0), "10.0.0.1")
+	require.NoError(t, err)
+	_, err = f.guard.Check(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+}
+
+// TestMFA_ChallengeDisabledUser
+// -----------------------------
+// An account disabled between the password step and the code step cannot
+// finish logging in, even with a valid code.
+func TestMFA_ChallengeDisabledUser(t *testing.T) {
+	f := newMFAFixture(t)
+	f.enable(t)
+	ctx := context.Background()
+
+	token, err := f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	f.users.createdUsers[0].DisabledAt = &f.now
+
+	_, err = f.svc.CompleteChallenge(ctx, token, f.code(t, 0), "10.0.0.1")
+	assert.ErrorIs(t, err, ErrAccountDisabled)
+}
+
+// TestMFA_RecoveryCodes
+// ---------------------
+// Recovery codes work once each, regardless of case and separators.
+func TestMFA_RecoveryCodes(t *testing.T) {
+	f := newMFAFixture(t)
+	codes := f.enable(t)
+	ctx := context.Background()
+
+	token, err := f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	_, err = f.svc.CompleteChallenge(ctx, token, " "+codes[0]+" ", "10.0.0.1")
+	require.NoError(t, err)
+
+	token, err = f.svc.StartChallenge(ctx, "user-1")
+	require.NoError(t, err)
+	_, err = f.svc.CompleteChallenge(ctx, token, codes[0], "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	_, err = f.svc.CompleteChallenge(ctx, token, codes[1], "10.0.0.1")
+	assert.NoError(t, err)
+}
+
+// TestMFA_Disable
+// ---------------
+// Disabling needs both the password and a code.
+func TestMFA_Disable(t *testing.T) {
+	f := newMFAFixture(t)
+	codes := f.enable(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, f.svc.Disable(ctx, "user-1", "wrong", codes[0]), ErrInvalidCredentials)
+	assert.ErrorIs(t, f.svc.Disable(ctx, "user-1", "secret123", "000000"), ErrInvalidMFACode)
+	require.NoError(t, f.svc.Disable(ctx, "user-1", "secret123", f.code(t, 0)))
+
+	enabled, err := f.svc.Enabled(ctx, "user-1")
+	require.NoError(t, err)
+	assert.False(t, enabled)
+	assert.ErrorIs(t, f.svc.Disable(ctx, "user-1", "secret123", codes[1]), ErrMFANotEnabled)
+}
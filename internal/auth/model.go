@@ -14,12 +14,33 @@ type User struct {
 	Email     string
 	Password  string // hashed password
 	CreatedAt time.Time
+	// TokenVersion is bumped by "log out everywhere"; access tokens
+	// carrying an older version are rejected.
+	TokenVersion  int
+	EmailVerified bool
+	Role          Role
+	// DisabledAt is set while an admin has disabled the account.
+	DisabledAt *time.Time
+	// DeletionRequestedAt is set while the account waits out its
+	// deletion grace period.
+	DeletionRequestedAt *time.Time
 }
 
-// TokenClaims defines what we store in the JWT.
+// TokenClaims defines what we store in the JWT. RegisteredClaims.ID is
+// the jti used to revoke a single token; SessionID ties the token to the
+// login that produced it.
 type TokenClaims struct {
-	UserID string `json:"sub"`
-	Email  string `json:"email"`
+	UserID        string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	TokenVersion  int    `json:"ver"`
+	SessionID     string `json:"sid,omitempty"`
+	Role          Role   `json:"role,omitempty"`
+	// Scopes narrows the role's permissions, for API keys and OAuth
+	// clients; empty means the role's full set.
+	Scopes []Permission `json:"scp,omitempty"`
+	// ClientID is set on tokens issued to OAuth clients.
+	ClientID string `json:"client_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -42,8 +63,22 @@ type signUpRequest struct {
 	Password string `json:"password"`
 }
 type Handler struct {
-	service      AuthService
-	tokenService TokenService
+	service        AuthService
+	tokenService   TokenService
+	refreshService RefreshService
+	revocations    RevocationService
+	sessions       SessionService
+	passwords      PasswordService
+	verification   VerificationService
+	mfa            MFAService
+	guard          LoginGuard
+	admin          AdminService
+	apiKeys        APIKeyService
+	oidc           OIDCService
+	oidcReturnURL  string
+	oauth          OAuthService
+	account        AccountService
+	proxies        TrustedProxies
 }
 
 type loginRequest struct {
@@ -52,6 +87,149 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Status string `json:"status"`          // "passed" or "failed"
-	Token  string `json:"token,omitempty"` // JWT token if passed
+	Status       string `json:"status"`                 // "passed", "failed" or "mfa_required"
+	Message      string `json:"message,omitempty"`      // why, when known, or a notice
+	Token        string `json:"token,omitempty"`        // JWT token if passed
+	RefreshToken string `json:"refreshToken,omitempty"` // opaque, single use
+	MFAToken     string `json:"mfaToken,omitempty"`     // redeem at /login/mfa
+}
+
+type oidcProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// mfaLoginRequest finishes a login that answered "mfa_required". Code is
+// a TOTP code or a recovery code.
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type disableMFARequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// verifyEmailRequest takes either the token from the emailed link or the
+// address and the emailed code.
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type changeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+type confirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// deleteAccountResponse says when the account will be gone for good.
+type deleteAccountResponse struct {
+	Status  string    `json:"status"`
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// sessionResponse marks the session the request was made from.
+type sessionResponse struct {
+	Session
+	Current bool `json:"current"`
+}
+
+type logoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+	// Everywhere logs out every session of the user, not just this token.
+	Everywhere bool `json:"everywhere"`
+}
+
+// adminUserResponse is one account as shown to admins and auditors.
+type adminUserResponse struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	Role          Role       `json:"role"`
+	EmailVerified bool       `json:"emailVerified"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DisabledAt    *time.Time `json:"disabledAt,omitempty"`
+	// DeletionRequestedAt is set while the account waits to be purged.
+	DeletionRequestedAt *time.Time `json:"deletionRequestedAt,omitempty"`
+}
+
+type setRoleRequest struct {
+	Role Role `json:"role"`
+}
+
+type createAPIKeyRequest struct {
+	Name      string       `json:"name"`
+	Scopes    []Permission `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expiresAt"`
+}
+
+// createAPIKeyResponse is the only place the key itself is returned.
+type createAPIKeyResponse struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"apiKey"`
+}
+
+type registerOAuthClientRequest struct {
+	Name         string       `json:"name"`
+	RedirectURIs []string     `json:"redirectUris"`
+	Scopes       []Permission `json:"scopes"`
+	Confidential bool         `json:"confidential"`
+}
+
+// registerOAuthClientResponse is the only place the client secret is
+// returned.
+type registerOAuthClientResponse struct {
+	ClientSecret string      `json:"clientSecret,omitempty"`
+	Client       OAuthClient `json:"client"`
+}
+
+// oauthConsentRequest is the consent page's answer to an authorization
+// request.
+type oauthConsentRequest struct {
+	ResponseType        string `json:"responseType"`
+	ClientID            string `json:"clientId"`
+	RedirectURI         string `json:"redirectUri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"codeChallenge"`
+	CodeChallengeMethod string `json:"codeChallengeMethod"`
+	Approved            bool   `json:"approved"`
+}
+
+type oauthConsentResponse struct {
+	RedirectTo string `json:"redirectTo"`
 }
@@ -0,0 +1,1089 @@
+// internal/auth/oauth.go
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrInvalidClientName   = errors.New("client name must be 1 to 100 characters")
+	// ErrInvalidRedirectURI is also returned for authorization requests
+	// whose redirect_uri is not registered; those must not be redirected.
+	ErrInvalidRedirectURI = errors.New("redirect uris must be https, or http on a loopback address, without a fragment")
+)
+
+// OAuthError is an error response of RFC 6749; Code is its "error" value.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Is matches OAuthErrors by code, so errors.Is(err, ErrOAuthInvalidGrant)
+// holds whatever the description.
+func (e *OAuthError) Is(target error) bool {
+	t, ok := target.(*OAuthError)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrOAuthInvalidRequest          = &OAuthError{Code: "invalid_request"}
+	ErrOAuthInvalidClient           = &OAuthError{Code: "invalid_client"}
+	ErrOAuthInvalidGrant            = &OAuthError{Code: "invalid_grant"}
+	ErrOAuthUnauthorizedClient      = &OAuthError{Code: "unauthorized_client"}
+	ErrOAuthUnsupportedGrantType    = &OAuthError{Code: "unsupported_grant_type"}
+	ErrOAuthInvalidScope            = &OAuthError{Code: "invalid_scope"}
+	ErrOAuthAccessDenied            = &OAuthError{Code: "access_denied"}
+	ErrOAuthUnsupportedResponseType = &OAuthError{Code: "unsupported_response_type"}
+)
+
+func oauthError(base *OAuthError, description string) error {
+	return &OAuthError{Code: base.Code, Description: description}
+}
+
+const (
+	// DefaultOAuthCodeTTL is how long an authorization code can be redeemed.
+	DefaultOAuthCodeTTL = 5 * time.Minute
+	maxOAuthClientName  = 100
+	maxRedirectURIs     = 10
+	pkceChallengeLen    = 43
+)
+
+// OAuthScopes are the permissions third-party clients may ask for; like
+// API keys, they cannot reach account or admin endpoints.
+var OAuthScopes = []Permission{PermCalcWrite, PermHistoryRead}
+
+// OAuthClient is a third-party application registered by a user.
+// Confidential clients authenticate with a secret, shown once at
+// registration, and may use the client credentials grant to act as their
+// owner; public clients (browser and mobile apps) have no secret.
+type OAuthClient struct {
+	ID           string       `json:"clientId"`
+	OwnerID      string       `json:"-"`
+	Name         string       `json:"name"`
+	SecretHash   string       `json:"-"`
+	RedirectURIs []string     `json:"redirectUris"`
+	Scopes       []Permission `json:"scopes"`
+	Confidential bool         `json:"confidential"`
+	CreatedAt    time.Time    `json:"createdAt"`
+	RevokedAt    *time.Time   `json:"-"`
+}
+
+type OAuthClientRegistration struct {
+	Name         string
+	RedirectURIs []string
+	// Scopes default to all of OAuthScopes.
+	Scopes       []Permission
+	Confidential bool
+}
+
+// AuthorizationCode is issued when a user approves a client; it is
+// redeemed once, with the PKCE verifier, for a grant.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scopes        []Permission
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	// GrantID is the grant the code was redeemed for, revoked if the code
+	// is presented again.
+	GrantID string
+}
+
+// OAuthGrant is a user's approval of a client. It owns a session, so it
+// is listed and revoked with the user's other logins, and a rotating
+// refresh token.
+type OAuthGrant struct {
+	ID                  string
+	ClientID            string
+	UserID              string
+	SessionID           string
+	Scopes              []Permission
+	RefreshHash         string
+	PreviousRefreshHash string
+	RefreshExpiresAt    time.Time
+	CreatedAt           time.Time
+	RevokedAt           *time.Time
+}
+
+// AuthorizationRequest holds the parameters of the authorization endpoint.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest holds the parameters of the token endpoint; the client's
+// credentials come from Basic auth or the form.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Introspection is an RFC 7662 response; inactive tokens carry only
+// Active.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, c OAuthClient) error
+	// FindClient returns ErrOAuthClientNotFound for unknown IDs.
+	FindClient(ctx context.Context, id string) (OAuthClient, error)
+	// ListClients returns the owner's live clients, newest first.
+	ListClients(ctx context.Context, ownerID string) ([]OAuthClient, error)
+	// RevokeClient reports false when the owner has no such live client.
+	RevokeClient(ctx context.Context, ownerID, id string, at time.Time) (bool, error)
+
+	CreateCode(ctx context.Context, c AuthorizationCode) error
+	// FindCode returns ErrOAuthInvalidGrant for unknown codes.
+	FindCode(ctx context.Context, hash string) (AuthorizationCode, error)
+	// UseCode marks an unused code as redeemed for grantID; it reports
+	// false when the code was already used.
+	UseCode(ctx context.Context, hash, grantID string, at time.Time) (bool, error)
+
+	CreateGrant(ctx context.Context, g OAuthGrant) error
+	// FindGrant returns ErrOAuthInvalidGrant for unknown IDs.
+	FindGrant(ctx context.Context, id string) (OAuthGrant, error)
+	// FindGrantByRefresh matches the current or the previous refresh
+	// token hash, or returns ErrOAuthInvalidGrant.
+	FindGrantByRefresh(ctx context.Context, hash string) (OAuthGrant, error)
+	// RotateRefresh replaces the refresh token if it is still oldHash.
+	RotateRefresh(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error)
+	RevokeGrant(ctx context.Context, id string, at time.Time) error
+	// RevokeClientGrants revokes and returns the client's live grants.
+	RevokeClientGrants(ctx context.Context, clientID string, at time.Time) ([]OAuthGrant, error)
+}
+
+// OAuthService is an OAuth 2.0 authorization server for third-party
+// clients: the authorization code grant with PKCE, refresh tokens and
+// client credentials, with introspection (RFC 7662) and revocation
+// (RFC 7009).
+type OAuthService interface {
+	// TokenChecker rejects access tokens of deleted clients.
+	TokenChecker
+	// RegisterClient returns the client and, for confidential clients, its
+	// secret, which cannot be retrieved later.
+	RegisterClient(ctx context.Context, ownerID string, reg OAuthClientRegistration) (OAuthClient, string, error)
+	ListClients(ctx context.Context, ownerID string) ([]OAuthClient, error)
+	// DeleteClient revokes the client and every grant made to it.
+	DeleteClient(ctx context.Context, ownerID, id string) error
+	// ValidateAuthorization checks an authorization request and returns
+	// the client and the scopes to ask the user for. ErrOAuthClientNotFound
+	// and ErrInvalidRedirectURI must be shown to the user; OAuthErrors go
+	// back to the client through AuthorizationErrorRedirect.
+	ValidateAuthorization(ctx context.Context, req AuthorizationRequest) (OAuthClient, []Permission, error)
+	// Authorize records the user's decision and returns where to send the
+	// browser: the redirect URI with a code, or with an error.
+	Authorize(ctx context.Context, userID string, req AuthorizationRequest, approved bool) (string, error)
+	Token(ctx context.Context, req TokenRequest) (OAuthTokenResponse, error)
+	// Introspect describes a token issued to the calling client, which
+	// must be confidential. Anything else is reported inactive.
+	Introspect(ctx context.Context, clientID, clientSecret, token string) (Introspection, error)
+	// Revoke ends a refresh token's grant, or a single access token.
+	// Unknown tokens and other clients' tokens are ignored.
+	Revoke(ctx context.Context, clientID, clientSecret, token string) error
+}
+
+type OAuthConfig struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	CodeTTL    time.Duration
+	// CacheTTL bounds how long a client deleted on another instance can
+	// go unnoticed by this one.
+	CacheTTL time.Duration
+}
+
+type cachedClient struct {
+	revoked   bool
+	fetchedAt time.Time
+}
+
+type oauthService struct {
+	repo        OAuthRepository
+	users       UserRepository
+	tokens      TokenService
+	sessions    SessionService
+	revocations RevocationService
+	cfg         OAuthConfig
+	now         func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]cachedClient
+}
+
+func NewOAuthService(
+	repo OAuthRepository,
+	users UserRepository,
+	tokens TokenService,
+	sessions SessionService,
+	revocations RevocationService,
+	cfg OAuthConfig,
+) OAuthService {
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = DefaultOAuthCodeTTL
+	}
+	return &oauthService{
+		repo:        repo,
+		users:       users,
+		tokens:      tokens,
+		sessions:    sessions,
+		revocations: revocations,
+		cfg:         cfg,
+		now:         func() time.Time { return time.Now().UTC() },
+		clients:     map[string]cachedClient{},
+	}
+}
+
+func (s *oauthService) RegisterClient(ctx context.Context, ownerID string, reg OAuthClientRegistration) (OAuthClient, string, error) {
+	name := strings.TrimSpace(reg.Name)
+	if name == "" || len(name) > maxOAuthClientName {
+		return OAuthClient{}, "", ErrInvalidClientName
+	}
+	scopes, err := normalizeScopes(reg.Scopes, OAuthScopes)
+	if err != nil {
+		return OAuthClient{}, "", err
+	}
+	// Confidential clients may use client credentials only.
+	if len(reg.RedirectURIs) > maxRedirectURIs || (len(reg.RedirectURIs) == 0 && !reg.Confidential) {
+		return OAuthClient{}, "", ErrInvalidRedirectURI
+	}
+	for _, u := range reg.RedirectURIs {
+		if !validRedirectURI(u) {
+			return OAuthClient{}, "", ErrInvalidRedirectURI
+		}
+	}
+
+	client := OAuthClient{
+		ID:           uuid.NewString(),
+		OwnerID:      ownerID,
+		Name:         name,
+		RedirectURIs: slices.Clone(reg.RedirectURIs),
+		Scopes:       scopes,
+		Confidential: reg.Confidential,
+		CreatedAt:    s.now(),
+	}
+	var secret string
+	if reg.Confidential {
+		if secret, err = newOpaqueToken(); err != nil {
+			return OAuthClient{}, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	if err := s.repo.CreateClient(ctx, client); err != nil {
+		return OAuthClient{}, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *oauthService) ListClients(ctx context.Context, ownerID string) ([]OAuthClient, error) {
+	return s.repo.ListClients(ctx, ownerID)
+}
+
+func (s *oauthService) DeleteClient(ctx context.Context, ownerID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrOAuthClientNotFound
+	}
+	now := s.now()
+	ok, err := s.repo.RevokeClient(ctx, ownerID, id, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrOAuthClientNotFound
+	}
+	s.storeClient(id, cachedClient{revoked: true, fetchedAt: now})
+
+	grants, err := s.repo.RevokeClientGrants(ctx, id, now)
+	if err != nil {
+		return err
+	}
+	for _, g := range grants {
+		if err := s.endSession(ctx, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *oauthService) ValidateAuthorization(ctx context.Context, req AuthorizationRequest) (OAuthClient, []Permission, error) {
+	client, err := s.liveClient(ctx, req.ClientID)
+	if err != nil {
+		return OAuthClient{}, nil, err
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return OAuthClient{}, nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return OAuthClient{}, nil, oauthError(ErrOAuthUnsupportedResponseType, "only response_type=code is supported")
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != pkceChallengeLen {
+		return OAuthClient{}, nil, oauthError(ErrOAuthInvalidRequest, "PKCE with code_challenge_method=S256 is required")
+	}
+	scopes, err := requestedScopes(req.Scope, client.Scopes)
+	if err != nil {
+		return OAuthClient{}, nil, err
+	}
+	return client, scopes, nil
+}
+
+func (s *oauthService) Authorize(ctx context.Context, userID string, req AuthorizationRequest, approved bool) (string, error) {
+	client, scopes, err := s.ValidateAuthorization(ctx, req)
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) {
+			return AuthorizationErrorRedirect(req, err), nil
+		}
+		return "", err
+	}
+	if !approved {
+		return AuthorizationErrorRedirect(req, oauthError(ErrOAuthAccessDenied, "the user denied the request")), nil
+	}
+
+	code, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateCode(ctx, AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     s.now().Add(s.cfg.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{"code": {code}}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	return withQuery(req.RedirectURI, q), nil
+}
+
+// AuthorizationErrorRedirect returns the redirect URI of a validated
+// request with err as an RFC 6749 error response.
+func AuthorizationErrorRedirect(req AuthorizationRequest, err error) string {
+	q := url.Values{"error": {ErrOAuthInvalidRequest.Code}}
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		q.Set("error", oauthErr.Code)
+		if oauthErr.Description != "" {
+			q.Set("error_description", oauthErr.Description)
+		}
+	}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	return withQuery(req.RedirectURI, q)
+}
+
+func (s *oauthService) Token(ctx context.Context, req TokenRequest) (OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return s.redeemCode(ctx, client, req)
+	case "refresh_token":
+		return s.refresh(ctx, client, req)
+	case "client_credentials":
+		return s.clientCredentials(ctx, client, req)
+	case "":
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidRequest, "grant_type is required")
+	}
+	return OAuthTokenResponse{}, ErrOAuthUnsupportedGrantType
+}
+
+// redeemCode exchanges an authorization code for a new grant. A code
+// presented twice revokes the grant it was first redeemed for.
+func (s *oauthService) redeemCode(ctx context.Context, client OAuthClient, req TokenRequest) (OAuthTokenResponse, error) {
+	hash := hashToken(req.Code)
+	code, err := s.repo.FindCode(ctx, hash)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	if code.ClientID != client.ID {
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "code was issued to another client")
+	}
+	if code.UsedAt != nil {
+		if err := s.revokeGrant(ctx, code.GrantID); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "code already used")
+	}
+
+	now := s.now()
+	switch {
+	case !now.Before(code.ExpiresAt):
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "code expired")
+	case req.RedirectURI != code.RedirectURI:
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "redirect_uri does not match")
+	case subtle.ConstantTimeCompare([]byte(pkceChallenge(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1:
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "code_verifier does not match")
+	}
+
+	grantID := uuid.NewString()
+	ok, err := s.repo.UseCode(ctx, hash, grantID, now)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	if !ok {
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "code already used")
+	}
+
+	user, err := s.activeUser(ctx, code.UserID)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	session, err := s.sessions.Start(ctx, user.ID, "OAuth: "+client.Name, "")
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	refresh, err := newOpaqueToken()
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	err = s.repo.CreateGrant(ctx, OAuthGrant{
+		ID:               grantID,
+		ClientID:         client.ID,
+		UserID:           user.ID,
+		SessionID:        session.ID,
+		Scopes:           code.Scopes,
+		RefreshHash:      hashToken(refresh),
+		RefreshExpiresAt: now.Add(s.cfg.RefreshTTL),
+		CreatedAt:        now,
+	})
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	return s.issue(user, session.ID, client.ID, code.Scopes, refresh)
+}
+
+// refresh rotates a grant's refresh token. Presenting the token it
+// replaced revokes the grant, since one of the two copies was stolen.
+func (s *oauthService) refresh(ctx context.Context, client OAuthClient, req TokenRequest) (OAuthTokenResponse, error) {
+	hash := hashToken(req.RefreshToken)
+	grant, err := s.repo.FindGrantByRefresh(ctx, hash)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	if grant.ClientID != client.ID || grant.RevokedAt != nil {
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "refresh token is not valid")
+	}
+	if hash != grant.RefreshHash {
+		if err := s.revokeGrant(ctx, grant.ID); err != nil {
+			return OAuthTokenResponse{}, err
+		}
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "refresh token already used")
+	}
+
+	now := s.now()
+	if !now.Before(grant.RefreshExpiresAt) {
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "refresh token expired")
+	}
+	scopes, err := requestedScopes(req.Scope, grant.Scopes)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	if err := s.sessions.Resume(ctx, grant.UserID, grant.SessionID); err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "grant revoked")
+		}
+		return OAuthTokenResponse{}, err
+	}
+	user, err := s.activeUser(ctx, grant.UserID)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	refresh, err := newOpaqueToken()
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	ok, err := s.repo.RotateRefresh(ctx, grant.ID, hash, hashToken(refresh), now.Add(s.cfg.RefreshTTL))
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	if !ok {
+		return OAuthTokenResponse{}, oauthError(ErrOAuthInvalidGrant, "refresh token already used")
+	}
+
+	return s.issue(user, grant.SessionID, client.ID, scopes, refresh)
+}
+
+// clientCredentials lets a confidential client act as its owner, within
+// its scopes and without a refresh token.
+func (s *oauthService) clientCredentials(ctx context.Context, client OAuthClient, req TokenRequest) (OAuthTokenResponse, error) {
+	if !client.Confidential {
+		return OAuthTokenResponse{}, oauthError(ErrOAuthUnauthorizedClient, "public clients cannot use client_credentials")
+	}
+	scopes, err := requestedScopes(req.Scope, client.Scopes)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	owner, err := s.activeUser(ctx, client.OwnerID)
+	if err != nil {
+		return OAuthTokenResponse{}, ErrOAuthInvalidClient
+	}
+	return s.issue(owner, "", client.ID, scopes, "")
+}
+
+func (s *oauthService) issue(user *User, sessionID, clientID string, scopes []Permission, refresh string) (OAuthTokenResponse, error) {
+	access, err := s.tokens.GenerateClientToken(user, sessionID, clientID, scopes)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	return OAuthTokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.AccessTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        scopeString(scopes),
+	}, nil
+}
+
+func (s *oauthService) Introspect(ctx context.Context, clientID, clientSecret, token string) (Introspection, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return Introspection{}, err
+	}
+	if !client.Confidential {
+		return Introspection{}, oauthError(ErrOAuthUnauthorizedClient, "public clients cannot introspect tokens")
+	}
+
+	if looksLikeJWT(token) {
+		claims, err := s.tokens.ParseToken(token)
+		if err != nil || claims.ClientID != client.ID {
+			return Introspection{}, nil
+		}
+		for _, c := range []TokenChecker{s.revocations, s.sessions, s} {
+			if err := c.Check(ctx, claims); err != nil {
+				if errors.Is(err, ErrTokenRevoked) || errors.Is(err, ErrSessionRevoked) {
+					return Introspection{}, nil
+				}
+				return Introspection{}, err
+			}
+		}
+		resp := Introspection{
+			Active:    true,
+			Scope:     scopeString(claims.Scopes),
+			ClientID:  claims.ClientID,
+			Username:  claims.Email,
+			TokenType: "access_token",
+			Sub:       claims.UserID,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+		}
+		if claims.ExpiresAt != nil {
+			resp.Exp = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			resp.Iat = claims.IssuedAt.Unix()
+		}
+		return resp, nil
+	}
+
+	hash := hashToken(token)
+	grant, err := s.repo.FindGrantByRefresh(ctx, hash)
+	if err != nil {
+		if errors.Is(err, ErrOAuthInvalidGrant) {
+			return Introspection{}, nil
+		}
+		return Introspection{}, err
+	}
+	if grant.ClientID != client.ID || grant.RevokedAt != nil || hash != grant.RefreshHash ||
+		!s.now().Before(grant.RefreshExpiresAt) {
+		return Introspection{}, nil
+	}
+	if err := s.sessions.Check(ctx, &TokenClaims{UserID: grant.UserID, SessionID: grant.SessionID}); err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			return Introspection{}, nil
+		}
+		return Introspection{}, err
+	}
+	user, err := s.activeUser(ctx, grant.UserID)
+	if err != nil {
+		return Introspection{}, nil
+	}
+	return Introspection{
+		Active:    true,
+		Scope:     scopeString(grant.Scopes),
+		ClientID:  grant.ClientID,
+		Username:  user.Email,
+		TokenType: "refresh_token",
+		Exp:       grant.RefreshExpiresAt.Unix(),
+		Iat:       grant.CreatedAt.Unix(),
+		Sub:       grant.UserID,
+	}, nil
+}
+
+func (s *oauthService) Revoke(ctx context.Context, clientID, clientSecret, token string) error {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if looksLikeJWT(token) {
+		claims, err := s.tokens.ParseToken(token)
+		if err != nil || claims.ClientID != client.ID {
+			return nil
+		}
+		return s.revocations.Revoke(ctx, claims)
+	}
+
+	grant, err := s.repo.FindGrantByRefresh(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrOAuthInvalidGrant) {
+			return nil
+		}
+		return err
+	}
+	if grant.ClientID != client.ID || grant.RevokedAt != nil {
+		return nil
+	}
+	return s.revokeGrant(ctx, grant.ID)
+}
+
+func (s *oauthService) Check(ctx context.Context, claims *TokenClaims) error {
+	if claims.ClientID == "" {
+		return nil
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.clients[claims.ClientID]
+	s.mu.Unlock()
+	if !ok || now.Sub(entry.fetchedAt) >= s.cfg.CacheTTL {
+		client, err := s.repo.FindClient(ctx, claims.ClientID)
+		if err != nil && !errors.Is(err, ErrOAuthClientNotFound) {
+			return err
+		}
+		entry = cachedClient{revoked: err != nil || client.RevokedAt != nil, fetchedAt: now}
+		s.storeClient(claims.ClientID, entry)
+	}
+	if entry.revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// authenticateClient checks the credentials of the client making a
+// back-channel request: the secret of a confidential client, none for a
+// public one.
+func (s *oauthService) authenticateClient(ctx context.Context, clientID, secret string) (OAuthClient, error) {
+	if clientID == "" {
+		return OAuthClient{}, oauthError(ErrOAuthInvalidClient, "client authentication required")
+	}
+	client, err := s.liveClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, ErrOAuthClientNotFound) {
+			return OAuthClient{}, ErrOAuthInvalidClient
+		}
+		return OAuthClient{}, err
+	}
+	if client.Confidential {
+		if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+			return OAuthClient{}, ErrOAuthInvalidClient
+		}
+	} else if secret != "" {
+		return OAuthClient{}, ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+func (s *oauthService) liveClient(ctx context.Context, id string) (OAuthClient, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return OAuthClient{}, ErrOAuthClientNotFound
+	}
+	client, err := s.repo.FindClient(ctx, id)
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	if client.RevokedAt != nil {
+		return OAuthClient{}, ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+// activeUser loads a user who may still be issued tokens.
+func (s *oauthService) activeUser(ctx context.Context, id string) (*User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, oauthError(ErrOAuthInvalidGrant, "user not found")
+		}
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, oauthError(ErrOAuthInvalidGrant, ErrAccountDisabled.Error())
+	}
+	if user.DeletionRequestedAt != nil {
+		return nil, oauthError(ErrOAuthInvalidGrant, ErrAccountPendingDeletion.Error())
+	}
+	return &user, nil
+}
+
+// revokeGrant ends a grant and its session, which also rejects the
+// access tokens issued under it.
+func (s *oauthService) revokeGrant(ctx context.Context, id string) error {
+	grant, err := s.repo.FindGrant(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrOAuthInvalidGrant) {
+			return nil
+		}
+		return err
+	}
+	if err := s.repo.RevokeGrant(ctx, id, s.now()); err != nil {
+		return err
+	}
+	return s.endSession(ctx, grant)
+}
+
+func (s *oauthService) endSession(ctx context.Context, g OAuthGrant) error {
+	err := s.sessions.Revoke(ctx, g.UserID, g.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *oauthService) storeClient(id string, entry cachedClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[id] = entry
+}
+
+// requestedScopes parses a space-separated scope parameter, which may
+// only narrow allowed; an empty one means all of allowed.
+func requestedScopes(scope string, allowed []Permission) ([]Permission, error) {
+	var requested []Permission
+	for _, f := range strings.Fields(scope) {
+		requested = append(requested, Permission(f))
+	}
+	scopes, err := normalizeScopes(requested, allowed)
+	if err != nil {
+		return nil, oauthError(ErrOAuthInvalidScope, "scope exceeds what the client may request")
+	}
+	return scopes, nil
+}
+
+func scopeString(scopes []Permission) string {
+	return strings.Join(permissionStrings(scopes), " ")
+}
+
+// validRedirectURI accepts absolute https URIs, and http ones on loopback
+// addresses for native apps (RFC 8252), without fragments.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		ip := net.ParseIP(host)
+		return host == "localhost" || (ip != nil && ip.IsLoopback())
+	}
+	return false
+}
+
+func withQuery(rawURL string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + q.Encode()
+}
+
+// looksLikeJWT tells access tokens from opaque refresh tokens.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+type postgresOAuthRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOAuthRepository(db *sql.DB) OAuthRepository {
+	return &postgresOAuthRepository{db: db}
+}
+
+func (r *postgresOAuthRepository) CreateClient(ctx context.Context, c OAuthClient) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, scopes, confidential, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		c.ID, c.OwnerID, c.Name, c.SecretHash, pq.Array(c.RedirectURIs), pq.Array(permissionStrings(c.Scopes)),
+		c.Confidential, c.CreatedAt,
+	)
+	return err
+}
+
+const selectOAuthClient = `
+SELECT id, owner_id, name, secret_hash, redirect_uris, scopes, confidential, created_at, revoked_at
+FROM oauth_clients`
+
+func (r *postgresOAuthRepository) FindClient(ctx context.Context, id string) (OAuthClient, error) {
+	c, err := scanOAuthClient(r.db.QueryRowContext(ctx, selectOAuthClient+` WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthClient{}, ErrOAuthClientNotFound
+	}
+	return c, err
+}
+
+func (r *postgresOAuthRepository) ListClients(ctx context.Context, ownerID string) ([]OAuthClient, error) {
+	rows, err := r.db.QueryContext(ctx,
+		selectOAuthClient+` WHERE owner_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []OAuthClient{}
+	for rows.Next() {
+		c, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+func scanOAuthClient(row interface{ Scan(dest ...any) error }) (OAuthClient, error) {
+	var c OAuthClient
+	var scopes []string
+	var revokedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.OwnerID, &c.Name, &c.SecretHash, pq.Array(&c.RedirectURIs), pq.Array(&scopes),
+		&c.Confidential, &c.CreatedAt, &revokedAt)
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	c.Scopes = toPermissions(scopes)
+	if revokedAt.Valid {
+		c.RevokedAt = &revokedAt.Time
+	}
+	return c, nil
+}
+
+func (r *postgresOAuthRepository) RevokeClient(ctx context.Context, ownerID, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_clients SET revoked_at = $3 WHERE id = $1 AND owner_id = $2 AND revoked_at IS NULL`,
+		id, ownerID, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresOAuthRepository) CreateCode(ctx context.Context, c AuthorizationCode) error {
+	// Expired codes are cleaned up as new ones are issued.
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oauth_codes WHERE expires_at < NOW() - INTERVAL '1 day'`); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		c.CodeHash, c.ClientID, c.UserID, c.RedirectURI, pq.Array(permissionStrings(c.Scopes)), c.CodeChallenge, c.ExpiresAt,
+	)
+	return err
+}
+
+func (r *postgresOAuthRepository) FindCode(ctx context.Context, hash string) (AuthorizationCode, error) {
+	var c AuthorizationCode
+	var scopes []string
+	var usedAt sql.NullTime
+	var grantID sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at, used_at, grant_id
+         FROM oauth_codes WHERE code_hash = $1`,
+		hash,
+	).Scan(&c.CodeHash, &c.ClientID, &c.UserID, &c.RedirectURI, pq.Array(&scopes), &c.CodeChallenge,
+		&c.ExpiresAt, &usedAt, &grantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationCode{}, oauthError(ErrOAuthInvalidGrant, "unknown code")
+	}
+	if err != nil {
+		return AuthorizationCode{}, err
+	}
+	c.Scopes = toPermissions(scopes)
+	if usedAt.Valid {
+		c.UsedAt = &usedAt.Time
+	}
+	c.GrantID = grantID.String
+	return c, nil
+}
+
+func (r *postgresOAuthRepository) UseCode(ctx context.Context, hash, grantID string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_codes SET used_at = $3, grant_id = $2 WHERE code_hash = $1 AND used_at IS NULL`,
+		hash, grantID, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresOAuthRepository) CreateGrant(ctx context.Context, g OAuthGrant) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO oauth_grants (id, client_id, user_id, session_id, scopes, refresh_hash, refresh_expires_at, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		g.ID, g.ClientID, g.UserID, g.SessionID, pq.Array(permissionStrings(g.Scopes)), g.RefreshHash,
+		g.RefreshExpiresAt, g.CreatedAt,
+	)
+	return err
+}
+
+const selectOAuthGrant = `
+SELECT id, client_id, user_id, session_id, scopes, refresh_hash, COALESCE(previous_refresh_hash, ''),
+       refresh_expires_at, created_at, revoked_at
+FROM oauth_grants`
+
+func (r *postgresOAuthRepository) FindGrant(ctx context.Context, id string) (OAuthGrant, error) {
+	return r.findGrant(ctx, selectOAuthGrant+` WHERE id = $1`, id)
+}
+
+func (r *postgresOAuthRepository) FindGrantByRefresh(ctx context.Context, hash string) (OAuthGrant, error) {
+	return r.findGrant(ctx, selectOAuthGrant+` WHERE refresh_hash = $1 OR previous_refresh_hash = $1`, hash)
+}
+
+func (r *postgresOAuthRepository) findGrant(ctx context.Context, query string, arg string) (OAuthGrant, error) {
+	g, err := scanOAuthGrant(r.db.QueryRowContext(ctx, query, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthGrant{}, oauthError(ErrOAuthInvalidGrant, "unknown grant")
+	}
+	return g, err
+}
+
+func scanOAuthGrant(row interface{ Scan(dest ...any) error }) (OAuthGrant, error) {
+	var g OAuthGrant
+	var scopes []string
+	var revokedAt sql.NullTime
+	err := row.Scan(&g.ID, &g.ClientID, &g.UserID, &g.SessionID, pq.Array(&scopes), &g.RefreshHash,
+		&g.PreviousRefreshHash, &g.RefreshExpiresAt, &g.CreatedAt, &revokedAt)
+	if err != nil {
+		return OAuthGrant{}, err
+	}
+	g.Scopes = toPermissions(scopes)
+	if revokedAt.Valid {
+		g.RevokedAt = &revokedAt.Time
+	}
+	return g, nil
+}
+
+func (r *postgresOAuthRepository) RotateRefresh(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_grants
+         SET previous_refresh_hash = refresh_hash, refresh_hash = $3, refresh_expires_at = $4
+         WHERE id = $1 AND refresh_hash = $2 AND revoked_at IS NULL`,
+		id, oldHash, newHash, expiresAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresOAuthRepository) RevokeGrant(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE oauth_grants SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL`,
+		id, at,
+	)
+	return err
+}
+
+func (r *postgresOAuthRepository) RevokeClientGrants(ctx context.Context, clientID string, at time.Time) ([]OAuthGrant, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE oauth_grants SET revoked_at = $2 WHERE client_id = $1 AND revoked_at IS NULL
+         RETURNING id, client_id, user_id, session_id, scopes, refresh_hash, COALESCE(previous_refresh_hash, ''),
+                   refresh_expires_at, created_at, revoked_at`,
+		clientID, at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []OAuthGrant
+	for rows.Next() {
+		g, err := scanOAuthGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+func toPermissions(values []string) []Permission {
+	perms := make([]Permission, len(values))
+	for i, v := range values {
+		perms[i] = Permission(v)
+	}
+	return perms
+}
@@ -0,0 +1,567 @@
+// internal/auth/oauth_test.go
+package auth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOAuthRepo keeps clients, codes and grants in memory.
+type fakeOAuthRepo struct {
+	clients []*OAuthClient
+	codes   map[string]*AuthorizationCode
+	grants  map[string]*OAuthGrant
+}
+
+func newFakeOAuthRepo() *fakeOAuthRepo {
+	return &fakeOAuthRepo{codes: map[string]*AuthorizationCode{}, grants: map[string]*OAuthGrant{}}
+}
+
+func (f *fakeOAuthRepo) CreateClient(ctx context.Context, c OAuthClient) error {
+	f.clients = append(f.clients, &c)
+	return nil
+}
+
+func (f *fakeOAuthRepo) FindClient(ctx context.Context, id string) (OAuthClient, error) {
+	for _, c := range f.clients {
+		if c.ID == id {
+			return *c, nil
+		}
+	}
+	return OAuthClient{}, ErrOAuthClientNotFound
+}
+
+func (f *fakeOAuthRepo) ListClients(ctx context.Context, ownerID string) ([]OAuthClient, error) {
+	clients := []OAuthClient{}
+	for i := len(f.clients) - 1; i >= 0; i-- {
+		if c := f.clients[i]; c.OwnerID == ownerID && c.RevokedAt == nil {
+			clients = append(clients, *c)
+		}
+	}
+	return clients, nil
+}
+
+func (f *fakeOAuthRepo) RevokeClient(ctx context.Context, ownerID, id string, at time.Time) (bool, error) {
+	for _, c := range f.clients {
+		if c.ID == id && c.OwnerID == ownerID && c.RevokedAt == nil {
+			c.RevokedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeOAuthRepo) CreateCode(ctx context.Context, c AuthorizationCode) error {
+	f.codes[c.CodeHash] = &c
+	return nil
+}
+
+func (f *fakeOAuthRepo) FindCode(ctx context.Context, hash string) (AuthorizationCode, error) {
+	c, ok := f.codes[hash]
+	if !ok {
+		return AuthorizationCode{}, ErrOAuthInvalidGrant
+	}
+	return *c, nil
+}
+
+func (f *fakeOAuthRepo) UseCode(ctx context.Context, hash, grantID string, at time.Time) (bool, error) {
+	c, ok := f.codes[hash]
+	if !ok || c.UsedAt != nil {
+		return false, nil
+	}
+	c.UsedAt = &at
+	c.GrantID = grantID
+	return true, nil
+}
+
+func (f *fakeOAuthRepo) CreateGrant(ctx context.Context, g OAuthGrant) error {
+	f.grants[g.ID] = &g
+	return nil
+}
+
+func (f *fakeOAuthRepo) FindGrant(ctx context.Context, id string) (OAuthGrant, error) {
+	g, ok := f.grants[id]
+	if !ok {
+		return OAuthGrant{}, ErrOAuthInvalidGrant
+	}
+	return *g, nil
+}
+
+func (f *fakeOAuthRepo) FindGrantByRefresh(ctx context.Context, hash string) (OAuthGrant, error) {
+	for _, g := range f.grants {
+		if g.RefreshHash == hash || g.PreviousRefreshHash == hash {
+			return *g, nil
+		}
+	}
+	return OAuthGrant{}, ErrOAuthInvalidGrant
+}
+
+func (f *fakeOAuthRepo) RotateRefresh(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	g, ok := f.grants[id]
+	if !ok || g.RefreshHash != oldHash || g.RevokedAt != nil {
+		return false, nil
+	}
+	g.PreviousRefreshHash, g.RefreshHash, g.RefreshExpiresAt = g.RefreshHash, newHash, expiresAt
+	return true, nil
+}
+
+func (f *fakeOAuthRepo) RevokeGrant(ctx context.Context, id string, at time.Time) error {
+	if g, ok := f.grants[id]; ok && g.RevokedAt == nil {
+		g.RevokedAt = &at
+	}
+	return nil
+}
+
+func (f *fakeOAuthRepo) RevokeClientGrants(ctx context.Context, clientID string, at time.Time) ([]OAuthGrant, error) {
+	var out []OAuthGrant
+	for _, g := range f.grants {
+		if g.ClientID == clientID && g.RevokedAt == nil {
+			g.RevokedAt = &at
+			out = append(out, *g)
+		}
+	}
+	return out, nil
+}
+
+const (
+	testRedirectURI  = "https://partner.example/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mJ92K1rqUFsvsDx4dnp3HJqpKqSEbk"
+)
+
+type oauthFixture struct {
+	svc      *oauthService
+	repo     *fakeOAuthRepo
+	users    *fakeUserRepo
+	tokens   TokenService
+	sessions SessionService
+	now      time.Time
+}
+
+func newOAuthFixture(t *testing.T) *oauthFixture {
+	t.Helper()
+	f := &oauthFixture{
+		repo:     newFakeOAuthRepo(),
+		users:    &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Role: RoleUser}}},
+		tokens:   NewJWTTokenService("test-secret", "test-issuer", 15*time.Minute),
+		sessions: NewSessionService(newFakeSessionRepo(), 24*time.Hour, 0),
+		now:      time.Unix(1_700_000_000, 0).UTC(),
+	}
+	revocations := NewRevocationService(newFakeRevocationRepo(), 0)
+	f.svc = NewOAuthService(f.repo, f.users, f.tokens, f.sessions, revocations, OAuthConfig{
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 24 * time.Hour,
+	}).(*oauthService)
+	f.svc.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *oauthFixture) register(t *testing.T, confidential bool) (OAuthClient, string) {
+	t.Helper()
+	client, secret, err := f.svc.RegisterClient(context.Background(), "user-1", OAuthClientRegistration{
+		Name:         "Partner",
+		RedirectURIs: []string{testRedirectURI},
+		Confidential: confidential,
+	})
+	require.NoError(t, err)
+	return client, secret
+}
+
+func (f *oauthFixture) authRequest(client OAuthClient) AuthorizationRequest {
+	return AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            client.ID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "calc:write",
+		State:               "xyz",
+		CodeChallenge:       pkceChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// authorize approves the client for user-1 and returns the code.
+func (f *oauthFixture) authorize(t *testing.T, client OAuthClient) string {
+	t.Helper()
+	redirect, err := f.svc.Authorize(context.Background(), "user-1", f.authRequest(client), true)
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	require.NotEmpty(t, u.Query().Get("code"))
+	return u.Query().Get("code")
+}
+
+func (f *oauthFixture) redeem(client OAuthClient, secret, code string) (OAuthTokenResponse, error) {
+	return f.svc.Token(context.Background(), TokenRequest{
+		GrantType:    "authorization_code",
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testCodeVerifier,
+	})
+}
+
+// check runs an access token through the middleware's checks.
+func (f *oauthFixture) check(t *testing.T, access string) error {
+	t.Helper()
+	claims, err := f.tokens.ParseToken(access)
+	require.NoError(t, err)
+	if err := f.sessions.Check(context.Background(), claims); err != nil {
+		return err
+	}
+	return f.svc.Check(context.Background(), claims)
+}
+
+// TestOAuth_AuthorizationCodeFlow
+// -------------------------------
+// An approved request yields a code that, with the PKCE verifier, is
+// exchanged for an access token scoped to what the user approved and a
+// refresh token. The grant shows up as one of the user's sessions.
+func TestOAuth_AuthorizationCodeFlow(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, _ := f.register(t, false)
+
+	gotClient, scopes, err := f.svc.ValidateAuthorization(ctx, f.authRequest(client))
+	require.NoError(t, err)
+	assert.Equal(t, "Partner", gotClient.Name)
+	assert.Equal(t, []Permission{PermCalcWrite}, scopes)
+
+	resp, err := f.redeem(client, "", f.authorize(t, client))
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, 900, resp.ExpiresIn)
+	assert.Equal(t, "calc:write", resp.Scope)
+	assert.NotEmpty(t, resp.RefreshToken)
+
+	claims, err := f.tokens.ParseToken(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.Equal(t, client.ID, claims.ClientID)
+	assert.True(t, claims.Permits(PermCalcWrite))
+	assert.False(t, claims.Permits(PermHistoryRead))
+	assert.NoError(t, f.check(t, resp.AccessToken))
+
+	sessions, err := f.sessions.List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "OAuth: Partner", sessions[0].UserAgent)
+	assert.Equal(t, claims.SessionID, sessions[0].ID)
+
+	// Ending the session ends the grant.
+	require.NoError(t, f.sessions.Revoke(ctx, "user-1", claims.SessionID))
+	assert.ErrorIs(t, f.check(t, resp.AccessToken), ErrSessionRevoked)
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "refresh_token", ClientID: client.ID, RefreshToken: resp.RefreshToken})
+	assert.ErrorIs(t, err, ErrOAuthInvalidGrant)
+}
+
+// TestOAuth_InvalidAuthorizationRequests
+// --------------------------------------
+// Unknown clients and unregistered redirect URIs are not redirected
+// anywhere; other mistakes go back to the client as OAuth errors, as
+// does a denial.
+func TestOAuth_InvalidAuthorizationRequests(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, _ := f.register(t, false)
+
+	tests := []struct {
+		name   string
+		mutate func(*AuthorizationRequest)
+		want   error
+	}{
+		{"unknown client", func(r *AuthorizationRequest) { r.ClientID = "not-a-client" }, ErrOAuthClientNotFound},
+		{"unregistered redirect", func(r *AuthorizationRequest) { r.RedirectURI = "https://evil.example/cb" }, ErrInvalidRedirectURI},
+		{"token response type", func(r *AuthorizationRequest) { r.ResponseType = "token" }, ErrOAuthUnsupportedResponseType},
+		{"no PKCE", func(r *AuthorizationRequest) { r.CodeChallenge = "" }, ErrOAuthInvalidRequest},
+		{"plain PKCE", func(r *AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, ErrOAuthInvalidRequest},
+		{"admin scope", func(r *AuthorizationRequest) { r.Scope = "users:write" }, ErrOAuthInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := f.authRequest(client)
+			tt.mutate(&req)
+			_, _, err := f.svc.ValidateAuthorization(ctx, req)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	redirect, err := f.svc.Authorize(ctx, "user-1", f.authRequest(client), false)
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	assert.Equal(t, "access_denied", u.Query().Get("error"))
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	assert.Empty(t, f.repo.codes)
+}
+
+// TestOAuth_CodeRedemption
+// ------------------------
+// A code is bound to its client, redirect URI and PKCE challenge, and
+// expires. Presenting a redeemed code again revokes what it produced.
+func TestOAuth_CodeRedemption(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, _ := f.register(t, false)
+	other, _ := f.register(t, false)
+
+	tests := []struct {
+		name   string
+		mutate func(*TokenRequest)
+	}{
+		{"wrong verifier", func(r *TokenRequest) { r.CodeVerifier = "wrong-verifier-wrong-verifier-wrong-verifier" }},
+		{"wrong redirect", func(r *TokenRequest) { r.RedirectURI = "https://partner.example/other" }},
+		{"other client", func(r *TokenRequest) { r.ClientID = other.ID }},
+		{"unknown code", func(r *TokenRequest) { r.Code = "guess" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := TokenRequest{
+				GrantType:    "authorization_code",
+				ClientID:     client.ID,
+				Code:         f.authorize(t, client),
+				RedirectURI:  testRedirectURI,
+				CodeVerifier: testCodeVerifier,
+			}
+			tt.mutate(&req)
+			_, err := f.svc.Token(ctx, req)
+			assert.ErrorIs(t, err, ErrOAuthInvalidGrant)
+		})
+	}
+
+	expired := f.authorize(t, client)
+	f.now = f.now.Add(DefaultOAuthCodeTTL)
+	_, err := f.redeem(client, "", expired)
+	assert.ErrorIs(t, err, ErrOAuthInvalidGrant)
+
+	code := f.authorize(t, client)
+	resp, err := f.redeem(client, "", code)
+	require.NoError(t, err)
+	_, err = f.redeem(client, "", code)
+	assert.ErrorIs(t, err, ErrOAuthInvalidGrant)
+	assert.ErrorIs(t, f.check(t, resp.AccessToken), ErrSessionRevoked)
+}
+
+// TestOAuth_RefreshRotation
+// -------------------------
+// Refreshing rotates the refresh token and may narrow the scopes. Reusing
+// a replaced refresh token revokes the grant.
+func TestOAuth_RefreshRotation(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, secret := f.register(t, true)
+
+	req := f.authRequest(client)
+	req.Scope = ""
+	redirect, err := f.svc.Authorize(ctx, "user-1", req, true)
+	require.NoError(t, err)
+	u, _ := url.Parse(redirect)
+	first, err := f.redeem(client, secret, u.Query().Get("code"))
+	require.NoError(t, err)
+	assert.Equal(t, "calc:write history:read", first.Scope)
+
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "refresh_token", ClientID: client.ID, RefreshToken: first.RefreshToken})
+	assert.ErrorIs(t, err, ErrOAuthInvalidClient, "confidential clients must authenticate")
+
+	second, err := f.svc.Token(ctx, TokenRequest{
+		GrantType:    "refresh_token",
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		RefreshToken: first.RefreshToken,
+		Scope:        "history:read",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "history:read", second.Scope)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, err = f.svc.Token(ctx, TokenRequest{
+		GrantType:    "refresh_token",
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		RefreshToken: first.RefreshToken,
+	})
+	assert.ErrorIs(t, err, ErrOAuthInvalidGrant)
+	assert.ErrorIs(t, f.check(t, second.AccessToken), ErrSessionRevoked)
+	_, err = f.svc.Token(ctx, TokenRequest{
+		GrantType:    "refresh_token",
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		RefreshToken: second.RefreshToken,
+	})
+	assert.ErrorIs(t, err, ErrOAuthInvalidGrant)
+}
+
+// TestOAuth_ClientCredentials
+// ---------------------------
+// Confidential clients get tokens acting as their owner, without a
+// refresh token; public clients and wrong secrets are refused.
+func TestOAuth_ClientCredentials(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, secret := f.register(t, true)
+	public, _ := f.register(t, false)
+
+	resp, err := f.svc.Token(ctx, TokenRequest{
+		GrantType:    "client_credentials",
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		Scope:        "calc:write",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, resp.RefreshToken)
+	claims, err := f.tokens.ParseToken(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.Equal(t, client.ID, claims.ClientID)
+	assert.Empty(t, claims.SessionID)
+	assert.NoError(t, f.check(t, resp.AccessToken))
+
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "client_credentials", ClientID: client.ID, ClientSecret: "wrong"})
+	assert.ErrorIs(t, err, ErrOAuthInvalidClient)
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "client_credentials", ClientID: public.ID})
+	assert.ErrorIs(t, err, ErrOAuthUnauthorizedClient)
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "client_credentials", ClientID: client.ID, ClientSecret: secret, Scope: "users:read"})
+	assert.ErrorIs(t, err, ErrOAuthInvalidScope)
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "password", ClientID: client.ID, ClientSecret: secret})
+	assert.ErrorIs(t, err, ErrOAuthUnsupportedGrantType)
+
+	f.users.createdUsers[0].DisabledAt = &f.now
+	_, err = f.svc.Token(ctx, TokenRequest{GrantType: "client_credentials", ClientID: client.ID, ClientSecret: secret})
+	assert.ErrorIs(t, err, ErrOAuthInvalidClient)
+}
+
+// TestOAuth_IntrospectAndRevoke
+// -----------------------------
+// A confidential client can introspect its own tokens only; revoking an
+// access token or a refresh token makes it inactive.
+func TestOAuth_IntrospectAndRevoke(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, secret := f.register(t, true)
+	other, otherSecret := f.register(t, true)
+	public, _ := f.register(t, false)
+
+	resp, err := f.redeem(client, secret, f.authorize(t, client))
+	require.NoError(t, err)
+
+	info, err := f.svc.Introspect(ctx, client.ID, secret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, info.Active)
+	assert.Equal(t, "calc:write", info.Scope)
+	assert.Equal(t, client.ID, info.ClientID)
+	assert.Equal(t, "a@example.com", info.Username)
+	assert.Equal(t, "access_token", info.TokenType)
+	assert.NotZero(t, info.Exp)
+
+	info, err = f.svc.Introspect(ctx, client.ID, secret, resp.RefreshToken)
+	require.NoError(t, err)
+	assert.True(t, info.Active)
+	assert.Equal(t, "refresh_token", info.TokenType)
+
+	info, err = f.svc.Introspect(ctx, other.ID, otherSecret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, info.Active, "tokens of other clients are not disclosed")
+	_, err = f.svc.Introspect(ctx, public.ID, "", resp.AccessToken)
+	assert.ErrorIs(t, err, ErrOAuthUnauthorizedClient)
+
+	// Other clients' tokens and unknown tokens are ignored.
+	require.NoError(t, f.svc.Revoke(ctx, other.ID, otherSecret, resp.AccessToken))
+	require.NoError(t, f.svc.Revoke(ctx, client.ID, secret, "unknown"))
+	info, err = f.svc.Introspect(ctx, client.ID, secret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, info.Active)
+
+	require.NoError(t, f.svc.Revoke(ctx, client.ID, secret, resp.AccessToken))
+	info, err = f.svc.Introspect(ctx, client.ID, secret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, info.Active)
+	info, err = f.svc.Introspect(ctx, client.ID, secret, resp.RefreshToken)
+	require.NoError(t, err)
+	assert.True(t, info.Active, "revoking an access token keeps the grant")
+
+	require.NoError(t, f.svc.Revoke(ctx, client.ID, secret, resp.RefreshToken))
+	info, err = f.svc.Introspect(ctx, client.ID, secret, resp.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, Introspection{}, info)
+}
+
+// TestOAuth_DeleteClient
+// ----------------------
+// Deleting a client rejects its outstanding access tokens and refresh
+// tokens, and only its owner can delete it.
+func TestOAuth_DeleteClient(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+	client, secret := f.register(t, true)
+
+	resp, err := f.redeem(client, secret, f.authorize(t, client))
+	require.NoError(t, err)
+	cc, err := f.svc.Token(ctx, TokenRequest{GrantType: "client_credentials", ClientID: client.ID, ClientSecret: secret})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, f.svc.DeleteClient(ctx, "user-2", client.ID), ErrOAuthClientNotFound)
+	require.NoError(t, f.svc.DeleteClient(ctx, "user-1", client.ID))
+	assert.ErrorIs(t, f.svc.DeleteClient(ctx, "user-1", client.ID), ErrOAuthClientNotFound)
+
+	assert.ErrorIs(t, f.check(t, cc.AccessToken), ErrTokenRevoked)
+	assert.ErrorIs(t, f.check(t, resp.AccessToken), ErrSessionRevoked)
+	_, err = f.svc.Token(ctx, TokenRequest{
+		GrantType:    "refresh_token",
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		RefreshToken: resp.RefreshToken,
+	})
+	assert.ErrorIs(t, err, ErrOAuthInvalidClient)
+
+	clients, err := f.svc.ListClients(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, clients)
+}
+
+// TestOAuth_RegisterClient
+// ------------------------
+// Registration validates names, scopes and redirect URIs, and returns a
+// secret for confidential clients only.
+func TestOAuth_RegisterClient(t *testing.T) {
+	f := newOAuthFixture(t)
+	ctx := context.Background()
+
+	client, secret, err := f.svc.RegisterClient(ctx, "user-1", OAuthClientRegistration{
+		Name:         " CLI ",
+		RedirectURIs: []string{"http://127.0.0.1:8123/cb"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+	assert.Equal(t, "CLI", client.Name)
+	assert.Equal(t, OAuthScopes, client.Scopes)
+
+	client, secret, err = f.svc.RegisterClient(ctx, "user-1", OAuthClientRegistration{Name: "Backend", Confidential: true})
+	require.NoError(t, err)
+	assert.NotEmpty(t, secret)
+	assert.Equal(t, hashToken(secret), client.SecretHash)
+
+	tests := []struct {
+		name string
+		reg  OAuthClientRegistration
+		want error
+	}{
+		{"no name", OAuthClientRegistration{RedirectURIs: []string{testRedirectURI}}, ErrInvalidClientName},
+		{"admin scope", OAuthClientRegistration{Name: "x", RedirectURIs: []string{testRedirectURI}, Scopes: []Permission{PermUsersRead}}, ErrInvalidScope},
+		{"public without redirect", OAuthClientRegistration{Name: "x"}, ErrInvalidRedirectURI},
+		{"plain http", OAuthClientRegistration{Name: "x", RedirectURIs: []string{"http://partner.example/cb"}}, ErrInvalidRedirectURI},
+		{"fragment", OAuthClientRegistration{Name: "x", RedirectURIs: []string{"https://partner.example/cb#x"}}, ErrInvalidRedirectURI},
+		{"relative", OAuthClientRegistration{Name: "x", RedirectURIs: []string{"/cb"}}, ErrInvalidRedirectURI},
+		{"custom scheme", OAuthClientRegistration{Name: "x", RedirectURIs: []string{"javascript://alert(1)"}}, ErrInvalidRedirectURI},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := f.svc.RegisterClient(ctx, "user-1", tt.reg)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
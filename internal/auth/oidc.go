@@ -0,0 +1,571 @@
+// internal/auth/oidc.go
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrInvalidOIDCState    = errors.New("invalid or expired login state")
+	ErrInvalidIDToken      = errors.New("invalid id token")
+	ErrOIDCCodeExchange    = errors.New("authorization code exchange failed")
+	ErrOIDCEmailUnverified = errors.New("the identity provider has not verified this email address")
+	// ErrOIDCAccountUnverified refuses to link a provider to an account
+	// whose address was never verified: whoever registered it may not own
+	// the address, and would keep its password.
+	ErrOIDCAccountUnverified = errors.New("an account with this email exists but is not verified; verify it before signing in with a provider")
+)
+
+const (
+	// DefaultOIDCStateTTL bounds how long the user may spend at the
+	// provider.
+	DefaultOIDCStateTTL = 10 * time.Minute
+	// oidcJWKSRefetch limits how often an unknown kid refetches the
+	// provider's keys.
+	oidcJWKSRefetch   = time.Minute
+	oidcIDTokenLeeway = time.Minute
+	oidcHTTPTimeout   = 10 * time.Second
+)
+
+var defaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// OIDCProviderConfig registers this server as a client of one provider.
+type OIDCProviderConfig struct {
+	// Name appears in URLs, e.g. /api/v1/auth/oidc/{name}/start.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes default to openid, email and profile.
+	Scopes []string
+}
+
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+	StateTTL  time.Duration
+	// HTTPClient talks to the providers; nil uses a client with a timeout.
+	HTTPClient *http.Client
+}
+
+// OIDCState is a login in progress: the provider must return the state,
+// and the ID token must carry the nonce.
+type OIDCState struct {
+	StateHash    string
+	Provider     string
+	NonceHash    string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// OIDCIdentity links a provider's subject to a user.
+type OIDCIdentity struct {
+	Provider  string
+	Subject   string
+	UserID    string
+	Email     string
+	CreatedAt time.Time
+}
+
+type OIDCRepository interface {
+	CreateState(ctx context.Context, st OIDCState) error
+	// ConsumeState deletes and returns the state, or returns
+	// ErrInvalidOIDCState.
+	ConsumeState(ctx context.Context, stateHash string) (OIDCState, error)
+	// FindIdentity returns ErrUserNotFound for unlinked subjects.
+	FindIdentity(ctx context.Context, provider, subject string) (OIDCIdentity, error)
+	LinkIdentity(ctx context.Context, id OIDCIdentity) error
+}
+
+type OIDCService interface {
+	// Providers lists the configured provider names.
+	Providers() []string
+	// Start returns the provider's authorization URL and the state, which
+	// the caller should also bind to the browser.
+	Start(ctx context.Context, provider string) (authURL, state string, err error)
+	// Complete redeems the code returned to the callback and returns the
+	// linked user, linking or creating one by verified email on first use.
+	Complete(ctx context.Context, provider, state, code string) (*User, error)
+}
+
+type oidcService struct {
+	repo      OIDCRepository
+	users     UserRepository
+	hasher    PasswordHasher
+	providers map[string]*oidcProvider
+	names     []string
+	stateTTL  time.Duration
+	now       func() time.Time
+}
+
+func NewOIDCService(repo OIDCRepository, users UserRepository, hasher PasswordHasher, cfg OIDCConfig) OIDCService {
+	if cfg.StateTTL <= 0 {
+		cfg.StateTTL = DefaultOIDCStateTTL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+	}
+	s := &oidcService{
+		repo:      repo,
+		users:     users,
+		hasher:    hasher,
+		providers: map[string]*oidcProvider{},
+		stateTTL:  cfg.StateTTL,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+	for _, p := range cfg.Providers {
+		if len(p.Scopes) == 0 {
+			p.Scopes = defaultOIDCScopes
+		}
+		s.providers[p.Name] = &oidcProvider{cfg: p, client: cfg.HTTPClient}
+		s.names = append(s.names, p.Name)
+	}
+	return s
+}
+
+func (s *oidcService) Providers() []string {
+	return append([]string{}, s.names...)
+}
+
+func (s *oidcService) Start(ctx context.Context, provider string) (string, string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownOIDCProvider
+	}
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.repo.CreateState(ctx, OIDCState{
+		StateHash:    hashToken(state),
+		Provider:     provider,
+		NonceHash:    hashToken(nonce),
+		CodeVerifier: verifier,
+		ExpiresAt:    s.now().Add(s.stateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+func (s *oidcService) Complete(ctx context.Context, provider, state, code string) (*User, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	st, err := s.repo.ConsumeState(ctx, hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if st.Provider != provider || !s.now().Before(st.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	rawIDToken, err := p.exchange(ctx, code, st.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.verify(ctx, rawIDToken, s.now)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(claims.Nonce)), []byte(st.NonceHash)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return s.link(ctx, provider, claims)
+}
+
+// link returns the user linked to the subject, linking an account with
+// the same verified email or creating one on first sign-in.
+func (s *oidcService) link(ctx context.Context, provider string, claims *oidcClaims) (*User, error) {
+	identity, err := s.repo.FindIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		user, err := s.users.FindByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	user, err := s.users.FindByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !user.EmailVerified {
+			return nil, ErrOIDCAccountUnverified
+		}
+	case errors.Is(err, ErrUserNotFound):
+		user, err = s.createUser(ctx, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = s.repo.LinkIdentity(ctx, OIDCIdentity{
+		Provider:  provider,
+		Subject:   claims.Subject,
+		UserID:    user.ID,
+		Email:     claims.Email,
+		CreatedAt: s.now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createUser registers a verified account with a random password; the user
+// can set one through the password reset flow.
+func (s *oidcService) createUser(ctx context.Context, email string) (User, error) {
+	password, err := newOpaqueToken()
+	if err != nil {
+		return User{}, err
+	}
+	hash, err := s.hasher.HashPassword(ctx, password)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{
+		ID:        uuid.NewString(),
+		Email:     email,
+		Password:  hash,
+		CreatedAt: s.now(),
+		Role:      RoleUser,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return User{}, err
+	}
+	if err := s.users.MarkEmailVerified(ctx, user.ID, email); err != nil {
+		return User{}, err
+	}
+	user.EmailVerified = true
+	return user, nil
+}
+
+// pkceChallenge is the S256 code challenge of RFC 7636.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// oidcMetadata is the part of the discovery document we use.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the ID token claims we check.
+type oidcClaims struct {
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   oidcBool `json:"email_verified"`
+	AuthorizedParty string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// oidcBool accepts the "true"/"false" strings some providers send instead
+// of booleans.
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = oidcBool(v)
+	case string:
+		*b = oidcBool(v == "true")
+	}
+	return nil
+}
+
+// oidcProvider caches a provider's discovery document and keys.
+type oidcProvider struct {
+	cfg    OIDCProviderConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	meta      *oidcMetadata
+	keys      map[string]JWK
+	keysFetch time.Time
+}
+
+// metadata fetches the discovery document once; failures are retried on
+// the next call.
+func (p *oidcProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta oidcMetadata
+	discovery := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discovery, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.cfg.Name, err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery for %s: issuer %q does not match %q", p.cfg.Name, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery for %s: incomplete document", p.cfg.Name)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// exchange redeems the code at the token endpoint and returns the ID token.
+func (p *oidcProvider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// RFC 6749 section 2.3.1: both parts are form-encoded first.
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOIDCCodeExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("%w: %s %s", ErrOIDCCodeExchange, body.Error, body.ErrorDescription)
+	}
+	return body.IDToken, nil
+}
+
+// verify checks the ID token's signature against the provider's JWKS and
+// its issuer, audience and lifetime. The nonce is left to the caller.
+func (p *oidcProvider) verify(ctx context.Context, raw string, now func() time.Time) (*oidcClaims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &oidcClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		jwk, err := p.key(ctx, meta.JWKSURI, kid)
+		if err != nil {
+			return nil, err
+		}
+		pub, alg, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != alg || (jwk.Alg != "" && jwk.Alg != alg) {
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+		}
+		return pub, nil
+	},
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcIDTokenLeeway),
+		jwt.WithTimeFunc(now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	// With several audiences, the token must have been issued to us.
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// key returns the provider key named kid, refetching the JWKS when the
+// kid is unknown, at most once per oidcJWKSRefetch.
+func (p *oidcProvider) key(ctx context.Context, jwksURI, kid string) (JWK, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.keysFetch) < oidcJWKSRefetch {
+		return JWK{}, ErrUnknownKey
+	}
+	p.keysFetch = time.Now()
+
+	var set JWKSet
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return JWK{}, fmt.Errorf("fetch jwks for %s: %w", p.cfg.Name, err)
+	}
+	p.keys = map[string]JWK{}
+	for _, k := range set.Keys {
+		if k.Use == "" || k.Use == "sig" {
+			p.keys[k.Kid] = k
+		}
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return JWK{}, ErrUnknownKey
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type postgresOIDCRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOIDCRepository(db *sql.DB) OIDCRepository {
+	return &postgresOIDCRepository{db: db}
+}
+
+func (r *postgresOIDCRepository) CreateState(ctx context.Context, st OIDCState) error {
+	// Abandoned logins are cleaned up as new ones start.
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO oidc_states (state_hash, provider, nonce_hash, code_verifier, expires_at)
+         VALUES ($1, $2, $3, $4, $5)`,
+		st.StateHash, st.Provider, st.NonceHash, st.CodeVerifier, st.ExpiresAt,
+	)
+	return err
+}
+
+func (r *postgresOIDCRepository) ConsumeState(ctx context.Context, stateHash string) (OIDCState, error) {
+	var st OIDCState
+	err := r.db.QueryRowContext(ctx,
+		`DELETE FROM oidc_states WHERE state_hash = $1
+         RETURNING state_hash, provider, nonce_hash, code_verifier, expires_at`,
+		stateHash,
+	).Scan(&st.StateHash, &st.Provider, &st.NonceHash, &st.CodeVerifier, &st.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+	return st, err
+}
+
+func (r *postgresOIDCRepository) FindIdentity(ctx context.Context, provider, subject string) (OIDCIdentity, error) {
+	var id OIDCIdentity
+	err := r.db.QueryRowContext(ctx,
+		`SELECT provider, subject, user_id, email, created_at
+         FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject,
+	).Scan(&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return OIDCIdentity{}, ErrUserNotFound
+	}
+	return id, err
+}
+
+func (r *postgresOIDCRepository) LinkIdentity(ctx context.Context, id OIDCIdentity) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_identities (provider, subject, user_id, email, created_at)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (provider, subject) DO NOTHING`,
+		id.Provider, id.Subject, id.UserID, id.Email, id.CreatedAt,
+	)
+	return err
+}
@@ -0,0 +1,364 @@
+// internal/auth/oidc_test.go
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockClientID     = "calculator"
+	mockClientSecret = "s3cret/+"
+	mockKeyID        = "mock-key"
+)
+
+// fakeOIDCRepo keeps states and identities in memory.
+type fakeOIDCRepo struct {
+	states     map[string]OIDCState
+	identities map[string]OIDCIdentity
+}
+
+func newFakeOIDCRepo() *fakeOIDCRepo {
+	return &fakeOIDCRepo{states: map[string]OIDCState{}, identities: map[string]OIDCIdentity{}}
+}
+
+func (f *fakeOIDCRepo) CreateState(ctx context.Context, st OIDCState) error {
+	f.states[st.StateHash] = st
+	return nil
+}
+
+func (f *fakeOIDCRepo) ConsumeState(ctx context.Context, stateHash string) (OIDCState, error) {
+	st, ok := f.states[stateHash]
+	if !ok {
+		return OIDCState{}, ErrInvalidOIDCState
+	}
+	delete(f.states, stateHash)
+	return st, nil
+}
+
+func (f *fakeOIDCRepo) FindIdentity(ctx context.Context, provider, subject string) (OIDCIdentity, error) {
+	id, ok := f.identities[provider+"|"+subject]
+	if !ok {
+		return OIDCIdentity{}, ErrUserNotFound
+	}
+	return id, nil
+}
+
+func (f *fakeOIDCRepo) LinkIdentity(ctx context.Context, id OIDCIdentity) error {
+	f.identities[id.Provider+"|"+id.Subject] = id
+	return nil
+}
+
+// mockGrant is what the mock provider remembers about an issued code.
+type mockGrant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+// mockOIDCProvider is a minimal OpenID provider: discovery, JWKS and a
+// token endpoint that enforces client authentication and PKCE.
+type mockOIDCProvider struct {
+	*httptest.Server
+	signer crypto.Signer
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	p := &mockOIDCProvider{signer: testRSAKey, grants: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		key := SigningKey{ID: mockKeyID, Alg: AlgRS256, Private: testRSAKey}
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{publicJWK(key)}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize stands in for the user logging in at the provider: it issues
+// a code for the request in authURL, with the given ID token claims on
+// top of the defaults.
+func (p *mockOIDCProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+	require.Equal(t, p.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	require.Equal(t, "code", q.Get("response_type"))
+	require.Equal(t, mockClientID, q.Get("client_id"))
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+	require.Equal(t, "openid email profile", q.Get("scope"))
+
+	now := time.Now()
+	all := jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            mockClientID,
+		"sub":            "subject-1",
+		"email":          "oidc@example.com",
+		"email_verified": true,
+		"nonce":          q.Get("nonce"),
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+		} else {
+			all[k] = v
+		}
+	}
+
+	code, err := newOpaqueToken()
+	require.NoError(t, err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants[code] = mockGrant{challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: all}
+	return code
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != mockClientID || secret != mockClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostFormValue("code")]
+	delete(p.grants, r.PostFormValue("code"))
+	p.mu.Unlock()
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != grant.redirectURI ||
+		pkceChallenge(r.PostFormValue("code_verifier")) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = mockKeyID
+	idToken, err := token.SignedString(p.signer)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+type oidcFixture struct {
+	svc      OIDCService
+	repo     *fakeOIDCRepo
+	users    *fakeUserRepo
+	provider *mockOIDCProvider
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	provider := newMockOIDCProvider(t)
+	repo := newFakeOIDCRepo()
+	users := &fakeUserRepo{}
+	svc := NewOIDCService(repo, users, &fakeHasher{}, OIDCConfig{
+		Providers: []OIDCProviderConfig{{
+			Name:         "mock",
+			Issuer:       provider.URL,
+			ClientID:     mockClientID,
+			ClientSecret: mockClientSecret,
+			RedirectURL:  "http://localhost:8080/api/v1/auth/oidc/mock/callback",
+		}},
+		HTTPClient: provider.Client(),
+	})
+	return &oidcFixture{svc: svc, repo: repo, users: users, provider: provider}
+}
+
+// login runs a whole sign-in, with claims overriding the ID token's.
+func (f *oidcFixture) login(t *testing.T, claims jwt.MapClaims) (*User, error) {
+	t.Helper()
+	authURL, state, err := f.svc.Start(context.Background(), "mock")
+	require.NoError(t, err)
+	code := f.provider.authorize(t, authURL, claims)
+	return f.svc.Complete(context.Background(), "mock", state, code)
+}
+
+// TestOIDC_CreatesVerifiedUser
+// ----
+// The first sign-in with an unknown address creates a verified account
+// and links the subject; the next one finds it through the link.
+func TestOIDC_CreatesVerifiedUser(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	user, err := f.login(t, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "oidc@example.com", user.Email)
+	assert.True(t, user.EmailVerified)
+	require.Len(t, f.users.createdUsers, 1)
+	assert.True(t, f.users.createdUsers[0].EmailVerified)
+	assert.Equal(t, user.ID, f.repo.identities["mock|subject-1"].UserID)
+
+	// The provider address may change; the subject stays linked.
+	again, err := f.login(t, jwt.MapClaims{"email": "renamed@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Len(t, f.users.createdUsers, 1)
+}
+
+// TestOIDC_LinksVerifiedAccount
+// ----
+// A provider address matching a verified account signs into that account.
+func TestOIDC_LinksVerifiedAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.users.createdUsers = []User{{ID: "existing", Email: "oidc@example.com", EmailVerified: true}}
+
+	user, err := f.login(t, jwt.MapClaims{"email_verified": "true"})
+	require.NoError(t, err)
+	assert.Equal(t, "existing", user.ID)
+	assert.Len(t, f.users.createdUsers, 1)
+	assert.Equal(t, "existing", f.repo.identities["mock|subject-1"].UserID)
+}
+
+// TestOIDC_RefusesUnverifiedAddresses
+// ----
+// Nothing is linked when the provider has not verified the address, or
+// when the matching account never verified it.
+func TestOIDC_RefusesUnverifiedAddresses(t *testing.T) {
+	f := newOIDCFixture(t)
+	_, err := f.login(t, jwt.MapClaims{"email_verified": false})
+	assert.ErrorIs(t, err, ErrOIDCEmailUnverified)
+
+	f.users.createdUsers = []User{{ID: "squatter", Email: "oidc@example.com"}}
+	_, err = f.login(t, nil)
+	assert.ErrorIs(t, err, ErrOIDCAccountUnverified)
+	assert.Empty(t, f.repo.identities)
+}
+
+// TestOIDC_StateIsSingleUse
+// ----
+// A state can complete one login only, and only for its own provider.
+func TestOIDC_StateIsSingleUse(t *testing.T) {
+	f := newOIDCFixture(t)
+	ctx := context.Background()
+
+	authURL, state, err := f.svc.Start(ctx, "mock")
+	require.NoError(t, err)
+	code := f.provider.authorize(t, authURL, nil)
+	_, err = f.svc.Complete(ctx, "mock", state, code)
+	require.NoError(t, err)
+
+	_, err = f.svc.Complete(ctx, "mock", state, code)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	_, err = f.svc.Complete(ctx, "mock", "made-up", code)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	_, err = f.svc.Complete(ctx, "other", state, code)
+	assert.ErrorIs(t, err, ErrUnknownOIDCProvider)
+}
+
+// TestOIDC_ExpiredState
+// ----
+// Logins that take longer than the state TTL are refused.
+func TestOIDC_ExpiredState(t *testing.T) {
+	f := newOIDCFixture(t)
+	svc := f.svc.(*oidcService)
+
+	authURL, state, err := svc.Start(context.Background(), "mock")
+	require.NoError(t, err)
+	code := f.provider.authorize(t, authURL, nil)
+
+	svc.now = func() time.Time { return time.Now().Add(DefaultOIDCStateTTL + time.Second) }
+	_, err = svc.Complete(context.Background(), "mock", state, code)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+}
+
+// TestOIDC_RejectsBadIDTokens
+// ----
+// ID tokens for another client, from another issuer, expired, without
+// the login's nonce, or without a subject are rejected.
+func TestOIDC_RejectsBadIDTokens(t *testing.T) {
+	cases := map[string]jwt.MapClaims{
+		"audience":     {"aud": "someone-else"},
+		"azp":          {"aud": []string{mockClientID, "someone-else"}, "azp": "someone-else"},
+		"issuer":       {"iss": "https://evil.example.com"},
+		"expired":      {"exp": time.Now().Add(-time.Hour).Unix()},
+		"no expiry":    {"exp": nil},
+		"nonce":        {"nonce": "replayed"},
+		"no subject":   {"sub": nil},
+		"future issue": {"iat": time.Now().Add(time.Hour).Unix()},
+	}
+	for name, claims := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+			_, err := f.login(t, claims)
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+			assert.Empty(t, f.users.createdUsers)
+		})
+	}
+}
+
+// TestOIDC_RejectsForeignSignature
+// ----
+// An ID token must verify against the provider's published keys.
+func TestOIDC_RejectsForeignSignature(t *testing.T) {
+	f := newOIDCFixture(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f.provider.signer = other
+
+	_, err = f.login(t, nil)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+// TestOIDC_PKCE
+// ----
+// The code is only redeemed with the verifier of the login that started
+// it; the mock provider enforces the challenge.
+func TestOIDC_PKCE(t *testing.T) {
+	f := newOIDCFixture(t)
+	ctx := context.Background()
+
+	authURL, state, err := f.svc.Start(ctx, "mock")
+	require.NoError(t, err)
+	code := f.provider.authorize(t, authURL, nil)
+
+	st := f.repo.states[hashToken(state)]
+	st.CodeVerifier = "intercepted-" + st.CodeVerifier
+	f.repo.states[hashToken(state)] = st
+
+	_, err = f.svc.Complete(ctx, "mock", state, code)
+	assert.ErrorIs(t, err, ErrOIDCCodeExchange)
+}
+
+// TestOIDC_UnknownProvider
+// ----
+// Only configured providers can be used.
+func TestOIDC_UnknownProvider(t *testing.T) {
+	f := newOIDCFixture(t)
+	assert.Equal(t, []string{"mock"}, f.svc.Providers())
+
+	_, _, err := f.svc.Start(context.Background(), "nope")
+	assert.ErrorIs(t, err, ErrUnknownOIDCProvider)
+}
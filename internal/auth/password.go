@@ -1,27 +1,279 @@
 // internal/auth/password.go
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnsupportedHash is returned by CheckPassword for a hash in a format
+// the hasher does not produce.
+var ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+// Stored hashes start with their format, so hashes of several algorithms
+// can sit side by side in users.password.
+const (
+	argon2idPrefix = "$argon2id$"
+	bcryptPrefix   = "$2"
+)
 
 type PasswordHasher interface {
-	HashPassword(password string) (string, error)
-	CheckPassword(hash, password string) error
+	HashPassword(ctx context.Context, password string) (string, error)
+	CheckPassword(ctx context.Context, hash, password string) error
+	// NeedsRehash reports whether hash was made by another algorithm or
+	// with weaker parameters than HashPassword now uses.
+	NeedsRehash(hash string) bool
 }
 
-type bcryptPasswordHasher struct{}
+type bcryptPasswordHasher struct {
+	cost int
+}
 
-func NewBcryptPasswordHasher() PasswordHasher {
-	return &bcryptPasswordHasher{}
+// NewBcryptPasswordHasher hashes with bcrypt at cost, or at
+// bcrypt.DefaultCost when cost is 0.
+func NewBcryptPasswordHasher(cost int) PasswordHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptPasswordHasher{cost: cost}
 }
 
-func (b *bcryptPasswordHasher) HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (b *bcryptPasswordHasher) HashPassword(ctx context.Context, password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
 
-func (b *bcryptPasswordHasher) CheckPassword(hash, password string) error {
+func (b *bcryptPasswordHasher) CheckPassword(ctx context.Context, hash, password string) error {
+	if !strings.HasPrefix(hash, bcryptPrefix) {
+		return ErrUnsupportedHash
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
+
+func (b *bcryptPasswordHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < b.cost
+}
+
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2Params are OWASP's minimum recommendation: 19 MiB, two
+// passes, one lane. Use TuneArgon2id to pick stronger ones for the
+// hardware.
+var DefaultArgon2Params = Argon2Params{Memory: 19 * 1024, Time: 2, Threads: 1}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+type argon2idPasswordHasher struct {
+	params Argon2Params
+}
+
+// NewArgon2idPasswordHasher hashes with Argon2id and stores hashes in the
+// PHC string format, $argon2id$v=19$m=...,t=...,p=...$salt$key, so
+// old hashes keep verifying after the parameters change.
+func NewArgon2idPasswordHasher(params Argon2Params) (PasswordHasher, error) {
+	if params.Memory < 8*uint32(params.Threads) || params.Time < 1 || params.Threads < 1 {
+		return nil, fmt.Errorf("invalid argon2id parameters %+v", params)
+	}
+	return &argon2idPasswordHasher{params: params}, nil
+}
+
+func (a *argon2idPasswordHasher) HashPassword(ctx context.Context, password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.params.Time, a.params.Memory, a.params.Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.params.Memory, a.params.Time, a.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2idPasswordHasher) CheckPassword(ctx context.Context, hash, password string) error {
+	params, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+	got := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (a *argon2idPasswordHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := parseArgon2idHash(hash)
+	return err != nil || params.Memory < a.params.Memory || params.Time < a.params.Time ||
+		params.Threads < a.params.Threads
+}
+
+func parseArgon2idHash(hash string) (Argon2Params, []byte, []byte, error) {
+	rest, ok := strings.CutPrefix(hash, argon2idPrefix)
+	if !ok {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	parts := strings.Split(rest, "$")
+	if len(parts) != 4 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil ||
+		p.Time < 1 || p.Threads < 1 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	return p, salt, key, nil
+}
+
+type upgradingPasswordHasher struct {
+	current PasswordHasher
+	legacy  []PasswordHasher
+}
+
+// NewUpgradingPasswordHasher hashes with current and also checks hashes
+// made by the legacy hashers. Their hashes, and current's own hashes
+// made with older parameters, report NeedsRehash, so logins move users
+// onto the current algorithm.
+func NewUpgradingPasswordHasher(current PasswordHasher, legacy ...PasswordHasher) PasswordHasher {
+	return &upgradingPasswordHasher{current: current, legacy: legacy}
+}
+
+func (u *upgradingPasswordHasher) HashPassword(ctx context.Context, password string) (string, error) {
+	return u.current.HashPassword(ctx, password)
+}
+
+func (u *upgradingPasswordHasher) CheckPassword(ctx context.Context, hash, password string) error {
+	err := u.current.CheckPassword(ctx, hash, password)
+	for _, h := range u.legacy {
+		if !errors.Is(err, ErrUnsupportedHash) {
+			break
+		}
+		err = h.CheckPassword(ctx, hash, password)
+	}
+	return err
+}
+
+func (u *upgradingPasswordHasher) NeedsRehash(hash string) bool {
+	return u.current.NeedsRehash(hash)
+}
+
+type limitedPasswordHasher struct {
+	next  PasswordHasher
+	slots chan struct{}
+}
+
+// NewLimitedPasswordHasher lets at most n hashes or checks through next
+// run at once; the others wait until a slot frees up or their context
+// ends. Each Argon2id run holds its full memory cost (19 MiB by default),
+// so a burst of logins could otherwise exhaust the server's memory.
+func NewLimitedPasswordHasher(next PasswordHasher, n int) PasswordHasher {
+	if n < 1 {
+		n = 1
+	}
+	return &limitedPasswordHasher{next: next, slots: make(chan struct{}, n)}
+}
+
+func (l *limitedPasswordHasher) HashPassword(ctx context.Context, password string) (string, error) {
+	if err := l.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer l.release()
+	return l.next.HashPassword(ctx, password)
+}
+
+func (l *limitedPasswordHasher) CheckPassword(ctx context.Context, hash, password string) error {
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	defer l.release()
+	return l.next.CheckPassword(ctx, hash, password)
+}
+
+// acquire waits for a free slot, or until the request is abandoned, so a
+// client that gave up does not still get a hash run.
+func (l *limitedPasswordHasher) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *limitedPasswordHasher) release() {
+	<-l.slots
+}
+
+func (l *limitedPasswordHasher) NeedsRehash(hash string) bool {
+	return l.next.NeedsRehash(hash)
+}
+
+// TimePasswordHash returns the average time h takes to hash a password
+// over n runs.
+func TimePasswordHash(h PasswordHasher, n int) (time.Duration, error) {
+	if n < 1 {
+		n = 1
+	}
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := h.HashPassword(context.Background(), "correct horse battery staple"); err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start) / time.Duration(n), nil
+}
+
+// TuneArgon2id finds Argon2id parameters for this machine: with the
+// given memory and threads, the number of passes is raised until one
+// hash takes at least target. It returns the parameters and their
+// measured cost.
+func TuneArgon2id(target time.Duration, memory uint32, threads uint8) (Argon2Params, time.Duration, error) {
+	params := Argon2Params{Memory: memory, Time: 1, Threads: threads}
+	for {
+		h, err := NewArgon2idPasswordHasher(params)
+		if err != nil {
+			return Argon2Params{}, 0, err
+		}
+		took, err := TimePasswordHash(h, 3)
+		if err != nil {
+			return Argon2Params{}, 0, err
+		}
+		if took >= target || params.Time >= 100 {
+			return params, took, nil
+		}
+		params.Time++
+	}
+}
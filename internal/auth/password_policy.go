@@ -0,0 +1,529 @@
+// internal/auth/password_policy.go
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password rule violations. The policy returns them wrapped in a
+// *PasswordPolicyError whose message states the configured limit.
+var (
+	ErrPasswordTooLong       = errors.New("password is too long")
+	ErrPasswordContainsEmail = errors.New("password must not contain your email address")
+	ErrPasswordGuessable     = errors.New("password is too easy to guess")
+	ErrPasswordBreached      = errors.New("password appears in a list of breached passwords")
+)
+
+// PasswordPolicyError is a password rule violation: Rule is one of the
+// ErrPassword* errors, Message what to tell the user.
+type PasswordPolicyError struct {
+	Rule    error
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string { return e.Message }
+
+func (e *PasswordPolicyError) Unwrap() error { return e.Rule }
+
+// PasswordPolicy decides which new passwords are acceptable.
+type PasswordPolicy interface {
+	// Validate checks a password chosen by the owner of email, which may
+	// be empty when it is not known.
+	Validate(ctx context.Context, password, email string) error
+}
+
+type PasswordPolicyConfig struct {
+	MinLength int
+	MaxLength int
+
+	// Character classes a password must contain.
+	RequireLetter    bool
+	RequireDigit     bool
+	RequireMixedCase bool
+	RequireSymbol    bool
+
+	// DisallowEmail rejects passwords containing the address or its
+	// local part.
+	DisallowEmail bool
+	// MinStrength is the lowest EstimatePasswordStrength score accepted,
+	// 0 (off) to 4.
+	MinStrength int
+}
+
+// DefaultPasswordPolicyConfig keeps the original rules, at least eight
+// characters with a letter and a digit, and rejects the email address.
+var DefaultPasswordPolicyConfig = PasswordPolicyConfig{
+	MinLength:     8,
+	MaxLength:     128,
+	RequireLetter: true,
+	RequireDigit:  true,
+	DisallowEmail: true,
+}
+
+type passwordPolicy struct {
+	cfg      PasswordPolicyConfig
+	breached BreachedPasswords
+}
+
+// NewPasswordPolicy builds a policy from cfg; breached may be nil to skip
+// the breached-password check.
+func NewPasswordPolicy(cfg PasswordPolicyConfig, breached BreachedPasswords) PasswordPolicy {
+	return &passwordPolicy{cfg: cfg, breached: breached}
+}
+
+// DefaultPasswordPolicy applies DefaultPasswordPolicyConfig.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return NewPasswordPolicy(DefaultPasswordPolicyConfig, nil)
+}
+
+func (p *passwordPolicy) Validate(ctx context.Context, password, email string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.cfg.MinLength {
+		return &PasswordPolicyError{
+			Rule:    ErrPasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters", p.cfg.MinLength),
+		}
+	}
+	if p.cfg.MaxLength > 0 && n > p.cfg.MaxLength {
+		return &PasswordPolicyError{
+			Rule:    ErrPasswordTooLong,
+			Message: fmt.Sprintf("password must be at most %d characters", p.cfg.MaxLength),
+		}
+	}
+
+	if required, ok := p.checkClasses(password); !ok {
+		return &PasswordPolicyError{
+			Rule:    ErrPasswordTooWeak,
+			Message: "password must contain at least " + joinAnd(required),
+		}
+	}
+
+	if p.cfg.DisallowEmail && containsEmail(password, email) {
+		return &PasswordPolicyError{Rule: ErrPasswordContainsEmail, Message: ErrPasswordContainsEmail.Error()}
+	}
+
+	if p.cfg.MinStrength > 0 {
+		if score, _ := EstimatePasswordStrength(password, email); score < p.cfg.MinStrength {
+			return &PasswordPolicyError{
+				Rule:    ErrPasswordGuessable,
+				Message: "password is too easy to guess; try a longer phrase of unrelated words",
+			}
+		}
+	}
+
+	if p.breached != nil {
+		found, err := p.breached.Contains(ctx, password)
+		if err != nil {
+			return err
+		}
+		if found {
+			return &PasswordPolicyError{
+				Rule:    ErrPasswordBreached,
+				Message: "password has appeared in a data breach; choose another",
+			}
+		}
+	}
+	return nil
+}
+
+// checkClasses reports whether password has every required character
+// class, and describes the requirement.
+func (p *passwordPolicy) checkClasses(password string) ([]string, bool) {
+	var letter, digit, upper, lower, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+			upper = upper || unicode.IsUpper(r)
+			lower = lower || unicode.IsLower(r)
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	var required []string
+	ok := true
+	for _, c := range []struct {
+		required, present bool
+		desc              string
+	}{
+		{p.cfg.RequireLetter, letter, "one letter"},
+		{p.cfg.RequireDigit, digit, "one digit"},
+		{p.cfg.RequireMixedCase, upper && lower, "one uppercase and one lowercase letter"},
+		{p.cfg.RequireSymbol, symbol, "one symbol"},
+	} {
+		if c.required {
+			required = append(required, c.desc)
+			ok = ok && c.present
+		}
+	}
+	return required, ok
+}
+
+// containsEmail reports whether password contains the address, or its
+// local part when that is long enough to be meaningful.
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	pw := strings.ToLower(password)
+	email = strings.ToLower(email)
+	if strings.Contains(pw, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return utf8.RuneCountInString(local) >= 3 && strings.Contains(pw, local)
+}
+
+func joinAnd(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+// BreachedPasswords looks passwords up in a list of leaked ones.
+type BreachedPasswords interface {
+	Contains(ctx context.Context, password string) (bool, error)
+}
+
+type breachedPasswordDir struct {
+	dir string
+}
+
+// NewBreachedPasswordDir reads a local copy of the Pwned Passwords range
+// files: dir holds one file per five-hex-digit SHA-1 prefix, such as
+// 21BD1.txt, with a SUFFIX:COUNT line per leaked hash (the layout the
+// haveibeenpwned-downloader writes). A lookup reads only its prefix's
+// file, as the k-anonymity range API would return it.
+func NewBreachedPasswordDir(dir string) (BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &breachedPasswordDir{dir: dir}, nil
+}
+
+func (b *breachedPasswordDir) Contains(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		s, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(s, suffix) {
+			continue
+		}
+		// Padding entries, added to blur response sizes, have a count of 0.
+		n, err := strconv.Atoi(count)
+		return err != nil || n > 0, nil
+	}
+	return false, scanner.Err()
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswordRanks maps each common password or word to its rank,
+// most common first.
+var commonPasswordRanks = func() map[string]int {
+	ranks := map[string]int{}
+	for i, w := range strings.Fields(commonPasswordsFile) {
+		if _, ok := ranks[w]; !ok {
+			ranks[w] = i + 1
+		}
+	}
+	return ranks
+}()
+
+const (
+	// maxEstimatedRunes bounds the estimator's work; longer passwords
+	// score on their prefix, which is already unguessable.
+	maxEstimatedRunes = 64
+	// bruteforceCardinality is the guesses charged per character not
+	// covered by a pattern.
+	bruteforceCardinality = 10
+)
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qwertzuiop", "azertyuiop"}
+
+var leetSubstitutions = map[rune][]rune{
+	'4': {'a'}, '@': {'a'}, '3': {'e'}, '1': {'i', 'l'}, '!': {'i'},
+	'0': {'o'}, '$': {'s'}, '5': {'s'}, '7': {'t'}, '+': {'t'},
+}
+
+// EstimatePasswordStrength scores a password like zxcvbn: it finds the
+// cheapest way to build it from common passwords and words (with
+// capitals, reversal and l33t substitutions), the user's own inputs such
+// as their email, sequences, repeats, keyboard runs and dates, charging
+// bruteforce for the rest. It returns the estimated guesses and a score
+// from 0 (under 10^3 guesses) to 4 (10^10 or more).
+func EstimatePasswordStrength(password string, userInputs ...string) (int, float64) {
+	inputs := map[string]bool{}
+	for _, in := range userInputs {
+		in = strings.ToLower(in)
+		if in == "" {
+			continue
+		}
+		inputs[in] = true
+		if local, _, ok := strings.Cut(in, "@"); ok && local != "" {
+			inputs[local] = true
+		}
+	}
+
+	runes := []rune(password)
+	if len(runes) > maxEstimatedRunes {
+		runes = runes[:maxEstimatedRunes]
+	}
+	guesses := estimateGuesses(runes, inputs)
+
+	switch {
+	case guesses < 1e3:
+		return 0, guesses
+	case guesses < 1e6:
+		return 1, guesses
+	case guesses < 1e8:
+		return 2, guesses
+	case guesses < 1e10:
+		return 3, guesses
+	}
+	return 4, guesses
+}
+
+// estimateGuesses returns the fewest guesses over all ways of splitting
+// runes into patterns and bruteforced characters.
+func estimateGuesses(runes []rune, inputs map[string]bool) float64 {
+	n := len(runes)
+	best := make([]float64, n+1)
+	best[0] = 1
+	for j := 1; j <= n; j++ {
+		best[j] = best[j-1] * bruteforceCardinality
+		for i := 0; i+2 < j; i++ {
+			if g := patternGuesses(runes[i:j], inputs); g < math.Inf(1) {
+				best[j] = math.Min(best[j], best[i]*g)
+			}
+		}
+	}
+	return best[n]
+}
+
+// patternGuesses is the cheapest pattern matching all of sub, or +Inf.
+func patternGuesses(sub []rune, inputs map[string]bool) float64 {
+	g := math.Inf(1)
+	g = math.Min(g, dictionaryGuesses(sub, inputs))
+	g = math.Min(g, sequenceGuesses(sub))
+	g = math.Min(g, repeatGuesses(sub, inputs))
+	g = math.Min(g, keyboardGuesses(sub))
+	g = math.Min(g, dateGuesses(sub))
+	return g
+}
+
+func dictionaryGuesses(sub []rune, inputs map[string]bool) float64 {
+	lower := strings.ToLower(string(sub))
+	caseFactor := uppercaseVariations(sub)
+	g := math.Inf(1)
+	for _, v := range unleetVariants(lower) {
+		factor := caseFactor
+		if v != lower {
+			factor *= 2
+		}
+		for _, reversed := range []bool{false, true} {
+			word := v
+			if reversed {
+				word = reverseString(v)
+				factor *= 2
+			}
+			if inputs[word] {
+				g = math.Min(g, factor)
+			}
+			if rank, ok := commonPasswordRanks[word]; ok {
+				g = math.Min(g, float64(rank)*factor)
+			}
+		}
+	}
+	return g
+}
+
+// uppercaseVariations counts the ways of capitalising a word that an
+// attacker would try before reaching sub's.
+func uppercaseVariations(sub []rune) float64 {
+	var upper, lower int
+	for _, r := range sub {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(sub[0]) || unicode.IsUpper(sub[len(sub)-1]))) {
+		return 2
+	}
+	var variations float64
+	for i := 1; i <= min(upper, lower); i++ {
+		variations += binomial(upper+lower, i)
+	}
+	return variations
+}
+
+// unleetVariants returns s with each combination of l33t substitutions
+// undone, s itself first.
+func unleetVariants(s string) []string {
+	variants := []string{""}
+	for _, r := range s {
+		subs := append([]rune{r}, leetSubstitutions[r]...)
+		next := make([]string, 0, len(variants)*len(subs))
+		for _, v := range variants {
+			for _, c := range subs {
+				next = append(next, v+string(c))
+			}
+		}
+		if len(next) > 16 {
+			next = next[:16]
+		}
+		variants = next
+	}
+	return variants
+}
+
+// sequenceGuesses matches runs like abc, 2468 or 987.
+func sequenceGuesses(sub []rune) float64 {
+	delta := sub[1] - sub[0]
+	if delta == 0 || delta > 2 || delta < -2 {
+		return math.Inf(1)
+	}
+	for i := 2; i < len(sub); i++ {
+		if sub[i]-sub[i-1] != delta {
+			return math.Inf(1)
+		}
+	}
+
+	var base float64
+	switch first := unicode.ToLower(sub[0]); {
+	case strings.ContainsRune("az019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return base * float64(len(sub))
+}
+
+// repeatGuesses matches a block repeated, like aaa or abcabc.
+func repeatGuesses(sub []rune, inputs map[string]bool) float64 {
+	for period := 1; period <= len(sub)/2; period++ {
+		if len(sub)%period != 0 {
+			continue
+		}
+		repeated := true
+		for i := period; i < len(sub); i++ {
+			if sub[i] != sub[i-period] {
+				repeated = false
+				break
+			}
+		}
+		if repeated {
+			return estimateGuesses(sub[:period], inputs) * float64(len(sub)/period)
+		}
+	}
+	return math.Inf(1)
+}
+
+// keyboardGuesses matches runs along a keyboard row, like asdf or poiu.
+func keyboardGuesses(sub []rune) float64 {
+	if len(sub) < 4 {
+		return math.Inf(1)
+	}
+	lower := strings.ToLower(string(sub))
+	for _, row := range keyboardRows {
+		if strings.Contains(row, lower) || strings.Contains(reverseString(row), lower) {
+			return 40 * float64(len(sub))
+		}
+	}
+	return math.Inf(1)
+}
+
+// dateGuesses matches years (1987) and all-digit dates (31121999,
+// 19991231, 311299).
+func dateGuesses(sub []rune) float64 {
+	s := string(sub)
+	for _, r := range sub {
+		if r < '0' || r > '9' {
+			return math.Inf(1)
+		}
+	}
+
+	thisYear := time.Now().Year()
+	yearSpace := func(year int) float64 {
+		return math.Max(math.Abs(float64(year-thisYear)), 20)
+	}
+	switch len(s) {
+	case 4:
+		if year, _ := strconv.Atoi(s); year >= 1900 && year <= 2099 {
+			return yearSpace(year)
+		}
+	case 6, 8:
+		for _, layout := range []string{"020106", "010206", "02012006", "01022006", "20060102"} {
+			if len(layout) != len(s) {
+				continue
+			}
+			if t, err := time.Parse(layout, s); err == nil {
+				return 365 * yearSpace(t.Year())
+			}
+		}
+	}
+	return math.Inf(1)
+}
+
+func reverseString(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
@@ -0,0 +1,172 @@
+// internal/auth/password_policy_test.go
+package auth
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBreachedPasswords writes a range file per prefix for the given
+// passwords, plus a padding entry, and returns the directory.
+func writeBreachedPasswords(t *testing.T, passwords ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, pw := range passwords {
+		sum := sha1.Sum([]byte(pw))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		path := filepath.Join(dir, hash[:5]+".txt")
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = f.WriteString("0000000000000000000000000000000000A:0\r\n" + hash[5:] + ":42\r\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	return dir
+}
+
+// TestPasswordPolicy_Rules
+// ------------------------
+// Each rule fails with its own error, and length and character class
+// messages state the configured limits.
+func TestPasswordPolicy_Rules(t *testing.T) {
+	breached, err := NewBreachedPasswordDir(writeBreachedPasswords(t, "Leaked-Pass-42"))
+	require.NoError(t, err)
+	policy := NewPasswordPolicy(PasswordPolicyConfig{
+		MinLength:        10,
+		MaxLength:        20,
+		RequireLetter:    true,
+		RequireDigit:     true,
+		RequireMixedCase: true,
+		RequireSymbol:    true,
+		DisallowEmail:    true,
+		MinStrength:      3,
+	}, breached)
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+		message  string
+	}{
+		{"too short", "Ab1!", ErrPasswordTooShort, "password must be at least 10 characters"},
+		{"too long", "Abcdefghij-123456789x", ErrPasswordTooLong, "password must be at most 20 characters"},
+		{"no digit", "Abcdefghij-k", ErrPasswordTooWeak, "password must contain at least one letter, one digit, one uppercase and one lowercase letter and one symbol"},
+		{"one case", "abcdefgh-123", ErrPasswordTooWeak, ""},
+		{"no symbol", "Abcdefgh1234", ErrPasswordTooWeak, ""},
+		{"local part", "x-Jane.Doe-77", ErrPasswordContainsEmail, ""},
+		{"guessable", "Password-1234", ErrPasswordGuessable, ""},
+		{"breached", "Leaked-Pass-42", ErrPasswordBreached, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(context.Background(), tt.password, "jane.doe@example.com")
+			require.ErrorIs(t, err, tt.want)
+			if tt.message != "" {
+				assert.EqualError(t, err, tt.message)
+			}
+			msg, ok := passwordMessage(err)
+			assert.True(t, ok)
+			assert.Equal(t, err.Error(), msg)
+		})
+	}
+
+	assert.NoError(t, policy.Validate(context.Background(), "Violet-Harbor-27", "jane.doe@example.com"))
+}
+
+// TestPasswordPolicy_Default
+// --------------------------
+// The default policy keeps the original rules and messages and rejects
+// the email address, but does not judge strength.
+func TestPasswordPolicy_Default(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	ctx := context.Background()
+
+	err := policy.Validate(ctx, "Abc123", "")
+	assert.ErrorIs(t, err, ErrPasswordTooShort)
+	assert.EqualError(t, err, "password must be at least 8 characters")
+	err = policy.Validate(ctx, "OnlyLetters", "")
+	assert.ErrorIs(t, err, ErrPasswordTooWeak)
+	assert.EqualError(t, err, "password must contain at least one letter and one digit")
+
+	assert.ErrorIs(t, policy.Validate(ctx, "bob@example.com1", "bob@example.com"), ErrPasswordContainsEmail)
+	assert.NoError(t, policy.Validate(ctx, "Password123", "bob@example.com"), "a two-letter local part is not checked")
+	assert.NoError(t, policy.Validate(ctx, "Password123", ""))
+}
+
+// TestSignUp_PolicyErrors
+// -----------------------
+// SignUp checks the password against the account's own address.
+func TestSignUp_PolicyErrors(t *testing.T) {
+	repo := &fakeUserRepo{}
+	svc := NewAuthService(repo, &fakeHasher{}, DefaultPasswordPolicy())
+
+	err := svc.SignUp(context.Background(), "walter@example.com", "walter2024")
+	assert.ErrorIs(t, err, ErrPasswordContainsEmail)
+	assert.Empty(t, repo.createdUsers)
+}
+
+// TestEstimatePasswordStrength
+// ----------------------------
+// Common passwords and their usual disguises score low; long unrelated
+// words and random strings score high.
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+	}{
+		{"password", 0, 0},
+		{"Password123", 0, 0},
+		{"P@ssw0rd", 0, 0},
+		{"drowssap", 0, 0},
+		{"qwerty", 0, 0},
+		{"asdfghjkl", 0, 0},
+		{"abcdefgh", 0, 0},
+		{"aaaaaaaa", 0, 0},
+		{"abcabcabcabc", 0, 0},
+		{"jane.doe99", 0, 0},
+		{"31121990", 1, 1},
+		{"correcthorsebatterystaple", 3, 3},
+		{"x7#kQp2!vL9z", 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			score, guesses := EstimatePasswordStrength(tt.password, "jane.doe@example.com")
+			assert.GreaterOrEqual(t, score, tt.minScore, "guesses %g", guesses)
+			assert.LessOrEqual(t, score, tt.maxScore, "guesses %g", guesses)
+		})
+	}
+
+	long := strings.Repeat("Zq8#", 100)
+	score, _ := EstimatePasswordStrength(long)
+	assert.LessOrEqual(t, score, 1, "repeats are cheap however long")
+}
+
+// TestBreachedPasswordDir
+// -----------------------
+// Lookups match full hashes within the prefix file, ignore padding
+// entries, and treat a missing prefix file as not breached.
+func TestBreachedPasswordDir(t *testing.T) {
+	dir := writeBreachedPasswords(t, "hunter2")
+	list, err := NewBreachedPasswordDir(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	found, err := list.Contains(ctx, "hunter2")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = list.Contains(ctx, "hunter3")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = NewBreachedPasswordDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,271 @@
+// internal/auth/password_reset.go
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// DefaultPasswordResetTTL is how long a reset link stays valid.
+const DefaultPasswordResetTTL = time.Hour
+
+// PasswordResetToken is a stored reset token; like refresh tokens only
+// the SHA-256 of the token is kept.
+type PasswordResetToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token PasswordResetToken) error
+	// FindByHash returns ErrInvalidResetToken for unknown hashes.
+	FindByHash(ctx context.Context, hash string) (PasswordResetToken, error)
+	// MarkUsed reports false if the token was already used.
+	MarkUsed(ctx context.Context, id string, at time.Time) (bool, error)
+	// InvalidateUser marks all of the user's unused tokens as used.
+	InvalidateUser(ctx context.Context, userID string, at time.Time) error
+}
+
+type PasswordResetConfig struct {
+	TTL time.Duration
+	// ResetURL is the page that accepts the token; it is sent as
+	// ResetURL?token=<token>.
+	ResetURL string
+}
+
+type PasswordService interface {
+	// Change sets a new password after checking the current one, and ends
+	// every other session of the user.
+	Change(ctx context.Context, userID, sessionID, current, next string) error
+	// RequestReset mails a reset link. Unknown emails succeed silently so
+	// the endpoint does not reveal which addresses have accounts.
+	RequestReset(ctx context.Context, email string) error
+	// Reset sets a new password with a reset token, logs the user out
+	// everywhere and lifts a login lockout.
+	Reset(ctx context.Context, token, next string) error
+}
+
+type passwordService struct {
+	users       UserRepository
+	resets      PasswordResetRepository
+	hasher      PasswordHasher
+	policy      PasswordPolicy
+	mailer      mail.Mailer
+	sessions    SessionService
+	revocations RevocationService
+	guard       LoginGuard
+	cfg         PasswordResetConfig
+	now         func() time.Time
+}
+
+func NewPasswordService(
+	users UserRepository,
+	resets PasswordResetRepository,
+	hasher PasswordHasher,
+	policy PasswordPolicy,
+	mailer mail.Mailer,
+	sessions SessionService,
+	revocations RevocationService,
+	guard LoginGuard,
+	cfg PasswordResetConfig,
+) PasswordService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultPasswordResetTTL
+	}
+	return &passwordService{
+		users:       users,
+		resets:      resets,
+		hasher:      hasher,
+		policy:      policy,
+		mailer:      mailer,
+		sessions:    sessions,
+		revocations: revocations,
+		guard:       guard,
+		cfg:         cfg,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *passwordService) Change(ctx context.Context, userID, sessionID, current, next string) error {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.hasher.CheckPassword(ctx, user.Password, current); err != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.setPassword(ctx, user, next); err != nil {
+		return err
+	}
+	return s.sessions.RevokeOthers(ctx, userID, sessionID)
+}
+
+func (s *passwordService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	// Only the newest link works.
+	if err := s.resets.InvalidateUser(ctx, user.ID, now); err != nil {
+		return err
+	}
+	err = s.resets.Create(ctx, PasswordResetToken{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.ResetURL + "?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your calculator account.\n\n"+
+			"Open this link within %s to choose a new one:\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password has not changed.\n",
+			s.cfg.TTL, link),
+	})
+	// An error here would only ever happen for existing accounts.
+	if err != nil {
+		log.Printf("send password reset email: %v", err)
+	}
+	return nil
+}
+
+func (s *passwordService) Reset(ctx context.Context, token, next string) error {
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+	stored, err := s.resets.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if stored.UsedAt != nil || !now.Before(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	user, err := s.users.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return err
+	}
+	// Check the new password before spending the token.
+	if err := s.policy.Validate(ctx, next, user.Email); err != nil {
+		return err
+	}
+	ok, err := s.resets.MarkUsed(ctx, stored.ID, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(ctx, user, next); err != nil {
+		return err
+	}
+	if err := s.revocations.RevokeAll(ctx, stored.UserID); err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeAll(ctx, stored.UserID); err != nil {
+		return err
+	}
+	return s.guard.Unlock(ctx, user.Email, "password-reset")
+}
+
+func (s *passwordService) setPassword(ctx context.Context, user User, password string) error {
+	if err := s.policy.Validate(ctx, password, user.Email); err != nil {
+		return err
+	}
+	hash, err := s.hasher.HashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+	return s.users.UpdatePassword(ctx, user.ID, hash)
+}
+
+type postgresPasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresPasswordResetRepository(db *sql.DB) PasswordResetRepository {
+	return &postgresPasswordResetRepository{db: db}
+}
+
+func (r *postgresPasswordResetRepository) Create(ctx context.Context, t PasswordResetToken) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at)
+         VALUES ($1, $2, $3, $4, $5)`,
+		t.ID, t.UserID, t.TokenHash, t.CreatedAt, t.ExpiresAt,
+	)
+	return err
+}
+
+func (r *postgresPasswordResetRepository) FindByHash(ctx context.Context, hash string) (PasswordResetToken, error) {
+	var t PasswordResetToken
+	var usedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, token_hash, created_at, expires_at, used_at
+         FROM password_reset_tokens WHERE token_hash = $1`,
+		hash,
+	).Scan(&t.ID, &t.UserID, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PasswordResetToken{}, ErrInvalidResetToken
+		}
+		return PasswordResetToken{}, err
+	}
+	if usedAt.Valid {
+		t.UsedAt = &usedAt.Time
+	}
+	return t, nil
+}
+
+func (r *postgresPasswordResetRepository) MarkUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE password_reset_tokens SET used_at = $2 WHERE id = $1 AND used_at IS NULL`,
+		id, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresPasswordResetRepository) InvalidateUser(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE password_reset_tokens SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`,
+		userID, at,
+	)
+	return err
+}
@@ -0,0 +1,199 @@
+// internal/auth/password_reset_test.go
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+)
+
+// fakeResetRepo keeps reset tokens in memory, keyed by hash.
+type fakeResetRepo struct {
+	tokens map[string]*PasswordResetToken
+}
+
+func (f *fakeResetRepo) Create(ctx context.Context, t PasswordResetToken) error {
+	f.tokens[t.TokenHash] = &t
+	return nil
+}
+
+func (f *fakeResetRepo) FindByHash(ctx context.Context, hash string) (PasswordResetToken, error) {
+	t, ok := f.tokens[hash]
+	if !ok {
+		return PasswordResetToken{}, ErrInvalidResetToken
+	}
+	return *t, nil
+}
+
+func (f *fakeResetRepo) MarkUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	for _, t := range f.tokens {
+		if t.ID == id && t.UsedAt == nil {
+			t.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeResetRepo) InvalidateUser(ctx context.Context, userID string, at time.Time) error {
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.UsedAt == nil {
+			t.UsedAt = &at
+		}
+	}
+	return nil
+}
+
+type passwordFixture struct {
+	svc      *passwordService
+	users    *fakeUserRepo
+	sessions SessionService
+	guard    LoginGuard
+	outbox   *bytes.Buffer
+}
+
+func newPasswordFixture(t *testing.T) *passwordFixture {
+	t.Helper()
+	users := &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Password: "HASHED:OldPassword1"}}}
+	sessions := NewSessionService(newFakeSessionRepo(), time.Hour, time.Minute)
+	revocations := NewRevocationService(newFakeRevocationRepo(), time.Minute)
+	guard := NewLoginGuard(newFakeLoginAttemptRepo(), LockoutConfig{})
+	outbox := &bytes.Buffer{}
+	svc := NewPasswordService(users, &fakeResetRepo{tokens: map[string]*PasswordResetToken{}}, &fakeHasher{}, DefaultPasswordPolicy(),
+		mail.NewLogMailer(outbox, "calc@example.com"), sessions, revocations, guard,
+		PasswordResetConfig{ResetURL: "https://calc.example.com/reset-password"})
+	return &passwordFixture{svc: svc.(*passwordService), users: users, sessions: sessions, guard: guard, outbox: outbox}
+}
+
+var resetLink = regexp.MustCompile(`reset-password\?token=([A-Za-z0-9_-]+)`)
+
+// mailedToken returns the token from the last reset email.
+func (f *passwordFixture) mailedToken(t *testing.T) string {
+	t.Helper()
+	all := resetLink.FindAllStringSubmatch(f.outbox.String(), -1)
+	require.NotEmpty(t, all, "no reset link was mailed")
+	return all[len(all)-1][1]
+}
+
+// TestChangePassword
+// ------------------
+// The current password must match; other sessions end, the caller's stays.
+func TestChangePassword(t *testing.T) {
+	f := newPasswordFixture(t)
+	ctx := context.Background()
+
+	current, err := f.sessions.Start(ctx, "user-1", "laptop", "10.0.0.1")
+	require.NoError(t, err)
+	other, err := f.sessions.Start(ctx, "user-1", "phone", "10.0.0.2")
+	require.NoError(t, err)
+
+	err = f.svc.Change(ctx, "user-1", current.ID, "WrongPassword1", "NewPassword1")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	err = f.svc.Change(ctx, "user-1", current.ID, "OldPassword1", "short")
+	assert.ErrorIs(t, err, ErrPasswordTooShort)
+
+	require.NoError(t, f.svc.Change(ctx, "user-1", current.ID, "OldPassword1", "NewPassword1"))
+	assert.Equal(t, "HASHED:NewPassword1", f.users.createdUsers[0].Password)
+
+	assert.NoError(t, f.sessions.Check(ctx, &TokenClaims{UserID: "user-1", SessionID: current.ID}))
+	assert.ErrorIs(t, f.sessions.Check(ctx, &TokenClaims{UserID: "user-1", SessionID: other.ID}), ErrSessionRevoked)
+}
+
+// TestResetPassword_SingleUse
+// ---------------------------
+// The mailed token sets a new password once, and logs out every session.
+func TestResetPassword_SingleUse(t *testing.T) {
+	f := newPasswordFixture(t)
+	ctx := context.Background()
+
+	s, err := f.sessions.Start(ctx, "user-1", "laptop", "10.0.0.1")
+	require.NoError(t, err)
+
+	require.NoError(t, f.svc.RequestReset(ctx, "a@example.com"))
+	assert.Contains(t, f.outbox.String(), "To: a@example.com")
+	token := f.mailedToken(t)
+
+	// A weak password does not spend the token.
+	assert.ErrorIs(t, f.svc.Reset(ctx, token, "lettersonly"), ErrPasswordTooWeak)
+
+	require.NoError(t, f.svc.Reset(ctx, token, "NewPassword1"))
+	assert.Equal(t, "HASHED:NewPassword1", f.users.createdUsers[0].Password)
+	assert.ErrorIs(t, f.sessions.Check(ctx, &TokenClaims{UserID: "user-1", SessionID: s.ID}), ErrSessionRevoked)
+
+	assert.ErrorIs(t, f.svc.Reset(ctx, token, "OtherPassword1"), ErrInvalidResetToken)
+}
+
+// TestResetPassword_Unlocks
+// -------------------------
+// Resetting the password lifts a login lockout of the account.
+func TestResetPassword_Unlocks(t *testing.T) {
+	f := newPasswordFixture(t)
+	ctx := context.Background()
+
+	for i := 0; i < DefaultLockoutThreshold; i++ {
+		require.NoError(t, f.guard.Fail(ctx, "a@example.com", ""))
+	}
+	_, err := f.guard.Check(ctx, "a@example.com", "")
+	require.ErrorIs(t, err, ErrLoginThrottled)
+
+	require.NoError(t, f.svc.RequestReset(ctx, "a@example.com"))
+	require.NoError(t, f.svc.Reset(ctx, f.mailedToken(t), "NewPassword1"))
+
+	_, err = f.guard.Check(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+}
+
+// TestResetPassword_ExpiredOrSuperseded
+// -------------------------------------
+// Tokens expire, and requesting a new link invalidates the previous one.
+func TestResetPassword_ExpiredOrSuperseded(t *testing.T) {
+	f := newPasswordFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, f.svc.RequestReset(ctx, "a@example.com"))
+	first := f.mailedToken(t)
+	require.NoError(t, f.svc.RequestReset(ctx, "a@example.com"))
+	second := f.mailedToken(t)
+
+	assert.ErrorIs(t, f.svc.Reset(ctx, first, "NewPassword1"), ErrInvalidResetToken)
+
+	f.svc.now = func() time.Time { return time.Now().UTC().Add(2 * time.Hour) }
+	assert.ErrorIs(t, f.svc.Reset(ctx, second, "NewPassword1"), ErrInvalidResetToken)
+}
+
+// TestRequestReset_UnknownEmail
+// -----------------------------
+// Unknown addresses succeed without sending anything.
+func TestRequestReset_UnknownEmail(t *testing.T) {
+	f := newPasswordFixture(t)
+
+	require.NoError(t, f.svc.RequestReset(context.Background(), "nobody@example.com"))
+	assert.Empty(t, f.outbox.String())
+}
+
+// failingMailer refuses every message.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mail.Message) error {
+	return errors.New("mail server unavailable")
+}
+
+// TestRequestReset_MailFailureHidden
+// ----------------------------------
+// A failed send looks like an unknown address, so the response does not
+// tell which addresses have accounts.
+func TestRequestReset_MailFailureHidden(t *testing.T) {
+	f := newPasswordFixture(t)
+	f.svc.mailer = failingMailer{}
+
+	assert.NoError(t, f.svc.RequestReset(context.Background(), "a@example.com"))
+}
@@ -0,0 +1,251 @@
+// internal/auth/password_test.go
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testArgon2Params keep the tests fast; they are far below what a server
+// should use.
+var testArgon2Params = Argon2Params{Memory: 64, Time: 1, Threads: 1}
+
+func newTestArgon2Hasher(t *testing.T, params Argon2Params) PasswordHasher {
+	t.Helper()
+	h, err := NewArgon2idPasswordHasher(params)
+	require.NoError(t, err)
+	return h
+}
+
+// TestArgon2id_HashAndCheck
+// -------------------------
+// Hashes are salted PHC strings that verify the right password only.
+func TestArgon2id_HashAndCheck(t *testing.T) {
+	ctx := context.Background()
+	h := newTestArgon2Hasher(t, testArgon2Params)
+
+	hash, err := h.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+	again, err := h.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again, "salted")
+
+	assert.NoError(t, h.CheckPassword(ctx, hash, "Password123"))
+	assert.ErrorIs(t, h.CheckPassword(ctx, hash, "Password124"), ErrInvalidCredentials)
+	assert.False(t, h.NeedsRehash(hash))
+
+	for _, bad := range []string{"", "plain", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"} {
+		assert.ErrorIs(t, h.CheckPassword(ctx, bad, "Password123"), ErrUnsupportedHash, bad)
+	}
+
+	_, err = NewArgon2idPasswordHasher(Argon2Params{Memory: 64, Time: 0, Threads: 1})
+	assert.Error(t, err)
+}
+
+// TestPasswordHasher_NeedsRehash
+// ------------------------------
+// Hashes from another algorithm or with weaker parameters need a rehash;
+// stronger ones do not.
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	ctx := context.Background()
+	weak := newTestArgon2Hasher(t, testArgon2Params)
+	strong := newTestArgon2Hasher(t, Argon2Params{Memory: 128, Time: 2, Threads: 1})
+	bcryptLow := NewBcryptPasswordHasher(4)
+	bcryptHigh := NewBcryptPasswordHasher(5)
+
+	weakHash, err := weak.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	strongHash, err := strong.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	bcryptHash, err := bcryptLow.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+
+	assert.True(t, strong.NeedsRehash(weakHash))
+	assert.False(t, weak.NeedsRehash(strongHash))
+	assert.True(t, strong.NeedsRehash(bcryptHash))
+	assert.True(t, bcryptHigh.NeedsRehash(bcryptHash))
+	assert.False(t, bcryptLow.NeedsRehash(bcryptHash))
+	assert.True(t, bcryptLow.NeedsRehash(weakHash))
+	assert.ErrorIs(t, bcryptLow.CheckPassword(ctx, weakHash, "Password123"), ErrUnsupportedHash)
+}
+
+// TestUpgradingPasswordHasher
+// ---------------------------
+// Legacy hashes still verify, new hashes use the current algorithm, and
+// only hashes of the current algorithm and cost are left alone.
+func TestUpgradingPasswordHasher(t *testing.T) {
+	ctx := context.Background()
+	bcryptHasher := NewBcryptPasswordHasher(4)
+	h := NewUpgradingPasswordHasher(newTestArgon2Hasher(t, testArgon2Params), bcryptHasher)
+
+	legacy, err := bcryptHasher.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	assert.NoError(t, h.CheckPassword(ctx, legacy, "Password123"))
+	assert.Error(t, h.CheckPassword(ctx, legacy, "Password124"))
+	assert.True(t, h.NeedsRehash(legacy))
+
+	current, err := h.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(current, argon2idPrefix))
+	assert.NoError(t, h.CheckPassword(ctx, current, "Password123"))
+	assert.False(t, h.NeedsRehash(current))
+
+	assert.ErrorIs(t, h.CheckPassword(ctx, "HASHED:Password123", "Password123"), ErrUnsupportedHash)
+}
+
+// TestLogin_RehashesOnSuccess
+// ---------------------------
+// A successful login stores the password under the current algorithm; a
+// failed one leaves the stored hash alone.
+func TestLogin_RehashesOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	bcryptHasher := NewBcryptPasswordHasher(4)
+	legacy, err := bcryptHasher.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	repo := &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Password: legacy}}}
+	svc := NewAuthService(repo, NewUpgradingPasswordHasher(newTestArgon2Hasher(t, testArgon2Params), bcryptHasher), DefaultPasswordPolicy())
+
+	ok, err := svc.Login(ctx, "a@example.com", "Wrong1234")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, legacy, repo.createdUsers[0].Password)
+
+	ok, err = svc.Login(ctx, "a@example.com", "Password123")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	upgraded := repo.createdUsers[0].Password
+	assert.True(t, strings.HasPrefix(upgraded, argon2idPrefix), upgraded)
+
+	ok, err = svc.Login(ctx, "a@example.com", "Password123")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, upgraded, repo.createdUsers[0].Password, "current hashes are kept")
+}
+
+// racingUserRepo changes the password right after a login has read the
+// user, as a reset finishing at that moment would.
+type racingUserRepo struct {
+	*fakeUserRepo
+}
+
+func (r racingUserRepo) FindByEmail(ctx context.Context, email string) (User, error) {
+	u, err := r.fakeUserRepo.FindByEmail(ctx, email)
+	if err == nil {
+		err = r.UpdatePassword(ctx, u.ID, "HASHED:NewPassword1")
+	}
+	return u, err
+}
+
+// TestLogin_RehashKeepsNewerPassword
+// -----------------------------------
+// A rehash that races a password change does not bring the old password
+// back.
+func TestLogin_RehashKeepsNewerPassword(t *testing.T) {
+	ctx := context.Background()
+	bcryptHasher := NewBcryptPasswordHasher(4)
+	legacy, err := bcryptHasher.HashPassword(ctx, "Password123")
+	require.NoError(t, err)
+	repo := &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Password: legacy}}}
+	svc := NewAuthService(racingUserRepo{repo}, NewUpgradingPasswordHasher(newTestArgon2Hasher(t, testArgon2Params), bcryptHasher), DefaultPasswordPolicy())
+
+	ok, err := svc.Login(ctx, "a@example.com", "Password123")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "HASHED:NewPassword1", repo.createdUsers[0].Password)
+}
+
+// blockingHasher counts concurrent calls and waits on release.
+type blockingHasher struct {
+	fakeHasher
+	running, peak atomic.Int32
+	release       chan struct{}
+}
+
+func (b *blockingHasher) HashPassword(ctx context.Context, password string) (string, error) {
+	n := b.running.Add(1)
+	defer b.running.Add(-1)
+	for {
+		p := b.peak.Load()
+		if n <= p || b.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	<-b.release
+	return b.fakeHasher.HashPassword(ctx, password)
+}
+
+// TestLimitedPasswordHasher
+// -------------------------
+// No more than the limit of hashes run at once; the rest wait their turn.
+func TestLimitedPasswordHasher(t *testing.T) {
+	inner := &blockingHasher{release: make(chan struct{})}
+	h := NewLimitedPasswordHasher(inner, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = h.HashPassword(context.Background(), "Password123")
+		}()
+	}
+	require.Eventually(t, func() bool { return inner.running.Load() == 2 }, time.Second, time.Millisecond)
+	for i := 0; i < 5; i++ {
+		inner.release <- struct{}{}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), inner.peak.Load())
+}
+
+// TestLimitedPasswordHasher_AbandonedWait
+// ---------------------------------------
+// A request that ends while waiting for a slot gives up without hashing.
+func TestLimitedPasswordHasher_AbandonedWait(t *testing.T) {
+	inner := &blockingHasher{release: make(chan struct{})}
+	h := NewLimitedPasswordHasher(inner, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = h.HashPassword(context.Background(), "Password123")
+	}()
+	require.Eventually(t, func() bool { return inner.running.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := h.HashPassword(ctx, "Password123")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, h.CheckPassword(ctx, "HASHED:Password123", "Password123"), context.DeadlineExceeded)
+
+	inner.release <- struct{}{}
+	<-done
+	assert.Equal(t, int32(1), inner.peak.Load())
+}
+
+// BenchmarkPasswordHashers times the production defaults; see
+// cmd/hashtune to pick parameters for a machine.
+func BenchmarkPasswordHashers(b *testing.B) {
+	argon2Hasher, err := NewArgon2idPasswordHasher(DefaultArgon2Params)
+	require.NoError(b, err)
+	hashers := map[string]PasswordHasher{
+		"argon2id": argon2Hasher,
+		"bcrypt":   NewBcryptPasswordHasher(0),
+	}
+	for name, h := range hashers {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := h.HashPassword(context.Background(), "correct horse battery staple"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// internal/auth/proxy.go
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the networks of the reverse proxies in front of the
+// server. Only they may say, through X-Forwarded-For, who the client is;
+// anyone else could put any address there to dodge per-IP limits.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies reads a comma-separated list of CIDRs or single
+// addresses, e.g. "10.0.0.0/8, 127.0.0.1". An empty list trusts no one.
+func ParseTrustedProxies(s string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !strings.Contains(f, "/") {
+			ip := net.ParseIP(f)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", f)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network %q", f)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the peer address, unless the peer is a trusted proxy. Then
+// X-Forwarded-For is read from the right, since each proxy appends the
+// address it saw, and the first hop that is not a trusted proxy is the
+// client. Hops further left were written by the client and are ignored.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.trusts(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !p.trusts(hop) {
+			return hop
+		}
+		ip = hop
+	}
+	// Every hop is a proxy of ours; the left-most one is the closest to
+	// the client.
+	return ip
+}
@@ -0,0 +1,51 @@
+// internal/auth/proxy_test.go
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientIP_TrustedProxies
+// ---------------------------
+// X-Forwarded-For only counts when the peer is a trusted proxy, and then
+// the right-most hop that is not a proxy is the client; whatever the
+// client wrote further left is ignored.
+func TestClientIP_TrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.1 ,")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"direct", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"spoofed by an untrusted peer", "203.0.113.7:5000", "1.2.3.4", "203.0.113.7"},
+		{"one proxy", "10.1.2.3:5000", "198.51.100.9", "198.51.100.9"},
+		{"client prepends a fake hop", "10.1.2.3:5000", "1.2.3.4, 198.51.100.9", "198.51.100.9"},
+		{"chain of proxies", "10.1.2.3:5000", "1.2.3.4, 198.51.100.9, 192.168.1.1, 10.9.9.9", "198.51.100.9"},
+		{"only proxies", "10.1.2.3:5000", "10.2.2.2", "10.2.2.2"},
+		{"no header", "192.168.1.1:5000", "", "192.168.1.1"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		assert.Equal(t, tc.want, proxies.ClientIP(r), tc.name)
+	}
+
+	var none TrustedProxies
+	r := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+	r.RemoteAddr = "10.1.2.3:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	assert.Equal(t, "10.1.2.3", none.ClientIP(r))
+
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies("proxy.internal")
+	assert.Error(t, err)
+}
@@ -0,0 +1,315 @@
+// internal/auth/refresh.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// RefreshToken is the stored form of an opaque refresh token. Only the
+// SHA-256 of the token is kept; every token issued by rotating another
+// shares its FamilyID, so a replayed token can revoke the whole chain.
+// The family ID is the ID of the session started at login.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (RefreshToken, error)
+	// Rotate flags the live token id as used, loads its user and stores
+	// next in one transaction, so a failure part way leaves the old token
+	// usable. It returns ErrRefreshTokenReused when the token was already
+	// rotated or revoked, so two concurrent refreshes cannot both succeed,
+	// and ErrInvalidRefreshToken, changing nothing, when the user is gone,
+	// disabled or being deleted.
+	Rotate(ctx context.Context, id string, next RefreshToken, at time.Time) (User, error)
+	RevokeFamily(ctx context.Context, familyID string, at time.Time) error
+	RevokeUser(ctx context.Context, userID string, at time.Time) error
+}
+
+// Rotation is the outcome of a successful refresh.
+type Rotation struct {
+	User         *User
+	SessionID    string
+	RefreshToken string
+}
+
+// RefreshService issues and rotates refresh tokens.
+type RefreshService interface {
+	// Issue starts the token family of a new session, at login.
+	Issue(ctx context.Context, userID, sessionID string) (string, error)
+	// Rotate exchanges a live refresh token for a new one in the same
+	// family. Presenting a token that was already rotated revokes the
+	// family and its session and returns ErrRefreshTokenReused.
+	Rotate(ctx context.Context, token string) (*Rotation, error)
+	// Revoke ends the family of the given token if it belongs to userID;
+	// unknown tokens and those of other users are ignored.
+	Revoke(ctx context.Context, userID, token string) error
+	// RevokeAll ends every refresh token family of the user.
+	RevokeAll(ctx context.Context, userID string) error
+}
+
+type refreshService struct {
+	repo     RefreshTokenRepository
+	sessions SessionService
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+func NewRefreshService(repo RefreshTokenRepository, sessions SessionService, ttl time.Duration) RefreshService {
+	return &refreshService{
+		repo:     repo,
+		sessions: sessions,
+		ttl:      ttl,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *refreshService) Issue(ctx context.Context, userID, sessionID string) (string, error) {
+	return s.issue(ctx, userID, sessionID)
+}
+
+func (s *refreshService) Rotate(ctx context.Context, token string) (*Rotation, error) {
+	if token == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	stored, err := s.repo.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	now := s.now()
+	if stored.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.RotatedAt != nil {
+		return nil, s.revokeFamily(ctx, stored, now)
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := s.sessions.Resume(ctx, stored.UserID, stored.FamilyID); err != nil {
+		if errors.Is(err, ErrSessionRevoked) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	next, nextToken, err := s.newToken(stored.UserID, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.Rotate(ctx, stored.ID, next, now)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			// Lost a race with another refresh of the same token.
+			return nil, s.revokeFamily(ctx, stored, now)
+		}
+		return nil, err
+	}
+	return &Rotation{User: &user, SessionID: stored.FamilyID, RefreshToken: nextToken}, nil
+}
+
+func (s *refreshService) Revoke(ctx context.Context, userID, token string) error {
+	stored, err := s.repo.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != userID {
+		return nil
+	}
+	return s.repo.RevokeFamily(ctx, stored.FamilyID, s.now())
+}
+
+func (s *refreshService) RevokeAll(ctx context.Context, userID string) error {
+	return s.repo.RevokeUser(ctx, userID, s.now())
+}
+
+func (s *refreshService) issue(ctx context.Context, userID, familyID string) (string, error) {
+	t, token, err := s.newToken(userID, familyID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.Create(ctx, t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// newToken returns a fresh token of the family and its stored form.
+func (s *refreshService) newToken(userID, familyID string) (RefreshToken, string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return RefreshToken{}, "", err
+	}
+
+	now := s.now()
+	return RefreshToken{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}, token, nil
+}
+
+func (s *refreshService) revokeFamily(ctx context.Context, stored RefreshToken, now time.Time) error {
+	if err := s.repo.RevokeFamily(ctx, stored.FamilyID, now); err != nil {
+		return err
+	}
+	err := s.sessions.Revoke(ctx, stored.UserID, stored.FamilyID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// newOpaqueToken returns 32 random bytes, base64url encoded.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is the lookup key for an opaque token. The tokens carry 256
+// bits of entropy, so a fast unsalted hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type postgresRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &postgresRefreshTokenRepository{db: db}
+}
+
+func (r *postgresRefreshTokenRepository) Create(ctx context.Context, t RefreshToken) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+		t.ID, t.UserID, t.FamilyID, t.TokenHash, t.CreatedAt, t.ExpiresAt,
+	)
+	return err
+}
+
+func (r *postgresRefreshTokenRepository) FindByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	var t RefreshToken
+	var rotatedAt, revokedAt sql.NullTime
+	row := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, token_hash, created_at, expires_at, rotated_at, revoked_at
+         FROM refresh_tokens WHERE token_hash = $1`,
+		hash,
+	)
+	err := row.Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RefreshToken{}, ErrInvalidRefreshToken
+		}
+		return RefreshToken{}, err
+	}
+	if rotatedAt.Valid {
+		t.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return t, nil
+}
+
+func (r *postgresRefreshTokenRepository) Rotate(ctx context.Context, id string, next RefreshToken, at time.Time) (User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET rotated_at = $2
+         WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL`,
+		id, at,
+	)
+	if err != nil {
+		return User{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return User{}, err
+		}
+		return User{}, ErrRefreshTokenReused
+	}
+
+	// FOR SHARE holds off a concurrent disable or deletion until the new
+	// token is stored, so it revokes that token too.
+	user, err := scanUser(tx.QueryRowContext(ctx, selectUser+` WHERE id = $1 FOR SHARE`, next.UserID))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return User{}, ErrInvalidRefreshToken
+		}
+		return User{}, err
+	}
+	if user.DisabledAt != nil || user.DeletionRequestedAt != nil {
+		return User{}, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+		next.ID, next.UserID, next.FamilyID, next.TokenHash, next.CreatedAt, next.ExpiresAt,
+	); err != nil {
+		return User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (r *postgresRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $2
+         WHERE family_id = $1 AND revoked_at IS NULL`,
+		familyID, at,
+	)
+	return err
+}
+
+func (r *postgresRefreshTokenRepository) RevokeUser(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $2
+         WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID, at,
+	)
+	return err
+}
@@ -0,0 +1,215 @@
+// internal/auth/refresh_test.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRefreshRepo keeps refresh tokens in memory, keyed by hash. Rotate
+// loads users from users.
+type fakeRefreshRepo struct {
+	users  UserRepository
+	tokens map[string]*RefreshToken
+}
+
+func newFakeRefreshRepo(users UserRepository) *fakeRefreshRepo {
+	return &fakeRefreshRepo{users: users, tokens: map[string]*RefreshToken{}}
+}
+
+func (f *fakeRefreshRepo) Create(ctx context.Context, t RefreshToken) error {
+	f.tokens[t.TokenHash] = &t
+	return nil
+}
+
+func (f *fakeRefreshRepo) FindByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	t, ok := f.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+	return *t, nil
+}
+
+func (f *fakeRefreshRepo) Rotate(ctx context.Context, id string, next RefreshToken, at time.Time) (User, error) {
+	var current *RefreshToken
+	for _, t := range f.tokens {
+		if t.ID == id && t.RotatedAt == nil && t.RevokedAt == nil {
+			current = t
+		}
+	}
+	if current == nil {
+		return User{}, ErrRefreshTokenReused
+	}
+
+	user, err := f.users.FindByID(ctx, next.UserID)
+	if errors.Is(err, ErrUserNotFound) || err == nil && (user.DisabledAt != nil || user.DeletionRequestedAt != nil) {
+		return User{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	current.RotatedAt = &at
+	f.tokens[next.TokenHash] = &next
+	return user, nil
+}
+
+func (f *fakeRefreshRepo) RevokeFamily(ctx context.Context, familyID string, at time.Time) error {
+	for _, t := range f.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (f *fakeRefreshRepo) RevokeUser(ctx context.Context, userID string, at time.Time) error {
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func newTestRefreshService(t *testing.T) (*refreshService, *fakeRefreshRepo) {
+	t.Helper()
+	users := &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com"}}}
+	repo := newFakeRefreshRepo(users)
+	sessions := NewSessionService(newFakeSessionRepo(), 24*time.Hour, time.Minute)
+	return NewRefreshService(repo, sessions, time.Hour).(*refreshService), repo
+}
+
+// login starts a session and issues its first refresh token.
+func login(t *testing.T, svc *refreshService) (sessionID, token string) {
+	t.Helper()
+	s, err := svc.sessions.Start(context.Background(), "user-1", "test", "127.0.0.1")
+	require.NoError(t, err)
+	token, err = svc.Issue(context.Background(), "user-1", s.ID)
+	require.NoError(t, err)
+	return s.ID, token
+}
+
+// TestRefresh_RotateIssuesNewToken
+// --------------------------------
+// A live refresh token yields its user and a different token; the old one
+// is stored only as a hash and is marked rotated.
+func TestRefresh_RotateIssuesNewToken(t *testing.T) {
+	svc, repo := newTestRefreshService(t)
+	ctx := context.Background()
+
+	sessionID, first := login(t, svc)
+	require.NotContains(t, repo.tokens, first)
+
+	rotation, err := svc.Rotate(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", rotation.User.ID)
+	assert.Equal(t, sessionID, rotation.SessionID)
+	second := rotation.RefreshToken
+	assert.NotEqual(t, first, second)
+
+	old := repo.tokens[hashToken(first)]
+	next := repo.tokens[hashToken(second)]
+	require.NotNil(t, old.RotatedAt)
+	assert.Equal(t, old.FamilyID, next.FamilyID)
+
+	_, err = svc.Rotate(ctx, second)
+	assert.NoError(t, err)
+}
+
+// TestRefresh_ReuseRevokesFamily
+// ------------------------------
+// Replaying a rotated token revokes every token in its family, including
+// the one the legitimate client holds now, and ends the session.
+func TestRefresh_ReuseRevokesFamily(t *testing.T) {
+	svc, _ := newTestRefreshService(t)
+	ctx := context.Background()
+
+	sessionID, first := login(t, svc)
+	rotation, err := svc.Rotate(ctx, first)
+	require.NoError(t, err)
+
+	// An unrelated login is a separate family and stays valid.
+	_, other := login(t, svc)
+
+	_, err = svc.Rotate(ctx, first)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = svc.Rotate(ctx, rotation.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	claims := &TokenClaims{UserID: "user-1", SessionID: sessionID}
+	assert.ErrorIs(t, svc.sessions.Check(ctx, claims), ErrSessionRevoked)
+
+	_, err = svc.Rotate(ctx, other)
+	assert.NoError(t, err)
+}
+
+// TestRefresh_RevokedSession
+// --------------------------
+// Ending a session from the sessions list stops its refresh token.
+func TestRefresh_RevokedSession(t *testing.T) {
+	svc, _ := newTestRefreshService(t)
+	ctx := context.Background()
+
+	sessionID, token := login(t, svc)
+	require.NoError(t, svc.sessions.Revoke(ctx, "user-1", sessionID))
+
+	_, err := svc.Rotate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+// TestRefresh_ExpiredOrUnknown
+// ----------------------------
+// Unknown and expired tokens are rejected without touching the family.
+func TestRefresh_ExpiredOrUnknown(t *testing.T) {
+	svc, _ := newTestRefreshService(t)
+	ctx := context.Background()
+
+	_, err := svc.Rotate(ctx, "not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, token := login(t, svc)
+
+	svc.now = func() time.Time { return time.Now().UTC().Add(2 * time.Hour) }
+	_, err = svc.Rotate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+// TestRefresh_DisabledUserKeepsToken
+// ----------------------------------
+// A refresh refused because the user is disabled stores no new token and
+// leaves the presented one unrotated, so nothing is half done.
+func TestRefresh_DisabledUserKeepsToken(t *testing.T) {
+	svc, repo := newTestRefreshService(t)
+	ctx := context.Background()
+
+	_, token := login(t, svc)
+	disabled := time.Now().UTC()
+	repo.users.(*fakeUserRepo).createdUsers[0].DisabledAt = &disabled
+
+	_, err := svc.Rotate(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	assert.Len(t, repo.tokens, 1)
+	assert.Nil(t, repo.tokens[hashToken(token)].RotatedAt)
+}
+
+// TestRefresh_RevokeChecksOwner
+// -----------------------------
+// Logging out with someone else's refresh token leaves that token alone.
+func TestRefresh_RevokeChecksOwner(t *testing.T) {
+	svc, repo := newTestRefreshService(t)
+	ctx := context.Background()
+
+	_, token := login(t, svc)
+	require.NoError(t, svc.Revoke(ctx, "user-2", token))
+	assert.Nil(t, repo.tokens[hashToken(token)].RevokedAt)
+
+	require.NoError(t, svc.Revoke(ctx, "user-1", token))
+	assert.NotNil(t, repo.tokens[hashToken(token)].RevokedAt)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -16,6 +17,29 @@ var ErrEmailAlreadyExists = errors.New("email already exists")
 type UserRepository interface {
 	Create(ctx context.Context, user User) error
 	FindByEmail(ctx context.Context, email string) (User, error)
+	FindByID(ctx context.Context, id string) (User, error)
+	UpdatePassword(ctx context.Context, id, hash string) error
+	// ReplacePassword stores hash only while the stored hash is still old;
+	// it reports false when the password was changed meanwhile.
+	ReplacePassword(ctx context.Context, id, old, hash string) (bool, error)
+	// MarkEmailVerified verifies the user's address if it is still email;
+	// otherwise it returns ErrUserNotFound.
+	MarkEmailVerified(ctx context.Context, id, email string) error
+	// List returns users oldest first.
+	List(ctx context.Context, limit, offset int) ([]User, error)
+	SetRole(ctx context.Context, id string, role Role) error
+	// SetDisabled disables the account at the given time, or enables it
+	// again when at is nil.
+	SetDisabled(ctx context.Context, id string, at *time.Time) error
+	// ChangeEmail moves the account to a new, verified address; it returns
+	// ErrEmailAlreadyExists if another account has it.
+	ChangeEmail(ctx context.Context, id, email string) error
+	// SetDeletionRequested schedules the account for deletion, or
+	// cancels that when at is nil.
+	SetDeletionRequested(ctx context.Context, id string, at *time.Time) error
+	// DeletePendingBefore deletes the accounts scheduled for deletion at
+	// or before the given time and returns how many there were.
+	DeletePendingBefore(ctx context.Context, before time.Time) (int, error)
 }
 
 type postgresUserRepository struct {
@@ -28,9 +52,9 @@ func NewPostgresUserRepository(db *sql.DB) UserRepository {
 
 func (r *postgresUserRepository) Create(ctx context.Context, user User) error {
 	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO users (id, email, password, created_at)
-         VALUES ($1, $2, $3, $4)`,
-		user.ID, user.Email, user.Password, user.CreatedAt,
+		`INSERT INTO users (id, email, password, created_at, role)
+         VALUES ($1, $2, $3, $4, $5)`,
+		user.ID, user.Email, user.Password, user.CreatedAt, user.Role,
 	)
 	if err != nil {
 		// Check for unique constraint violation on email
@@ -42,21 +66,160 @@ func (r *postgresUserRepository) Create(ctx context.Context, user User) error {
 	return nil
 }
 
+const selectUser = `
+SELECT id, email, password, created_at, token_version, email_verified, role, disabled_at, deletion_requested_at
+FROM users`
+
 func (r *postgresUserRepository) FindByEmail(ctx context.Context, email string) (User, error) {
-	var u User
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, email, password, created_at FROM users WHERE email = $1`,
-		email,
+	return scanUser(r.db.QueryRowContext(ctx, selectUser+` WHERE email = $1`, email))
+}
+
+func (r *postgresUserRepository) FindByID(ctx context.Context, id string) (User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, selectUser+` WHERE id = $1`, id))
+}
+
+func (r *postgresUserRepository) List(ctx context.Context, limit, offset int) ([]User, error) {
+	rows, err := r.db.QueryContext(ctx,
+		selectUser+` ORDER BY created_at, id LIMIT $1 OFFSET $2`,
+		limit, offset,
 	)
-	if err := row.Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt); err != nil {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// scanUser scans one selectUser row.
+func scanUser(row interface{ Scan(dest ...any) error }) (User, error) {
+	var u User
+	var disabledAt, deletionRequestedAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.CreatedAt, &u.TokenVersion, &u.EmailVerified, &u.Role, &disabledAt, &deletionRequestedAt)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, ErrUserNotFound
 		}
 		return User{}, err
 	}
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
+	}
+	if deletionRequestedAt.Valid {
+		u.DeletionRequestedAt = &deletionRequestedAt.Time
+	}
 	return u, nil
 }
 
+func (r *postgresUserRepository) UpdatePassword(ctx context.Context, id, hash string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET password = $2 WHERE id = $1`, id, hash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r *postgresUserRepository) ReplacePassword(ctx context.Context, id, old, hash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET password = $3 WHERE id = $1 AND password = $2`,
+		id, old, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresUserRepository) MarkEmailVerified(ctx context.Context, id, email string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET email_verified = TRUE WHERE id = $1 AND email = $2`,
+		id, email,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r *postgresUserRepository) SetRole(ctx context.Context, id string, role Role) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET role = $2 WHERE id = $1`, id, role)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r *postgresUserRepository) SetDisabled(ctx context.Context, id string, at *time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET disabled_at = $2 WHERE id = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r *postgresUserRepository) ChangeEmail(ctx context.Context, id, email string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET email = $2, email_verified = TRUE WHERE id = $1`,
+		id, email,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailAlreadyExists
+		}
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (r *postgresUserRepository) SetDeletionRequested(ctx context.Context, id string, at *time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET deletion_requested_at = $2 WHERE id = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// DeletePendingBefore relies on every table that references users,
+// calc_history included, cascading the delete.
+func (r *postgresUserRepository) DeletePendingBefore(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM users WHERE deletion_requested_at IS NOT NULL AND deletion_requested_at <= $1`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
 // isUniqueViolation detects Postgres unique-constraint errors (email already exists).
 func isUniqueViolation(err error) bool {
 	var pqErr *pq.Error
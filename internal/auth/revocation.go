@@ -0,0 +1,269 @@
+// internal/auth/revocation.go
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// DefaultRevocationCacheTTL is how long a "not revoked" answer or a token
+// version is trusted before Postgres is asked again. Revocations made on
+// this instance take effect immediately; those made on another instance
+// within this window.
+const DefaultRevocationCacheTTL = 30 * time.Second
+
+// maxCachedChecks bounds the negative cache and the token version cache
+// before expired entries are swept.
+const maxCachedChecks = 10_000
+
+type RevocationRepository interface {
+	// Revoke adds a token ID to the deny list until the token expires.
+	Revoke(ctx context.Context, jti, userID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// DeleteExpired drops entries for tokens that have expired anyway.
+	DeleteExpired(ctx context.Context, before time.Time) error
+	// TokenVersion returns the user's current token version;
+	// ErrUserNotFound for deleted users.
+	TokenVersion(ctx context.Context, userID string) (int, error)
+	// BumpTokenVersion increments and returns the user's token version.
+	BumpTokenVersion(ctx context.Context, userID string) (int, error)
+}
+
+// RevocationService decides whether a validly signed access token may
+// still be used.
+type RevocationService interface {
+	// TokenChecker returns ErrTokenRevoked if the token was logged out or
+	// was issued before the user's last "log out everywhere".
+	TokenChecker
+	// Revoke logs out a single access token.
+	Revoke(ctx context.Context, claims *TokenClaims) error
+	// RevokeAll invalidates every access token issued to the user so far.
+	RevokeAll(ctx context.Context, userID string) error
+}
+
+type cachedVersion struct {
+	version   int
+	fetchedAt time.Time
+}
+
+type revocationService struct {
+	repo RevocationRepository
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu       sync.Mutex
+	revoked  map[string]time.Time // jti -> token expiry
+	notFound map[string]time.Time // jti -> when the negative answer goes stale
+	versions map[string]cachedVersion
+}
+
+func NewRevocationService(repo RevocationRepository, cacheTTL time.Duration) RevocationService {
+	return &revocationService{
+		repo:     repo,
+		ttl:      cacheTTL,
+		now:      func() time.Time { return time.Now().UTC() },
+		revoked:  map[string]time.Time{},
+		notFound: map[string]time.Time{},
+		versions: map[string]cachedVersion{},
+	}
+}
+
+func (s *revocationService) Check(ctx context.Context, claims *TokenClaims) error {
+	version, err := s.tokenVersion(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrTokenRevoked
+		}
+		return err
+	}
+	if claims.TokenVersion < version {
+		return ErrTokenRevoked
+	}
+
+	// Tokens issued before jti existed can only be revoked by version.
+	if claims.ID == "" {
+		return nil
+	}
+	revoked, err := s.isRevoked(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (s *revocationService) Revoke(ctx context.Context, claims *TokenClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		// Nothing to list; fall back to invalidating everything.
+		return s.RevokeAll(ctx, claims.UserID)
+	}
+
+	now := s.now()
+	if err := s.repo.Revoke(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteExpired(ctx, now); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[claims.ID] = claims.ExpiresAt.Time
+	delete(s.notFound, claims.ID)
+	for jti, exp := range s.revoked {
+		if !now.Before(exp) {
+			delete(s.revoked, jti)
+		}
+	}
+	return nil
+}
+
+func (s *revocationService) RevokeAll(ctx context.Context, userID string) error {
+	version, err := s.repo.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheVersion(userID, version, s.now())
+	return nil
+}
+
+func (s *revocationService) isRevoked(ctx context.Context, jti string) (bool, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	if _, ok := s.revoked[jti]; ok {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if stale, ok := s.notFound[jti]; ok && now.Before(stale) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := s.repo.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if revoked {
+		// The expiry is unknown here; keep it for the cache TTL.
+		s.revoked[jti] = now.Add(s.ttl)
+		return true, nil
+	}
+	if len(s.notFound) >= maxCachedChecks {
+		for k, stale := range s.notFound {
+			if !now.Before(stale) {
+				delete(s.notFound, k)
+			}
+		}
+	}
+	s.notFound[jti] = now.Add(s.ttl)
+	return false, nil
+}
+
+func (s *revocationService) tokenVersion(ctx context.Context, userID string) (int, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	cached, ok := s.versions[userID]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < s.ttl {
+		return cached.version, nil
+	}
+
+	version, err := s.repo.TokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheVersion(userID, version, now)
+	return version, nil
+}
+
+// cacheVersion stores a user's token version; s.mu must be held. When the
+// cache is full, stale versions are swept, and if every entry is still
+// fresh the cache starts over rather than growing with each user seen.
+func (s *revocationService) cacheVersion(userID string, version int, now time.Time) {
+	if _, ok := s.versions[userID]; !ok && len(s.versions) >= maxCachedChecks {
+		for id, v := range s.versions {
+			if now.Sub(v.fetchedAt) >= s.ttl {
+				delete(s.versions, id)
+			}
+		}
+		if len(s.versions) >= maxCachedChecks {
+			clear(s.versions)
+		}
+	}
+	s.versions[userID] = cachedVersion{version: version, fetchedAt: now}
+}
+
+type postgresRevocationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRevocationRepository(db *sql.DB) RevocationRepository {
+	return &postgresRevocationRepository{db: db}
+}
+
+func (r *postgresRevocationRepository) Revoke(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, user_id, expires_at)
+         VALUES ($1, $2, $3)
+         ON CONFLICT (jti) DO NOTHING`,
+		jti, userID, expiresAt,
+	)
+	return err
+}
+
+func (r *postgresRevocationRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`,
+		jti,
+	).Scan(&revoked)
+	return revoked, err
+}
+
+func (r *postgresRevocationRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, before)
+	return err
+}
+
+func (r *postgresRevocationRepository) TokenVersion(ctx context.Context, userID string) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT token_version FROM users WHERE id = $1`,
+		userID,
+	).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	return version, err
+}
+
+func (r *postgresRevocationRepository) BumpTokenVersion(ctx context.Context, userID string) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version`,
+		userID,
+	).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	return version, err
+}
@@ -0,0 +1,172 @@
+// internal/auth/revocation_test.go
+package auth
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRevocationRepo keeps the deny list and token versions in memory and
+// counts lookups so tests can see what the cache absorbed.
+type fakeRevocationRepo struct {
+	revoked  map[string]time.Time
+	versions map[string]int
+	lookups  int
+}
+
+func newFakeRevocationRepo() *fakeRevocationRepo {
+	return &fakeRevocationRepo{revoked: map[string]time.Time{}, versions: map[string]int{"user-1": 0}}
+}
+
+func (f *fakeRevocationRepo) Revoke(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	f.revoked[jti] = expiresAt
+	return nil
+}
+
+func (f *fakeRevocationRepo) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	f.lookups++
+	_, ok := f.revoked[jti]
+	return ok, nil
+}
+
+func (f *fakeRevocationRepo) DeleteExpired(ctx context.Context, before time.Time) error {
+	for jti, exp := range f.revoked {
+		if exp.Before(before) {
+			delete(f.revoked, jti)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRevocationRepo) TokenVersion(ctx context.Context, userID string) (int, error) {
+	f.lookups++
+	v, ok := f.versions[userID]
+	if !ok {
+		return 0, ErrUserNotFound
+	}
+	return v, nil
+}
+
+func (f *fakeRevocationRepo) BumpTokenVersion(ctx context.Context, userID string) (int, error) {
+	f.versions[userID]++
+	return f.versions[userID], nil
+}
+
+func testClaims(jti string, version int) *TokenClaims {
+	return &TokenClaims{
+		UserID:       "user-1",
+		TokenVersion: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+// TestRevocation_RevokeSingleToken
+// --------------------------------
+// Logging out one token leaves the user's other tokens valid.
+func TestRevocation_RevokeSingleToken(t *testing.T) {
+	svc := NewRevocationService(newFakeRevocationRepo(), time.Minute)
+	ctx := context.Background()
+
+	first, second := testClaims("jti-1", 0), testClaims("jti-2", 0)
+	require.NoError(t, svc.Check(ctx, first))
+
+	require.NoError(t, svc.Revoke(ctx, first))
+
+	assert.ErrorIs(t, svc.Check(ctx, first), ErrTokenRevoked)
+	assert.NoError(t, svc.Check(ctx, second))
+}
+
+// TestRevocation_RevokeAllBumpsVersion
+// ------------------------------------
+// "Log out everywhere" rejects every token issued with the old version but
+// not tokens issued afterwards.
+func TestRevocation_RevokeAllBumpsVersion(t *testing.T) {
+	svc := NewRevocationService(newFakeRevocationRepo(), time.Minute)
+	ctx := context.Background()
+
+	old := testClaims("jti-1", 0)
+	require.NoError(t, svc.Check(ctx, old))
+
+	require.NoError(t, svc.RevokeAll(ctx, "user-1"))
+
+	assert.ErrorIs(t, svc.Check(ctx, old), ErrTokenRevoked)
+	assert.NoError(t, svc.Check(ctx, testClaims("jti-2", 1)))
+}
+
+// TestRevocation_CacheAbsorbsLookups
+// ----------------------------------
+// Repeated checks of the same token hit Postgres once per cache TTL, and a
+// revocation written by another instance is seen once the TTL passes.
+func TestRevocation_CacheAbsorbsLookups(t *testing.T) {
+	repo := newFakeRevocationRepo()
+	svc := NewRevocationService(repo, time.Minute).(*revocationService)
+	ctx := context.Background()
+	claims := testClaims("jti-1", 0)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, svc.Check(ctx, claims))
+	}
+	assert.Equal(t, 2, repo.lookups) // one version read, one jti read
+
+	// Another instance revokes the token directly in the database.
+	repo.revoked["jti-1"] = time.Now().Add(time.Hour)
+	assert.NoError(t, svc.Check(ctx, claims))
+
+	svc.now = func() time.Time { return time.Now().UTC().Add(2 * time.Minute) }
+	assert.ErrorIs(t, svc.Check(ctx, claims), ErrTokenRevoked)
+}
+
+// TestRevocation_DeletedUser
+// --------------------------
+// Tokens of a user that no longer exists are treated as revoked.
+func TestRevocation_DeletedUser(t *testing.T) {
+	svc := NewRevocationService(newFakeRevocationRepo(), time.Minute)
+
+	claims := testClaims("jti-1", 0)
+	claims.UserID = "gone"
+	assert.ErrorIs(t, svc.Check(context.Background(), claims), ErrTokenRevoked)
+}
+
+// TestRevocation_VersionCacheBounded
+// ----------------------------------
+// Checking tokens of ever more users does not grow the token version
+// cache past its limit; stale entries go first.
+func TestRevocation_VersionCacheBounded(t *testing.T) {
+	repo := newFakeRevocationRepo()
+	svc := NewRevocationService(repo, time.Minute).(*revocationService)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	svc.now = func() time.Time { return now }
+	check := func(userID string) {
+		repo.versions[userID] = 0
+		claims := testClaims("", 0)
+		claims.UserID = userID
+		require.NoError(t, svc.Check(ctx, claims))
+	}
+
+	check("user-1")
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < maxCachedChecks-1; i++ {
+		check("user-" + strconv.Itoa(i+2))
+	}
+	require.Len(t, svc.versions, maxCachedChecks)
+
+	check("one-more")
+	assert.Len(t, svc.versions, maxCachedChecks)
+	assert.NotContains(t, svc.versions, "user-1")
+
+	for i := 0; i < maxCachedChecks; i++ {
+		check("later-" + strconv.Itoa(i))
+	}
+	assert.LessOrEqual(t, len(svc.versions), maxCachedChecks)
+}
@@ -0,0 +1,76 @@
+// internal/auth/role.go
+package auth
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// Role is stored with each user and carried in access tokens.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+	// RoleAuditor can read every account and its history but change
+	// nothing, its own calculations included.
+	RoleAuditor Role = "auditor"
+)
+
+// Permission is what a route requires; roles grant sets of them.
+type Permission string
+
+const (
+	PermCalcWrite      Permission = "calc:write"
+	PermHistoryRead    Permission = "history:read"
+	PermHistoryReadAny Permission = "history:read:any"
+	PermUsersRead      Permission = "users:read"
+	PermUsersWrite     Permission = "users:write"
+	// PermSettingsWrite covers the user's own preferences and profile.
+	PermSettingsWrite Permission = "settings:write"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:    {PermCalcWrite, PermHistoryRead, PermSettingsWrite},
+	RoleAuditor: {PermHistoryRead, PermHistoryReadAny, PermUsersRead},
+	RoleAdmin:   {PermCalcWrite, PermHistoryRead, PermSettingsWrite, PermHistoryReadAny, PermUsersRead, PermUsersWrite},
+}
+
+// ParseRole accepts the names of the defined roles.
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := rolePermissions[r]; !ok {
+		return "", ErrInvalidRole
+	}
+	return r, nil
+}
+
+// Has reports whether the role grants p. Unknown roles grant nothing.
+func (r Role) Has(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRole is the token's role; tokens issued before roles existed
+// belong to ordinary users.
+func (c *TokenClaims) EffectiveRole() Role {
+	if c.Role == "" {
+		return RoleUser
+	}
+	return c.Role
+}
+
+// Permits reports whether the token grants p: its role must, and so must
+// its scopes if it has any.
+func (c *TokenClaims) Permits(p Permission) bool {
+	if len(c.Scopes) > 0 && !slices.Contains(c.Scopes, p) {
+		return false
+	}
+	return c.EffectiveRole().Has(p)
+}
@@ -0,0 +1,50 @@
+// internal/auth/role_test.go
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRole_Permissions
+// --------------------
+// Users calculate and read their own history, auditors only read, admins
+// do everything.
+func TestRole_Permissions(t *testing.T) {
+	assert.True(t, RoleUser.Has(PermCalcWrite))
+	assert.True(t, RoleUser.Has(PermSettingsWrite))
+	assert.False(t, RoleUser.Has(PermUsersRead))
+
+	assert.False(t, RoleAuditor.Has(PermCalcWrite))
+	assert.False(t, RoleAuditor.Has(PermSettingsWrite))
+	assert.True(t, RoleAuditor.Has(PermHistoryReadAny))
+	assert.False(t, RoleAuditor.Has(PermUsersWrite))
+
+	for _, p := range []Permission{PermCalcWrite, PermHistoryRead, PermSettingsWrite, PermHistoryReadAny, PermUsersRead, PermUsersWrite} {
+		assert.True(t, RoleAdmin.Has(p), p)
+	}
+	assert.False(t, Role("root").Has(PermCalcWrite))
+}
+
+// TestTokenClaims_LegacyRole
+// --------------------------
+// Tokens without a role claim act as ordinary users.
+func TestTokenClaims_LegacyRole(t *testing.T) {
+	claims := &TokenClaims{UserID: "user-1"}
+	assert.Equal(t, RoleUser, claims.EffectiveRole())
+	assert.True(t, claims.Permits(PermCalcWrite))
+	assert.False(t, claims.Permits(PermUsersRead))
+}
+
+// TestParseRole
+// -------------
+// Only the defined role names are accepted.
+func TestParseRole(t *testing.T) {
+	r, err := ParseRole("auditor")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleAuditor, r)
+
+	_, err = ParseRole("Admin")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+}
@@ -5,8 +5,8 @@ import (
 	"context"
 	"errors"
 	"net/mail"
+	"sync"
 	"time"
-	"unicode"
 
 	"github.com/google/uuid"
 )
@@ -25,6 +25,12 @@ type AuthService interface {
 type authService struct {
 	repo   UserRepository
 	hasher PasswordHasher
+	policy PasswordPolicy
+
+	// dummyHash is checked against when the user does not exist, so that
+	// path costs the same as a wrong password.
+	dummyOnce sync.Once
+	dummyHash string
 }
 
 func (s *authService) GetUserByEmail(ctx context.Context, email string) (*User, error) {
@@ -35,10 +41,11 @@ func (s *authService) GetUserByEmail(ctx context.Context, email string) (*User,
 	return &User, nil
 }
 
-func NewAuthService(repo UserRepository, hasher PasswordHasher) AuthService {
+func NewAuthService(repo UserRepository, hasher PasswordHasher, policy PasswordPolicy) AuthService {
 	return &authService{
 		repo:   repo,
 		hasher: hasher,
+		policy: policy,
 	}
 }
 
@@ -54,39 +61,16 @@ func validateEmail(email string) error {
 	return nil
 }
 
-// Password validation
-func validatePassword(pw string) error {
-	if len(pw) < 8 {
-		return ErrPasswordTooShort
-	}
-
-	var hasLetter, hasDigit bool
-	for _, r := range pw {
-		switch {
-		case unicode.IsLetter(r):
-			hasLetter = true
-		case unicode.IsDigit(r):
-			hasDigit = true
-		}
-	}
-
-	if !hasLetter || !hasDigit {
-		return ErrPasswordTooWeak
-	}
-
-	return nil
-}
-
 func (s *authService) SignUp(ctx context.Context, email, password string) error {
 	// email/password validation
 	if err := validateEmail(email); err != nil {
 		return err
 	}
-	if err := validatePassword(password); err != nil {
+	if err := s.policy.Validate(ctx, password, email); err != nil {
 		return err
 	}
 
-	hash, err := s.hasher.HashPassword(password)
+	hash, err := s.hasher.HashPassword(ctx, password)
 	if err != nil {
 		return err
 	}
@@ -96,6 +80,7 @@ func (s *authService) SignUp(ctx context.Context, email, password string) error
 		Email:     email,
 		Password:  hash,
 		CreatedAt: time.Now().UTC(),
+		Role:      RoleUser,
 	}
 
 	if err := s.repo.Create(ctx, user); err != nil {
@@ -112,16 +97,41 @@ func (s *authService) Login(ctx context.Context, email, password string) (bool,
 	user, err := s.repo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
-			// login failed
-			return false, nil
+			// login failed; spend the time a real check would take
+			_ = s.hasher.CheckPassword(ctx, s.dummy(), password)
+			return false, ctx.Err()
 		}
 		return false, err
 	}
 
-	if err := s.hasher.CheckPassword(user.Password, password); err != nil {
+	if err := s.hasher.CheckPassword(ctx, user.Password, password); err != nil {
+		// An abandoned request is not a wrong password and must not
+		// count toward the backoff.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
 		// wrong password
 		return false, nil
 	}
 
+	// Move the stored hash to the current algorithm and cost while the
+	// password is at hand. A failed upgrade is retried at the next login;
+	// one that lost to a password change or reset is dropped.
+	if s.hasher.NeedsRehash(user.Password) {
+		if hash, err := s.hasher.HashPassword(ctx, password); err == nil {
+			_, _ = s.repo.ReplacePassword(ctx, user.ID, user.Password, hash)
+		}
+	}
+
 	return true, nil
 }
+
+// dummy returns a hash made by the configured hasher, so it has the same
+// cost as the stored ones. It is made once for every later login, so it
+// does not depend on the first caller's request staying open.
+func (s *authService) dummy() string {
+	s.dummyOnce.Do(func() {
+		s.dummyHash, _ = s.hasher.HashPassword(context.Background(), uuid.NewString())
+	})
+	return s.dummyHash
+}
@@ -3,7 +3,9 @@ package auth
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,12 +34,131 @@ func (f *fakeUserRepo) Create(ctx context.Context, u User) error {
 	return nil
 }
 
-// FindByEmail is not used in these tests, but is implemented to satisfy
-// the UserRepository interface. For now it always returns "not found".
+// FindByEmail looks the user up among createdUsers.
 func (f *fakeUserRepo) FindByEmail(ctx context.Context, email string) (User, error) {
+	for _, u := range f.createdUsers {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+// FindByID looks the user up among createdUsers.
+func (f *fakeUserRepo) FindByID(ctx context.Context, id string) (User, error) {
+	for _, u := range f.createdUsers {
+		if u.ID == id {
+			return u, nil
+		}
+	}
 	return User{}, ErrUserNotFound
 }
 
+// UpdatePassword replaces the stored hash of a created user.
+func (f *fakeUserRepo) UpdatePassword(ctx context.Context, id, hash string) error {
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id {
+			f.createdUsers[i].Password = hash
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// ReplacePassword replaces the hash of a created user if it is still old.
+func (f *fakeUserRepo) ReplacePassword(ctx context.Context, id, old, hash string) (bool, error) {
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id {
+			if f.createdUsers[i].Password != old {
+				return false, nil
+			}
+			f.createdUsers[i].Password = hash
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MarkEmailVerified flags a created user whose email still matches.
+func (f *fakeUserRepo) MarkEmailVerified(ctx context.Context, id, email string) error {
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id && f.createdUsers[i].Email == email {
+			f.createdUsers[i].EmailVerified = true
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// List pages through createdUsers.
+func (f *fakeUserRepo) List(ctx context.Context, limit, offset int) ([]User, error) {
+	if offset >= len(f.createdUsers) {
+		return []User{}, nil
+	}
+	return f.createdUsers[offset:min(offset+limit, len(f.createdUsers))], nil
+}
+
+// SetRole changes the role of a created user.
+func (f *fakeUserRepo) SetRole(ctx context.Context, id string, role Role) error {
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id {
+			f.createdUsers[i].Role = role
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// SetDisabled disables or enables a created user.
+func (f *fakeUserRepo) SetDisabled(ctx context.Context, id string, at *time.Time) error {
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id {
+			f.createdUsers[i].DisabledAt = at
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// ChangeEmail moves a created user to a new, verified address.
+func (f *fakeUserRepo) ChangeEmail(ctx context.Context, id, email string) error {
+	if _, err := f.FindByEmail(ctx, email); err == nil {
+		return ErrEmailAlreadyExists
+	}
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id {
+			f.createdUsers[i].Email = email
+			f.createdUsers[i].EmailVerified = true
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// SetDeletionRequested schedules or cancels deletion of a created user.
+func (f *fakeUserRepo) SetDeletionRequested(ctx context.Context, id string, at *time.Time) error {
+	for i := range f.createdUsers {
+		if f.createdUsers[i].ID == id {
+			f.createdUsers[i].DeletionRequestedAt = at
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// DeletePendingBefore drops created users scheduled for deletion by before.
+func (f *fakeUserRepo) DeletePendingBefore(ctx context.Context, before time.Time) (int, error) {
+	kept := f.createdUsers[:0]
+	for _, u := range f.createdUsers {
+		if u.DeletionRequestedAt == nil || u.DeletionRequestedAt.After(before) {
+			kept = append(kept, u)
+		}
+	}
+	n := len(f.createdUsers) - len(kept)
+	f.createdUsers = kept
+	return n, nil
+}
+
 // fakeHasher simulates the password hasher.
 //
 // Instead of running a real hash (such as bcrypt), it simply prepends "HASHED:"
@@ -47,29 +168,34 @@ func (f *fakeUserRepo) FindByEmail(ctx context.Context, email string) (User, err
 type fakeHasher struct{}
 
 // HashPassword returns a deterministic "hashed" version of the password.
-func (f *fakeHasher) HashPassword(pw string) (string, error) {
+func (f *fakeHasher) HashPassword(ctx context.Context, pw string) (string, error) {
 	return "HASHED:" + pw, nil
 }
 
 // CheckPassword returns nil if the "hash" matches the expected format.
-func (f *fakeHasher) CheckPassword(hash, pw string) error {
+func (f *fakeHasher) CheckPassword(ctx context.Context, hash, pw string) error {
 	if hash == "HASHED:"+pw {
 		return nil
 	}
 	return ErrInvalidCredentials
 }
 
+// NeedsRehash reports whether the "hash" is not in fakeHasher's format.
+func (f *fakeHasher) NeedsRehash(hash string) bool {
+	return !strings.HasPrefix(hash, "HASHED:")
+}
+
 // newTestAuthService builds an authService using in-memory fakes.
 // This is the default constructor for tests that do not need to inspect
 // repository calls.
 func newTestAuthService() *authService {
-	return NewAuthService(&fakeUserRepo{}, &fakeHasher{}).(*authService)
+	return NewAuthService(&fakeUserRepo{}, &fakeHasher{}, DefaultPasswordPolicy()).(*authService)
 }
 
 // newTestAuthServiceWithFakeRepo builds an authService using a specific
 // fakeUserRepo, allowing tests to inspect createdUsers.
 func newTestAuthServiceWithFakeRepo(repo *fakeUserRepo) *authService {
-	return NewAuthService(repo, &fakeHasher{}).(*authService)
+	return NewAuthService(repo, &fakeHasher{}, DefaultPasswordPolicy()).(*authService)
 }
 
 //
@@ -153,3 +279,34 @@ func TestSignUp_OK(t *testing.T) {
 	assert.NotEqual(t, password, created.Password)
 	assert.Equal(t, "HASHED:"+password, created.Password)
 }
+
+// countingHasher wraps fakeHasher and counts password checks.
+type countingHasher struct {
+	fakeHasher
+	checks int
+}
+
+func (c *countingHasher) CheckPassword(ctx context.Context, hash, pw string) error {
+	c.checks++
+	return c.fakeHasher.CheckPassword(ctx, hash, pw)
+}
+
+// TestLogin_UnknownUserChecksPassword
+// -----------------------------------
+// A login for an address without an account still runs a password check,
+// so it takes as long as a wrong password and answers the same way.
+func TestLogin_UnknownUserChecksPassword(t *testing.T) {
+	hasher := &countingHasher{}
+	repo := &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com", Password: "HASHED:Password123"}}}
+	svc := NewAuthService(repo, hasher, DefaultPasswordPolicy())
+
+	ok, err := svc.Login(context.Background(), "a@example.com", "Wrong1234")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, hasher.checks)
+
+	ok, err = svc.Login(context.Background(), "nobody@example.com", "Wrong1234")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, hasher.checks)
+}
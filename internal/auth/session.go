@@ -0,0 +1,301 @@
+// internal/auth/session.go
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session has been revoked")
+)
+
+// sessionTouchInterval throttles last-seen writes to one per session per
+// interval.
+const sessionTouchInterval = time.Minute
+
+// Session is one login: the access and refresh tokens it produces carry
+// its ID (the refresh token family is the session). A session is active
+// until it is revoked or sits idle longer than the refresh token TTL.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// TokenChecker is consulted by the auth middleware after a token's
+// signature and expiry have been verified.
+type TokenChecker interface {
+	Check(ctx context.Context, claims *TokenClaims) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session Session) error
+	// Get returns ErrSessionNotFound for unknown IDs.
+	Get(ctx context.Context, id string) (Session, error)
+	// ListActive returns the user's unrevoked sessions seen since the
+	// given time, most recently seen first.
+	ListActive(ctx context.Context, userID string, seenSince time.Time) ([]Session, error)
+	Touch(ctx context.Context, id string, at time.Time) error
+	// Revoke reports false when the user has no such live session.
+	Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error)
+	// RevokeUser revokes all of the user's sessions except keepID, if set.
+	RevokeUser(ctx context.Context, userID, keepID string, at time.Time) error
+}
+
+type SessionService interface {
+	TokenChecker
+	Start(ctx context.Context, userID, userAgent, ip string) (Session, error)
+	List(ctx context.Context, userID string) ([]Session, error)
+	// Resume is called when a refresh token is rotated: it returns
+	// ErrSessionRevoked unless the session is active, and marks it seen.
+	Resume(ctx context.Context, userID, id string) error
+	Revoke(ctx context.Context, userID, id string) error
+	RevokeAll(ctx context.Context, userID string) error
+	// RevokeOthers ends every session of the user but keepID.
+	RevokeOthers(ctx context.Context, userID, keepID string) error
+}
+
+type cachedSession struct {
+	revoked   bool
+	fetchedAt time.Time
+	touchedAt time.Time
+}
+
+type sessionService struct {
+	repo        SessionRepository
+	idleTimeout time.Duration
+	cacheTTL    time.Duration
+	now         func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSession
+}
+
+// NewSessionService returns a SessionService. idleTimeout should match the
+// refresh token TTL; cacheTTL bounds how long a revocation made on another
+// instance can go unnoticed by this one.
+func NewSessionService(repo SessionRepository, idleTimeout, cacheTTL time.Duration) SessionService {
+	return &sessionService{
+		repo:        repo,
+		idleTimeout: idleTimeout,
+		cacheTTL:    cacheTTL,
+		now:         func() time.Time { return time.Now().UTC() },
+		cache:       map[string]cachedSession{},
+	}
+}
+
+func (s *sessionService) Start(ctx context.Context, userID, userAgent, ip string) (Session, error) {
+	now := s.now()
+	session := Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (s *sessionService) List(ctx context.Context, userID string) ([]Session, error) {
+	return s.repo.ListActive(ctx, userID, s.now().Add(-s.idleTimeout))
+}
+
+func (s *sessionService) Check(ctx context.Context, claims *TokenClaims) error {
+	// Tokens issued before sessions existed carry no sid.
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.cache[claims.SessionID]
+	s.mu.Unlock()
+
+	if !ok || now.Sub(entry.fetchedAt) >= s.cacheTTL {
+		session, err := s.repo.Get(ctx, claims.SessionID)
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+		entry = cachedSession{
+			revoked:   err != nil || session.RevokedAt != nil || session.UserID != claims.UserID,
+			fetchedAt: now,
+			touchedAt: session.LastSeenAt,
+		}
+	}
+	if entry.revoked {
+		s.store(claims.SessionID, entry)
+		return ErrSessionRevoked
+	}
+
+	if now.Sub(entry.touchedAt) >= sessionTouchInterval {
+		if err := s.repo.Touch(ctx, claims.SessionID, now); err != nil {
+			return err
+		}
+		entry.touchedAt = now
+	}
+	s.store(claims.SessionID, entry)
+	return nil
+}
+
+func (s *sessionService) Resume(ctx context.Context, userID, id string) error {
+	session, err := s.repo.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+
+	now := s.now()
+	if session.UserID != userID || session.RevokedAt != nil || now.Sub(session.LastSeenAt) > s.idleTimeout {
+		return ErrSessionRevoked
+	}
+	return s.repo.Touch(ctx, id, now)
+}
+
+func (s *sessionService) Revoke(ctx context.Context, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrSessionNotFound
+	}
+
+	now := s.now()
+	ok, err := s.repo.Revoke(ctx, userID, id, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	s.store(id, cachedSession{revoked: true, fetchedAt: now})
+	return nil
+}
+
+func (s *sessionService) RevokeAll(ctx context.Context, userID string) error {
+	// Cached entries of other sessions expire within cacheTTL; the token
+	// version bump that accompanies this call covers the gap.
+	return s.repo.RevokeUser(ctx, userID, "", s.now())
+}
+
+func (s *sessionService) RevokeOthers(ctx context.Context, userID, keepID string) error {
+	return s.repo.RevokeUser(ctx, userID, keepID, s.now())
+}
+
+func (s *sessionService) store(id string, entry cachedSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= maxCachedChecks {
+		cutoff := s.now().Add(-s.cacheTTL)
+		for k, e := range s.cache {
+			if e.fetchedAt.Before(cutoff) {
+				delete(s.cache, k)
+			}
+		}
+	}
+	s.cache[id] = entry
+}
+
+type postgresSessionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionRepository(db *sql.DB) SessionRepository {
+	return &postgresSessionRepository{db: db}
+}
+
+func (r *postgresSessionRepository) Create(ctx context.Context, s Session) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+		s.ID, s.UserID, s.UserAgent, s.IP, s.CreatedAt, s.LastSeenAt,
+	)
+	return err
+}
+
+func (r *postgresSessionRepository) Get(ctx context.Context, id string) (Session, error) {
+	var s Session
+	var revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at
+         FROM sessions WHERE id = $1`,
+		id,
+	).Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Session{}, ErrSessionNotFound
+		}
+		return Session{}, err
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	return s, nil
+}
+
+func (r *postgresSessionRepository) ListActive(ctx context.Context, userID string, seenSince time.Time) ([]Session, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, user_agent, ip, created_at, last_seen_at
+         FROM sessions
+         WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at >= $2
+         ORDER BY last_seen_at DESC`,
+		userID, seenSince,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *postgresSessionRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE sessions SET last_seen_at = $2 WHERE id = $1 AND last_seen_at < $2`,
+		id, at,
+	)
+	return err
+}
+
+func (r *postgresSessionRepository) Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = $3
+         WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresSessionRepository) RevokeUser(ctx context.Context, userID, keepID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE sessions SET revoked_at = $3
+         WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2`,
+		userID, keepID, at,
+	)
+	return err
+}
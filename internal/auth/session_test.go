@@ -0,0 +1,140 @@
+// internal/auth/session_test.go
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSessionRepo keeps sessions in memory and counts reads and writes so
+// tests can see what the cache absorbed.
+type fakeSessionRepo struct {
+	sessions map[string]*Session
+	gets     int
+	touches  int
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{sessions: map[string]*Session{}}
+}
+
+func (f *fakeSessionRepo) Create(ctx context.Context, s Session) error {
+	f.sessions[s.ID] = &s
+	return nil
+}
+
+func (f *fakeSessionRepo) Get(ctx context.Context, id string) (Session, error) {
+	f.gets++
+	s, ok := f.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return *s, nil
+}
+
+func (f *fakeSessionRepo) ListActive(ctx context.Context, userID string, seenSince time.Time) ([]Session, error) {
+	var out []Session
+	for _, s := range f.sessions {
+		if s.UserID == userID && s.RevokedAt == nil && !s.LastSeenAt.Before(seenSince) {
+			out = append(out, *s)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSessionRepo) Touch(ctx context.Context, id string, at time.Time) error {
+	f.touches++
+	f.sessions[id].LastSeenAt = at
+	return nil
+}
+
+func (f *fakeSessionRepo) Revoke(ctx context.Context, userID, id string, at time.Time) (bool, error) {
+	s, ok := f.sessions[id]
+	if !ok || s.UserID != userID || s.RevokedAt != nil {
+		return false, nil
+	}
+	s.RevokedAt = &at
+	return true, nil
+}
+
+func (f *fakeSessionRepo) RevokeUser(ctx context.Context, userID, keepID string, at time.Time) error {
+	for _, s := range f.sessions {
+		if s.UserID == userID && s.RevokedAt == nil && s.ID != keepID {
+			s.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+// TestSessions_RevokeRejectsTokens
+// --------------------------------
+// Once a session is revoked, tokens carrying its sid fail the check while
+// other sessions of the same user are unaffected.
+func TestSessions_RevokeRejectsTokens(t *testing.T) {
+	svc := NewSessionService(newFakeSessionRepo(), time.Hour, time.Minute)
+	ctx := context.Background()
+
+	phone, err := svc.Start(ctx, "user-1", "phone", "10.0.0.1")
+	require.NoError(t, err)
+	laptop, err := svc.Start(ctx, "user-1", "laptop", "10.0.0.2")
+	require.NoError(t, err)
+
+	phoneClaims := &TokenClaims{UserID: "user-1", SessionID: phone.ID}
+	require.NoError(t, svc.Check(ctx, phoneClaims))
+
+	require.NoError(t, svc.Revoke(ctx, "user-1", phone.ID))
+
+	assert.ErrorIs(t, svc.Check(ctx, phoneClaims), ErrSessionRevoked)
+	assert.NoError(t, svc.Check(ctx, &TokenClaims{UserID: "user-1", SessionID: laptop.ID}))
+
+	active, err := svc.List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, "laptop", active[0].UserAgent)
+}
+
+// TestSessions_RevokeOnlyOwn
+// --------------------------
+// A user cannot revoke someone else's session, nor an ID that isn't one.
+func TestSessions_RevokeOnlyOwn(t *testing.T) {
+	svc := NewSessionService(newFakeSessionRepo(), time.Hour, time.Minute)
+	ctx := context.Background()
+
+	s, err := svc.Start(ctx, "user-1", "phone", "10.0.0.1")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.Revoke(ctx, "user-2", s.ID), ErrSessionNotFound)
+	assert.ErrorIs(t, svc.Revoke(ctx, "user-1", "not-a-uuid"), ErrSessionNotFound)
+	assert.NoError(t, svc.Check(ctx, &TokenClaims{UserID: "user-1", SessionID: s.ID}))
+}
+
+// TestSessions_CheckCachesAndThrottlesTouch
+// -----------------------------------------
+// Repeated checks read the session once per cache TTL and write last-seen
+// at most once per touch interval.
+func TestSessions_CheckCachesAndThrottlesTouch(t *testing.T) {
+	repo := newFakeSessionRepo()
+	svc := NewSessionService(repo, time.Hour, 30*time.Second).(*sessionService)
+	ctx := context.Background()
+
+	s, err := svc.Start(ctx, "user-1", "phone", "10.0.0.1")
+	require.NoError(t, err)
+	claims := &TokenClaims{UserID: "user-1", SessionID: s.ID}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, svc.Check(ctx, claims))
+	}
+	assert.Equal(t, 1, repo.gets)
+	assert.Equal(t, 0, repo.touches)
+
+	later := time.Now().UTC().Add(2 * time.Minute)
+	svc.now = func() time.Time { return later }
+	require.NoError(t, svc.Check(ctx, claims))
+	assert.Equal(t, 2, repo.gets)
+	assert.Equal(t, 1, repo.touches)
+	assert.Equal(t, later, repo.sessions[s.ID].LastSeenAt)
+}
@@ -7,12 +7,18 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // TokenService is an interface so we can swap implementation or mock in tests.
 type TokenService interface {
-	GenerateToken(user *User) (string, error)
+	GenerateToken(user *User, sessionID string) (string, error)
+	// GenerateClientToken issues a token for an OAuth client acting for
+	// the user, limited to scopes.
+	GenerateClientToken(user *User, sessionID, clientID string, scopes []Permission) (string, error)
 	ParseToken(tokenStr string) (*TokenClaims, error)
+	// JWKS publishes the verification keys; it is empty for shared secrets.
+	JWKS() JWKSet
 }
 
 // jwtTokenService is our concrete implementation using HS256.
@@ -30,32 +36,117 @@ func NewJWTTokenService(secret, issuer string, ttl time.Duration) TokenService {
 	}
 }
 
-func (s *jwtTokenService) GenerateToken(user *User) (string, error) {
-	now := time.Now().UTC()
+func (s *jwtTokenService) GenerateToken(user *User, sessionID string) (string, error) {
+	return s.sign(newTokenClaims(user, sessionID, s.issuer, s.ttl))
+}
 
-	claims := TokenClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    s.issuer,
-			Subject:   user.ID,
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
-		},
-	}
+func (s *jwtTokenService) GenerateClientToken(user *User, sessionID, clientID string, scopes []Permission) (string, error) {
+	claims := newTokenClaims(user, sessionID, s.issuer, s.ttl)
+	claims.ClientID = clientID
+	claims.Scopes = scopes
+	return s.sign(claims)
+}
 
+func (s *jwtTokenService) sign(claims TokenClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.secret)
 }
 
 func (s *jwtTokenService) ParseToken(tokenStr string) (*TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, func(t *jwt.Token) (interface{}, error) {
+	return parseTokenClaims(tokenStr, func(t *jwt.Token) (interface{}, error) {
 		// Make sure the signing method is what we expect
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %T", t.Method)
 		}
 		return s.secret, nil
 	})
+}
+
+func (s *jwtTokenService) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{}}
+}
+
+// keySetTokenService signs with the active key of a KeySet (RS256 or
+// EdDSA) and names it in the kid header, so verifiers need only the
+// public keys.
+type keySetTokenService struct {
+	keys   KeySet
+	issuer string
+	ttl    time.Duration
+}
+
+// NewKeySetTokenService signs with keys. The KeySet's retention should be
+// at least ttl so rotated keys outlive the tokens they signed.
+func NewKeySetTokenService(keys KeySet, issuer string, ttl time.Duration) TokenService {
+	return &keySetTokenService{
+		keys:   keys,
+		issuer: issuer,
+		ttl:    ttl,
+	}
+}
+
+func (s *keySetTokenService) GenerateToken(user *User, sessionID string) (string, error) {
+	return s.sign(newTokenClaims(user, sessionID, s.issuer, s.ttl))
+}
+
+func (s *keySetTokenService) GenerateClientToken(user *User, sessionID, clientID string, scopes []Permission) (string, error) {
+	claims := newTokenClaims(user, sessionID, s.issuer, s.ttl)
+	claims.ClientID = clientID
+	claims.Scopes = scopes
+	return s.sign(claims)
+}
+
+func (s *keySetTokenService) sign(claims TokenClaims) (string, error) {
+	key, err := s.keys.Signer()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+func (s *keySetTokenService) ParseToken(tokenStr string) (*TokenClaims, error) {
+	return parseTokenClaims(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		pub, alg, err := s.keys.PublicKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// The key decides the algorithm, never the token.
+		if t.Method.Alg() != alg {
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Method.Alg())
+		}
+		return pub, nil
+	}, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}))
+}
+
+func (s *keySetTokenService) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
+func newTokenClaims(user *User, sessionID, issuer string, ttl time.Duration) TokenClaims {
+	now := time.Now().UTC()
+
+	return TokenClaims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		TokenVersion:  user.TokenVersion,
+		SessionID:     sessionID,
+		Role:          user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    issuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+func parseTokenClaims(tokenStr string, keyFunc jwt.Keyfunc, opts ...jwt.ParserOption) (*TokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, keyFunc, opts...)
 	if err != nil {
 		return nil, err
 	}
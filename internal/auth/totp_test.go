@@ -0,0 +1,55 @@
+// internal/auth/totp_test.go
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHOTP_RFC6238Vectors
+// ------------------------
+// The SHA-1 test vectors of RFC 6238, appendix B (eight digits).
+func TestHOTP_RFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range vectors {
+		assert.Equal(t, want, hotp(key, totpStep(time.Unix(unix, 0)), 8), "t=%d", unix)
+	}
+}
+
+// TestVerifyTOTP_Skew
+// -------------------
+// Codes one step off are accepted and report their own step; codes
+// further away and malformed codes are not.
+func TestVerifyTOTP_Skew(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	key := []byte("12345678901234567890")
+	now := time.Unix(1_700_000_000, 0)
+
+	step, ok := verifyTOTP(secret, hotp(key, totpStep(now)-1, totpDigits), now)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now)-1, step)
+
+	_, ok = verifyTOTP(secret, hotp(key, totpStep(now)+2, totpDigits), now)
+	assert.False(t, ok)
+
+	_, ok = verifyTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+// TestOtpauthURI
+// --------------
+// The URI follows the Key Uri Format understood by authenticator apps.
+func TestOtpauthURI(t *testing.T) {
+	uri := otpauthURI("Calc", "a@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/Calc:a@example.com?algorithm=SHA1&digits=6&issuer=Calc&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
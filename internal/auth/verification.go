@@ -0,0 +1,349 @@
+// internal/auth/verification.go
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+)
+
+var (
+	ErrInvalidVerification   = errors.New("invalid or expired verification code")
+	ErrVerificationThrottled = errors.New("verification email sent recently")
+	ErrEmailNotVerified      = errors.New("email not verified")
+)
+
+const (
+	DefaultVerificationTTL    = 24 * time.Hour
+	DefaultVerificationResend = time.Minute
+	// maxVerificationAttempts is how many codes, right or wrong, may be
+	// tried against a verification.
+	maxVerificationAttempts = 5
+)
+
+// EmailVerification is one verification email: a link token and a short
+// code, both stored hashed, for a specific address.
+type EmailVerification struct {
+	ID        string
+	UserID    string
+	Email     string
+	TokenHash string
+	CodeHash  string
+	Attempts  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, v EmailVerification) error
+	// FindByTokenHash and FindLatest return ErrInvalidVerification when
+	// nothing matches.
+	FindByTokenHash(ctx context.Context, hash string) (EmailVerification, error)
+	FindLatest(ctx context.Context, userID string) (EmailVerification, error)
+	// AddAttempt atomically counts a code attempt and returns the new
+	// attempt count.
+	AddAttempt(ctx context.Context, id string) (int, error)
+	// MarkUsed reports false if the verification was already used.
+	MarkUsed(ctx context.Context, id string, at time.Time) (bool, error)
+	InvalidateUser(ctx context.Context, userID string, at time.Time) error
+}
+
+type VerificationConfig struct {
+	TTL time.Duration
+	// ResendInterval is the minimum time between emails to one address.
+	ResendInterval time.Duration
+	// VerifyURL is the page that accepts the token; it is sent as
+	// VerifyURL?token=<token>.
+	VerifyURL string
+	// RequireForLogin refuses logins until the address is verified.
+	RequireForLogin bool
+}
+
+type VerificationService interface {
+	// Send mails a new link and code, replacing earlier ones. Unknown and
+	// already verified addresses succeed without sending anything;
+	// ErrVerificationThrottled is returned for any address asked for
+	// again within the resend interval.
+	Send(ctx context.Context, email string) error
+	VerifyToken(ctx context.Context, token string) error
+	VerifyCode(ctx context.Context, email, code string) error
+	// CheckLogin returns ErrEmailNotVerified when the deployment requires
+	// verification and the user has not verified.
+	CheckLogin(user *User) error
+}
+
+type verificationService struct {
+	users    UserRepository
+	repo     EmailVerificationRepository
+	mailer   mail.Mailer
+	cfg      VerificationConfig
+	throttle *throttle
+	now      func() time.Time
+}
+
+func NewVerificationService(users UserRepository, repo EmailVerificationRepository, mailer mail.Mailer, cfg VerificationConfig) VerificationService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultVerificationTTL
+	}
+	if cfg.ResendInterval <= 0 {
+		cfg.ResendInterval = DefaultVerificationResend
+	}
+	return &verificationService{
+		users:    users,
+		repo:     repo,
+		mailer:   mailer,
+		cfg:      cfg,
+		throttle: newThrottle(cfg.ResendInterval),
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *verificationService) Send(ctx context.Context, email string) error {
+	// Throttle on the address itself, before looking it up, so the
+	// response does not tell whether it has an account.
+	if !s.throttle.allow(strings.ToLower(email), s.now()) {
+		return ErrVerificationThrottled
+	}
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	code, err := newVerificationCode()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if err := s.repo.InvalidateUser(ctx, user.ID, now); err != nil {
+		return err
+	}
+	v := EmailVerification{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.TTL),
+	}
+	v.CodeHash = hashCode(v.ID, code)
+	if err := s.repo.Create(ctx, v); err != nil {
+		return err
+	}
+
+	link := s.cfg.VerifyURL + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm this address for your calculator account by opening:\n%s\n\n"+
+			"or by entering the code %s.\n\nBoth expire in %s.\n",
+			link, code, s.cfg.TTL),
+	})
+}
+
+func (s *verificationService) VerifyToken(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidVerification
+	}
+	v, err := s.repo.FindByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	return s.complete(ctx, v)
+}
+
+func (s *verificationService) VerifyCode(ctx context.Context, email, code string) error {
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidVerification
+		}
+		return err
+	}
+	v, err := s.repo.FindLatest(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if v.UsedAt != nil {
+		return ErrInvalidVerification
+	}
+	// Count the attempt before looking at the code, so parallel guesses
+	// cannot all pass a limit read before any of them was recorded.
+	attempts, err := s.repo.AddAttempt(ctx, v.ID)
+	if err != nil {
+		return err
+	}
+	if attempts > maxVerificationAttempts || v.CodeHash != hashCode(v.ID, code) {
+		return ErrInvalidVerification
+	}
+	return s.complete(ctx, v)
+}
+
+func (s *verificationService) CheckLogin(user *User) error {
+	if s.cfg.RequireForLogin && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+func (s *verificationService) complete(ctx context.Context, v EmailVerification) error {
+	now := s.now()
+	if v.UsedAt != nil || !now.Before(v.ExpiresAt) {
+		return ErrInvalidVerification
+	}
+	ok, err := s.repo.MarkUsed(ctx, v.ID, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidVerification
+	}
+	err = s.users.MarkEmailVerified(ctx, v.UserID, v.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		// The address changed since the email was sent.
+		return ErrInvalidVerification
+	}
+	return err
+}
+
+// newVerificationCode returns six random decimal digits.
+func newVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashCode binds a code to its verification so equal codes sent to
+// different users hash differently.
+func hashCode(verificationID, code string) string {
+	return hashToken(verificationID + ":" + strings.TrimSpace(code))
+}
+
+// throttle allows one event per key per interval. It is in memory, so
+// with several instances the effective limit is per instance.
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{interval: interval, last: map[string]time.Time{}}
+}
+
+func (t *throttle) allow(key string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last, ok := t.last[key]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	if len(t.last) >= maxCachedChecks {
+		for k, last := range t.last {
+			if now.Sub(last) >= t.interval {
+				delete(t.last, k)
+			}
+		}
+	}
+	t.last[key] = now
+	return true
+}
+
+type postgresEmailVerificationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresEmailVerificationRepository(db *sql.DB) EmailVerificationRepository {
+	return &postgresEmailVerificationRepository{db: db}
+}
+
+func (r *postgresEmailVerificationRepository) Create(ctx context.Context, v EmailVerification) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO email_verifications (id, user_id, email, token_hash, code_hash, created_at, expires_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		v.ID, v.UserID, v.Email, v.TokenHash, v.CodeHash, v.CreatedAt, v.ExpiresAt,
+	)
+	return err
+}
+
+const selectEmailVerification = `
+SELECT id, user_id, email, token_hash, code_hash, attempts, created_at, expires_at, used_at
+FROM email_verifications`
+
+func (r *postgresEmailVerificationRepository) FindByTokenHash(ctx context.Context, hash string) (EmailVerification, error) {
+	return r.scan(r.db.QueryRowContext(ctx, selectEmailVerification+` WHERE token_hash = $1`, hash))
+}
+
+func (r *postgresEmailVerificationRepository) FindLatest(ctx context.Context, userID string) (EmailVerification, error) {
+	return r.scan(r.db.QueryRowContext(ctx,
+		selectEmailVerification+` WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`, userID))
+}
+
+func (r *postgresEmailVerificationRepository) scan(row *sql.Row) (EmailVerification, error) {
+	var v EmailVerification
+	var usedAt sql.NullTime
+	err := row.Scan(&v.ID, &v.UserID, &v.Email, &v.TokenHash, &v.CodeHash, &v.Attempts, &v.CreatedAt, &v.ExpiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return EmailVerification{}, ErrInvalidVerification
+		}
+		return EmailVerification{}, err
+	}
+	if usedAt.Valid {
+		v.UsedAt = &usedAt.Time
+	}
+	return v, nil
+}
+
+func (r *postgresEmailVerificationRepository) AddAttempt(ctx context.Context, id string) (int, error) {
+	var attempts int
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE email_verifications SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts`,
+		id,
+	).Scan(&attempts)
+	return attempts, err
+}
+
+func (r *postgresEmailVerificationRepository) MarkUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE email_verifications SET used_at = $2 WHERE id = $1 AND used_at IS NULL`,
+		id, at,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresEmailVerificationRepository) InvalidateUser(ctx context.Context, userID string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE email_verifications SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`,
+		userID, at,
+	)
+	return err
+}
@@ -0,0 +1,182 @@
+// internal/auth/verification_test.go
+package auth
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/mail"
+)
+
+// fakeVerificationRepo keeps verifications in memory, in creation order.
+type fakeVerificationRepo struct {
+	all []*EmailVerification
+}
+
+func (f *fakeVerificationRepo) Create(ctx context.Context, v EmailVerification) error {
+	f.all = append(f.all, &v)
+	return nil
+}
+
+func (f *fakeVerificationRepo) FindByTokenHash(ctx context.Context, hash string) (EmailVerification, error) {
+	for _, v := range f.all {
+		if v.TokenHash == hash {
+			return *v, nil
+		}
+	}
+	return EmailVerification{}, ErrInvalidVerification
+}
+
+func (f *fakeVerificationRepo) FindLatest(ctx context.Context, userID string) (EmailVerification, error) {
+	for i := len(f.all) - 1; i >= 0; i-- {
+		if f.all[i].UserID == userID {
+			return *f.all[i], nil
+		}
+	}
+	return EmailVerification{}, ErrInvalidVerification
+}
+
+func (f *fakeVerificationRepo) AddAttempt(ctx context.Context, id string) (int, error) {
+	for _, v := range f.all {
+		if v.ID == id {
+			v.Attempts++
+			return v.Attempts, nil
+		}
+	}
+	return 0, nil
+}
+
+func (f *fakeVerificationRepo) MarkUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	for _, v := range f.all {
+		if v.ID == id && v.UsedAt == nil {
+			v.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeVerificationRepo) InvalidateUser(ctx context.Context, userID string, at time.Time) error {
+	for _, v := range f.all {
+		if v.UserID == userID && v.UsedAt == nil {
+			v.UsedAt = &at
+		}
+	}
+	return nil
+}
+
+type verificationFixture struct {
+	svc    *verificationService
+	users  *fakeUserRepo
+	outbox *bytes.Buffer
+}
+
+func newVerificationFixture(t *testing.T, cfg VerificationConfig) *verificationFixture {
+	t.Helper()
+	users := &fakeUserRepo{createdUsers: []User{{ID: "user-1", Email: "a@example.com"}}}
+	outbox := &bytes.Buffer{}
+	cfg.VerifyURL = "https://calc.example.com/verify-email"
+	svc := NewVerificationService(users, &fakeVerificationRepo{}, mail.NewLogMailer(outbox, "calc@example.com"), cfg)
+	return &verificationFixture{svc: svc.(*verificationService), users: users, outbox: outbox}
+}
+
+var (
+	verifyLink = regexp.MustCompile(`verify-email\?token=([A-Za-z0-9_-]+)`)
+	verifyCode = regexp.MustCompile(`code (\d{6})`)
+)
+
+func lastMatch(t *testing.T, re *regexp.Regexp, s string) string {
+	t.Helper()
+	all := re.FindAllStringSubmatch(s, -1)
+	require.NotEmpty(t, all)
+	return all[len(all)-1][1]
+}
+
+// TestVerification_Link
+// ---------------------
+// The emailed link verifies the address once.
+func TestVerification_Link(t *testing.T) {
+	f := newVerificationFixture(t, VerificationConfig{})
+	ctx := context.Background()
+
+	require.NoError(t, f.svc.Send(ctx, "a@example.com"))
+	token := lastMatch(t, verifyLink, f.outbox.String())
+
+	require.NoError(t, f.svc.VerifyToken(ctx, token))
+	assert.True(t, f.users.createdUsers[0].EmailVerified)
+	assert.ErrorIs(t, f.svc.VerifyToken(ctx, token), ErrInvalidVerification)
+}
+
+// TestVerification_CodeAttempts
+// -----------------------------
+// Every code tried counts against the verification; after five tries the
+// right code no longer works either.
+func TestVerification_CodeAttempts(t *testing.T) {
+	f := newVerificationFixture(t, VerificationConfig{})
+	ctx := context.Background()
+
+	require.NoError(t, f.svc.Send(ctx, "a@example.com"))
+	code := lastMatch(t, verifyCode, f.outbox.String())
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	assert.ErrorIs(t, f.svc.VerifyCode(ctx, "a@example.com", wrong), ErrInvalidVerification)
+	require.NoError(t, f.svc.VerifyCode(ctx, "a@example.com", code))
+	assert.True(t, f.users.createdUsers[0].EmailVerified)
+
+	// A fresh account burns its code after too many guesses.
+	f.users.createdUsers[0].EmailVerified = false
+	f.svc.now = func() time.Time { return time.Now().UTC().Add(time.Hour) }
+	require.NoError(t, f.svc.Send(ctx, "a@example.com"))
+	code = lastMatch(t, verifyCode, f.outbox.String())
+	for i := 0; i < maxVerificationAttempts; i++ {
+		_ = f.svc.VerifyCode(ctx, "a@example.com", wrong)
+	}
+	assert.ErrorIs(t, f.svc.VerifyCode(ctx, "a@example.com", code), ErrInvalidVerification)
+	assert.False(t, f.users.createdUsers[0].EmailVerified)
+	v, err := f.svc.repo.FindLatest(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, maxVerificationAttempts+1, v.Attempts)
+}
+
+// TestVerification_ResendThrottled
+// --------------------------------
+// A second email within the interval is refused, for unknown addresses
+// too, and allowed once the interval has passed.
+func TestVerification_ResendThrottled(t *testing.T) {
+	f := newVerificationFixture(t, VerificationConfig{ResendInterval: time.Minute})
+	ctx := context.Background()
+
+	require.NoError(t, f.svc.Send(ctx, "a@example.com"))
+	assert.ErrorIs(t, f.svc.Send(ctx, "A@example.com"), ErrVerificationThrottled)
+
+	require.NoError(t, f.svc.Send(ctx, "nobody@example.com"))
+	assert.ErrorIs(t, f.svc.Send(ctx, "nobody@example.com"), ErrVerificationThrottled)
+
+	f.svc.now = func() time.Time { return time.Now().UTC().Add(2 * time.Minute) }
+	assert.NoError(t, f.svc.Send(ctx, "a@example.com"))
+}
+
+// TestVerification_CheckLogin
+// ---------------------------
+// Unverified users may log in unless the deployment requires verification.
+func TestVerification_CheckLogin(t *testing.T) {
+	user := &User{ID: "user-1"}
+
+	open := newVerificationFixture(t, VerificationConfig{})
+	assert.NoError(t, open.svc.CheckLogin(user))
+
+	strict := newVerificationFixture(t, VerificationConfig{RequireForLogin: true})
+	assert.ErrorIs(t, strict.svc.CheckLogin(user), ErrEmailNotVerified)
+
+	user.EmailVerified = true
+	assert.NoError(t, strict.svc.CheckLogin(user))
+}
@@ -0,0 +1,70 @@
+// internal/calculator/constants.go
+package calculator
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownConstant = errors.New("unknown constant")
+
+// Constant is a named mathematical or physical constant. Uncertainty is the
+// absolute standard uncertainty (0 for exact values).
+type Constant struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Value       float64 `json:"value"`
+	Unit        string  `json:"unit"`
+	Uncertainty float64 `json:"uncertainty"`
+	Source      string  `json:"source"`
+}
+
+//go:embed constants.json
+var constantsJSON []byte
+
+// constantTable is the embedded table, in file order.
+var constantTable = mustLoadConstants(constantsJSON)
+
+// constantsByName indexes constantTable. Names are case-sensitive (G ≠ g).
+var constantsByName = indexConstants(constantTable)
+
+func mustLoadConstants(data []byte) []Constant {
+	var cs []Constant
+	if err := json.Unmarshal(data, &cs); err != nil {
+		panic(fmt.Sprintf("calculator: invalid embedded constants table: %v", err))
+	}
+	return cs
+}
+
+func indexConstants(cs []Constant) map[string]Constant {
+	m := make(map[string]Constant, len(cs))
+	for _, c := range cs {
+		m[c.Name] = c
+	}
+	return m
+}
+
+func lookupConstant(name string) (Constant, error) {
+	c, ok := constantsByName[name]
+	if !ok {
+		return Constant{}, fmt.Errorf("%w: %q", ErrUnknownConstant, name)
+	}
+	return c, nil
+}
+
+// constantsMetadata is what a history entry stores about the constants used.
+func constantsMetadata(used []Constant) []map[string]any {
+	out := make([]map[string]any, len(used))
+	for i, c := range used {
+		out[i] = map[string]any{
+			"name":        c.Name,
+			"value":       c.Value,
+			"unit":        c.Unit,
+			"uncertainty": c.Uncertainty,
+			"source":      c.Source,
+		}
+	}
+	return out
+}
@@ -0,0 +1,356 @@
+// internal/calculator/evaluate.go
+package calculator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// evalConfig carries the per-request settings of an evaluation.
+type evalConfig struct {
+	explain   bool
+	format    numeric.NumberFormat
+	special   numeric.SpecialValuePolicy
+	maxSteps  int
+	tolerance float64
+	angle     numeric.AngleMode
+}
+
+// evaluator walks an AST and computes its value. When trace is non-nil,
+// every decision it takes is recorded as a Step. Numbers in the trace
+// are rendered with format.
+type evaluator struct {
+	trace   *trace
+	format  numeric.NumberFormat
+	special numeric.SpecialValuePolicy
+	steps   int
+
+	maxSteps  int
+	tolerance float64
+	angle     numeric.AngleMode
+
+	// vars holds the bound variables of the enclosing series.
+	vars map[string]float64
+
+	// constants lists every constant referenced, in first-use order.
+	constants []Constant
+}
+
+func newEvaluator(cfg evalConfig) *evaluator {
+	e := &evaluator{
+		format:    cfg.format,
+		special:   cfg.special,
+		maxSteps:  cfg.maxSteps,
+		tolerance: cfg.tolerance,
+		angle:     cfg.angle,
+		vars:      make(map[string]float64),
+	}
+	if e.maxSteps <= 0 {
+		e.maxSteps = DefaultMaxEvalSteps
+	}
+	if e.tolerance <= 0 {
+		e.tolerance = DefaultTolerance
+	}
+	if cfg.explain {
+		e.trace = newTrace()
+	}
+	return e
+}
+
+// explain copies the collected trace into the result, if any.
+func (e *evaluator) explain(res *CalculationResult) {
+	if e.trace == nil {
+		return
+	}
+	res.Steps = e.trace.steps
+	res.Explanation = renderSteps(e.trace.steps)
+}
+
+// text renders a node with the evaluator's number format.
+func (e *evaluator) text(n node) string { return n.render(e.format) }
+
+// num renders a value with the evaluator's number format.
+func (e *evaluator) num(v float64) string { return e.format.Format(v) }
+
+func (e *evaluator) eval(n node) (float64, error) {
+	e.steps++
+	if e.steps > e.maxSteps {
+		return 0, fmt.Errorf("%w: more than %d evaluation steps", ErrExpressionTooComplex, e.maxSteps)
+	}
+
+	var (
+		v   float64
+		err error
+	)
+	switch n := n.(type) {
+	case *numberNode:
+		v = n.value
+	case *constantNode:
+		v = e.evalConstant(n)
+	case *identNode:
+		v, err = e.evalIdent(n)
+	case *callNode:
+		v, err = e.evalCall(n)
+	case *seriesNode:
+		v, err = e.evalSeries(n)
+	case *groupNode:
+		if _, isNumber := n.inner.(*numberNode); !isNumber {
+			e.trace.add(RuleParentheses, e.text(n),
+				fmt.Sprintf("evaluate %s first because it is in parentheses", e.text(n)))
+		}
+		v, err = e.eval(n.inner)
+	case *unaryNode:
+		v, err = e.evalUnary(n)
+	case *binaryNode:
+		v, err = e.evalBinary(n)
+	case *percentNode:
+		v, err = e.evalPercent(n)
+	case *percentChangeNode:
+		v, err = e.evalPercentChange(n)
+	default:
+		err = fmt.Errorf("%w: unsupported node %T", ErrInvalidExpression, n)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Reject +Inf/-Inf/NaN as soon as they appear so the trace stops at
+	// the offending step.
+	if err := e.special.Check(v); err != nil {
+		return 0, fmt.Errorf("%w: %s", err, e.text(n))
+	}
+
+	e.trace.remember(n, v)
+	return v, nil
+}
+
+func (e *evaluator) evalUnary(n *unaryNode) (float64, error) {
+	v, err := e.eval(n.operand)
+	if err != nil {
+		return 0, err
+	}
+	if n.op == '+' {
+		return v, nil
+	}
+	e.trace.addValue(RuleNegation, e.text(n), fmt.Sprintf("-(%s) = %s", e.num(v), e.num(-v)), -v)
+	return -v, nil
+}
+
+func (e *evaluator) evalBinary(n *binaryNode) (float64, error) {
+	e.notePrecedence(n)
+
+	l, err := e.eval(n.left)
+	if err != nil {
+		return 0, err
+	}
+	var r float64
+	if pct, ok := n.right.(*percentNode); ok && (n.op == '+' || n.op == '-') {
+		// a ± b% adds or removes b percent of a
+		r, err = e.evalPercentOf(pct, l)
+	} else {
+		r, err = e.eval(n.right)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := applyBinary(n.op, l, r)
+	if err != nil {
+		return 0, err
+	}
+
+	e.noteDistribution(n, l, r, res)
+	e.noteFraction(n, l, r)
+	e.trace.addValue(operationRule(n.op), e.text(n),
+		fmt.Sprintf("%s %c %s = %s", e.num(l), n.op, e.num(r), e.num(res)), res)
+	return res, nil
+}
+
+func (e *evaluator) evalConstant(n *constantNode) float64 {
+	c := n.constant
+	seen := false
+	for _, used := range e.constants {
+		if used.Name == c.Name {
+			seen = true
+			break
+		}
+	}
+	if !seen {
+		e.constants = append(e.constants, c)
+		detail := fmt.Sprintf("%s (%s) = %s", c.Name, c.Description, e.num(c.Value))
+		if c.Unit != "" {
+			detail += " " + c.Unit
+		}
+		e.trace.addValue(RuleConstant, c.Name, detail+", "+c.Source, c.Value)
+	}
+	return c.Value
+}
+
+// evalIdent resolves a name: a bound series variable first, then a constant.
+func (e *evaluator) evalIdent(n *identNode) (float64, error) {
+	if v, ok := e.vars[n.name]; ok {
+		return v, nil
+	}
+	c, err := lookupConstant(n.name)
+	if err != nil {
+		return 0, err
+	}
+	return e.evalConstant(&constantNode{constant: c}), nil
+}
+
+// metadata returns what should be stored alongside the history entry.
+func (e *evaluator) metadata() map[string]any {
+	if len(e.constants) == 0 {
+		return nil
+	}
+	return map[string]any{"constants": constantsMetadata(e.constants)}
+}
+
+// evalPercent evaluates a standalone "x%" as x/100.
+func (e *evaluator) evalPercent(n *percentNode) (float64, error) {
+	p, err := e.eval(n.operand)
+	if err != nil {
+		return 0, err
+	}
+	v := p / 100
+	e.trace.addValue(RulePercent, e.text(n), fmt.Sprintf("%s%% = %s", e.num(p), e.num(v)), v)
+	return v, nil
+}
+
+// evalPercentOf evaluates "x%" relative to base, i.e. base * x / 100.
+func (e *evaluator) evalPercentOf(n *percentNode, base float64) (float64, error) {
+	p, err := e.eval(n.operand)
+	if err != nil {
+		return 0, err
+	}
+	v := base * p / 100
+	if err := e.special.Check(v); err != nil {
+		return 0, fmt.Errorf("%w: %s", err, e.text(n))
+	}
+	e.trace.addValue(RulePercent, e.text(n),
+		fmt.Sprintf("%s%% of %s = %s", e.num(p), e.num(base), e.num(v)), v)
+	e.trace.remember(n, v)
+	return v, nil
+}
+
+// evalPercentChange evaluates (to - from) / |from| * 100.
+func (e *evaluator) evalPercentChange(n *percentChangeNode) (float64, error) {
+	from, err := e.eval(n.from)
+	if err != nil {
+		return 0, err
+	}
+	to, err := e.eval(n.to)
+	if err != nil {
+		return 0, err
+	}
+	if from == 0 {
+		return 0, ErrDivisionByZero
+	}
+	v := (to - from) / math.Abs(from) * 100
+	e.trace.addValue(RulePercentChange, e.text(n),
+		fmt.Sprintf("(%s - %s) / |%s| * 100 = %s%%", e.num(to), e.num(from), e.num(from), e.num(v)), v)
+	return v, nil
+}
+
+// notePrecedence explains why a child operation is evaluated before its parent.
+func (e *evaluator) notePrecedence(n *binaryNode) {
+	if e.trace == nil {
+		return
+	}
+	for i, child := range []node{n.left, n.right} {
+		c, ok := child.(*binaryNode)
+		if !ok {
+			continue
+		}
+		switch {
+		case precedence(c.op) > precedence(n.op):
+			e.trace.add(RulePrecedence, e.text(c),
+				fmt.Sprintf("'%c' binds tighter than '%c', so %s is evaluated first", c.op, n.op, e.text(c)))
+		case i == 0 && c.op != '^' && precedence(c.op) == precedence(n.op):
+			e.trace.add(RuleAssociativity, e.text(c),
+				fmt.Sprintf("'%c' and '%c' have equal precedence and are evaluated left to right, so %s comes first", c.op, n.op, e.text(c)))
+		case i == 1 && c.op == '^' && n.op == '^':
+			e.trace.add(RuleAssociativity, e.text(c),
+				fmt.Sprintf("'^' is right-associative, so %s is evaluated first", e.text(c)))
+		}
+	}
+}
+
+// noteDistribution shows a * (b ± c) as a*b ± a*c when one factor is a
+// parenthesised sum or difference; (b ± c) * a is shown as b*a ± c*a, so
+// the step reads in the order the expression was written.
+func (e *evaluator) noteDistribution(n *binaryNode, l, r, res float64) {
+	if e.trace == nil || n.op != '*' {
+		return
+	}
+
+	factor, factorNode, group := l, n.left, n.right
+	groupFirst := false
+	if _, ok := group.(*groupNode); !ok {
+		factor, factorNode, group = r, n.right, n.left
+		groupFirst = true
+	}
+	if _, ok := group.(*groupNode); !ok {
+		return
+	}
+	sum, ok := unwrapGroup(group).(*binaryNode)
+	if !ok || (sum.op != '+' && sum.op != '-') {
+		return
+	}
+
+	a, b := e.trace.values[sum.left], e.trace.values[sum.right]
+	f := e.text(factorNode)
+	product := func(term node) string {
+		if groupFirst {
+			return e.text(term) + " * " + f
+		}
+		return f + " * " + e.text(term)
+	}
+	e.trace.addValue(RuleDistribution,
+		fmt.Sprintf("%s = %s %c %s", e.text(n), product(sum.left), sum.op, product(sum.right)),
+		fmt.Sprintf("distribute %s over %s: %s %c %s = %s", e.num(factor), e.text(group), e.num(a*factor), sum.op, e.num(b*factor), e.num(res)),
+		res)
+}
+
+// noteFraction shows x / (a / b) as x * (b / a).
+func (e *evaluator) noteFraction(n *binaryNode, l, r float64) {
+	if e.trace == nil || n.op != '/' {
+		return
+	}
+	frac, ok := unwrapGroup(n.right).(*binaryNode)
+	if !ok || frac.op != '/' {
+		return
+	}
+
+	a, b := e.trace.values[frac.left], e.trace.values[frac.right]
+	if a == 0 {
+		return
+	}
+	x := e.text(n.left)
+	e.trace.add(RuleDivideFraction,
+		fmt.Sprintf("%s / %s = %s * (%s / %s)", x, e.text(n.right), x, e.text(frac.right), e.text(frac.left)),
+		fmt.Sprintf("dividing %s by the fraction %s/%s is multiplying by its reciprocal %s/%s = %s",
+			e.num(l), e.num(a), e.num(b), e.num(b), e.num(a), e.num(1/r)))
+}
+
+// applyBinary performs a single arithmetic operation.
+func applyBinary(op byte, l, r float64) (float64, error) {
+	switch op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	case '/':
+		if r == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return l / r, nil
+	case '^':
+		return math.Pow(l, r), nil
+	default:
+		return 0, ErrInvalidOperation
+	}
+}
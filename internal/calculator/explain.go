@@ -0,0 +1,125 @@
+// internal/calculator/explain.go
+package calculator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// Rule names used in explanation steps.
+const (
+	RuleRunningResult  = "running result"
+	RulePrecedence     = "precedence"
+	RuleAssociativity  = "associativity"
+	RuleParentheses    = "parentheses"
+	RuleNegation       = "negation"
+	RuleAddition       = "addition"
+	RuleSubtraction    = "subtraction"
+	RuleMultiplication = "multiplication"
+	RuleDivision       = "division"
+	RuleExponentiation = "exponentiation"
+	RuleDistribution   = "distribution"
+	RuleDivideFraction = "division by a fraction"
+	RulePercent        = "percent"
+	RulePercentChange  = "percent change"
+	RuleConstant       = "constant"
+	RuleFunction       = "function"
+	RuleSeries         = "series"
+)
+
+// Step is one entry of an evaluation trace, in the order it was applied.
+type Step struct {
+	Index      int      `json:"index"`
+	Rule       string   `json:"rule"`
+	Expression string   `json:"expression,omitempty"`
+	Value      *float64 `json:"value,omitempty"`
+	Detail     string   `json:"detail"`
+}
+
+// MarshalJSON encodes Value through numeric.Float, see CalculationResult.
+func (s Step) MarshalJSON() ([]byte, error) {
+	type alias Step
+	out := struct {
+		alias
+		Value *numeric.Float `json:"value,omitempty"`
+	}{alias: alias(s)}
+	if s.Value != nil {
+		v := numeric.Float(*s.Value)
+		out.Value = &v
+	}
+	return json.Marshal(out)
+}
+
+// trace collects steps while the evaluator walks the AST.
+// A nil *trace is valid and records nothing, so the evaluator
+// does not need to branch on whether an explanation was requested.
+type trace struct {
+	steps  []Step
+	values map[node]float64
+}
+
+func newTrace() *trace {
+	return &trace{values: make(map[node]float64)}
+}
+
+func (t *trace) add(rule, expr, detail string) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, Step{
+		Index:      len(t.steps) + 1,
+		Rule:       rule,
+		Expression: expr,
+		Detail:     detail,
+	})
+}
+
+func (t *trace) addValue(rule, expr, detail string, v float64) {
+	if t == nil {
+		return
+	}
+	t.add(rule, expr, detail)
+	t.steps[len(t.steps)-1].Value = &v
+}
+
+// remember stores the value of an already evaluated node so later
+// steps (distribution, reciprocal) can refer to it.
+func (t *trace) remember(n node, v float64) {
+	if t == nil {
+		return
+	}
+	t.values[n] = v
+}
+
+// renderSteps builds the human-readable version of a trace.
+func renderSteps(steps []Step) string {
+	var b strings.Builder
+	for i, s := range steps {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%d. %s: %s", s.Index, s.Rule, s.Detail)
+	}
+	return b.String()
+}
+
+// operationRule maps a binary operator to the rule reported in the trace.
+func operationRule(op byte) string {
+	switch op {
+	case '+':
+		return RuleAddition
+	case '-':
+		return RuleSubtraction
+	case '*':
+		return RuleMultiplication
+	case '/':
+		return RuleDivision
+	case '^':
+		return RuleExponentiation
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,524 @@
+// internal/calculator/expression.go
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+var ErrInvalidExpression = errors.New("invalid expression")
+var ErrExpressionTooComplex = errors.New("expression too complex")
+
+const (
+	// maxExpressionLength caps the raw input so parsing depth stays bounded.
+	maxExpressionLength = 1024
+	// DefaultMaxEvalSteps caps the number of nodes a single request may
+	// evaluate unless Config.MaxEvalSteps says otherwise.
+	DefaultMaxEvalSteps = 1_000_000
+)
+
+//
+// AST
+//
+
+// node is a single element of a parsed expression.
+type node interface {
+	// render prints the node, formatting numeric literals with f.
+	render(f numeric.NumberFormat) string
+}
+
+type numberNode struct {
+	value float64
+}
+
+type unaryNode struct {
+	op      byte
+	operand node
+}
+
+type binaryNode struct {
+	op          byte
+	left, right node
+}
+
+// groupNode keeps explicit parentheses so traces can refer to them.
+type groupNode struct {
+	inner node
+}
+
+// percentNode is a postfix "x%". On its own it means x/100; as the right
+// operand of + or - it means x% of the left operand, like a desk calculator
+// (200 + 10% = 220). In parentheses it is on its own again: 200 + (10%)
+// is 200.1.
+type percentNode struct {
+	operand node
+}
+
+// constantNode is a named constant from the embedded table.
+type constantNode struct {
+	constant Constant
+}
+
+// identNode is a name in an expression: a series variable if one is bound,
+// otherwise a constant.
+type identNode struct {
+	name string
+}
+
+// callNode is a call to a built-in function.
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+// seriesNode is sum(body, v = from..to) or prod(body, v = from..to).
+// A nil to means the series is infinite.
+type seriesNode struct {
+	product  bool
+	body     node
+	variable string
+	from, to node
+}
+
+// percentChangeNode is the relative change from one value to another, in
+// percent, written Δ%(from → to).
+type percentChangeNode struct {
+	from, to node
+}
+
+func (n *numberNode) render(f numeric.NumberFormat) string { return f.Format(n.value) }
+func (n *unaryNode) render(f numeric.NumberFormat) string {
+	return string(n.op) + n.operand.render(f)
+}
+func (n *binaryNode) render(f numeric.NumberFormat) string {
+	return n.left.render(f) + " " + string(n.op) + " " + n.right.render(f)
+}
+func (n *groupNode) render(f numeric.NumberFormat) string    { return "(" + n.inner.render(f) + ")" }
+func (n *constantNode) render(f numeric.NumberFormat) string { return n.constant.Name }
+func (n *identNode) render(f numeric.NumberFormat) string    { return n.name }
+func (n *callNode) render(f numeric.NumberFormat) string {
+	args := make([]string, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.render(f)
+	}
+	return n.name + "(" + strings.Join(args, ", ") + ")"
+}
+func (n *seriesNode) render(f numeric.NumberFormat) string {
+	name, to := "sum", "inf"
+	if n.product {
+		name = "prod"
+	}
+	if n.to != nil {
+		to = n.to.render(f)
+	}
+	return fmt.Sprintf("%s(%s, %s = %s..%s)", name, n.body.render(f), n.variable, n.from.render(f), to)
+}
+func (n *percentNode) render(f numeric.NumberFormat) string {
+	s := n.operand.render(f)
+	// -10% would parse as -(10%), which is no longer relative to the left
+	// operand of + or -.
+	switch n.operand.(type) {
+	case *unaryNode, *binaryNode, *percentNode:
+		return "(" + s + ")%"
+	}
+	if strings.HasPrefix(s, "-") {
+		return "(" + s + ")%"
+	}
+	return s + "%"
+}
+func (n *percentChangeNode) render(f numeric.NumberFormat) string {
+	return "Δ%(" + n.from.render(f) + " → " + n.to.render(f) + ")"
+}
+
+// precedence returns the binding strength of a binary operator.
+func precedence(op byte) int {
+	switch op {
+	case '+', '-':
+		return 1
+	case '*', '/':
+		return 2
+	case '^':
+		return 3
+	default:
+		return 0
+	}
+}
+
+// unwrapGroup strips any number of enclosing parentheses.
+func unwrapGroup(n node) node {
+	for {
+		g, ok := n.(*groupNode)
+		if !ok {
+			return n
+		}
+		n = g.inner
+	}
+}
+
+//
+// Lexer
+//
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokOperator
+	tokIdent
+	tokLParen
+	tokRParen
+	tokComma
+	tokEquals
+	tokRange         // ".." in series bounds
+	tokPercentChange // "Δ%"
+	tokArrow         // "→" in Δ%(from → to)
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value float64
+	pos   int
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '.' && i+1 < len(input) && input[i+1] == '.':
+			tokens = append(tokens, token{kind: tokRange, text: "..", pos: i})
+			i += 2
+		case isDigit(c) || c == '.':
+			start := i
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+				// stop before a range: 1..100
+				if input[i] == '.' && i+1 < len(input) && input[i+1] == '.' {
+					break
+				}
+				i++
+			}
+			// optional exponent: 1e10, 2.5E-3
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				j := i + 1
+				if j < len(input) && (input[j] == '+' || input[j] == '-') {
+					j++
+				}
+				if j < len(input) && isDigit(input[j]) {
+					for j < len(input) && isDigit(input[j]) {
+						j++
+					}
+					i = j
+				}
+			}
+			text := input[start:i]
+			// Literals past the float64 range become +Inf, which the special
+			// value policy rejects or reports like any other overflow.
+			v, err := strconv.ParseFloat(text, 64)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				return nil, fmt.Errorf("%w: invalid number %q at position %d", ErrInvalidExpression, text, start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, value: v, pos: start})
+		case isLetter(c):
+			start := i
+			for i < len(input) && (isLetter(input[i]) || isDigit(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: input[start:i], pos: start})
+		case strings.IndexByte("+-*/^%", c) >= 0:
+			tokens = append(tokens, token{kind: tokOperator, text: string(c), pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{kind: tokEquals, text: "=", pos: i})
+			i++
+		case strings.HasPrefix(input[i:], "Δ%"):
+			tokens = append(tokens, token{kind: tokPercentChange, text: "Δ%", pos: i})
+			i += len("Δ%")
+		case strings.HasPrefix(input[i:], "→"):
+			tokens = append(tokens, token{kind: tokArrow, text: "→", pos: i})
+			i += len("→")
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at position %d", ErrInvalidExpression, c, i)
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(input)})
+	return tokens, nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' }
+
+//
+// Parser (recursive descent)
+//
+//	expr    := term (('+' | '-') term)*
+//	term    := unary (('*' | '/') unary)*
+//	unary   := ('+' | '-') unary | power
+//	power   := primary '%'? ('^' unary)?
+//	primary := number | name | call | series | change | '(' expr ')'
+//	call    := name '(' expr (',' expr)* ')'
+//	series  := ('sum' | 'prod') '(' expr ',' name '=' expr '..' (expr | 'inf') ')'
+//	change  := 'Δ%' '(' expr '→' expr ')'
+//
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseExpression turns the textual expression into an AST.
+func parseExpression(input string) (node, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, fmt.Errorf("%w: empty expression", ErrInvalidExpression)
+	}
+	if len(input) > maxExpressionLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrExpressionTooComplex, maxExpressionLength)
+	}
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidExpression, tok.text, tok.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isOperator(ops string) bool {
+	tok := p.peek()
+	return tok.kind == tokOperator && strings.Contains(ops, tok.text)
+}
+
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+-") {
+		op := p.next().text[0]
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*/") {
+		op := p.next().text[0]
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("+-") {
+		op := p.next().text[0]
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePower()
+}
+
+func (p *parser) parsePower() (node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOperator("%") {
+		p.next()
+		base = &percentNode{operand: base}
+	}
+	if p.isOperator("^") {
+		p.next()
+		// right-associative: 2^3^2 = 2^(3^2)
+		exp, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: '^', left: base, right: exp}, nil
+	}
+	return base, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return &numberNode{value: tok.value}, nil
+	case tokIdent:
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		// Resolved at evaluation time: series variables shadow constants.
+		return &identNode{name: tok.text}, nil
+	case tokLParen:
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("%w: missing ')' at position %d", ErrInvalidExpression, closing.pos)
+		}
+		return &groupNode{inner: inner}, nil
+	case tokPercentChange:
+		return p.parsePercentChange()
+	case tokEOF:
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrInvalidExpression)
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidExpression, tok.text, tok.pos)
+	}
+}
+
+// expect consumes the next token if it has the given kind.
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		if tok.kind == tokEOF {
+			return tok, fmt.Errorf("%w: expected %s at end of expression", ErrInvalidExpression, what)
+		}
+		return tok, fmt.Errorf("%w: expected %s at position %d, got %q", ErrInvalidExpression, what, tok.pos, tok.text)
+	}
+	return tok, nil
+}
+
+// parseCall parses the argument list after a function name.
+func (p *parser) parseCall(name token) (node, error) {
+	p.next() // '('
+	if name.text == "sum" || name.text == "prod" {
+		return p.parseSeries(name.text == "prod")
+	}
+
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown function %q at position %d", ErrInvalidExpression, name.text, name.pos)
+	}
+
+	var args []node
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%w: %s takes %d argument(s), got %d", ErrInvalidExpression, name.text, fn.arity, len(args))
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+// parsePercentChange parses "(from → to)" after Δ%.
+func (p *parser) parsePercentChange() (node, error) {
+	if _, err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+	from, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokArrow, "'→'"); err != nil {
+		return nil, err
+	}
+	to, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return &percentChangeNode{from: from, to: to}, nil
+}
+
+// parseSeries parses "body, v = from..to)" after sum( or prod(.
+func (p *parser) parseSeries(product bool) (node, error) {
+	body, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokComma, "','"); err != nil {
+		return nil, err
+	}
+	variable, err := p.expect(tokIdent, "a variable name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokEquals, "'='"); err != nil {
+		return nil, err
+	}
+	from, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRange, "'..'"); err != nil {
+		return nil, err
+	}
+
+	var to node
+	if tok := p.peek(); tok.kind == tokIdent && tok.text == "inf" {
+		p.next()
+	} else if to, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+
+	return &seriesNode{product: product, body: body, variable: variable.text, from: from, to: to}, nil
+}
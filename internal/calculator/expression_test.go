@@ -0,0 +1,186 @@
+package calculator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// evalExplained parses and evaluates expr with tracing enabled.
+func evalExplained(t *testing.T, expr string) (float64, []Step) {
+	t.Helper()
+
+	tree, err := parseExpression(expr)
+	require.NoError(t, err)
+
+	ev := newEvaluator(evalConfig{explain: true})
+	v, err := ev.eval(tree)
+	require.NoError(t, err)
+	return v, ev.trace.steps
+}
+
+// rules returns the rule of every step, in order.
+func rules(steps []Step) []string {
+	out := make([]string, len(steps))
+	for i, s := range steps {
+		out[i] = s.Rule
+	}
+	return out
+}
+
+func TestParseExpression_Values(t *testing.T) {
+	cases := map[string]float64{
+		"1 + 2":         3,
+		"2 + 3 * 4":     14,
+		"(2 + 3) * 4":   20,
+		"10 - 4 - 3":    3,
+		"2 ^ 3 ^ 2":     512,
+		"-2 ^ 2":        -4,
+		"8 / (1 / 2)":   16,
+		"1.5e2 + .5":    150.5,
+		"-(3 - 5) * +2": 4,
+		"200 + 10%":     220,
+		"200 - 15%":     170,
+		"200 * 15%":     30,
+		"50%":           0.5,
+		"(100 + 20)%":   1.2,
+	}
+	for expr, want := range cases {
+		tree, err := parseExpression(expr)
+		require.NoError(t, err, expr)
+
+		got, err := newEvaluator(evalConfig{}).eval(tree)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, got, expr)
+	}
+}
+
+func TestExplain_PrecedenceDecision(t *testing.T) {
+	v, steps := evalExplained(t, "2 + 3 * 4")
+
+	assert.Equal(t, 14.0, v)
+	assert.Equal(t, []string{RulePrecedence, RuleMultiplication, RuleAddition}, rules(steps))
+	assert.Equal(t, "3 * 4", steps[0].Expression)
+	require.NotNil(t, steps[1].Value)
+	assert.Equal(t, 12.0, *steps[1].Value)
+}
+
+func TestExplain_Distribution(t *testing.T) {
+	v, steps := evalExplained(t, "3 * (2 + 4)")
+
+	assert.Equal(t, 18.0, v)
+	assert.Equal(t, []string{RuleParentheses, RuleAddition, RuleDistribution, RuleMultiplication}, rules(steps))
+	assert.Equal(t, "3 * (2 + 4) = 3 * 2 + 3 * 4", steps[2].Expression)
+	assert.Contains(t, steps[2].Detail, "6 + 12 = 18")
+
+	// The factor stays on the side it was written on.
+	v, steps = evalExplained(t, "(5 - 2) * 3")
+	assert.Equal(t, 9.0, v)
+	assert.Equal(t, "(5 - 2) * 3 = 5 * 3 - 2 * 3", steps[2].Expression)
+	assert.Contains(t, steps[2].Detail, "15 - 6 = 9")
+}
+
+func TestExplain_DivisionByFraction(t *testing.T) {
+	v, steps := evalExplained(t, "6 / (3 / 4)")
+
+	assert.Equal(t, 8.0, v)
+	assert.Contains(t, rules(steps), RuleDivideFraction)
+	for _, s := range steps {
+		if s.Rule == RuleDivideFraction {
+			assert.Equal(t, "6 / (3 / 4) = 6 * (4 / 3)", s.Expression)
+		}
+	}
+}
+
+func TestEvaluate_TooComplex(t *testing.T) {
+	long := make([]byte, maxExpressionLength+1)
+	for i := range long {
+		long[i] = '1'
+	}
+	_, err := parseExpression(string(long))
+	assert.ErrorIs(t, err, ErrExpressionTooComplex)
+}
+
+func TestSeries_Values(t *testing.T) {
+	cases := map[string]float64{
+		"sum(k^2, k = 1..100)":            338350,
+		"prod(k, k = 1..10)":              3628800,
+		"sum(k, k = 5..4)":                0, // empty range
+		"sum(sum(j, j = 1..k), k = 1..3)": 10,
+		"fib(10) + lucas(10)":             178,
+		"arith(1, 1, 100)":                5050,
+		"geom(1, 2, 10)":                  1023,
+		"geom_inf(1, 0.5)":                2,
+		"sum(1/2^k, k = 0..inf)":          2,
+		"2 * pi + sum(pi, k = 1..2)":      4 * 3.141592653589793,
+	}
+	for expr, want := range cases {
+		tree, err := parseExpression(expr)
+		require.NoError(t, err, expr)
+
+		got, err := newEvaluator(evalConfig{}).eval(tree)
+		require.NoError(t, err, expr)
+		assert.InDelta(t, want, got, 1e-9, expr)
+	}
+}
+
+func TestSeries_FibonacciOverflow(t *testing.T) {
+	fib, lucas := functions["fib"].apply, functions["lucas"].apply
+	for _, c := range []struct {
+		apply  func(numeric.AngleMode, []float64) (float64, error)
+		n      float64
+		finite bool
+	}{
+		{fib, maxFibIndex, true},
+		{fib, maxFibIndex + 1, false},
+		{lucas, 1474, true},
+		{lucas, 1475, false},
+	} {
+		v, err := c.apply(numeric.AngleRadians, []float64{c.n})
+		require.NoError(t, err, c.n)
+		assert.Equal(t, c.finite, !math.IsInf(v, 1), c.n)
+	}
+}
+
+func TestSeries_Explained(t *testing.T) {
+	v, steps := evalExplained(t, "sum(k^2, k = 1..3) + 1")
+
+	assert.Equal(t, 15.0, v)
+	assert.Equal(t, []string{RuleSeries, RuleAddition}, rules(steps))
+	assert.Equal(t, "sum of 3 terms for k = 1..3 = 14", steps[0].Detail)
+}
+
+func TestSeries_RangeOverStepLimit(t *testing.T) {
+	tree, err := parseExpression("sum(k, k = 1..1e12)")
+	require.NoError(t, err)
+
+	ev := newEvaluator(evalConfig{})
+	_, err = ev.eval(tree)
+	assert.ErrorIs(t, err, ErrExpressionTooComplex)
+	// rejected before evaluating any term
+	assert.Less(t, ev.steps, 10)
+}
+
+func TestSeries_Divergent(t *testing.T) {
+	for _, expr := range []string{"sum(1/k, k = 1..inf)", "sum(k, k = 1..inf)", "geom_inf(1, 2)"} {
+		tree, err := parseExpression(expr)
+		require.NoError(t, err, expr)
+
+		_, err = newEvaluator(evalConfig{maxSteps: 100000}).eval(tree)
+		assert.ErrorIs(t, err, ErrSeriesDiverges, expr)
+	}
+}
+
+func TestSeries_InvalidSyntax(t *testing.T) {
+	for _, expr := range []string{"sum(k, k = 1)", "sum(k, 1..2)", "sum(k, k = 0.5..2)", "nope(1)", "fib(1, 2)"} {
+		tree, err := parseExpression(expr)
+		if err == nil {
+			_, err = newEvaluator(evalConfig{}).eval(tree)
+		}
+		assert.ErrorIs(t, err, ErrInvalidExpression, expr)
+	}
+}
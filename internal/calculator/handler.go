@@ -3,9 +3,11 @@ package calculator
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
 )
 
 type Handler struct {
@@ -36,19 +38,113 @@ func (h *Handler) Calculate(w http.ResponseWriter, r *http.Request) {
 
 	res, err := h.svc.Calculate(r.Context(), userID, req)
 	if err != nil {
-		switch err {
-		case ErrInvalidOperation:
-			http.Error(w, `{"error":"invalid operation"}`, http.StatusBadRequest)
+		writeCalcError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Evaluate handles POST /api/v1/calc/expression.
+func (h *Handler) Evaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req ExpressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.Evaluate(r.Context(), userID, req)
+	if err != nil {
+		writeCalcError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Constants handles GET /api/v1/constants.
+func (h *Handler) Constants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.svc.Constants())
+}
+
+// Polynomial returns the handler for POST /api/v1/polynomial/{op}.
+func (h *Handler) Polynomial(op PolynomialOperation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
 			return
-		case ErrDivisionByZero:
-			http.Error(w, `{"error":"division by zero"}`, http.StatusBadRequest)
+		}
+
+		userID, _, ok := auth.UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		var req PolynomialRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			// Polynomial text is parsed while decoding; keep its position details.
+			if errors.Is(err, ErrInvalidPolynomial) || errors.Is(err, ErrExpressionTooComplex) {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
 			return
-		default:
-			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		}
+
+		res, err := h.svc.Polynomial(r.Context(), userID, op, req)
+		if err != nil {
+			writeCalcError(w, err)
 			return
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// writeCalcError maps service errors to HTTP responses.
+func writeCalcError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidOperation):
+		http.Error(w, `{"error":"invalid operation"}`, http.StatusBadRequest)
+	case errors.Is(err, ErrDivisionByZero):
+		http.Error(w, `{"error":"division by zero"}`, http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidExpression), errors.Is(err, ErrExpressionTooComplex),
+		errors.Is(err, ErrOverflow), errors.Is(err, ErrNotANumber),
+		errors.Is(err, ErrUnknownConstant), errors.Is(err, ErrSeriesDiverges),
+		errors.Is(err, ErrInvalidPolynomial), errors.Is(err, ErrConflictingOperands),
+		errors.Is(err, numeric.ErrInvalidFormat), errors.Is(err, numeric.ErrInvalidAngleMode):
+		// These carry position/limit details that are useful to the caller.
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
 	}
+}
 
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(res)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error": msg,
+	})
 }
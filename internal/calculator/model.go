@@ -1,6 +1,12 @@
 // internal/calculator/model.go
 package calculator
 
+import (
+	"encoding/json"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
 type Operation string
 
 const (
@@ -8,14 +14,123 @@ const (
 	OpSubtract Operation = "SUBTRACT"
 	OpMultiply Operation = "MULTIPLY"
 	OpDivide   Operation = "DIVIDE"
+
+	// Percent operations apply num as a percentage of the running result,
+	// like a desk calculator.
+	OpPercentAdd      Operation = "PERCENT_ADD"      // 200, 10 → 200 + 10% = 220
+	OpPercentSubtract Operation = "PERCENT_SUBTRACT" // 200, 15 → 200 - 15% = 170
+	OpPercentOf       Operation = "PERCENT_OF"       // 200, 15 → 200 * 15% = 30
+	OpPercentChange   Operation = "PERCENT_CHANGE"   // 200, 250 → Δ%(200 → 250) = 25
 )
 
+// operationSymbols maps each Operation to the operator used in the AST.
+var operationSymbols = map[Operation]byte{
+	OpAdd:      '+',
+	OpSubtract: '-',
+	OpMultiply: '*',
+	OpDivide:   '/',
+}
+
+// Constant, when set, names the operand instead of Num (see
+// GET /api/v1/constants); sending both is an error, sending neither
+// means 0. Format, when set, overrides the user's stored
+// display preferences for this request only.
 type CalculationRequest struct {
-	Num       float64   `json:"num"`
-	Operation Operation `json:"operation"`
+	Num       *float64              `json:"num,omitempty"`
+	Constant  string                `json:"constant,omitempty"`
+	Operation Operation             `json:"operation"`
+	Explain   bool                  `json:"explain,omitempty"`
+	Format    *numeric.NumberFormat `json:"format,omitempty"`
+}
+
+// ExpressionRequest evaluates a full infix expression such as "2 + 3 * (4 - 1)"
+// or "sum(k^2, k = 1..100)". MaxSteps lowers (never raises) the server's
+// evaluation step limit; Tolerance decides when an infinite series has
+// converged (default DefaultTolerance). AngleMode overrides the user's
+// stored angle unit for trigonometric functions.
+type ExpressionRequest struct {
+	Expression string                `json:"expression"`
+	Explain    bool                  `json:"explain,omitempty"`
+	Format     *numeric.NumberFormat `json:"format,omitempty"`
+	MaxSteps   int                   `json:"maxSteps,omitempty"`
+	Tolerance  float64               `json:"tolerance,omitempty"`
+	AngleMode  *numeric.AngleMode    `json:"angleMode,omitempty"`
 }
 
+// CalculationResult carries the full-precision Result alongside its
+// Formatted representation; Expression is rendered with the same format.
 type CalculationResult struct {
-	Expression string  `json:"expression"`
-	Result     float64 `json:"result"`
+	Expression  string  `json:"expression"`
+	Result      float64 `json:"result"`
+	Formatted   string  `json:"formatted"`
+	Steps       []Step  `json:"steps,omitempty"`
+	Explanation string  `json:"explanation,omitempty"`
+}
+
+// MarshalJSON writes Result through numeric.Float so non-finite values
+// (allowed by the "string" special value policy) still encode.
+func (r CalculationResult) MarshalJSON() ([]byte, error) {
+	type alias CalculationResult
+	return json.Marshal(struct {
+		alias
+		Result numeric.Float `json:"result"`
+	}{alias(r), numeric.Float(r.Result)})
+}
+
+// PolynomialOperation selects the polynomial endpoint,
+// POST /api/v1/polynomial/{operation}.
+type PolynomialOperation string
+
+const (
+	PolyAdd        PolynomialOperation = "add"
+	PolySubtract   PolynomialOperation = "subtract"
+	PolyMultiply   PolynomialOperation = "multiply"
+	PolyDivide     PolynomialOperation = "divide" // quotient and remainder
+	PolyGCD        PolynomialOperation = "gcd"
+	PolyEvaluate   PolynomialOperation = "evaluate"
+	PolyDerivative PolynomialOperation = "derivative"
+	PolyIntegral   PolynomialOperation = "integral"
+	PolyRoots      PolynomialOperation = "roots"
+	PolyFactor     PolynomialOperation = "factor"
+	PolySimplify   PolynomialOperation = "simplify" // the rational function p/q in lowest terms
+)
+
+// PolynomialOperations lists every operation, in the order they are routed.
+var PolynomialOperations = []PolynomialOperation{
+	PolyAdd, PolySubtract, PolyMultiply, PolyDivide, PolyGCD, PolyEvaluate,
+	PolyDerivative, PolyIntegral, PolyRoots, PolyFactor, PolySimplify,
+}
+
+// PolynomialRequest carries the operands of a polynomial operation.
+// P and Q are text ("x^2 - 1") or coefficients, highest degree first
+// ([1, 0, -1]). Q is the second operand of binary operations and the
+// denominator for simplify. X is the evaluation point; Order the
+// derivative order (default 1); Constant the integration constant, and
+// Lower/Upper, when both set, make the integral definite.
+type PolynomialRequest struct {
+	P        Polynomial  `json:"p"`
+	Q        *Polynomial `json:"q,omitempty"`
+	X        *Rational   `json:"x,omitempty"`
+	Order    int         `json:"order,omitempty"`
+	Constant *Rational   `json:"constant,omitempty"`
+	Lower    *Rational   `json:"lower,omitempty"`
+	Upper    *Rational   `json:"upper,omitempty"`
+}
+
+// PolynomialResult holds the canonical text of the result, which is also
+// what history stores. Value approximates an exact numeric Result
+// (evaluate, definite integral); the remaining fields are set only by
+// the operations they belong to.
+type PolynomialResult struct {
+	Expression   string             `json:"expression"`
+	Result       string             `json:"result"`
+	Coefficients []string           `json:"coefficients,omitempty"`
+	Value        *numeric.Float     `json:"value,omitempty"`
+	Remainder    *Polynomial        `json:"remainder,omitempty"`
+	Numerator    *Polynomial        `json:"numerator,omitempty"`
+	Denominator  *Polynomial        `json:"denominator,omitempty"`
+	Roots        []Root             `json:"roots,omitempty"`
+	Content      string             `json:"content,omitempty"`
+	Factors      []PolynomialFactor `json:"factors,omitempty"`
+	Complete     *bool              `json:"complete,omitempty"`
 }
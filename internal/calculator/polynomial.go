@@ -0,0 +1,574 @@
+// internal/calculator/polynomial.go
+package calculator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPolynomial = errors.New("invalid polynomial")
+
+const (
+	// maxPolynomialDegree bounds inputs and results so multiplication and
+	// factoring stay cheap.
+	maxPolynomialDegree = 256
+	// maxCoefficientBits bounds numerator and denominator of every coefficient.
+	maxCoefficientBits = 4096
+	// maxDecimalExponent is the largest exponent a Rational may be written
+	// with; 10^1233 is just above 2^4096.
+	maxDecimalExponent = 1233
+	// maxEvalBits bounds numerator and denominator while evaluating, so a
+	// large point cannot grow the Horner accumulator without limit.
+	maxEvalBits = 16 * maxCoefficientBits
+	// defaultVariable is used when a polynomial is given as coefficients.
+	defaultVariable = "x"
+)
+
+// Polynomial is a polynomial in one variable with exact rational
+// coefficients. The zero value is the zero polynomial in x.
+type Polynomial struct {
+	coeffs   []*big.Rat // coeffs[i] multiplies x^i; the last one is never zero
+	variable string
+}
+
+// NewPolynomial builds a polynomial from coefficients, highest degree
+// first: NewPolynomial(1, 0, -1) is x^2 - 1.
+func NewPolynomial(coeffs ...*big.Rat) Polynomial {
+	p := Polynomial{coeffs: make([]*big.Rat, len(coeffs))}
+	for i, c := range coeffs {
+		p.coeffs[len(coeffs)-1-i] = new(big.Rat).Set(c)
+	}
+	p.trim()
+	return p
+}
+
+// ParsePolynomial reads text such as "3x^2 - (1/2)x + 4" or "2*t^3 + t".
+// Coefficients may be integers, decimals or fractions; like terms are
+// combined. All terms must use the same variable.
+func ParsePolynomial(s string) (Polynomial, error) {
+	if len(s) > maxExpressionLength {
+		return Polynomial{}, fmt.Errorf("%w: more than %d characters", ErrExpressionTooComplex, maxExpressionLength)
+	}
+	ps := &polyScanner{input: s}
+	p, err := ps.parse()
+	if err != nil {
+		return Polynomial{}, err
+	}
+	return p, p.checkSize()
+}
+
+// Degree returns the degree, or -1 for the zero polynomial.
+func (p Polynomial) Degree() int { return len(p.coeffs) - 1 }
+
+// IsZero reports whether p is the zero polynomial.
+func (p Polynomial) IsZero() bool { return len(p.coeffs) == 0 }
+
+// Variable returns the variable name, "x" unless parsed otherwise.
+func (p Polynomial) Variable() string {
+	if p.variable == "" {
+		return defaultVariable
+	}
+	return p.variable
+}
+
+// Coefficient returns the coefficient of x^i.
+func (p Polynomial) Coefficient(i int) *big.Rat {
+	if i < 0 || i >= len(p.coeffs) {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(p.coeffs[i])
+}
+
+// Coefficients returns the coefficients as exact strings, highest degree first.
+func (p Polynomial) Coefficients() []string {
+	if p.IsZero() {
+		return []string{"0"}
+	}
+	out := make([]string, len(p.coeffs))
+	for i, c := range p.coeffs {
+		out[len(p.coeffs)-1-i] = c.RatString()
+	}
+	return out
+}
+
+// String returns the canonical form: terms by descending degree, integer
+// coefficients juxtaposed ("3x^2"), fractional ones parenthesised
+// ("(1/2)x"), unit coefficients omitted.
+func (p Polynomial) String() string {
+	if p.IsZero() {
+		return "0"
+	}
+	v := p.Variable()
+
+	var b strings.Builder
+	for i := len(p.coeffs) - 1; i >= 0; i-- {
+		c := p.coeffs[i]
+		if c.Sign() == 0 {
+			continue
+		}
+		switch {
+		case b.Len() == 0 && c.Sign() < 0:
+			b.WriteByte('-')
+		case b.Len() > 0 && c.Sign() < 0:
+			b.WriteString(" - ")
+		case b.Len() > 0:
+			b.WriteString(" + ")
+		}
+
+		abs := new(big.Rat).Abs(c)
+		switch {
+		case i == 0:
+			b.WriteString(abs.RatString())
+		case abs.IsInt() && abs.Num().Cmp(bigOne) == 0:
+		case abs.IsInt():
+			b.WriteString(abs.RatString())
+		default:
+			b.WriteString("(" + abs.RatString() + ")")
+		}
+
+		switch {
+		case i == 1:
+			b.WriteString(v)
+		case i > 1:
+			b.WriteString(v + "^" + strconv.Itoa(i))
+		}
+	}
+	return b.String()
+}
+
+// Add returns p + q.
+func (p Polynomial) Add(q Polynomial) Polynomial {
+	n := max(len(p.coeffs), len(q.coeffs))
+	out := Polynomial{coeffs: make([]*big.Rat, n), variable: sharedVariable(p, q)}
+	for i := range out.coeffs {
+		out.coeffs[i] = new(big.Rat).Add(p.Coefficient(i), q.Coefficient(i))
+	}
+	out.trim()
+	return out
+}
+
+// Sub returns p - q.
+func (p Polynomial) Sub(q Polynomial) Polynomial {
+	return p.Add(q.Scale(big.NewRat(-1, 1)))
+}
+
+// Scale returns c * p.
+func (p Polynomial) Scale(c *big.Rat) Polynomial {
+	out := Polynomial{coeffs: make([]*big.Rat, len(p.coeffs)), variable: p.variable}
+	for i, a := range p.coeffs {
+		out.coeffs[i] = new(big.Rat).Mul(a, c)
+	}
+	out.trim()
+	return out
+}
+
+// Mul returns p * q.
+func (p Polynomial) Mul(q Polynomial) Polynomial {
+	out := Polynomial{variable: sharedVariable(p, q)}
+	if p.IsZero() || q.IsZero() {
+		return out
+	}
+	out.coeffs = make([]*big.Rat, len(p.coeffs)+len(q.coeffs)-1)
+	for i := range out.coeffs {
+		out.coeffs[i] = new(big.Rat)
+	}
+	t := new(big.Rat)
+	for i, a := range p.coeffs {
+		for j, b := range q.coeffs {
+			out.coeffs[i+j].Add(out.coeffs[i+j], t.Mul(a, b))
+		}
+	}
+	out.trim()
+	return out
+}
+
+// DivMod returns the quotient and remainder of p / q, with
+// deg(remainder) < deg(q).
+func (p Polynomial) DivMod(q Polynomial) (Polynomial, Polynomial, error) {
+	if q.IsZero() {
+		return Polynomial{}, Polynomial{}, ErrDivisionByZero
+	}
+	v := sharedVariable(p, q)
+	rem := p.Scale(big.NewRat(1, 1))
+	rem.variable = v
+	quo := Polynomial{variable: v}
+	if p.Degree() < q.Degree() {
+		return quo, rem, nil
+	}
+
+	quo.coeffs = make([]*big.Rat, p.Degree()-q.Degree()+1)
+	for i := range quo.coeffs {
+		quo.coeffs[i] = new(big.Rat)
+	}
+	lead := q.coeffs[q.Degree()]
+	t := new(big.Rat)
+	for rem.Degree() >= q.Degree() {
+		shift := rem.Degree() - q.Degree()
+		c := new(big.Rat).Quo(rem.coeffs[rem.Degree()], lead)
+		quo.coeffs[shift] = c
+		for i, b := range q.coeffs {
+			rem.coeffs[i+shift].Sub(rem.coeffs[i+shift], t.Mul(c, b))
+		}
+		rem.trim()
+	}
+	quo.trim()
+	return quo, rem, nil
+}
+
+// GCD returns the monic greatest common divisor of p and q
+// (zero if both are zero).
+func (p Polynomial) GCD(q Polynomial) Polynomial {
+	a, b := p, q
+	for !b.IsZero() {
+		_, r, _ := a.DivMod(b)
+		a, b = b, r
+	}
+	a.variable = sharedVariable(p, q)
+	return a.Monic()
+}
+
+// Monic divides p by its leading coefficient.
+func (p Polynomial) Monic() Polynomial {
+	if p.IsZero() {
+		return p
+	}
+	return p.Scale(new(big.Rat).Inv(p.coeffs[p.Degree()]))
+}
+
+// Eval returns p(x) exactly, using Horner's rule. It stops with
+// ErrExpressionTooComplex once the value outgrows maxEvalBits.
+func (p Polynomial) Eval(x *big.Rat) (*big.Rat, error) {
+	acc := new(big.Rat)
+	for i := len(p.coeffs) - 1; i >= 0; i-- {
+		acc.Mul(acc, x).Add(acc, p.coeffs[i])
+		if acc.Num().BitLen() > maxEvalBits || acc.Denom().BitLen() > maxEvalBits {
+			return nil, fmt.Errorf("%w: the value exceeds %d bits", ErrExpressionTooComplex, maxEvalBits)
+		}
+	}
+	return acc, nil
+}
+
+// Derivative returns dp/dx.
+func (p Polynomial) Derivative() Polynomial {
+	out := Polynomial{variable: p.variable}
+	if len(p.coeffs) < 2 {
+		return out
+	}
+	out.coeffs = make([]*big.Rat, len(p.coeffs)-1)
+	for i := 1; i < len(p.coeffs); i++ {
+		out.coeffs[i-1] = new(big.Rat).Mul(p.coeffs[i], big.NewRat(int64(i), 1))
+	}
+	out.trim()
+	return out
+}
+
+// Integral returns the antiderivative of p whose constant term is c.
+func (p Polynomial) Integral(c *big.Rat) Polynomial {
+	out := Polynomial{coeffs: make([]*big.Rat, len(p.coeffs)+1), variable: p.variable}
+	out.coeffs[0] = new(big.Rat).Set(c)
+	for i, a := range p.coeffs {
+		out.coeffs[i+1] = new(big.Rat).Quo(a, big.NewRat(int64(i+1), 1))
+	}
+	out.trim()
+	return out
+}
+
+// UnmarshalJSON accepts either text ("x^2 - 1") or a coefficient array,
+// highest degree first ([1, 0, "-1"]).
+func (p *Polynomial) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		parsed, err := ParsePolynomial(text)
+		if err != nil {
+			return err
+		}
+		*p = parsed
+		return nil
+	}
+
+	var coeffs []Rational
+	if err := json.Unmarshal(b, &coeffs); err != nil {
+		return fmt.Errorf("%w: expected text or an array of coefficients", ErrInvalidPolynomial)
+	}
+	if len(coeffs) > maxPolynomialDegree+1 {
+		return fmt.Errorf("%w: degree above %d", ErrExpressionTooComplex, maxPolynomialDegree)
+	}
+	rats := make([]*big.Rat, len(coeffs))
+	for i := range coeffs {
+		rats[i] = &coeffs[i].Rat
+	}
+	*p = NewPolynomial(rats...)
+	return p.checkSize()
+}
+
+// MarshalJSON writes the canonical text form.
+func (p Polynomial) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// Rational is an exact rational number that reads from JSON as a
+// number (0.25) or a string ("1/3").
+type Rational struct {
+	big.Rat
+}
+
+// UnmarshalJSON applies the coefficient limits, so points and bounds
+// are no larger than the polynomials they are used with.
+func (r *Rational) UnmarshalJSON(b []byte) error {
+	s := strings.TrimSpace(strings.Trim(string(b), `"`))
+	if len(s) > maxExpressionLength {
+		return fmt.Errorf("%w: more than %d characters", ErrExpressionTooComplex, maxExpressionLength)
+	}
+	// SetString expands the exponent in full, so check it first.
+	if _, exp, ok := strings.Cut(strings.ToLower(s), "e"); ok {
+		n, err := strconv.Atoi(exp)
+		if err != nil {
+			return fmt.Errorf("%w: %s is not a rational number", ErrInvalidPolynomial, b)
+		}
+		if n > maxDecimalExponent || n < -maxDecimalExponent {
+			return fmt.Errorf("%w: numbers are limited to %d bits", ErrExpressionTooComplex, maxCoefficientBits)
+		}
+	}
+	if _, ok := r.SetString(s); !ok {
+		return fmt.Errorf("%w: %s is not a rational number", ErrInvalidPolynomial, b)
+	}
+	if r.Num().BitLen() > maxCoefficientBits || r.Denom().BitLen() > maxCoefficientBits {
+		return fmt.Errorf("%w: numbers are limited to %d bits", ErrExpressionTooComplex, maxCoefficientBits)
+	}
+	return nil
+}
+
+func (r Rational) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.RatString())
+}
+
+var bigOne = big.NewInt(1)
+
+func (p *Polynomial) trim() {
+	n := len(p.coeffs)
+	for n > 0 && p.coeffs[n-1].Sign() == 0 {
+		n--
+	}
+	p.coeffs = p.coeffs[:n]
+}
+
+// checkSize rejects polynomials above maxPolynomialDegree or with
+// coefficients above maxCoefficientBits.
+func (p Polynomial) checkSize() error {
+	if p.Degree() > maxPolynomialDegree {
+		return fmt.Errorf("%w: degree %d is above %d", ErrExpressionTooComplex, p.Degree(), maxPolynomialDegree)
+	}
+	for _, c := range p.coeffs {
+		if c.Num().BitLen() > maxCoefficientBits || c.Denom().BitLen() > maxCoefficientBits {
+			return fmt.Errorf("%w: coefficients are limited to %d bits", ErrExpressionTooComplex, maxCoefficientBits)
+		}
+	}
+	return nil
+}
+
+// sharedVariable picks the variable of a result: p's, unless p is a
+// constant without one.
+func sharedVariable(p, q Polynomial) string {
+	if p.variable != "" {
+		return p.variable
+	}
+	return q.variable
+}
+
+//
+// Parser
+//
+//	poly  := ['+' | '-'] term (('+' | '-') term)*
+//	term  := coeff ['*'] [var ['^' int]] | var ['^' int]
+//	coeff := number ['/' number] | '(' ['-'] number ['/' number] ')'
+//
+
+type polyScanner struct {
+	input    string
+	pos      int
+	variable string
+}
+
+func (s *polyScanner) parse() (Polynomial, error) {
+	terms := map[int]*big.Rat{}
+	first := true
+	for {
+		s.skipSpace()
+		if s.pos == len(s.input) {
+			if first {
+				return Polynomial{}, fmt.Errorf("%w: empty polynomial", ErrInvalidPolynomial)
+			}
+			break
+		}
+
+		neg := false
+		if c := s.input[s.pos]; c == '+' || c == '-' {
+			neg = c == '-'
+			s.pos++
+		} else if !first {
+			return Polynomial{}, s.errorf("expected '+' or '-'")
+		}
+		first = false
+
+		coeff, exp, err := s.term()
+		if err != nil {
+			return Polynomial{}, err
+		}
+		if exp > maxPolynomialDegree {
+			return Polynomial{}, fmt.Errorf("%w: degree %d is above %d", ErrExpressionTooComplex, exp, maxPolynomialDegree)
+		}
+		if neg {
+			coeff.Neg(coeff)
+		}
+		if terms[exp] == nil {
+			terms[exp] = new(big.Rat)
+		}
+		terms[exp].Add(terms[exp], coeff)
+	}
+
+	deg := -1
+	for e := range terms {
+		deg = max(deg, e)
+	}
+	p := Polynomial{coeffs: make([]*big.Rat, deg+1), variable: s.variable}
+	for i := range p.coeffs {
+		p.coeffs[i] = new(big.Rat)
+		if c, ok := terms[i]; ok {
+			p.coeffs[i].Set(c)
+		}
+	}
+	p.trim()
+	return p, nil
+}
+
+// term parses one term and returns its coefficient and exponent.
+func (s *polyScanner) term() (*big.Rat, int, error) {
+	s.skipSpace()
+	coeff := big.NewRat(1, 1)
+	hasCoeff := false
+
+	if s.pos < len(s.input) && (s.input[s.pos] == '(' || isDigit(s.input[s.pos]) || s.input[s.pos] == '.') {
+		c, err := s.coefficient()
+		if err != nil {
+			return nil, 0, err
+		}
+		coeff, hasCoeff = c, true
+		s.skipSpace()
+		if s.pos < len(s.input) && s.input[s.pos] == '*' {
+			s.pos++
+			s.skipSpace()
+			if s.pos == len(s.input) || !isLetter(s.input[s.pos]) {
+				return nil, 0, s.errorf("expected a variable after '*'")
+			}
+		}
+	}
+
+	if s.pos == len(s.input) || !isLetter(s.input[s.pos]) {
+		if !hasCoeff {
+			return nil, 0, s.errorf("expected a term")
+		}
+		return coeff, 0, nil
+	}
+
+	start := s.pos
+	for s.pos < len(s.input) && isLetter(s.input[s.pos]) {
+		s.pos++
+	}
+	name := s.input[start:s.pos]
+	if s.variable == "" {
+		s.variable = name
+	} else if name != s.variable {
+		return nil, 0, fmt.Errorf("%w: mixes variables %q and %q", ErrInvalidPolynomial, s.variable, name)
+	}
+
+	s.skipSpace()
+	if s.pos == len(s.input) || s.input[s.pos] != '^' {
+		return coeff, 1, nil
+	}
+	s.pos++
+	s.skipSpace()
+	start = s.pos
+	for s.pos < len(s.input) && isDigit(s.input[s.pos]) {
+		s.pos++
+	}
+	exp, err := strconv.Atoi(s.input[start:s.pos])
+	if err != nil {
+		s.pos = start
+		return nil, 0, s.errorf("expected a non-negative integer exponent")
+	}
+	return coeff, exp, nil
+}
+
+// coefficient parses "3", "0.5", "3/4" or "(-3/4)".
+func (s *polyScanner) coefficient() (*big.Rat, error) {
+	paren := s.input[s.pos] == '('
+	neg := false
+	if paren {
+		s.pos++
+		s.skipSpace()
+		if s.pos < len(s.input) && s.input[s.pos] == '-' {
+			neg = true
+			s.pos++
+		}
+	}
+
+	v, err := s.number()
+	if err != nil {
+		return nil, err
+	}
+	s.skipSpace()
+	if s.pos < len(s.input) && s.input[s.pos] == '/' {
+		s.pos++
+		s.skipSpace()
+		d, err := s.number()
+		if err != nil {
+			return nil, err
+		}
+		if d.Sign() == 0 {
+			return nil, fmt.Errorf("%w: zero denominator", ErrInvalidPolynomial)
+		}
+		v.Quo(v, d)
+	}
+
+	if paren {
+		s.skipSpace()
+		if s.pos == len(s.input) || s.input[s.pos] != ')' {
+			return nil, s.errorf("expected ')'")
+		}
+		s.pos++
+	}
+	if neg {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+func (s *polyScanner) number() (*big.Rat, error) {
+	start := s.pos
+	for s.pos < len(s.input) && (isDigit(s.input[s.pos]) || s.input[s.pos] == '.') {
+		s.pos++
+	}
+	v, ok := new(big.Rat).SetString(s.input[start:s.pos])
+	if !ok {
+		s.pos = start
+		return nil, s.errorf("expected a number")
+	}
+	return v, nil
+}
+
+func (s *polyScanner) skipSpace() {
+	for s.pos < len(s.input) && (s.input[s.pos] == ' ' || s.input[s.pos] == '\t') {
+		s.pos++
+	}
+}
+
+func (s *polyScanner) errorf(msg string) error {
+	if s.pos >= len(s.input) {
+		return fmt.Errorf("%w: %s at end of input", ErrInvalidPolynomial, msg)
+	}
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidPolynomial, msg, s.pos)
+}
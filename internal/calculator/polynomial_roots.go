@@ -0,0 +1,439 @@
+// internal/calculator/polynomial_roots.go
+package calculator
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxRootSearchBits bounds the constant and leading coefficients whose
+	// divisors are enumerated by the rational root test.
+	maxRootSearchBits = 40
+	// maxRootCandidates bounds the number of p/q candidates tried.
+	maxRootCandidates = 20000
+	// durandKernerIterations bounds the numeric root finder.
+	durandKernerIterations = 2000
+)
+
+// Root is one root of a polynomial. Exact is set for rational roots;
+// Real and Imag always hold the (approximate) value.
+type Root struct {
+	Exact        string  `json:"exact,omitempty"`
+	Real         float64 `json:"real"`
+	Imag         float64 `json:"imag,omitempty"`
+	Multiplicity int     `json:"multiplicity"`
+}
+
+// String renders the root for history, e.g. "-1/2", "≈1.414" or "≈0.5+1.2i".
+func (r Root) String() string {
+	s := r.Exact
+	if s == "" {
+		s = "≈" + strconv.FormatFloat(r.Real, 'g', -1, 64)
+		if r.Imag != 0 {
+			sign := "+"
+			if r.Imag < 0 {
+				sign = "-"
+			}
+			s += sign + strconv.FormatFloat(math.Abs(r.Imag), 'g', -1, 64) + "i"
+		}
+	}
+	if r.Multiplicity > 1 {
+		s += " (×" + strconv.Itoa(r.Multiplicity) + ")"
+	}
+	return s
+}
+
+// PolynomialFactor is an irreducible (or, if Factorization.Complete is
+// false, possibly reducible) factor with integer coefficients.
+type PolynomialFactor struct {
+	Factor       Polynomial `json:"factor"`
+	Multiplicity int        `json:"multiplicity"`
+}
+
+// Factorization writes p as Content times the product of its factors.
+// Complete is false when a factor of degree six or more has no linear or
+// quadratic factor but might still split, or when values were too large
+// to search.
+type Factorization struct {
+	Content  *big.Rat
+	Factors  []PolynomialFactor
+	Complete bool
+}
+
+// String renders the factorization, e.g. "3(x - 1)^2(2x + 1)".
+func (f Factorization) String() string {
+	var b strings.Builder
+	switch {
+	case len(f.Factors) == 0:
+		return f.Content.RatString()
+	case f.Content.Cmp(big.NewRat(-1, 1)) == 0:
+		b.WriteByte('-')
+	case !f.Content.IsInt():
+		b.WriteString("(" + f.Content.RatString() + ")")
+	case f.Content.Cmp(big.NewRat(1, 1)) != 0:
+		b.WriteString(f.Content.RatString())
+	}
+	// "x^2 + 1" stands alone, but "(x - 1)^2", "3(x + 1)" and "x(x + 1)" need parentheses.
+	alone := len(f.Factors) == 1 && b.Len() == 0 && f.Factors[0].Multiplicity == 1
+	for _, pf := range f.Factors {
+		s := pf.Factor.String()
+		if !alone && strings.Contains(s, " ") {
+			s = "(" + s + ")"
+		}
+		b.WriteString(s)
+		if pf.Multiplicity > 1 {
+			b.WriteString("^" + strconv.Itoa(pf.Multiplicity))
+		}
+	}
+	return b.String()
+}
+
+// Factor factors p over the rationals as far as square-free decomposition,
+// rational roots and quadratic factors (Kronecker's method) allow. This is
+// a complete factorization up to degree five.
+func (p Polynomial) Factor() Factorization {
+	if p.Degree() < 1 {
+		return Factorization{Content: p.Coefficient(0), Complete: true}
+	}
+
+	f := Factorization{Complete: true}
+	for _, sf := range p.squareFree() {
+		roots, rest, ok := sf.poly.rationalRoots()
+		f.Complete = f.Complete && ok
+		for _, r := range roots {
+			// r = a/b gives the primitive factor bx - a
+			lin := NewPolynomial(new(big.Rat).SetInt(r.Denom()), new(big.Rat).SetInt(new(big.Int).Neg(r.Num())))
+			lin.variable = p.variable
+			f.Factors = append(f.Factors, PolynomialFactor{Factor: lin, Multiplicity: sf.multiplicity})
+		}
+		if rest.Degree() >= 1 {
+			parts, ok := rest.primitive().splitQuadratics()
+			f.Complete = f.Complete && ok
+			for _, part := range parts {
+				f.Factors = append(f.Factors, PolynomialFactor{Factor: part, Multiplicity: sf.multiplicity})
+			}
+		}
+	}
+
+	sort.SliceStable(f.Factors, func(i, j int) bool {
+		return factorLess(f.Factors[i].Factor, f.Factors[j].Factor)
+	})
+
+	// content = lc(p) / Π lc(factor)^m
+	f.Content = p.Coefficient(p.Degree())
+	for _, pf := range f.Factors {
+		lc := pf.Factor.Coefficient(pf.Factor.Degree())
+		for i := 0; i < pf.Multiplicity; i++ {
+			f.Content.Quo(f.Content, lc)
+		}
+	}
+	return f
+}
+
+// Roots returns every complex root with its multiplicity: rational roots
+// exactly, the others numerically.
+func (p Polynomial) Roots() ([]Root, error) {
+	if p.IsZero() {
+		return nil, ErrInvalidPolynomial
+	}
+
+	var out []Root
+	for _, sf := range p.squareFree() {
+		roots, rest, _ := sf.poly.rationalRoots()
+		for _, r := range roots {
+			v, _ := r.Float64()
+			out = append(out, Root{Exact: r.RatString(), Real: v, Multiplicity: sf.multiplicity})
+		}
+		for _, z := range rest.numericRoots() {
+			out = append(out, Root{Real: real(z), Imag: imag(z), Multiplicity: sf.multiplicity})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Real != out[j].Real {
+			return out[i].Real < out[j].Real
+		}
+		return out[i].Imag < out[j].Imag
+	})
+	return out, nil
+}
+
+// factorLess orders factors by degree, with x first and the other linear
+// factors by their root; higher degrees compare coefficients from the
+// highest degree down.
+func factorLess(a, b Polynomial) bool {
+	if a.Degree() != b.Degree() {
+		return a.Degree() < b.Degree()
+	}
+	if a.Degree() == 1 {
+		if a.Coefficient(0).Sign() == 0 || b.Coefficient(0).Sign() == 0 {
+			return a.Coefficient(0).Sign() == 0 && b.Coefficient(0).Sign() != 0
+		}
+		ra := new(big.Rat).Quo(a.Coefficient(0), a.Coefficient(1))
+		rb := new(big.Rat).Quo(b.Coefficient(0), b.Coefficient(1))
+		return ra.Cmp(rb) > 0 // roots are -c0/c1
+	}
+	for i := a.Degree(); i >= 0; i-- {
+		if c := a.Coefficient(i).Cmp(b.Coefficient(i)); c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+type squareFreeFactor struct {
+	poly         Polynomial
+	multiplicity int
+}
+
+// squareFree splits p into monic, pairwise coprime, square-free factors
+// using Yun's algorithm: p = lc · Π f_i^i.
+func (p Polynomial) squareFree() []squareFreeFactor {
+	var out []squareFreeFactor
+	dp := p.Derivative()
+	g := p.GCD(dp)
+	c, _, _ := p.DivMod(g)
+	d, _, _ := dp.DivMod(g)
+	d = d.Sub(c.Derivative())
+
+	for i := 1; c.Degree() > 0; i++ {
+		a := c.GCD(d)
+		if a.Degree() > 0 {
+			a.variable = p.variable
+			out = append(out, squareFreeFactor{poly: a, multiplicity: i})
+		}
+		c, _, _ = c.DivMod(a)
+		d, _, _ = d.DivMod(a)
+		d = d.Sub(c.Derivative())
+	}
+	return out
+}
+
+// rationalRoots finds the rational roots of a square-free polynomial with
+// the rational root test and returns them with the remaining cofactor.
+// ok is false if the coefficients were too large to search.
+func (p Polynomial) rationalRoots() (roots []*big.Rat, rest Polynomial, ok bool) {
+	rest = p
+	if rest.Coefficient(0).Sign() == 0 && rest.Degree() >= 1 {
+		roots = append(roots, new(big.Rat))
+		rest, _, _ = rest.DivMod(NewPolynomial(big.NewRat(1, 1), new(big.Rat)))
+	}
+	if rest.Degree() < 1 {
+		return roots, rest, true
+	}
+
+	prim := rest.primitive()
+	a0 := new(big.Int).Abs(prim.Coefficient(0).Num())
+	an := new(big.Int).Abs(prim.Coefficient(prim.Degree()).Num())
+	if a0.BitLen() > maxRootSearchBits || an.BitLen() > maxRootSearchBits {
+		return roots, rest, false
+	}
+
+	nums, dens := divisors(a0.Uint64()), divisors(an.Uint64())
+	if len(nums)*len(dens) > maxRootCandidates {
+		return roots, rest, false
+	}
+search:
+	for _, num := range nums {
+		for _, den := range dens {
+			for _, sign := range []int64{1, -1} {
+				if rest.Degree() < 1 {
+					break search
+				}
+				r := big.NewRat(sign*int64(num), int64(den))
+				if v, err := rest.Eval(r); err != nil || v.Sign() != 0 {
+					continue
+				}
+				roots = append(roots, r)
+				rest, _, _ = rest.DivMod(NewPolynomial(big.NewRat(1, 1), new(big.Rat).Neg(r)))
+			}
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Cmp(roots[j]) < 0 })
+	return roots, rest, true
+}
+
+// splitQuadratics splits a primitive polynomial without rational roots
+// into quadratic factors and a remainder. ok is false when the search was
+// skipped or the remainder, of degree six or more, may still be reducible.
+func (p Polynomial) splitQuadratics() (factors []Polynomial, ok bool) {
+	for p.Degree() >= 4 {
+		g, searched := p.quadraticFactor()
+		if !searched {
+			return append(factors, p), false
+		}
+		if g.IsZero() {
+			break
+		}
+		factors = append(factors, g)
+		p, _, _ = p.DivMod(g)
+		p = p.primitive()
+	}
+	return append(factors, p), p.Degree() <= 5
+}
+
+// quadraticFactor looks for an integer quadratic ax^2 + bx + c dividing the
+// primitive polynomial p, using Kronecker's method: g(k) divides p(k) for
+// k = -1, 0, 1, and those three values determine g. It returns the zero
+// polynomial if there is none, and searched = false if p(k) was too
+// large to try every divisor.
+func (p Polynomial) quadraticFactor() (g Polynomial, searched bool) {
+	var values [3][]int64
+	total := 1
+	for i, k := range []int64{-1, 0, 1} {
+		pk, err := p.Eval(big.NewRat(k, 1))
+		if err != nil {
+			return Polynomial{}, false
+		}
+		v := pk.Num()
+		if v.Sign() == 0 || v.BitLen() > maxRootSearchBits {
+			return Polynomial{}, false
+		}
+		for _, d := range divisors(new(big.Int).Abs(v).Uint64()) {
+			values[i] = append(values[i], int64(d), -int64(d))
+		}
+		total *= len(values[i])
+	}
+	if total > maxRootCandidates*4 {
+		return Polynomial{}, false
+	}
+
+	// g and -g are the same factor, so g(0) = c stays positive.
+	for _, u := range values[0] {
+		for _, c := range values[1] {
+			if c < 0 {
+				continue
+			}
+			for _, w := range values[2] {
+				// g(-1) = a - b + c = u, g(1) = a + b + c = w
+				if (u+w)%2 != 0 {
+					continue
+				}
+				a, b := (u+w)/2-c, (w-u)/2
+				if a == 0 {
+					continue
+				}
+				cand := NewPolynomial(big.NewRat(a, 1), big.NewRat(b, 1), big.NewRat(c, 1))
+				cand.variable = p.variable
+				if _, rem, _ := p.DivMod(cand); rem.IsZero() {
+					return cand.primitive(), true
+				}
+			}
+		}
+	}
+	return Polynomial{}, true
+}
+
+// primitive scales p to integer coefficients with gcd 1 and a positive
+// leading coefficient.
+func (p Polynomial) primitive() Polynomial {
+	if p.IsZero() {
+		return p
+	}
+	lcm := big.NewInt(1)
+	for _, c := range p.coeffs {
+		g := new(big.Int).GCD(nil, nil, lcm, c.Denom())
+		lcm.Mul(lcm, new(big.Int).Quo(c.Denom(), g))
+	}
+	scaled := p.Scale(new(big.Rat).SetInt(lcm))
+
+	g := new(big.Int)
+	for _, c := range scaled.coeffs {
+		g.GCD(nil, nil, g, new(big.Int).Abs(c.Num()))
+	}
+	if scaled.coeffs[scaled.Degree()].Sign() < 0 {
+		g.Neg(g)
+	}
+	return scaled.Scale(new(big.Rat).SetFrac(big.NewInt(1), g))
+}
+
+// numericRoots approximates all roots of a polynomial without rational
+// roots: in closed form for quadratics, with Durand–Kerner otherwise.
+func (p Polynomial) numericRoots() []complex128 {
+	if p.Degree() < 1 {
+		return nil
+	}
+	m := p.Monic()
+	c := make([]complex128, len(m.coeffs))
+	for i, a := range m.coeffs {
+		f, _ := a.Float64()
+		c[i] = complex(f, 0)
+	}
+
+	if p.Degree() == 1 {
+		return []complex128{-c[0]}
+	}
+	if p.Degree() == 2 {
+		sq := cmplx.Sqrt(c[1]*c[1] - 4*c[0])
+		return []complex128{cleanRoot((-c[1] + sq) / 2), cleanRoot((-c[1] - sq) / 2)}
+	}
+
+	n := p.Degree()
+	z := make([]complex128, n)
+	seed := complex(0.4, 0.9)
+	z[0] = 1
+	for i := 1; i < n; i++ {
+		z[i] = z[i-1] * seed
+	}
+	eval := func(x complex128) complex128 {
+		acc := complex(0, 0)
+		for i := n; i >= 0; i-- {
+			acc = acc*x + c[i]
+		}
+		return acc
+	}
+	for iter := 0; iter < durandKernerIterations; iter++ {
+		moved := 0.0
+		for i := range z {
+			den := complex(1, 0)
+			for j := range z {
+				if i != j {
+					den *= z[i] - z[j]
+				}
+			}
+			if den == 0 {
+				den = complex(1e-12, 0)
+			}
+			delta := eval(z[i]) / den
+			z[i] -= delta
+			moved = math.Max(moved, cmplx.Abs(delta))
+		}
+		if moved < 1e-15 {
+			break
+		}
+	}
+	for i := range z {
+		z[i] = cleanRoot(z[i])
+	}
+	return z
+}
+
+// cleanRoot drops an imaginary part that is only rounding noise.
+func cleanRoot(z complex128) complex128 {
+	if math.Abs(imag(z)) <= 1e-12*math.Max(1, cmplx.Abs(z)) {
+		return complex(real(z), 0)
+	}
+	return z
+}
+
+// divisors lists the positive divisors of n (n = 0 yields none).
+func divisors(n uint64) []uint64 {
+	var small, large []uint64
+	for d := uint64(1); d*d <= n; d++ {
+		if n%d == 0 {
+			small = append(small, d)
+			if d*d != n {
+				large = append(large, n/d)
+			}
+		}
+	}
+	for i := len(large) - 1; i >= 0; i-- {
+		small = append(small, large[i])
+	}
+	return small
+}
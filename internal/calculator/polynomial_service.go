@@ -0,0 +1,216 @@
+// internal/calculator/polynomial_service.go
+package calculator
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// Polynomial runs one polynomial operation and stores its canonical
+// result as an exact history entry.
+func (s *service) Polynomial(ctx context.Context, userID string, op PolynomialOperation, req PolynomialRequest) (PolynomialResult, error) {
+	res, err := polynomialOperation(op, req)
+	if err != nil {
+		return PolynomialResult{}, err
+	}
+
+	metadata := map[string]any{"tool": "polynomial", "operation": string(op)}
+	if res.Remainder != nil {
+		metadata["remainder"] = res.Remainder.String()
+	}
+	entry := &history.HistoryEntry{
+		UserID:      userID,
+		Expression:  res.Expression,
+		ExactResult: res.Result,
+		Metadata:    metadata,
+	}
+	if err := s.historySvc.Record(ctx, entry); err != nil {
+		return PolynomialResult{}, err
+	}
+	return res, nil
+}
+
+// polynomialOperation computes op without side effects.
+func polynomialOperation(op PolynomialOperation, req PolynomialRequest) (PolynomialResult, error) {
+	p := req.P
+	var q Polynomial
+	switch op {
+	case PolyAdd, PolySubtract, PolyMultiply, PolyDivide, PolyGCD, PolySimplify:
+		if req.Q == nil {
+			return PolynomialResult{}, fmt.Errorf("%w: %s needs a second polynomial q", ErrInvalidPolynomial, op)
+		}
+		q = *req.Q
+		if p.variable != "" && q.variable != "" && p.variable != q.variable {
+			return PolynomialResult{}, fmt.Errorf("%w: p is in %s but q is in %s", ErrInvalidPolynomial, p.variable, q.variable)
+		}
+	}
+
+	var (
+		res    PolynomialResult
+		result Polynomial
+	)
+	switch op {
+	case PolyAdd:
+		result = p.Add(q)
+		res.Expression = paren(p) + " + " + paren(q)
+	case PolySubtract:
+		result = p.Sub(q)
+		res.Expression = paren(p) + " - " + paren(q)
+	case PolyMultiply:
+		if p.Degree()+q.Degree() > maxPolynomialDegree {
+			return PolynomialResult{}, fmt.Errorf("%w: product degree above %d", ErrExpressionTooComplex, maxPolynomialDegree)
+		}
+		result = p.Mul(q)
+		res.Expression = paren(p) + " * " + paren(q)
+	case PolyDivide:
+		quo, rem, err := p.DivMod(q)
+		if err != nil {
+			return PolynomialResult{}, err
+		}
+		result = quo
+		res.Remainder = &rem
+		res.Expression = paren(p) + " / " + paren(q)
+	case PolyGCD:
+		result = p.GCD(q)
+		res.Expression = fmt.Sprintf("gcd(%s, %s)", p, q)
+	case PolySimplify:
+		return simplifyRational(p, q)
+	case PolyEvaluate:
+		if req.X == nil {
+			return PolynomialResult{}, fmt.Errorf("%w: evaluate needs a point x", ErrInvalidPolynomial)
+		}
+		v, err := p.Eval(&req.X.Rat)
+		if err != nil {
+			return PolynomialResult{}, err
+		}
+		res.Expression = fmt.Sprintf("p(%s) where p = %s", req.X.RatString(), p)
+		return exactValue(res, v)
+	case PolyDerivative:
+		order := req.Order
+		if order == 0 {
+			order = 1
+		}
+		if order < 0 || order > maxPolynomialDegree+1 {
+			return PolynomialResult{}, fmt.Errorf("%w: order must be between 1 and %d", ErrInvalidPolynomial, maxPolynomialDegree+1)
+		}
+		result = p
+		for i := 0; i < order; i++ {
+			result = result.Derivative()
+		}
+		res.Expression = fmt.Sprintf("d%s/d%s%s %s", orderSuffix(order), p.Variable(), orderSuffix(order), paren(p))
+	case PolyIntegral:
+		if p.Degree() >= maxPolynomialDegree {
+			return PolynomialResult{}, fmt.Errorf("%w: integral degree above %d", ErrExpressionTooComplex, maxPolynomialDegree)
+		}
+		c := new(big.Rat)
+		if req.Constant != nil {
+			c = &req.Constant.Rat
+		}
+		result = p.Integral(c)
+		if (req.Lower == nil) != (req.Upper == nil) {
+			return PolynomialResult{}, fmt.Errorf("%w: a definite integral needs both lower and upper", ErrInvalidPolynomial)
+		}
+		if req.Lower != nil {
+			upper, err := result.Eval(&req.Upper.Rat)
+			if err != nil {
+				return PolynomialResult{}, err
+			}
+			lower, err := result.Eval(&req.Lower.Rat)
+			if err != nil {
+				return PolynomialResult{}, err
+			}
+			v := new(big.Rat).Sub(upper, lower)
+			res.Expression = fmt.Sprintf("∫[%s, %s] %s d%s", req.Lower.RatString(), req.Upper.RatString(), paren(p), p.Variable())
+			return exactValue(res, v)
+		}
+		res.Expression = fmt.Sprintf("∫ %s d%s", paren(p), p.Variable())
+	case PolyRoots:
+		roots, err := p.Roots()
+		if err != nil {
+			return PolynomialResult{}, fmt.Errorf("%w: the zero polynomial has every number as a root", err)
+		}
+		parts := make([]string, len(roots))
+		for i, r := range roots {
+			parts[i] = r.String()
+		}
+		res.Expression = fmt.Sprintf("roots(%s)", p)
+		res.Result = "{" + strings.Join(parts, ", ") + "}"
+		res.Roots = roots
+		return res, nil
+	case PolyFactor:
+		f := p.Factor()
+		res.Expression = fmt.Sprintf("factor(%s)", p)
+		res.Result = f.String()
+		res.Content = f.Content.RatString()
+		res.Factors = f.Factors
+		res.Complete = &f.Complete
+		return res, nil
+	default:
+		return PolynomialResult{}, ErrInvalidOperation
+	}
+
+	if err := result.checkSize(); err != nil {
+		return PolynomialResult{}, err
+	}
+	res.Result = result.String()
+	res.Coefficients = result.Coefficients()
+	return res, nil
+}
+
+// simplifyRational reduces p/q to lowest terms with a monic denominator.
+func simplifyRational(p, q Polynomial) (PolynomialResult, error) {
+	if q.IsZero() {
+		return PolynomialResult{}, ErrDivisionByZero
+	}
+	g := p.GCD(q)
+	if g.IsZero() {
+		g = NewPolynomial(big.NewRat(1, 1))
+	}
+	num, _, _ := p.DivMod(g)
+	den, _, _ := q.DivMod(g)
+	lc := new(big.Rat).Inv(den.Coefficient(den.Degree()))
+	num, den = num.Scale(lc), den.Scale(lc)
+
+	res := PolynomialResult{
+		Expression:  paren(p) + " / " + paren(q),
+		Numerator:   &num,
+		Denominator: &den,
+	}
+	if den.Degree() == 0 {
+		res.Result = num.String()
+	} else {
+		res.Result = paren(num) + " / " + paren(den)
+	}
+	return res, nil
+}
+
+// exactValue sets an exact rational result and its float approximation.
+func exactValue(res PolynomialResult, v *big.Rat) (PolynomialResult, error) {
+	f, _ := v.Float64()
+	approx := numeric.Float(f)
+	res.Result = v.RatString()
+	res.Value = &approx
+	return res, nil
+}
+
+// paren wraps p in parentheses unless it is a single term.
+func paren(p Polynomial) string {
+	s := p.String()
+	if strings.Contains(s, " ") {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// orderSuffix renders the derivative order as in d^2/dx^2.
+func orderSuffix(order int) string {
+	if order == 1 {
+		return ""
+	}
+	return fmt.Sprintf("^%d", order)
+}
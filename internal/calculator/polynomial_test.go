@@ -0,0 +1,192 @@
+package calculator
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustPoly(t *testing.T, s string) Polynomial {
+	t.Helper()
+	p, err := ParsePolynomial(s)
+	require.NoError(t, err, s)
+	return p
+}
+
+func TestParsePolynomial_Canonical(t *testing.T) {
+	cases := map[string]string{
+		"x^2 - 3x + 2":       "x^2 - 3x + 2",
+		"2 + x*3 ":           "",
+		"-x + x^2 + x":       "x^2",
+		"0.5x^3 - (1/3)x":    "(1/2)x^3 - (1/3)x",
+		"3/4 t^2 + (-1/2) t": "(3/4)t^2 - (1/2)t",
+		"x - x":              "0",
+		"7":                  "7",
+		"+2*x^10 - 1":        "2x^10 - 1",
+	}
+	for in, want := range cases {
+		p, err := ParsePolynomial(in)
+		if want == "" {
+			assert.ErrorIs(t, err, ErrInvalidPolynomial, in)
+			continue
+		}
+		require.NoError(t, err, in)
+		assert.Equal(t, want, p.String(), in)
+
+		// the canonical form parses back to itself
+		assert.Equal(t, want, mustPoly(t, want).String(), in)
+	}
+
+	_, err := ParsePolynomial("x + y")
+	assert.ErrorIs(t, err, ErrInvalidPolynomial)
+	_, err = ParsePolynomial("x^1000")
+	assert.ErrorIs(t, err, ErrExpressionTooComplex)
+}
+
+func TestPolynomial_JSONTextOrCoefficients(t *testing.T) {
+	var req PolynomialRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"p": [1, 0, "-1/4"], "q": "x - 1/2", "x": "2"}`), &req))
+
+	assert.Equal(t, "x^2 - 1/4", req.P.String())
+	assert.Equal(t, "x - 1/2", req.Q.String())
+	assert.Equal(t, "2", req.X.RatString())
+
+	err := json.Unmarshal([]byte(`{"p": "x +* 1"}`), &req)
+	assert.ErrorIs(t, err, ErrInvalidPolynomial)
+}
+
+func TestRational_SizeLimits(t *testing.T) {
+	for _, in := range []string{`"1e-100000"`, `1e5000`, `"1e999999999999"`} {
+		var r Rational
+		assert.ErrorIs(t, json.Unmarshal([]byte(in), &r), ErrExpressionTooComplex, in)
+	}
+	var r Rational
+	assert.ErrorIs(t, json.Unmarshal([]byte(`"1e-x"`), &r), ErrInvalidPolynomial)
+	require.NoError(t, json.Unmarshal([]byte(`"2.5e-3"`), &r))
+	assert.Equal(t, "1/400", r.RatString())
+
+	// Points within the limits still cannot blow up the evaluation.
+	x := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), maxCoefficientBits-1))
+	coeffs := make([]*big.Rat, 65)
+	for i := range coeffs {
+		coeffs[i] = big.NewRat(1, 1)
+	}
+	_, err := NewPolynomial(coeffs...).Eval(x)
+	assert.ErrorIs(t, err, ErrExpressionTooComplex)
+}
+
+func TestPolynomial_Arithmetic(t *testing.T) {
+	p, q := mustPoly(t, "x^3 - 2x^2 - 4"), mustPoly(t, "x - 3")
+
+	assert.Equal(t, "x^3 - 2x^2 + x - 7", p.Add(q).String())
+	assert.Equal(t, "x^4 - 5x^3 + 6x^2 - 4x + 12", p.Mul(q).String())
+
+	quo, rem, err := p.DivMod(q)
+	require.NoError(t, err)
+	assert.Equal(t, "x^2 + x + 3", quo.String())
+	assert.Equal(t, "5", rem.String())
+
+	_, _, err = p.DivMod(Polynomial{})
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+
+	g := mustPoly(t, "2x^2 - 2").GCD(mustPoly(t, "x^2 + 2x + 1"))
+	assert.Equal(t, "x + 1", g.String())
+
+	v, err := mustPoly(t, "x^3 - 1/4").Eval(big.NewRat(1, 2))
+	require.NoError(t, err)
+	assert.Equal(t, "-1/8", v.RatString())
+	assert.Equal(t, "3x^2 - 4x", p.Derivative().String())
+	assert.Equal(t, "x^3 - x + 5", mustPoly(t, "3x^2 - 1").Integral(big.NewRat(5, 1)).String())
+}
+
+func TestPolynomial_Factor(t *testing.T) {
+	cases := map[string]struct {
+		text     string
+		complete bool
+	}{
+		"3x^3 - 3x":           {"3x(x + 1)(x - 1)", true},
+		"x^4 - 2x^2 + 1":      {"(x + 1)^2(x - 1)^2", true},
+		"2x^2 + x - 1":        {"(x + 1)(2x - 1)", true},
+		"x^2 + 1":             {"x^2 + 1", true},
+		"(1/2)x^3 + (1/2)x":   {"(1/2)x(x^2 + 1)", true},
+		"x^5 + x^3 - x^2 - 1": {"(x - 1)(x^2 + 1)(x^2 + x + 1)", true},
+		"x^4 + 4":             {"(x^2 - 2x + 2)(x^2 + 2x + 2)", true}, // no rational roots
+		"x^4 + x + 1":         {"x^4 + x + 1", true},
+		"x^6 + x + 1":         {"x^6 + x + 1", false},
+		"-4":                  {"-4", true},
+	}
+	for in, want := range cases {
+		f := mustPoly(t, in).Factor()
+		assert.Equal(t, want.text, f.String(), in)
+		assert.Equal(t, want.complete, f.Complete, in)
+	}
+}
+
+func TestPolynomial_Roots(t *testing.T) {
+	roots, err := mustPoly(t, "x^3 - x^2 - x + 1").Roots()
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+	assert.Equal(t, Root{Exact: "-1", Real: -1, Multiplicity: 1}, roots[0])
+	assert.Equal(t, Root{Exact: "1", Real: 1, Multiplicity: 2}, roots[1])
+
+	roots, err = mustPoly(t, "x^2 + 1").Roots()
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+	assert.InDelta(t, -1, roots[0].Imag, 1e-12)
+	assert.InDelta(t, 1, roots[1].Imag, 1e-12)
+
+	// x^5 - x - 1 has no rational roots: one real root, found numerically
+	roots, err = mustPoly(t, "x^5 - x - 1").Roots()
+	require.NoError(t, err)
+	require.Len(t, roots, 5)
+	real := 0
+	for _, r := range roots {
+		if r.Imag == 0 {
+			real++
+			assert.InDelta(t, 1.1673039782614187, r.Real, 1e-9)
+		}
+		assert.Empty(t, r.Exact)
+	}
+	assert.Equal(t, 1, real)
+
+	_, err = Polynomial{}.Roots()
+	assert.ErrorIs(t, err, ErrInvalidPolynomial)
+}
+
+func TestService_PolynomialStoresCanonicalHistory(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := newTestCalcServiceWithHistory(fh)
+	q := mustPoly(t, "x - 1")
+
+	res, err := svc.Polynomial(context.Background(), "user-123", PolyDivide, PolynomialRequest{P: mustPoly(t, "x^2 + 1"), Q: &q})
+	require.NoError(t, err)
+	assert.Equal(t, "x + 1", res.Result)
+	assert.Equal(t, "2", res.Remainder.String())
+
+	require.Len(t, fh.recordedEntries, 1)
+	assert.Equal(t, "(x^2 + 1) / (x - 1)", fh.recordedEntries[0].Expression)
+	assert.Equal(t, "x + 1", fh.recordedEntries[0].ExactResult)
+	assert.Equal(t, "2", fh.recordedEntries[0].Metadata["remainder"])
+
+	res, err = svc.Polynomial(context.Background(), "user-123", PolyIntegral, PolynomialRequest{
+		P: mustPoly(t, "x^2"), Lower: &Rational{}, Upper: &Rational{Rat: *big.NewRat(1, 1)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1/3", res.Result)
+	assert.InDelta(t, 1.0/3, float64(*res.Value), 1e-15)
+
+	res, err = svc.Polynomial(context.Background(), "user-123", PolySimplify, PolynomialRequest{
+		P: mustPoly(t, "x^2 - 1"), Q: ptr(mustPoly(t, "2x^2 + 2x")),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "((1/2)x - 1/2) / x", res.Result)
+
+	_, err = svc.Polynomial(context.Background(), "user-123", PolyAdd, PolynomialRequest{P: q})
+	assert.ErrorIs(t, err, ErrInvalidPolynomial)
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,339 @@
+// internal/calculator/series.go
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numbertheory"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+var ErrSeriesDiverges = errors.New("series does not converge")
+
+// DefaultTolerance is the relative size below which the terms of an
+// infinite series are considered negligible.
+const DefaultTolerance = 1e-10
+
+const (
+	// convergedTerms is how many consecutive negligible terms end an
+	// infinite series; a single small term may just be a zero crossing.
+	convergedTerms = 3
+	// maxSeriesBound keeps series variables exactly representable.
+	maxSeriesBound = 1 << 53
+	// maxFibIndex is the largest n whose Fibonacci number fits a float64;
+	// beyond it the result is +Inf without computing the exact term.
+	// Lucas numbers already overflow from n = 1475 in the conversion.
+	maxFibIndex = 1476
+)
+
+// function is a built-in callable from expressions. formula, when set,
+// is shown in the explanation next to the result.
+// Trigonometric functions read (sin, cos, tan) or return (asin, acos,
+// atan, atan2) angles in the evaluation's angle mode.
+type function struct {
+	arity   int
+	formula string
+	angular bool
+	apply   func(angle numeric.AngleMode, args []float64) (float64, error)
+}
+
+var functions = map[string]function{
+	"fib":   {arity: 1, apply: fibonacci(numbertheory.Fibonacci)},
+	"lucas": {arity: 1, apply: fibonacci(numbertheory.Lucas)},
+	"arith": {
+		// sum of the first n terms of a1, a1 + d, a1 + 2d, ...
+		arity:   3,
+		formula: "n/2 * (2a + (n - 1)d)",
+		apply: func(_ numeric.AngleMode, a []float64) (float64, error) {
+			n, err := termCount(a[2])
+			if err != nil {
+				return 0, err
+			}
+			return n / 2 * (2*a[0] + (n-1)*a[1]), nil
+		},
+	},
+	"geom": {
+		// sum of the first n terms of a, ar, ar², ...
+		arity:   3,
+		formula: "a(1 - r^n) / (1 - r)",
+		apply: func(_ numeric.AngleMode, a []float64) (float64, error) {
+			n, err := termCount(a[2])
+			if err != nil {
+				return 0, err
+			}
+			if a[1] == 1 {
+				return a[0] * n, nil
+			}
+			return a[0] * (1 - math.Pow(a[1], n)) / (1 - a[1]), nil
+		},
+	},
+	"sin":  {arity: 1, angular: true, apply: func(m numeric.AngleMode, a []float64) (float64, error) { return m.Sin(a[0]), nil }},
+	"cos":  {arity: 1, angular: true, apply: func(m numeric.AngleMode, a []float64) (float64, error) { return m.Cos(a[0]), nil }},
+	"tan":  {arity: 1, angular: true, apply: func(m numeric.AngleMode, a []float64) (float64, error) { return m.Tan(a[0]), nil }},
+	"asin": {arity: 1, angular: true, apply: inverseTrig(math.Asin)},
+	"acos": {arity: 1, angular: true, apply: inverseTrig(math.Acos)},
+	"atan": {arity: 1, angular: true, apply: inverseTrig(math.Atan)},
+	"atan2": {
+		arity:   2,
+		angular: true,
+		apply: func(m numeric.AngleMode, a []float64) (float64, error) {
+			return m.FromRadians(math.Atan2(a[0], a[1])), nil
+		},
+	},
+	"sqrt": {
+		arity: 1,
+		apply: func(_ numeric.AngleMode, a []float64) (float64, error) {
+			if a[0] < 0 {
+				return 0, fmt.Errorf("%w: square root of a negative number", ErrNotANumber)
+			}
+			return math.Sqrt(a[0]), nil
+		},
+	},
+	"geom_inf": {
+		arity:   2,
+		formula: "a / (1 - r)",
+		apply: func(_ numeric.AngleMode, a []float64) (float64, error) {
+			if math.Abs(a[1]) >= 1 {
+				return 0, fmt.Errorf("%w: geometric series with |r| >= 1", ErrSeriesDiverges)
+			}
+			return a[0] / (1 - a[1]), nil
+		},
+	},
+}
+
+// fibonacci adapts an exact big-integer sequence to float64 arguments.
+func fibonacci(term func(int64) *big.Int) func(numeric.AngleMode, []float64) (float64, error) {
+	return func(_ numeric.AngleMode, a []float64) (float64, error) {
+		n := a[0]
+		if n < 0 || n != math.Trunc(n) {
+			return 0, fmt.Errorf("%w: index must be a non-negative integer", ErrInvalidExpression)
+		}
+		if n > maxFibIndex {
+			return math.Inf(1), nil
+		}
+		v, _ := new(big.Float).SetInt(term(int64(n))).Float64()
+		return v, nil
+	}
+}
+
+// inverseTrig wraps an inverse function so its result is in the angle mode.
+// Arguments outside its domain give NaN, which the special value policy
+// rejects or reports.
+func inverseTrig(f func(float64) float64) func(numeric.AngleMode, []float64) (float64, error) {
+	return func(m numeric.AngleMode, a []float64) (float64, error) {
+		return m.FromRadians(f(a[0])), nil
+	}
+}
+
+// termCount validates the number of terms of a closed-form series.
+func termCount(n float64) (float64, error) {
+	if n < 0 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("%w: number of terms must be a non-negative integer", ErrInvalidExpression)
+	}
+	return n, nil
+}
+
+func (e *evaluator) evalCall(n *callNode) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, err := e.eval(a)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+
+	v, err := n.fn.apply(e.angle, args)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.trace != nil {
+		shown := make([]string, len(args))
+		for i, a := range args {
+			shown[i] = e.num(a)
+		}
+		detail := fmt.Sprintf("%s(%s) = %s", n.name, strings.Join(shown, ", "), e.num(v))
+		if n.fn.formula != "" {
+			detail += " using " + n.fn.formula
+		}
+		if n.fn.angular {
+			detail += fmt.Sprintf(" (angles in %s)", e.angle.OrDefault())
+		}
+		e.trace.addValue(RuleFunction, e.text(n), detail, v)
+	}
+	return v, nil
+}
+
+// evalSeries sums or multiplies body over an integer range. The range is
+// checked against the remaining step budget before any term is evaluated,
+// so sum(k, k = 1..1e12) fails immediately instead of running until the
+// limit. Individual terms are not traced; the series is one step.
+func (e *evaluator) evalSeries(n *seriesNode) (float64, error) {
+	from, err := e.evalBound(n.from)
+	if err != nil {
+		return 0, err
+	}
+
+	// Terms are evaluated with tracing off and the variable bound; both
+	// are restored even if a term fails.
+	saved := e.trace
+	old, shadowed := e.vars[n.variable]
+	defer func() {
+		e.trace = saved
+		if shadowed {
+			e.vars[n.variable] = old
+		} else {
+			delete(e.vars, n.variable)
+		}
+	}()
+
+	if n.to == nil {
+		e.trace = nil
+		v, terms, err := e.infiniteSeries(n, from)
+		if err != nil {
+			return 0, err
+		}
+		saved.addValue(RuleSeries, e.text(n),
+			fmt.Sprintf("converged to %s after %d terms (tolerance %g)", e.num(v), terms, e.tolerance), v)
+		return v, nil
+	}
+
+	to, err := e.evalBound(n.to)
+	if err != nil {
+		return 0, err
+	}
+	count := to - from + 1
+	if count < 0 {
+		count = 0
+	}
+	cost := int64(nodeCount(n.body))
+	if remaining := int64(e.maxSteps - e.steps); count > remaining/cost {
+		return 0, fmt.Errorf("%w: %s has %d terms of %d steps each, more than the %d steps left",
+			ErrExpressionTooComplex, e.text(n), count, cost, remaining)
+	}
+
+	e.trace = nil
+	acc := seriesIdentity(n.product)
+	for k := from; k <= to; k++ {
+		e.vars[n.variable] = float64(k)
+		t, err := e.eval(n.body)
+		if err != nil {
+			return 0, err
+		}
+		acc = seriesCombine(n.product, acc, t)
+		if err := e.special.Check(acc); err != nil {
+			return 0, fmt.Errorf("%w: %s at %s = %d", err, e.text(n), n.variable, k)
+		}
+	}
+
+	saved.addValue(RuleSeries, e.text(n),
+		fmt.Sprintf("%s of %d terms for %s = %d..%d = %s", seriesName(n.product), count, n.variable, from, to, e.num(acc)), acc)
+	return acc, nil
+}
+
+// infiniteSeries adds terms until convergedTerms consecutive terms are
+// negligible relative to the running value (|t| <= tol * max(1, |sum|),
+// or |t - 1| <= tol for products), or the step budget runs out.
+func (e *evaluator) infiniteSeries(n *seriesNode, from int64) (float64, int64, error) {
+	cost := int64(nodeCount(n.body))
+	budget := int64(e.maxSteps-e.steps) / cost
+
+	acc := seriesIdentity(n.product)
+	small := 0
+	for i := int64(0); i < budget; i++ {
+		k := from + i
+		e.vars[n.variable] = float64(k)
+		t, err := e.eval(n.body)
+		if err != nil {
+			return 0, 0, err
+		}
+		acc = seriesCombine(n.product, acc, t)
+		if math.IsInf(acc, 0) || math.IsNaN(acc) {
+			return 0, 0, fmt.Errorf("%w: %s grows without bound", ErrSeriesDiverges, e.text(n))
+		}
+
+		change := math.Abs(t)
+		if n.product {
+			change = math.Abs(t - 1)
+		}
+		if change <= e.tolerance*math.Max(1, math.Abs(acc)) {
+			small++
+		} else {
+			small = 0
+		}
+		if small >= convergedTerms {
+			return acc, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: %s did not reach tolerance %g within %d terms",
+		ErrSeriesDiverges, e.text(n), e.tolerance, budget)
+}
+
+// evalBound evaluates a series bound, which must be an integer.
+func (e *evaluator) evalBound(n node) (int64, error) {
+	v, err := e.eval(n)
+	if err != nil {
+		return 0, err
+	}
+	if v != math.Trunc(v) || math.Abs(v) > maxSeriesBound {
+		return 0, fmt.Errorf("%w: series bound %s is not an integer", ErrInvalidExpression, e.text(n))
+	}
+	return int64(v), nil
+}
+
+func seriesIdentity(product bool) float64 {
+	if product {
+		return 1
+	}
+	return 0
+}
+
+func seriesCombine(product bool, acc, t float64) float64 {
+	if product {
+		return acc * t
+	}
+	return acc + t
+}
+
+func seriesName(product bool) string {
+	if product {
+		return "product"
+	}
+	return "sum"
+}
+
+// nodeCount is the number of evaluation steps one pass over n takes,
+// not counting the terms of nested series.
+func nodeCount(n node) int {
+	switch n := n.(type) {
+	case *unaryNode:
+		return 1 + nodeCount(n.operand)
+	case *binaryNode:
+		return 1 + nodeCount(n.left) + nodeCount(n.right)
+	case *groupNode:
+		return 1 + nodeCount(n.inner)
+	case *percentNode:
+		return 1 + nodeCount(n.operand)
+	case *percentChangeNode:
+		return 1 + nodeCount(n.from) + nodeCount(n.to)
+	case *callNode:
+		c := 1
+		for _, a := range n.args {
+			c += nodeCount(a)
+		}
+		return c
+	case *seriesNode:
+		c := 1 + nodeCount(n.from) + nodeCount(n.body)
+		if n.to != nil {
+			c += nodeCount(n.to)
+		}
+		return c
+	default:
+		return 1
+	}
+}
@@ -7,24 +7,53 @@ import (
 	"fmt"
 
 	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/preferences"
 )
 
 var ErrInvalidOperation = errors.New("invalid operation")
 var ErrDivisionByZero = errors.New("division by zero")
+var ErrConflictingOperands = errors.New("give either num or constant, not both")
+
+// Results outside the float64 range; see Config.SpecialValues.
+var (
+	ErrOverflow   = numeric.ErrOverflow
+	ErrNotANumber = numeric.ErrNotANumber
+)
 
 type Service interface {
 	Calculate(ctx context.Context, userID string, req CalculationRequest) (CalculationResult, error)
+	Evaluate(ctx context.Context, userID string, req ExpressionRequest) (CalculationResult, error)
+	Constants() []Constant
+	Polynomial(ctx context.Context, userID string, op PolynomialOperation, req PolynomialRequest) (PolynomialResult, error)
+}
+
+// Config holds deployment-wide calculator settings.
+type Config struct {
+	// SpecialValues decides whether +Inf/-Inf/NaN results are rejected
+	// (the default) or returned as JSON strings.
+	SpecialValues numeric.SpecialValuePolicy
+	// MaxEvalSteps caps the AST nodes one request may evaluate, including
+	// every term of a series. Zero selects DefaultMaxEvalSteps.
+	MaxEvalSteps int
 }
 
 type service struct {
 	historySvc history.Service
+	prefsSvc   preferences.Service
+	cfg        Config
 }
 
-func NewService(historySvc history.Service) Service {
-	return &service{historySvc: historySvc}
+func NewService(historySvc history.Service, prefsSvc preferences.Service, cfg Config) Service {
+	return &service{historySvc: historySvc, prefsSvc: prefsSvc, cfg: cfg}
 }
 
 func (s *service) Calculate(ctx context.Context, userID string, req CalculationRequest) (CalculationResult, error) {
+	cfg, err := s.evalConfig(ctx, userID, req.Explain, req.Format, nil)
+	if err != nil {
+		return CalculationResult{}, err
+	}
+
 	// 1) Get previous result (state), default 0
 	prevResult, err := s.historySvc.GetLatestResult(ctx, userID)
 	if err != nil {
@@ -32,45 +61,175 @@ func (s *service) Calculate(ctx context.Context, userID string, req CalculationR
 	}
 
 	// 2) Apply operation: result = prevResult (op) num
-	newResult, expr, err := applyOperation(prevResult, req.Num, req.Operation)
+	ev := newEvaluator(cfg)
+	ev.trace.addValue(RuleRunningResult, ev.num(prevResult),
+		fmt.Sprintf("start from the previous result %s", ev.num(prevResult)), prevResult)
+
+	operand, err := operandNode(req)
+	if err != nil {
+		return CalculationResult{}, err
+	}
+
+	newResult, expr, err := applyOperation(ev, prevResult, operand, req.Operation)
 	if err != nil {
 		return CalculationResult{}, err
 	}
 
 	// 3) Save in history
-	entry := &history.HistoryEntry{
-		UserID:     userID,
+	if err := s.record(ctx, userID, expr, newResult, ev.metadata()); err != nil {
+		return CalculationResult{}, err
+	}
+
+	res := CalculationResult{
 		Expression: expr,
 		Result:     newResult,
+		Formatted:  ev.num(newResult),
 	}
-	if err := s.historySvc.Record(ctx, entry); err != nil {
+	ev.explain(&res)
+	return res, nil
+}
+
+// Evaluate parses and evaluates a full expression. The result is stored in
+// history and becomes the new running result for Calculate.
+func (s *service) Evaluate(ctx context.Context, userID string, req ExpressionRequest) (CalculationResult, error) {
+	cfg, err := s.evalConfig(ctx, userID, req.Explain, req.Format, req.AngleMode)
+	if err != nil {
+		return CalculationResult{}, err
+	}
+
+	tree, err := parseExpression(req.Expression)
+	if err != nil {
+		return CalculationResult{}, err
+	}
+
+	if req.MaxSteps < 0 {
+		return CalculationResult{}, fmt.Errorf("%w: maxSteps must not be negative", ErrInvalidExpression)
+	}
+	if req.MaxSteps > 0 && req.MaxSteps < cfg.maxSteps {
+		cfg.maxSteps = req.MaxSteps
+	}
+	if req.Tolerance < 0 || req.Tolerance >= 1 {
+		return CalculationResult{}, fmt.Errorf("%w: tolerance must be between 0 and 1", ErrInvalidExpression)
+	}
+	cfg.tolerance = req.Tolerance
+
+	ev := newEvaluator(cfg)
+	value, err := ev.eval(tree)
+	if err != nil {
 		return CalculationResult{}, err
 	}
 
-	return CalculationResult{
+	expr := ev.text(tree)
+	if err := s.record(ctx, userID, expr, value, ev.metadata()); err != nil {
+		return CalculationResult{}, err
+	}
+
+	res := CalculationResult{
 		Expression: expr,
-		Result:     newResult,
-	}, nil
+		Result:     value,
+		Formatted:  ev.num(value),
+	}
+	ev.explain(&res)
+	return res, nil
 }
 
-func applyOperation(prev, num float64, op Operation) (float64, string, error) {
-	switch op {
-	case OpAdd:
-		res := prev + num
-		return res, fmt.Sprintf("%g + %g", prev, num), nil
-	case OpSubtract:
-		res := prev - num
-		return res, fmt.Sprintf("%g - %g", prev, num), nil
-	case OpMultiply:
-		res := prev * num
-		return res, fmt.Sprintf("%g * %g", prev, num), nil
-	case OpDivide:
-		if num == 0 {
-			return 0, "", ErrDivisionByZero
+// evalConfig combines the deployment settings with the user's stored
+// preferences and the per-request overrides of format and angle mode.
+func (s *service) evalConfig(ctx context.Context, userID string, explain bool, format *numeric.NumberFormat, angle *numeric.AngleMode) (evalConfig, error) {
+	prefs, err := s.prefsSvc.Get(ctx, userID)
+	if err != nil {
+		return evalConfig{}, err
+	}
+
+	cfg := evalConfig{
+		explain:  explain,
+		format:   prefs.NumberFormat.Merge(format),
+		special:  s.cfg.SpecialValues,
+		maxSteps: s.cfg.MaxEvalSteps,
+		angle:    prefs.AngleMode.Merge(angle),
+	}
+	if cfg.maxSteps <= 0 {
+		cfg.maxSteps = DefaultMaxEvalSteps
+	}
+	if err := cfg.format.Validate(); err != nil {
+		return evalConfig{}, err
+	}
+	if err := cfg.angle.Validate(); err != nil {
+		return evalConfig{}, err
+	}
+	return cfg, nil
+}
+
+// Constants lists the embedded constant table.
+func (s *service) Constants() []Constant {
+	out := make([]Constant, len(constantTable))
+	copy(out, constantTable)
+	return out
+}
+
+func (s *service) record(ctx context.Context, userID, expr string, result float64, metadata map[string]any) error {
+	entry := &history.HistoryEntry{
+		UserID:     userID,
+		Expression: expr,
+		Result:     result,
+		Metadata:   metadata,
+	}
+	return s.historySvc.Record(ctx, entry)
+}
+
+// applyOperation builds the "prev (op) num" expression and evaluates it
+// with the same evaluator used for full expressions.
+func applyOperation(ev *evaluator, prev float64, operand node, op Operation) (float64, string, error) {
+	tree, err := operationTree(prev, operand, op)
+	if err != nil {
+		return 0, "", err
+	}
+
+	res, err := ev.eval(tree)
+	if err != nil {
+		return 0, "", err
+	}
+	return res, ev.text(tree), nil
+}
+
+// operandNode returns the right-hand operand of a stateful operation:
+// the named constant if one is given, the literal number otherwise.
+func operandNode(req CalculationRequest) (node, error) {
+	if req.Constant == "" {
+		var v float64
+		if req.Num != nil {
+			v = *req.Num
 		}
-		res := prev / num
-		return res, fmt.Sprintf("%g / %g", prev, num), nil
-	default:
-		return 0, "", ErrInvalidOperation
+		return &numberNode{value: v}, nil
+	}
+	if req.Num != nil {
+		return nil, ErrConflictingOperands
+	}
+	c, err := lookupConstant(req.Constant)
+	if err != nil {
+		return nil, err
+	}
+	return &constantNode{constant: c}, nil
+}
+
+// operationTree returns the AST for a single stateful operation.
+func operationTree(prev float64, right node, op Operation) (node, error) {
+	left := &numberNode{value: prev}
+
+	switch op {
+	case OpPercentAdd:
+		return &binaryNode{op: '+', left: left, right: &percentNode{operand: right}}, nil
+	case OpPercentSubtract:
+		return &binaryNode{op: '-', left: left, right: &percentNode{operand: right}}, nil
+	case OpPercentOf:
+		return &binaryNode{op: '*', left: left, right: &percentNode{operand: right}}, nil
+	case OpPercentChange:
+		return &percentChangeNode{from: left, to: right}, nil
+	}
+
+	sym, ok := operationSymbols[op]
+	if !ok {
+		return nil, ErrInvalidOperation
 	}
+	return &binaryNode{op: sym, left: left, right: right}, nil
 }
@@ -2,12 +2,16 @@ package calculator
 
 import (
 	"context"
+	"encoding/json"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/preferences"
 )
 
 //
@@ -39,9 +43,35 @@ func (f *fakeHistoryService) List(ctx context.Context, userID string, limit, off
 	return nil, nil
 }
 
+// fakePreferencesService implements preferences.Service with a fixed
+// number format and angle mode.
+type fakePreferencesService struct {
+	format numeric.NumberFormat
+	angle  numeric.AngleMode
+}
+
+func (f *fakePreferencesService) Get(ctx context.Context, userID string) (preferences.Preferences, error) {
+	return preferences.Preferences{UserID: userID, NumberFormat: f.format, AngleMode: f.angle}, nil
+}
+
+func (f *fakePreferencesService) Update(ctx context.Context, prefs *preferences.Preferences) error {
+	f.format = prefs.NumberFormat
+	f.angle = prefs.AngleMode
+	return nil
+}
+
+func (f *fakePreferencesService) GetProfile(ctx context.Context, userID string) (preferences.Profile, error) {
+	return preferences.Profile{UserID: userID, NumberFormat: f.format}, nil
+}
+
+func (f *fakePreferencesService) UpdateProfile(ctx context.Context, profile *preferences.Profile) error {
+	f.format = profile.NumberFormat
+	return nil
+}
+
 // helper to build the concrete *service under test
 func newTestCalcServiceWithHistory(hs history.Service) *service {
-	return NewService(hs).(*service)
+	return NewService(hs, &fakePreferencesService{}, Config{}).(*service)
 }
 
 //
@@ -56,7 +86,7 @@ func TestCalculate_AddFromZero(t *testing.T) {
 	svc := newTestCalcServiceWithHistory(fh)
 
 	req := CalculationRequest{
-		Num:       1,
+		Num:       ptr(1.0),
 		Operation: OpAdd,
 	}
 
@@ -84,7 +114,7 @@ func TestCalculate_SubtractWithPreviousResult(t *testing.T) {
 	svc := newTestCalcServiceWithHistory(fh)
 
 	req := CalculationRequest{
-		Num:       3,
+		Num:       ptr(3.0),
 		Operation: OpSubtract,
 	}
 
@@ -110,7 +140,7 @@ func TestCalculate_DivideByZero(t *testing.T) {
 	svc := newTestCalcServiceWithHistory(fh)
 
 	req := CalculationRequest{
-		Num:       0,
+		Num:       ptr(0.0),
 		Operation: OpDivide,
 	}
 
@@ -130,7 +160,7 @@ func TestCalculate_InvalidOperation(t *testing.T) {
 	svc := newTestCalcServiceWithHistory(fh)
 
 	req := CalculationRequest{
-		Num:       2,
+		Num:       ptr(2.0),
 		Operation: Operation("BOGUS"),
 	}
 
@@ -140,3 +170,309 @@ func TestCalculate_InvalidOperation(t *testing.T) {
 
 	assert.Len(t, fh.recordedEntries, 0)
 }
+
+// Test expression evaluation honours precedence and records history.
+func TestEvaluate_Precedence(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	res, err := svc.Evaluate(context.Background(), "user-123", ExpressionRequest{
+		Expression: "2 + 3 * 4",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 14.0, res.Result)
+	assert.Equal(t, "2 + 3 * 4", res.Expression)
+	assert.Empty(t, res.Steps, "steps are only returned when explain=true")
+
+	require.Len(t, fh.recordedEntries, 1)
+	assert.Equal(t, res.Result, fh.recordedEntries[0].Result)
+}
+
+// Test syntax errors are reported as ErrInvalidExpression and not recorded.
+func TestEvaluate_InvalidExpression(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	for _, expr := range []string{"", "2 +", "(1 + 2", "3 $ 4", "1 2"} {
+		_, err := svc.Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: expr})
+		assert.ErrorIs(t, err, ErrInvalidExpression, expr)
+	}
+	assert.Len(t, fh.recordedEntries, 0)
+}
+
+// Test explain=true on the stateful calculator returns the running result
+// and the applied operation.
+func TestCalculate_Explain(t *testing.T) {
+	fh := &fakeHistoryService{latestResult: 10}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	res, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(4.0),
+		Operation: OpDivide,
+		Explain:   true,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, res.Steps, 2)
+	assert.Equal(t, RuleRunningResult, res.Steps[0].Rule)
+	assert.Equal(t, RuleDivision, res.Steps[1].Rule)
+	require.NotNil(t, res.Steps[1].Value)
+	assert.Equal(t, 2.5, *res.Steps[1].Value)
+	assert.Equal(t, "1. running result: start from the previous result 10\n2. division: 10 / 4 = 2.5", res.Explanation)
+}
+
+// Test the stored user format is applied to Expression and Formatted while
+// Result keeps full precision, and a per-request format overrides it.
+func TestCalculate_FormatPreferences(t *testing.T) {
+	decimals := 2
+	fh := &fakeHistoryService{latestResult: 1234.5}
+	fp := &fakePreferencesService{format: numeric.NumberFormat{
+		Notation: numeric.NotationFixed,
+		Decimals: &decimals,
+		Locale:   "de",
+	}}
+	svc := NewService(fh, fp, Config{}).(*service)
+
+	res, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(3.0),
+		Operation: OpDivide,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 411.5, res.Result)
+	assert.Equal(t, "411,50", res.Formatted)
+	assert.Equal(t, "1234,50 / 3,00", res.Expression)
+	assert.Equal(t, res.Expression, fh.recordedEntries[0].Expression)
+	assert.Equal(t, 411.5, fh.recordedEntries[0].Result)
+
+	// per-request override
+	sig := 2
+	res, err = svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(3.0),
+		Operation: OpDivide,
+		Format:    &numeric.NumberFormat{Notation: numeric.NotationScientific, SignificantDigits: &sig},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "4,1e+02", res.Formatted)
+}
+
+// Test invalid per-request formats are rejected before anything is recorded.
+func TestCalculate_InvalidFormat(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	_, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(1.0),
+		Operation: OpAdd,
+		Format:    &numeric.NumberFormat{Rounding: "bankers"},
+	})
+	assert.ErrorIs(t, err, numeric.ErrInvalidFormat)
+	assert.Len(t, fh.recordedEntries, 0)
+}
+
+// Test MULTIPLY past the float64 range is rejected by default.
+func TestCalculate_OverflowRejected(t *testing.T) {
+	fh := &fakeHistoryService{latestResult: 1e308}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	_, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(1e308),
+		Operation: OpMultiply,
+	})
+	assert.ErrorIs(t, err, ErrOverflow)
+	assert.Len(t, fh.recordedEntries, 0)
+
+	_, err = svc.Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: "(1e308 * 10) - (1e308 * 10)"})
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+// Test the "string" policy keeps the value and encodes it as a JSON string.
+func TestCalculate_OverflowAsString(t *testing.T) {
+	fh := &fakeHistoryService{latestResult: 1e308}
+	svc := NewService(fh, &fakePreferencesService{}, Config{
+		SpecialValues: numeric.SpecialValuesString,
+	}).(*service)
+
+	res, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(-1e308),
+		Operation: OpMultiply,
+		Explain:   true,
+	})
+	require.NoError(t, err)
+	assert.True(t, math.IsInf(res.Result, -1))
+
+	b, err := json.Marshal(res)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"result":"-Infinity"`)
+	assert.Contains(t, string(b), `"value":"-Infinity"`)
+
+	// A literal past the float64 range is infinite too, not a parse error.
+	res, err = svc.Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: "-1e999 + 1"})
+	require.NoError(t, err)
+	assert.True(t, math.IsInf(res.Result, -1))
+
+	_, err = newTestCalcServiceWithHistory(&fakeHistoryService{}).Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: "1e999"})
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+// Test percent operations behave like a desk calculator and render with '%',
+// with the default format as expressions that evaluate to the same result.
+func TestCalculate_Percent(t *testing.T) {
+	cases := []struct {
+		op       Operation
+		num      float64
+		want     float64
+		wantExpr string
+	}{
+		{OpPercentAdd, 10, 220, "200 + 10%"},
+		{OpPercentSubtract, 15, 170, "200 - 15%"},
+		{OpPercentOf, 15, 30, "200 * 15%"},
+		{OpPercentAdd, -10, 180, "200 + (-10)%"},
+		{OpPercentChange, 250, 25, "Δ%(200 → 250)"},
+	}
+	for _, c := range cases {
+		fh := &fakeHistoryService{latestResult: 200}
+		svc := newTestCalcServiceWithHistory(fh)
+
+		res, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{Num: &c.num, Operation: c.op})
+		require.NoError(t, err, c.op)
+		assert.Equal(t, c.want, res.Result, c.op)
+		assert.Equal(t, c.wantExpr, res.Expression, c.op)
+		assert.Equal(t, c.wantExpr, fh.recordedEntries[0].Expression, c.op)
+
+		again, err := svc.Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: res.Expression})
+		require.NoError(t, err, c.op)
+		assert.Equal(t, c.want, again.Result, c.op)
+		assert.Equal(t, c.wantExpr, again.Expression, c.op)
+	}
+
+	// Only a bare b% is relative to the left operand.
+	svc := newTestCalcServiceWithHistory(&fakeHistoryService{})
+	res, err := svc.Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: "200 + (10%)"})
+	require.NoError(t, err)
+	assert.Equal(t, 200.1, res.Result)
+}
+
+// Test percent change from zero is a division by zero.
+func TestCalculate_PercentChangeFromZero(t *testing.T) {
+	svc := newTestCalcServiceWithHistory(&fakeHistoryService{latestResult: 0})
+
+	_, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{Num: ptr(5.0), Operation: OpPercentChange})
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+}
+
+// Test a constant can be used as the operand, but not together with num,
+// and its metadata is stored.
+func TestCalculate_ConstantOperand(t *testing.T) {
+	fh := &fakeHistoryService{latestResult: 2}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	res, err := svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Constant:  "c",
+		Operation: OpMultiply,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2*299792458.0, res.Result)
+	assert.Equal(t, "2 * c", res.Expression)
+
+	require.Len(t, fh.recordedEntries, 1)
+	used := fh.recordedEntries[0].Metadata["constants"].([]map[string]any)
+	require.Len(t, used, 1)
+	assert.Equal(t, "c", used[0]["name"])
+	assert.Equal(t, "m s^-1", used[0]["unit"])
+	assert.Equal(t, "CODATA 2018 (exact)", used[0]["source"])
+
+	_, err = svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Constant:  "warp",
+		Operation: OpAdd,
+	})
+	assert.ErrorIs(t, err, ErrUnknownConstant)
+
+	// Even num 0 alongside a constant is ambiguous.
+	_, err = svc.Calculate(context.Background(), "user-123", CalculationRequest{
+		Num:       ptr(0.0),
+		Constant:  "c",
+		Operation: OpAdd,
+	})
+	assert.ErrorIs(t, err, ErrConflictingOperands)
+	assert.Len(t, fh.recordedEntries, 1)
+}
+
+// Test constants in expressions are resolved and listed once in metadata.
+func TestEvaluate_Constants(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := newTestCalcServiceWithHistory(fh)
+
+	res, err := svc.Evaluate(context.Background(), "user-123", ExpressionRequest{
+		Expression: "G * 5.972e24 / 6.371e6 ^ 2 + 0 * G",
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 9.82, res.Result, 0.01)
+
+	used := fh.recordedEntries[0].Metadata["constants"].([]map[string]any)
+	require.Len(t, used, 1)
+	assert.Equal(t, 0.00015e-11, used[0]["uncertainty"])
+
+	_, err = svc.Evaluate(context.Background(), "user-123", ExpressionRequest{Expression: "2 * g"})
+	assert.ErrorIs(t, err, ErrUnknownConstant)
+}
+
+// Test the embedded table loads and names are unique.
+func TestConstants_Table(t *testing.T) {
+	svc := newTestCalcServiceWithHistory(&fakeHistoryService{})
+
+	cs := svc.Constants()
+	require.NotEmpty(t, cs)
+	assert.Len(t, constantsByName, len(cs))
+	for _, name := range []string{"pi", "e", "phi", "c", "G", "h", "N_A", "k_B"} {
+		_, err := lookupConstant(name)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestEvaluate_MaxStepsOnlyLowersServerLimit(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := NewService(fh, &fakePreferencesService{}, Config{MaxEvalSteps: 1000}).(*service)
+	ctx := context.Background()
+
+	// 100 terms of k^2 cost 300 steps: within the server limit...
+	res, err := svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "sum(k^2, k = 1..100)"})
+	require.NoError(t, err)
+	assert.Equal(t, 338350.0, res.Result)
+
+	// ...but not within a lower per-request limit,
+	_, err = svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "sum(k^2, k = 1..100)", MaxSteps: 100})
+	assert.ErrorIs(t, err, ErrExpressionTooComplex)
+
+	// and a request cannot raise it.
+	_, err = svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "sum(k^2, k = 1..1000)", MaxSteps: 1_000_000})
+	assert.ErrorIs(t, err, ErrExpressionTooComplex)
+}
+
+func TestEvaluate_TrigFollowsAngleMode(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := NewService(fh, &fakePreferencesService{angle: numeric.AngleDegrees}, Config{})
+	ctx := context.Background()
+
+	res, err := svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "sin(30) + cos(180)", Explain: true})
+	require.NoError(t, err)
+	assert.InDelta(t, -0.5, res.Result, 1e-15)
+	assert.Contains(t, res.Steps[0].Detail, "(angles in deg)")
+
+	res, err = svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "atan2(1, 1)"})
+	require.NoError(t, err)
+	assert.InDelta(t, 45, res.Result, 1e-12)
+
+	rad := numeric.AngleRadians
+	res, err = svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "acos(-1)", AngleMode: &rad})
+	require.NoError(t, err)
+	assert.InDelta(t, math.Pi, res.Result, 1e-15)
+
+	grad := numeric.AngleMode("gon")
+	_, err = svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "sin(1)", AngleMode: &grad})
+	assert.ErrorIs(t, err, numeric.ErrInvalidAngleMode)
+
+	_, err = svc.Evaluate(ctx, "user-123", ExpressionRequest{Expression: "tan(90)"})
+	assert.ErrorIs(t, err, ErrOverflow)
+}
@@ -0,0 +1,77 @@
+// internal/geometry/coordinates.go
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// dimensions is the number of values each system takes; zero means
+// either two or three (cartesian).
+var dimensions = map[CoordinateSystem]int{
+	Cartesian: 0,
+	Polar:     2,
+	Spherical: 3,
+}
+
+// convertCoordinates goes through cartesian coordinates, so any pair of
+// systems of the same dimension converts.
+func convertCoordinates(req CoordinateRequest, mode numeric.AngleMode) ([]float64, error) {
+	for _, sys := range []CoordinateSystem{req.From, req.To} {
+		if _, ok := dimensions[sys]; !ok {
+			return nil, fmt.Errorf("%w: coordinate system must be %q, %q or %q", ErrInvalidArgument, Cartesian, Polar, Spherical)
+		}
+	}
+	n := len(req.Values)
+	if want := dimensions[req.From]; (want == 0 && n != 2 && n != 3) || (want != 0 && n != want) {
+		return nil, fmt.Errorf("%w: %s coordinates take %s values", ErrInvalidArgument, req.From, valueCount(req.From))
+	}
+	if want := dimensions[req.To]; want != 0 && n != want {
+		return nil, fmt.Errorf("%w: %d-dimensional coordinates cannot be written as %s", ErrInvalidArgument, n, req.To)
+	}
+
+	xyz := toCartesian(req.From, req.Values, mode)
+	return fromCartesian(req.To, xyz, mode), nil
+}
+
+func toCartesian(sys CoordinateSystem, v []float64, mode numeric.AngleMode) []float64 {
+	switch sys {
+	case Polar:
+		r, theta := v[0], v[1]
+		return []float64{r * mode.Cos(theta), r * mode.Sin(theta)}
+	case Spherical:
+		r, theta, phi := v[0], v[1], v[2]
+		return []float64{
+			r * mode.Sin(theta) * mode.Cos(phi),
+			r * mode.Sin(theta) * mode.Sin(phi),
+			r * mode.Cos(theta),
+		}
+	default:
+		return append([]float64(nil), v...)
+	}
+}
+
+func fromCartesian(sys CoordinateSystem, v []float64, mode numeric.AngleMode) []float64 {
+	switch sys {
+	case Polar:
+		return []float64{math.Hypot(v[0], v[1]), mode.FromRadians(math.Atan2(v[1], v[0]))}
+	case Spherical:
+		r := math.Hypot(math.Hypot(v[0], v[1]), v[2])
+		theta := 0.0
+		if r > 0 {
+			theta = math.Acos(v[2] / r)
+		}
+		return []float64{r, mode.FromRadians(theta), mode.FromRadians(math.Atan2(v[1], v[0]))}
+	default:
+		return v
+	}
+}
+
+func valueCount(sys CoordinateSystem) string {
+	if n := dimensions[sys]; n != 0 {
+		return fmt.Sprint(n)
+	}
+	return "2 or 3"
+}
@@ -0,0 +1,30 @@
+// internal/geometry/handler.go
+package geometry
+
+import (
+	"net/http"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/jsonapi"
+)
+
+// clientErrors are the service errors answered with 400.
+var clientErrors = []error{ErrInvalidArgument, ErrNotATriangle}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// Triangle handles POST /api/v1/geometry/triangle.
+func (h *Handler) Triangle(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.Triangle, clientErrors...)
+}
+
+// Shape handles POST /api/v1/geometry/shape.
+func (h *Handler) Shape(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.Shape, clientErrors...)
+}
+
+// Coordinates handles POST /api/v1/geometry/coordinates.
+func (h *Handler) Coordinates(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.Coordinates, clientErrors...)
+}
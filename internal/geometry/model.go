@@ -0,0 +1,80 @@
+// internal/geometry/model.go
+package geometry
+
+import "github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+
+// TriangleCase names which parts of a triangle are given. Sides a, b, c
+// are opposite angles A, B, C.
+type TriangleCase string
+
+const (
+	CaseSSS TriangleCase = "SSS" // sides: [a, b, c]
+	CaseSAS TriangleCase = "SAS" // sides: [b, c], angles: [A], the angle between them
+	CaseASA TriangleCase = "ASA" // angles: [B, C], sides: [a], the side between them
+)
+
+// TriangleRequest solves a triangle. Angles are read and written in the
+// user's angle mode unless AngleMode overrides it for this request.
+type TriangleRequest struct {
+	Case      TriangleCase       `json:"case"`
+	Sides     []float64          `json:"sides"`
+	Angles    []float64          `json:"angles"`
+	AngleMode *numeric.AngleMode `json:"angleMode,omitempty"`
+}
+
+// TriangleResult is the fully solved triangle.
+type TriangleResult struct {
+	Expression string            `json:"expression"`
+	Sides      [3]float64        `json:"sides"`  // a, b, c
+	Angles     [3]float64        `json:"angles"` // A, B, C
+	AngleMode  numeric.AngleMode `json:"angleMode"`
+	Area       float64           `json:"area"`
+	Perimeter  float64           `json:"perimeter"`
+}
+
+// ShapeRequest measures a named shape, e.g.
+// {"shape": "cylinder", "dimensions": {"radius": 1, "height": 2}}.
+type ShapeRequest struct {
+	Shape      string             `json:"shape"`
+	Dimensions map[string]float64 `json:"dimensions"`
+}
+
+// ShapeResult holds area and perimeter for plane shapes, volume and
+// surface area for solids. Result is the area or the volume.
+type ShapeResult struct {
+	Expression  string   `json:"expression"`
+	Result      float64  `json:"result"`
+	Area        *float64 `json:"area,omitempty"`
+	Perimeter   *float64 `json:"perimeter,omitempty"`
+	Volume      *float64 `json:"volume,omitempty"`
+	SurfaceArea *float64 `json:"surfaceArea,omitempty"`
+}
+
+// CoordinateSystem names a coordinate representation.
+type CoordinateSystem string
+
+const (
+	Cartesian CoordinateSystem = "cartesian" // (x, y) or (x, y, z)
+	Polar     CoordinateSystem = "polar"     // (r, θ)
+	Spherical CoordinateSystem = "spherical" // (r, θ from the z axis, φ in the xy-plane)
+)
+
+// CoordinateRequest converts Values from one system to another. Angles
+// use the user's angle mode unless AngleMode overrides it.
+type CoordinateRequest struct {
+	From      CoordinateSystem   `json:"from"`
+	To        CoordinateSystem   `json:"to"`
+	Values    []float64          `json:"values"`
+	AngleMode *numeric.AngleMode `json:"angleMode,omitempty"`
+}
+
+type CoordinateResult struct {
+	Expression string            `json:"expression"`
+	Values     []float64         `json:"values"`
+	AngleMode  numeric.AngleMode `json:"angleMode"`
+}
+
+// Handler wires HTTP requests to the geometry Service.
+type Handler struct {
+	svc Service
+}
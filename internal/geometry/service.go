@@ -0,0 +1,170 @@
+// internal/geometry/service.go
+package geometry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/jsonapi"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/preferences"
+)
+
+var (
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrNotATriangle    = errors.New("not a triangle")
+)
+
+type Service interface {
+	Triangle(ctx context.Context, userID string, req TriangleRequest) (TriangleResult, error)
+	Shape(ctx context.Context, userID string, req ShapeRequest) (ShapeResult, error)
+	Coordinates(ctx context.Context, userID string, req CoordinateRequest) (CoordinateResult, error)
+}
+
+type service struct {
+	historySvc history.Service
+	prefsSvc   preferences.Service
+}
+
+func NewService(historySvc history.Service, prefsSvc preferences.Service) Service {
+	return &service{historySvc: historySvc, prefsSvc: prefsSvc}
+}
+
+func (s *service) Triangle(ctx context.Context, userID string, req TriangleRequest) (TriangleResult, error) {
+	mode, err := s.angleMode(ctx, userID, req.AngleMode)
+	if err != nil {
+		return TriangleResult{}, err
+	}
+
+	sides, angles, err := solveTriangle(req, mode)
+	if err != nil {
+		return TriangleResult{}, err
+	}
+
+	res := TriangleResult{Sides: sides, AngleMode: mode}
+	for i, a := range angles {
+		res.Angles[i] = mode.FromRadians(a)
+	}
+	res.Perimeter = sides[0] + sides[1] + sides[2]
+	res.Area = 0.5 * sides[1] * sides[2] * math.Sin(angles[0])
+	if err := jsonapi.CheckFinite(append(sides[:], res.Perimeter, res.Area)...); err != nil {
+		return TriangleResult{}, err
+	}
+
+	given := make([]string, 0, 3)
+	for _, v := range req.Sides {
+		given = append(given, fmt.Sprintf("%g", v))
+	}
+	for _, v := range req.Angles {
+		given = append(given, fmt.Sprintf("%g%s", v, mode.Symbol()))
+	}
+	res.Expression = fmt.Sprintf("triangle %s(%s)", req.Case, strings.Join(given, ", "))
+
+	err = jsonapi.Record(ctx, s.historySvc, userID, res.Expression, res.Area, map[string]any{
+		"tool":      "triangle",
+		"sides":     res.Sides,
+		"angles":    res.Angles,
+		"angleMode": mode,
+		"perimeter": res.Perimeter,
+	})
+	return res, err
+}
+
+func (s *service) Shape(ctx context.Context, userID string, req ShapeRequest) (ShapeResult, error) {
+	sh, ok := shapes[req.Shape]
+	if !ok {
+		return ShapeResult{}, fmt.Errorf("%w: unknown shape %q (supported: %s)", ErrInvalidArgument, req.Shape, shapeNames())
+	}
+
+	dims := make([]float64, len(sh.dims))
+	parts := make([]string, len(sh.dims))
+	for i, name := range sh.dims {
+		v, ok := req.Dimensions[name]
+		if !ok || !(v > 0) || math.IsInf(v, 0) {
+			return ShapeResult{}, fmt.Errorf("%w: %s needs positive %s", ErrInvalidArgument, req.Shape, strings.Join(sh.dims, ", "))
+		}
+		dims[i] = v
+		parts[i] = fmt.Sprintf("%s=%g", name, v)
+	}
+	if req.Shape == "regular_polygon" && (dims[0] < 3 || dims[0] != math.Trunc(dims[0])) {
+		return ShapeResult{}, fmt.Errorf("%w: a regular polygon needs a whole number of sides, at least 3", ErrInvalidArgument)
+	}
+	if req.Shape == "triangle" {
+		if _, _, err := solveTriangle(TriangleRequest{Case: CaseSSS, Sides: dims}, numeric.AngleRadians); err != nil {
+			return ShapeResult{}, err
+		}
+	}
+
+	first, second := sh.measure(dims)
+	if err := jsonapi.CheckFinite(first, second); err != nil {
+		return ShapeResult{}, err
+	}
+	res := ShapeResult{Result: first}
+	kind := "area"
+	if sh.solid {
+		kind = "volume"
+		res.Volume, res.SurfaceArea = &first, &second
+	} else {
+		res.Area, res.Perimeter = &first, &second
+	}
+	res.Expression = fmt.Sprintf("%s(%s, %s)", kind, req.Shape, strings.Join(parts, ", "))
+
+	err := jsonapi.Record(ctx, s.historySvc, userID, res.Expression, res.Result, map[string]any{
+		"tool":        "shape",
+		"area":        res.Area,
+		"perimeter":   res.Perimeter,
+		"volume":      res.Volume,
+		"surfaceArea": res.SurfaceArea,
+	})
+	return res, err
+}
+
+func (s *service) Coordinates(ctx context.Context, userID string, req CoordinateRequest) (CoordinateResult, error) {
+	mode, err := s.angleMode(ctx, userID, req.AngleMode)
+	if err != nil {
+		return CoordinateResult{}, err
+	}
+
+	values, err := convertCoordinates(req, mode)
+	if err != nil {
+		return CoordinateResult{}, err
+	}
+	if err := jsonapi.CheckFinite(values...); err != nil {
+		return CoordinateResult{}, err
+	}
+
+	in := make([]string, len(req.Values))
+	for i, v := range req.Values {
+		in[i] = fmt.Sprintf("%g", v)
+	}
+	res := CoordinateResult{
+		Expression: fmt.Sprintf("%s(%s) → %s", req.From, strings.Join(in, ", "), req.To),
+		Values:     values,
+		AngleMode:  mode,
+	}
+
+	// The first coordinate (x or r) stands in as the numeric result.
+	err = jsonapi.Record(ctx, s.historySvc, userID, res.Expression, values[0], map[string]any{
+		"tool":      "coordinates",
+		"values":    values,
+		"angleMode": mode,
+	})
+	return res, err
+}
+
+// angleMode returns the per-request override or the user's stored mode.
+func (s *service) angleMode(ctx context.Context, userID string, override *numeric.AngleMode) (numeric.AngleMode, error) {
+	prefs, err := s.prefsSvc.Get(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	mode := prefs.AngleMode.Merge(override)
+	if err := mode.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+	return mode.OrDefault(), nil
+}
@@ -0,0 +1,197 @@
+package geometry
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/jsonapi"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/preferences"
+)
+
+//
+// Test fakes
+//
+
+// fakeHistoryService records entries so tests can inspect them.
+type fakeHistoryService struct {
+	recordedEntries []*history.HistoryEntry
+}
+
+func (f *fakeHistoryService) GetLatestResult(ctx context.Context, userID string) (float64, error) {
+	return 0, nil
+}
+
+func (f *fakeHistoryService) Record(ctx context.Context, entry *history.HistoryEntry) error {
+	f.recordedEntries = append(f.recordedEntries, entry)
+	return nil
+}
+
+func (f *fakeHistoryService) List(ctx context.Context, userID string, limit, offset int) ([]history.HistoryEntry, error) {
+	return nil, nil
+}
+
+// fakePreferencesService returns a fixed angle mode.
+type fakePreferencesService struct {
+	angle numeric.AngleMode
+}
+
+func (f *fakePreferencesService) Get(ctx context.Context, userID string) (preferences.Preferences, error) {
+	return preferences.Preferences{UserID: userID, AngleMode: f.angle}, nil
+}
+
+func (f *fakePreferencesService) Update(ctx context.Context, prefs *preferences.Preferences) error {
+	f.angle = prefs.AngleMode
+	return nil
+}
+
+func (f *fakePreferencesService) GetProfile(ctx context.Context, userID string) (preferences.Profile, error) {
+	return preferences.Profile{UserID: userID}, nil
+}
+
+func (f *fakePreferencesService) UpdateProfile(ctx context.Context, profile *preferences.Profile) error {
+	return nil
+}
+
+func newTestService(angle numeric.AngleMode) (*fakeHistoryService, Service) {
+	fh := &fakeHistoryService{}
+	return fh, NewService(fh, &fakePreferencesService{angle: angle})
+}
+
+func mode(m numeric.AngleMode) *numeric.AngleMode { return &m }
+
+//
+// Tests
+//
+
+func TestTriangle_SSSInDegrees(t *testing.T) {
+	fh, svc := newTestService(numeric.AngleDegrees)
+
+	res, err := svc.Triangle(context.Background(), "user-123", TriangleRequest{Case: CaseSSS, Sides: []float64{3, 4, 5}})
+	require.NoError(t, err)
+
+	assert.InDelta(t, 36.8699, res.Angles[0], 1e-4)
+	assert.InDelta(t, 53.1301, res.Angles[1], 1e-4)
+	assert.InDelta(t, 90, res.Angles[2], 1e-9)
+	assert.InDelta(t, 6, res.Area, 1e-12)
+	assert.Equal(t, 12.0, res.Perimeter)
+	assert.Equal(t, numeric.AngleDegrees, res.AngleMode)
+
+	require.Len(t, fh.recordedEntries, 1)
+	assert.Equal(t, "triangle SSS(3, 4, 5)", fh.recordedEntries[0].Expression)
+	assert.InDelta(t, 6, fh.recordedEntries[0].Result, 1e-12)
+}
+
+func TestTriangle_SASAndASAAgree(t *testing.T) {
+	_, svc := newTestService(numeric.AngleGradians)
+	ctx := context.Background()
+
+	// right angle (100 grad) between sides 3 and 4
+	sas, err := svc.Triangle(ctx, "user-123", TriangleRequest{Case: CaseSAS, Sides: []float64{3, 4}, Angles: []float64{100}})
+	require.NoError(t, err)
+	assert.InDelta(t, 5, sas.Sides[0], 1e-12)
+
+	asa, err := svc.Triangle(ctx, "user-123", TriangleRequest{
+		Case: CaseASA, Sides: []float64{sas.Sides[0]}, Angles: []float64{sas.Angles[1], sas.Angles[2]},
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 3, asa.Sides[1], 1e-9)
+	assert.InDelta(t, 4, asa.Sides[2], 1e-9)
+	assert.InDelta(t, 100, asa.Angles[0], 1e-9)
+
+	// the per-request mode wins over the stored one
+	rad, err := svc.Triangle(ctx, "user-123", TriangleRequest{
+		Case: CaseSAS, Sides: []float64{1, 1}, Angles: []float64{math.Pi / 3}, AngleMode: mode(numeric.AngleRadians),
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, 1, rad.Sides[0], 1e-12)
+}
+
+func TestTriangle_Invalid(t *testing.T) {
+	_, svc := newTestService(numeric.AngleDegrees)
+	ctx := context.Background()
+
+	_, err := svc.Triangle(ctx, "user-123", TriangleRequest{Case: CaseSSS, Sides: []float64{1, 2, 3}})
+	assert.ErrorIs(t, err, ErrNotATriangle)
+	_, err = svc.Triangle(ctx, "user-123", TriangleRequest{Case: CaseASA, Sides: []float64{1}, Angles: []float64{100, 80}})
+	assert.ErrorIs(t, err, ErrNotATriangle)
+	_, err = svc.Triangle(ctx, "user-123", TriangleRequest{Case: CaseSAS, Sides: []float64{1}, Angles: []float64{30}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.Triangle(ctx, "user-123", TriangleRequest{Case: "AAA", Angles: []float64{60, 60, 60}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestShape_PlaneAndSolid(t *testing.T) {
+	fh, svc := newTestService("")
+	ctx := context.Background()
+
+	res, err := svc.Shape(ctx, "user-123", ShapeRequest{Shape: "circle", Dimensions: map[string]float64{"radius": 2}})
+	require.NoError(t, err)
+	assert.InDelta(t, 4*math.Pi, *res.Area, 1e-12)
+	assert.InDelta(t, 4*math.Pi, *res.Perimeter, 1e-12)
+	assert.Nil(t, res.Volume)
+
+	res, err = svc.Shape(ctx, "user-123", ShapeRequest{Shape: "cylinder", Dimensions: map[string]float64{"radius": 1, "height": 2}})
+	require.NoError(t, err)
+	assert.InDelta(t, 2*math.Pi, *res.Volume, 1e-12)
+	assert.InDelta(t, 6*math.Pi, *res.SurfaceArea, 1e-12)
+	assert.Equal(t, "volume(cylinder, radius=1, height=2)", res.Expression)
+
+	res, err = svc.Shape(ctx, "user-123", ShapeRequest{Shape: "regular_polygon", Dimensions: map[string]float64{"sides": 4, "length": 3}})
+	require.NoError(t, err)
+	assert.InDelta(t, 9, *res.Area, 1e-12)
+
+	assert.Len(t, fh.recordedEntries, 3)
+
+	_, err = svc.Shape(ctx, "user-123", ShapeRequest{Shape: "rectangle", Dimensions: map[string]float64{"width": 2}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.Shape(ctx, "user-123", ShapeRequest{Shape: "triangle", Dimensions: map[string]float64{"a": 1, "b": 1, "c": 5}})
+	assert.ErrorIs(t, err, ErrNotATriangle)
+	_, err = svc.Shape(ctx, "user-123", ShapeRequest{Shape: "hexahedron"})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// Results beyond float64 are refused, not stored.
+	_, err = svc.Shape(ctx, "user-123", ShapeRequest{Shape: "cube", Dimensions: map[string]float64{"side": 1e200}})
+	assert.ErrorIs(t, err, jsonapi.ErrNotFinite)
+	_, err = svc.Triangle(ctx, "user-123", TriangleRequest{Case: CaseSSS, Sides: []float64{1e308, 1e308, 1e308}})
+	assert.ErrorIs(t, err, jsonapi.ErrNotFinite)
+	assert.Len(t, fh.recordedEntries, 3)
+}
+
+func TestCoordinates_RoundTrip(t *testing.T) {
+	_, svc := newTestService(numeric.AngleDegrees)
+	ctx := context.Background()
+
+	res, err := svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Polar, To: Cartesian, Values: []float64{2, 90}})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0, 2}, res.Values) // exact quarter turn
+
+	res, err = svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Cartesian, To: Polar, Values: []float64{1, 1}})
+	require.NoError(t, err)
+	assert.InDelta(t, math.Sqrt2, res.Values[0], 1e-15)
+	assert.InDelta(t, 45, res.Values[1], 1e-12)
+
+	res, err = svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Cartesian, To: Spherical, Values: []float64{0, 0, 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 0, 0}, res.Values)
+
+	back, err := svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Spherical, To: Cartesian, Values: []float64{1, 90, 180}})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{-1, 0, 0}, back.Values)
+
+	big, err := svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Cartesian, To: Spherical, Values: []float64{1e200, 0, 1e200}})
+	require.NoError(t, err)
+	assert.InDelta(t, math.Sqrt2*1e200, big.Values[0], 1e186)
+	_, err = svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Cartesian, To: Polar, Values: []float64{math.MaxFloat64, math.MaxFloat64}})
+	assert.ErrorIs(t, err, jsonapi.ErrNotFinite)
+
+	_, err = svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Polar, To: Spherical, Values: []float64{1, 2}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.Coordinates(ctx, "user-123", CoordinateRequest{From: Cartesian, To: Polar, Values: []float64{1, 2}, AngleMode: mode("turns")})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
@@ -0,0 +1,77 @@
+// internal/geometry/shapes.go
+package geometry
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// shape describes a supported shape: its required dimensions, in order,
+// and how to measure it. Plane shapes return (area, perimeter), solids
+// return (volume, surface area).
+type shape struct {
+	dims    []string
+	solid   bool
+	measure func(d []float64) (float64, float64)
+}
+
+var shapes = map[string]shape{
+	"circle": {dims: []string{"radius"}, measure: func(d []float64) (float64, float64) {
+		return math.Pi * d[0] * d[0], 2 * math.Pi * d[0]
+	}},
+	"square": {dims: []string{"side"}, measure: func(d []float64) (float64, float64) {
+		return d[0] * d[0], 4 * d[0]
+	}},
+	"rectangle": {dims: []string{"width", "height"}, measure: func(d []float64) (float64, float64) {
+		return d[0] * d[1], 2 * (d[0] + d[1])
+	}},
+	"triangle": {dims: []string{"a", "b", "c"}, measure: func(d []float64) (float64, float64) {
+		return heron(d[0], d[1], d[2]), d[0] + d[1] + d[2]
+	}},
+	"ellipse": {dims: []string{"a", "b"}, measure: func(d []float64) (float64, float64) {
+		// Ramanujan's second approximation for the perimeter
+		a, b := d[0], d[1]
+		h := (a - b) * (a - b) / ((a + b) * (a + b))
+		return math.Pi * a * b, math.Pi * (a + b) * (1 + 3*h/(10+math.Sqrt(4-3*h)))
+	}},
+	"regular_polygon": {dims: []string{"sides", "length"}, measure: func(d []float64) (float64, float64) {
+		n, s := d[0], d[1]
+		return n * s * s / (4 * math.Tan(math.Pi/n)), n * s
+	}},
+	"sphere": {dims: []string{"radius"}, solid: true, measure: func(d []float64) (float64, float64) {
+		r := d[0]
+		return 4.0 / 3 * math.Pi * r * r * r, 4 * math.Pi * r * r
+	}},
+	"cube": {dims: []string{"side"}, solid: true, measure: func(d []float64) (float64, float64) {
+		return d[0] * d[0] * d[0], 6 * d[0] * d[0]
+	}},
+	"cuboid": {dims: []string{"length", "width", "height"}, solid: true, measure: func(d []float64) (float64, float64) {
+		l, w, h := d[0], d[1], d[2]
+		return l * w * h, 2 * (l*w + l*h + w*h)
+	}},
+	"cylinder": {dims: []string{"radius", "height"}, solid: true, measure: func(d []float64) (float64, float64) {
+		r, h := d[0], d[1]
+		return math.Pi * r * r * h, 2 * math.Pi * r * (r + h)
+	}},
+	"cone": {dims: []string{"radius", "height"}, solid: true, measure: func(d []float64) (float64, float64) {
+		r, h := d[0], d[1]
+		return math.Pi * r * r * h / 3, math.Pi * r * (r + math.Hypot(r, h))
+	}},
+}
+
+// shapeNames lists the supported shapes for error messages.
+func shapeNames() string {
+	names := make([]string, 0, len(shapes))
+	for name := range shapes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// heron returns the area of a triangle from its three sides.
+func heron(a, b, c float64) float64 {
+	s := (a + b + c) / 2
+	return math.Sqrt(s * (s - a) * (s - b) * (s - c))
+}
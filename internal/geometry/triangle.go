@@ -0,0 +1,68 @@
+// internal/geometry/triangle.go
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// solveTriangle returns sides (a, b, c) and angles (A, B, C) in radians.
+func solveTriangle(req TriangleRequest, mode numeric.AngleMode) (sides, angles [3]float64, err error) {
+	want := map[TriangleCase][2]int{CaseSSS: {3, 0}, CaseSAS: {2, 1}, CaseASA: {1, 2}}
+	n, ok := want[req.Case]
+	if !ok {
+		return sides, angles, fmt.Errorf("%w: case must be %q, %q or %q", ErrInvalidArgument, CaseSSS, CaseSAS, CaseASA)
+	}
+	if len(req.Sides) != n[0] || len(req.Angles) != n[1] {
+		return sides, angles, fmt.Errorf("%w: %s takes %d side(s) and %d angle(s)", ErrInvalidArgument, req.Case, n[0], n[1])
+	}
+	for _, s := range req.Sides {
+		if !(s > 0) || math.IsInf(s, 0) {
+			return sides, angles, fmt.Errorf("%w: sides must be positive", ErrInvalidArgument)
+		}
+	}
+	given := make([]float64, len(req.Angles))
+	for i, a := range req.Angles {
+		given[i] = mode.ToRadians(a)
+		if !(given[i] > 0) || given[i] >= math.Pi {
+			return sides, angles, fmt.Errorf("%w: angles must be between 0 and a half turn", ErrNotATriangle)
+		}
+	}
+
+	switch req.Case {
+	case CaseSSS:
+		a, b, c := req.Sides[0], req.Sides[1], req.Sides[2]
+		if a+b <= c || a+c <= b || b+c <= a {
+			return sides, angles, fmt.Errorf("%w: each side must be shorter than the other two together", ErrNotATriangle)
+		}
+		sides = [3]float64{a, b, c}
+		angles[0] = lawOfCosines(a, b, c)
+		angles[1] = lawOfCosines(b, a, c)
+		angles[2] = math.Pi - angles[0] - angles[1]
+	case CaseSAS:
+		b, c, A := req.Sides[0], req.Sides[1], given[0]
+		a := math.Sqrt(b*b + c*c - 2*b*c*math.Cos(A))
+		sides = [3]float64{a, b, c}
+		angles[0] = A
+		angles[1] = lawOfCosines(b, a, c)
+		angles[2] = math.Pi - angles[0] - angles[1]
+	case CaseASA:
+		B, C, a := given[0], given[1], req.Sides[0]
+		A := math.Pi - B - C
+		if A <= 0 {
+			return sides, angles, fmt.Errorf("%w: the two angles add up to a half turn or more", ErrNotATriangle)
+		}
+		sides = [3]float64{a, a * math.Sin(B) / math.Sin(A), a * math.Sin(C) / math.Sin(A)}
+		angles = [3]float64{A, B, C}
+	}
+	return sides, angles, nil
+}
+
+// lawOfCosines returns the angle opposite side x in a triangle with
+// sides x, y, z, clamping rounding noise into acos's domain.
+func lawOfCosines(x, y, z float64) float64 {
+	cos := (y*y + z*z - x*x) / (2 * y * z)
+	return math.Acos(math.Max(-1, math.Min(1, cos)))
+}
@@ -7,7 +7,10 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
 )
 
 // NewHandler constructs a new History HTTP handler.
@@ -23,6 +26,40 @@ func NewHandler(svc Service) *Handler {
 //   - Asks the History service for that user's entries.
 //   - Returns a JSON array where each item includes email.
 func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	// Get user identity from JWT/context
+	userID, email, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": "unauthorized",
+		})
+		return
+	}
+
+	h.writeHistory(w, r, userID, email)
+}
+
+// GetUserHistory handles GET /api/v1/admin/users/{id}/history?limit=&offset=
+// for admins and auditors. Entries carry no email, since the token is not
+// the owner's.
+func (h *Handler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	if _, err := uuid.Parse(userID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": "user not found",
+		})
+		return
+	}
+
+	h.writeHistory(w, r, userID, "")
+}
+
+// writeHistory parses limit/offset with defaults (20, 0) and writes the
+// user's entries.
+func (h *Handler) writeHistory(w http.ResponseWriter, r *http.Request, userID, email string) {
 	ctx := r.Context()
 	q := r.URL.Query()
 
@@ -41,17 +78,6 @@ func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Get user identity from JWT/context
-	userID, email, ok := auth.UserFromContext(ctx)
-	if !ok {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"error": "unauthorized",
-		})
-		return
-	}
-
 	// Fetch history entries for this user
 	entries, err := h.svc.List(ctx, userID, limit, offset)
 	if err != nil {
@@ -67,11 +93,16 @@ func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	resp := make([]historyResponseEntry, len(entries))
 	for i, e := range entries {
 		resp[i] = historyResponseEntry{
-			ID:         e.ID,
-			Expression: e.Expression,
-			Result:     e.Result,
-			CreatedAt:  e.CreatedAt.Format(time.RFC3339), // or another format if you prefer
-			Email:      email,
+			ID:          e.ID,
+			Expression:  e.Expression,
+			ExactResult: e.ExactResult,
+			Metadata:    e.Metadata,
+			CreatedAt:   e.CreatedAt.Format(time.RFC3339), // or another format if you prefer
+			Email:       email,
+		}
+		if e.ExactResult == "" {
+			result := numeric.Float(e.Result)
+			resp[i].Result = &result
 		}
 	}
 
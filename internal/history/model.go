@@ -1,14 +1,28 @@
 // internal/history/model.go
 package history
 
-import "time"
+import (
+	"time"
 
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// HistoryEntry is one stored calculation. Metadata carries optional,
+// calculation-specific details (for example the constants that were used).
+//
+// Exact results (big integers) are kept in ExactResult as text and leave
+// Result unset, so they never lose precision through float64. Such entries
+// do not become the calculator's running result, and neither do entries
+// whose Metadata names a "tool" (probability, geometry, ...): a dice roll
+// is recorded, but the next calculation does not build on it.
 type HistoryEntry struct {
-	ID         int64     `json:"id"`
-	UserID     string    `json:"userId"`
-	Expression string    `json:"expression"`
-	Result     float64   `json:"result"`
-	CreatedAt  time.Time `json:"createdAt"`
+	ID          int64          `json:"id"`
+	UserID      string         `json:"userId"`
+	Expression  string         `json:"expression"`
+	Result      float64        `json:"result"`
+	ExactResult string         `json:"exactResult,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
 }
 
 // Handler wires HTTP requests to the History service.
@@ -18,11 +32,15 @@ type Handler struct {
 
 // historyResponseEntry is the JSON shape returned by /api/v1/history.
 // It is derived from HistoryEntry but uses a string for CreatedAt and
-// includes the user's email (taken from the JWT/context).
+// includes the user's email (taken from the JWT/context; omitted when an
+// admin reads someone else's history).
+// Result is null for exact entries, which carry ExactResult instead.
 type historyResponseEntry struct {
-	ID         int64   `json:"id"`
-	Expression string  `json:"expression"`
-	Result     float64 `json:"result"`
-	CreatedAt  string  `json:"createdAt"`
-	Email      string  `json:"email"`
+	ID          int64          `json:"id"`
+	Expression  string         `json:"expression"`
+	Result      *numeric.Float `json:"result"`
+	ExactResult string         `json:"exactResult,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	CreatedAt   string         `json:"createdAt"`
+	Email       string         `json:"email,omitempty"`
 }
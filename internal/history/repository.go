@@ -4,7 +4,10 @@ package history
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
 )
 
 type Repository interface {
@@ -13,24 +16,66 @@ type Repository interface {
 	GetLatestResult(ctx context.Context, userID string) (float64, error)
 }
 
+// PostgresRepository stores history in calc_history. SpecialValues
+// decides whether +Inf/-Inf/NaN results may be stored at all.
 type PostgresRepository struct {
-	DB *sql.DB
+	DB            *sql.DB
+	SpecialValues numeric.SpecialValuePolicy
 }
 
-func NewPostgresRepository(db *sql.DB) *PostgresRepository {
-	return &PostgresRepository{DB: db}
+func NewPostgresRepository(db *sql.DB, specialValues numeric.SpecialValuePolicy) *PostgresRepository {
+	return &PostgresRepository{DB: db, SpecialValues: specialValues}
 }
 
 func (r *PostgresRepository) Create(ctx context.Context, e *HistoryEntry) error {
+	// Exact entries store only the text form; result stays NULL.
+	var result, exact any
+	if e.ExactResult != "" {
+		exact = e.ExactResult
+	} else {
+		if err := r.SpecialValues.Check(e.Result); err != nil {
+			return err
+		}
+		result = resultParam(e.Result)
+	}
+
+	metadata, err := metadataParam(e.Metadata)
+	if err != nil {
+		return err
+	}
+
 	row := r.DB.QueryRowContext(ctx,
-		`INSERT INTO calc_history (user_id, expression, result)
-         VALUES ($1, $2, $3)
+		`INSERT INTO calc_history (user_id, expression, result, exact_result, metadata)
+         VALUES ($1, $2, $3, $4, $5)
          RETURNING id, created_at`,
-		e.UserID, e.Expression, e.Result,
+		e.UserID, e.Expression, result, exact, metadata,
 	)
 	return row.Scan(&e.ID, &e.CreatedAt)
 }
 
+// metadataParam encodes metadata as JSON, or NULL when there is none.
+func metadataParam(m map[string]any) (any, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// resultParam converts non-finite values to the literals PostgreSQL
+// accepts for DOUBLE PRECISION ('Infinity', '-Infinity', 'NaN'); lib/pq
+// would otherwise send Go's "+Inf" spelling. Reading them back works as-is
+// because strconv.ParseFloat understands those literals.
+func resultParam(v float64) any {
+	if s, ok := numeric.SpecialString(v); ok {
+		return s
+	}
+	return v
+}
+
 func (r *PostgresRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]HistoryEntry, error) {
 	if limit <= 0 {
 		limit = 20
@@ -40,7 +85,7 @@ func (r *PostgresRepository) ListByUser(ctx context.Context, userID string, limi
 	}
 
 	rows, err := r.DB.QueryContext(ctx,
-		`SELECT id, user_id, expression, result, created_at
+		`SELECT id, user_id, expression, result, exact_result, metadata, created_at
          FROM calc_history
          WHERE user_id = $1
          ORDER BY created_at DESC
@@ -54,21 +99,36 @@ func (r *PostgresRepository) ListByUser(ctx context.Context, userID string, limi
 
 	var res []HistoryEntry
 	for rows.Next() {
-		var e HistoryEntry
-		if err := rows.Scan(&e.ID, &e.UserID, &e.Expression, &e.Result, &e.CreatedAt); err != nil {
+		var (
+			e        HistoryEntry
+			result   sql.NullFloat64
+			exact    sql.NullString
+			metadata []byte
+		)
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Expression, &result, &exact, &metadata, &e.CreatedAt); err != nil {
 			return nil, err
 		}
+		e.Result = result.Float64
+		e.ExactResult = exact.String
+		if metadata != nil {
+			if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+				return nil, err
+			}
+		}
 		res = append(res, e)
 	}
 	return res, rows.Err()
 }
 
-// GetLatestResult returns the last stored result for a user, or 0 if none exist.
+// GetLatestResult returns the last stored floating-point result for a user,
+// or 0 if none exist. Exact (big integer) entries and tool results are
+// skipped.
 func (r *PostgresRepository) GetLatestResult(ctx context.Context, userID string) (float64, error) {
 	row := r.DB.QueryRowContext(ctx, `
         SELECT result
         FROM calc_history
-        WHERE user_id = $1
+        WHERE user_id = $1 AND result IS NOT NULL
+          AND (metadata IS NULL OR NOT metadata ? 'tool')
         ORDER BY created_at DESC
         LIMIT 1
     `, userID)
@@ -0,0 +1,32 @@
+package history
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// Under the reject policy, non-finite results never reach the database
+// (DB is nil here, so any query would panic).
+func TestPostgresRepository_CreateRejectsSpecialValues(t *testing.T) {
+	repo := NewPostgresRepository(nil, numeric.SpecialValuesReject)
+
+	err := repo.Create(context.Background(), &HistoryEntry{UserID: "u", Result: math.Inf(1)})
+	assert.ErrorIs(t, err, numeric.ErrOverflow)
+
+	err = repo.Create(context.Background(), &HistoryEntry{UserID: "u", Result: math.NaN()})
+	assert.ErrorIs(t, err, numeric.ErrNotANumber)
+}
+
+// Under the string policy, non-finite results are sent using the
+// PostgreSQL literal spelling.
+func TestResultParam(t *testing.T) {
+	assert.Equal(t, 2.5, resultParam(2.5))
+	assert.Equal(t, "Infinity", resultParam(math.Inf(1)))
+	assert.Equal(t, "-Infinity", resultParam(math.Inf(-1)))
+	assert.Equal(t, "NaN", resultParam(math.NaN()))
+}
@@ -3,6 +3,7 @@ package httpserver
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -20,8 +21,11 @@ func Chain(h http.Handler, mws ...Middleware) http.Handler {
 	return h
 }
 
-// AuthMiddleware builds a middleware that enforces a valid JWT in the Authorization header.
-func AuthMiddleware(tokenService auth.TokenService) Middleware {
+// AuthMiddleware builds a middleware that enforces a valid JWT in the
+// Authorization header that every checker accepts (not revoked, session
+// still live). When apiKeys is non-nil, "ApiKey <key>" is accepted too;
+// key claims carry the key's scopes and skip the token checkers.
+func AuthMiddleware(tokenService auth.TokenService, apiKeys auth.APIKeyService, checkers ...auth.TokenChecker) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -31,30 +35,119 @@ func AuthMiddleware(tokenService auth.TokenService) Middleware {
 			}
 
 			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			if len(parts) != 2 {
 				writeUnauthorized(w, "invalid Authorization header format")
 				return
 			}
 
-			tokenStr := parts[1]
+			var claims *auth.TokenClaims
+			switch {
+			case strings.EqualFold(parts[0], "Bearer"):
+				var err error
+				claims, err = tokenService.ParseToken(parts[1])
+				if err != nil {
+					writeUnauthorized(w, "invalid or expired token")
+					return
+				}
 
-			claims, err := tokenService.ParseToken(tokenStr)
-			if err != nil {
-				writeUnauthorized(w, "invalid or expired token")
+				for _, c := range checkers {
+					if err := c.Check(r.Context(), claims); err != nil {
+						if errors.Is(err, auth.ErrTokenRevoked) || errors.Is(err, auth.ErrSessionRevoked) {
+							writeUnauthorized(w, err.Error())
+							return
+						}
+						writeError(w, http.StatusInternalServerError, "internal error")
+						return
+					}
+				}
+			case strings.EqualFold(parts[0], "ApiKey") && apiKeys != nil:
+				var err error
+				claims, err = apiKeys.Authenticate(r.Context(), parts[1])
+				if err != nil {
+					if errors.Is(err, auth.ErrInvalidAPIKey) {
+						writeUnauthorized(w, err.Error())
+						return
+					}
+					writeError(w, http.StatusInternalServerError, "internal error")
+					return
+				}
+			default:
+				writeUnauthorized(w, "invalid Authorization header format")
 				return
 			}
 
 			// Put user info into context so handlers can access it.
 			ctx := auth.ContextWithUser(r.Context(), claims.UserID, claims.Email)
+			ctx = auth.ContextWithClaims(ctx, claims)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RequireVerifiedEmail rejects requests whose token says the user has not
+// verified their address. It must run after AuthMiddleware.
+func RequireVerifiedEmail() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok || !claims.EmailVerified {
+				writeError(w, http.StatusForbidden, "email not verified")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission rejects requests whose token does not grant every
+// listed permission. It must run after AuthMiddleware.
+func RequirePermission(perms ...auth.Permission) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "unauthorized")
+				return
+			}
+			for _, p := range perms {
+				if !claims.Permits(p) {
+					writeError(w, http.StatusForbidden, "missing permission "+string(p))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireLoginToken rejects access tokens issued to OAuth clients, which
+// may only reach the endpoints their scopes cover. It must run after
+// AuthMiddleware.
+func RequireLoginToken() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.ClaimsFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "unauthorized")
+				return
+			}
+			if claims.ClientID != "" {
+				writeError(w, http.StatusForbidden, "not available to OAuth clients")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func writeUnauthorized(w http.ResponseWriter, msg string) {
+	writeError(w, http.StatusUnauthorized, msg)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(status)
 
 	_ = json.NewEncoder(w).Encode(map[string]string{
 		"error": msg,
@@ -6,29 +6,200 @@ import (
 
 	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
 	"github.com/whiterabbit0809/overengineered-calculator/internal/calculator"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/geometry"
 	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numbertheory"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/preferences"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/probability"
 )
 
 func NewRouter(
 	authHandler *auth.Handler,
 	tokenService auth.TokenService,
+	revocations auth.RevocationService,
+	sessions auth.SessionService,
+	apiKeys auth.APIKeyService,
+	oauth auth.OAuthService,
 	calcHandler *calculator.Handler,
 	historyHandler *history.Handler,
+	prefsHandler *preferences.Handler,
+	probHandler *probability.Handler,
+	bigintHandler *numbertheory.Handler,
+	geometryHandler *geometry.Handler,
+	requireVerifiedForCalc bool,
 ) http.Handler {
 	mux := http.NewServeMux()
+	authenticate := AuthMiddleware(tokenService, nil, revocations, sessions, oauth)
+	// requireAuth takes the user's own login tokens only; account and
+	// admin endpoints stay out of reach of API keys and OAuth clients.
+	requireAuth := func(next http.Handler) http.Handler {
+		return authenticate(RequireLoginToken()(next))
+	}
+	// requireAuthOrKey also accepts API keys and OAuth access tokens,
+	// limited to their scopes.
+	requireAuthOrKey := AuthMiddleware(tokenService, apiKeys, revocations, sessions, oauth)
+
+	// compute guards the endpoints that calculate and record history,
+	// which auditors may not use.
+	compute := []Middleware{requireAuthOrKey, RequirePermission(auth.PermCalcWrite)}
+
+	// calcAuth guards /api/v1/calc, which deployments may reserve for
+	// verified addresses.
+	calcAuth := compute
+	if requireVerifiedForCalc {
+		calcAuth = append(append([]Middleware{}, compute...), RequireVerifiedEmail())
+	}
 
 	// Auth
+	mux.HandleFunc("/.well-known/jwks.json", authHandler.JWKS)
+	// OAuth 2.0 authorization server (RFC 6749, 7009, 7662)
+	mux.HandleFunc("/oauth/authorize", authHandler.OAuthAuthorize)
+	mux.HandleFunc("/oauth/token", authHandler.OAuthToken)
+	mux.HandleFunc("/oauth/introspect", authHandler.OAuthIntrospect)
+	mux.HandleFunc("/oauth/revoke", authHandler.OAuthRevoke)
 	mux.HandleFunc("/api/v1/auth/signup", authHandler.SignUp)
 	mux.HandleFunc("/api/v1/auth/login", authHandler.Login)
+	mux.HandleFunc("/api/v1/auth/login/mfa", authHandler.LoginMFA)
+	mux.HandleFunc("/api/v1/auth/oidc", authHandler.OIDCProviders)
+	mux.HandleFunc("/api/v1/auth/oidc/{provider}/start", authHandler.OIDCStart)
+	mux.HandleFunc("/api/v1/auth/oidc/{provider}/callback", authHandler.OIDCCallback)
+	mux.HandleFunc("/api/v1/auth/refresh", authHandler.Refresh)
+	mux.Handle("/api/v1/auth/logout",
+		Chain(http.HandlerFunc(authHandler.Logout), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/password",
+		Chain(http.HandlerFunc(authHandler.ChangePassword), requireAuth),
+	)
+	mux.HandleFunc("/api/v1/auth/password/forgot", authHandler.ForgotPassword)
+	mux.HandleFunc("/api/v1/auth/password/reset", authHandler.ResetPassword)
+	mux.HandleFunc("/api/v1/auth/verify-email", authHandler.VerifyEmail)
+	mux.HandleFunc("/api/v1/auth/verify-email/resend", authHandler.ResendVerification)
+	mux.Handle("/api/v1/auth/email",
+		Chain(http.HandlerFunc(authHandler.ChangeEmail), requireAuth),
+	)
+	mux.HandleFunc("/api/v1/auth/email/confirm", authHandler.ConfirmEmailChange)
+	mux.Handle("/api/v1/auth/account/delete",
+		Chain(http.HandlerFunc(authHandler.DeleteAccount), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/sessions",
+		Chain(http.HandlerFunc(authHandler.Sessions), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/sessions/{id}",
+		Chain(http.HandlerFunc(authHandler.RevokeSession), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/api-keys",
+		Chain(http.HandlerFunc(authHandler.APIKeys), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/api-keys/{id}",
+		Chain(http.HandlerFunc(authHandler.RevokeAPIKey), requireAuth),
+	)
+	mux.Handle("/api/v1/oauth/clients",
+		Chain(http.HandlerFunc(authHandler.OAuthClients), requireAuth),
+	)
+	mux.Handle("/api/v1/oauth/clients/{id}",
+		Chain(http.HandlerFunc(authHandler.DeleteOAuthClient), requireAuth),
+	)
+	mux.Handle("/api/v1/oauth/authorize",
+		Chain(http.HandlerFunc(authHandler.OAuthConsent), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/mfa/enroll",
+		Chain(http.HandlerFunc(authHandler.EnrollMFA), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/mfa/confirm",
+		Chain(http.HandlerFunc(authHandler.ConfirmMFA), requireAuth),
+	)
+	mux.Handle("/api/v1/auth/mfa/disable",
+		Chain(http.HandlerFunc(authHandler.DisableMFA), requireAuth),
+	)
+
+	// Admin (protected, by permission)
+	mux.Handle("/api/v1/admin/users",
+		Chain(http.HandlerFunc(authHandler.AdminListUsers), requireAuth, RequirePermission(auth.PermUsersRead)),
+	)
+	mux.Handle("/api/v1/admin/users/{id}/disable",
+		Chain(http.HandlerFunc(authHandler.AdminDisableUser), requireAuth, RequirePermission(auth.PermUsersWrite)),
+	)
+	mux.Handle("/api/v1/admin/users/{id}/enable",
+		Chain(http.HandlerFunc(authHandler.AdminEnableUser), requireAuth, RequirePermission(auth.PermUsersWrite)),
+	)
+	mux.Handle("/api/v1/admin/users/{id}/role",
+		Chain(http.HandlerFunc(authHandler.AdminSetRole), requireAuth, RequirePermission(auth.PermUsersWrite)),
+	)
+	mux.Handle("/api/v1/admin/users/{id}/unlock",
+		Chain(http.HandlerFunc(authHandler.AdminUnlockUser), requireAuth, RequirePermission(auth.PermUsersWrite)),
+	)
+	mux.Handle("/api/v1/admin/users/{id}/history",
+		Chain(http.HandlerFunc(historyHandler.GetUserHistory), requireAuth, RequirePermission(auth.PermHistoryReadAny)),
+	)
 
 	// Calculator (protected)
 	mux.Handle("/api/v1/calc",
-		Chain(http.HandlerFunc(calcHandler.Calculate), AuthMiddleware(tokenService)),
+		Chain(http.HandlerFunc(calcHandler.Calculate), calcAuth...),
+	)
+	mux.Handle("/api/v1/calc/expression",
+		Chain(http.HandlerFunc(calcHandler.Evaluate), calcAuth...),
+	)
+	// Polynomials (protected), one endpoint per operation
+	for _, op := range calculator.PolynomialOperations {
+		mux.Handle("/api/v1/polynomial/"+string(op),
+			Chain(calcHandler.Polynomial(op), compute...),
+		)
+	}
+	// Probability (protected)
+	mux.Handle("/api/v1/probability/random",
+		Chain(http.HandlerFunc(probHandler.Random), compute...),
+	)
+	mux.Handle("/api/v1/probability/dice",
+		Chain(http.HandlerFunc(probHandler.Dice), compute...),
+	)
+	mux.Handle("/api/v1/probability/combinatorics",
+		Chain(http.HandlerFunc(probHandler.Combinatorics), compute...),
+	)
+	mux.Handle("/api/v1/probability/distribution",
+		Chain(http.HandlerFunc(probHandler.Distribution), compute...),
 	)
+	// Big-integer number theory (protected)
+	mux.Handle("/api/v1/bigint",
+		Chain(http.HandlerFunc(bigintHandler.Compute), compute...),
+	)
+	// Geometry (protected)
+	mux.Handle("/api/v1/geometry/triangle",
+		Chain(http.HandlerFunc(geometryHandler.Triangle), compute...),
+	)
+	mux.Handle("/api/v1/geometry/shape",
+		Chain(http.HandlerFunc(geometryHandler.Shape), compute...),
+	)
+	mux.Handle("/api/v1/geometry/coordinates",
+		Chain(http.HandlerFunc(geometryHandler.Coordinates), compute...),
+	)
+	// Constants (public reference data)
+	mux.HandleFunc("/api/v1/constants", calcHandler.Constants)
 	// History (protected)
 	mux.Handle("/api/v1/history",
-		Chain(http.HandlerFunc(historyHandler.GetHistory), AuthMiddleware(tokenService)),
+		Chain(http.HandlerFunc(historyHandler.GetHistory), requireAuthOrKey, RequirePermission(auth.PermHistoryRead)),
+	)
+	// Preferences (protected; changing them needs a permission)
+	mux.Handle("GET /api/v1/preferences",
+		Chain(http.HandlerFunc(prefsHandler.Preferences), requireAuth),
 	)
+	mux.Handle("PUT /api/v1/preferences",
+		Chain(http.HandlerFunc(prefsHandler.Preferences), requireAuth, RequirePermission(auth.PermSettingsWrite)),
+	)
+	mux.Handle("GET /api/v1/profile",
+		Chain(http.HandlerFunc(prefsHandler.Profile), requireAuth),
+	)
+	mux.Handle("PUT /api/v1/profile",
+		Chain(http.HandlerFunc(prefsHandler.Profile), requireAuth, RequirePermission(auth.PermSettingsWrite)),
+	)
+
+	// Links mailed to users open the frontend, which reads ?token= and
+	// finishes the flow through the API.
+	frontend := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "web/index.html")
+	}
+	mux.HandleFunc("GET /reset-password", frontend)
+	mux.HandleFunc("GET /verify-email", frontend)
+	mux.HandleFunc("GET /confirm-email", frontend)
 
 	// Static frontend
 	fs := http.FileServer(http.Dir("web"))
@@ -0,0 +1,61 @@
+// internal/jsonapi/serve.go
+package jsonapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+)
+
+// Serve decodes a POST body into Req, calls fn for the authenticated user
+// and writes the JSON result. ErrNotFinite and errors matching one of
+// badRequest are the caller's fault and are returned with 400; anything
+// else is a 500.
+func Serve[Req, Res any](w http.ResponseWriter, r *http.Request, fn func(context.Context, string, Req) (Res, error), badRequest ...error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req Req
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	res, err := fn(r.Context(), userID, req)
+	if err != nil {
+		status, msg := http.StatusInternalServerError, "internal error"
+		if isBadRequest(err, badRequest) {
+			status, msg = http.StatusBadRequest, err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func isBadRequest(err error, badRequest []error) bool {
+	if errors.Is(err, ErrNotFinite) {
+		return true
+	}
+	for _, target := range badRequest {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
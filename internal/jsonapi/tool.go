@@ -0,0 +1,35 @@
+// internal/jsonapi/tool.go
+package jsonapi
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+)
+
+// ErrNotFinite is returned for a tool result that overflowed float64 or is
+// undefined, which history cannot store. Serve answers it with 400.
+var ErrNotFinite = errors.New("the result is not a finite number; use smaller values")
+
+// CheckFinite returns ErrNotFinite if any of vs is infinite or NaN.
+func CheckFinite(vs ...float64) error {
+	for _, v := range vs {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return ErrNotFinite
+		}
+	}
+	return nil
+}
+
+// Record stores a tool result in the user's history. The metadata names
+// the "tool", which keeps the entry out of the running result.
+func Record(ctx context.Context, historySvc history.Service, userID, expr string, result float64, metadata map[string]any) error {
+	return historySvc.Record(ctx, &history.HistoryEntry{
+		UserID:     userID,
+		Expression: expr,
+		Result:     result,
+		Metadata:   metadata,
+	})
+}
@@ -0,0 +1,35 @@
+// internal/mail/log.go
+package mail
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type logMailer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	from string
+}
+
+// NewLogMailer writes each message, headers included, to out instead of
+// sending it. Use it for local development (stdout or a file) and tests.
+func NewLogMailer(out io.Writer, from string) Mailer {
+	return &logMailer{out: out, from: from}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.out.Write(format(m.from, msg, time.Now())); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.out, "\r\n")
+	return err
+}
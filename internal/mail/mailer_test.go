@@ -0,0 +1,56 @@
+// internal/mail/mailer_test.go
+package mail
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogMailer_WritesMessage(t *testing.T) {
+	var out bytes.Buffer
+	m := NewLogMailer(&out, "calc@example.com")
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Hello",
+		Body:    "line one\nline two",
+	})
+	require.NoError(t, err)
+
+	s := out.String()
+	assert.Contains(t, s, "From: calc@example.com\r\n")
+	assert.Contains(t, s, "To: user@example.com\r\n")
+	assert.Contains(t, s, "Subject: Hello\r\n")
+	assert.Contains(t, s, "\r\n\r\nline one\r\nline two\r\n")
+}
+
+func TestLogMailer_RejectsHeaderInjection(t *testing.T) {
+	m := NewLogMailer(&bytes.Buffer{}, "calc@example.com")
+
+	err := m.Send(context.Background(), Message{To: "user@example.com\r\nBcc: x@example.com", Subject: "Hi"})
+	assert.Error(t, err)
+
+	err = m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi\nBcc: x@example.com"})
+	assert.Error(t, err)
+}
+
+func TestQueue_DeliversInBackground(t *testing.T) {
+	var out bytes.Buffer
+	q := NewQueue(NewLogMailer(&out, "calc@example.com"), 1).(*queueMailer)
+
+	assert.Error(t, q.Send(context.Background(), Message{To: "user@example.com\r\nBcc: x@example.com"}))
+	require.NoError(t, q.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello"}))
+	q.close()
+	assert.Contains(t, out.String(), "To: user@example.com\r\n")
+}
+
+func TestQueue_HidesDeliveryErrors(t *testing.T) {
+	q := NewQueue(NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: 1, From: "calc@example.com"}), 1).(*queueMailer)
+
+	assert.NoError(t, q.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello"}))
+	q.close()
+}
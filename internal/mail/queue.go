@@ -0,0 +1,56 @@
+// internal/mail/queue.go
+package mail
+
+import (
+	"context"
+	"log"
+)
+
+type queueMailer struct {
+	next Mailer
+	msgs chan Message
+	done chan struct{}
+}
+
+// NewQueue returns a Mailer whose Send only validates the message and
+// hands it to a background worker that delivers it through next. Callers
+// do not wait for the mail server, so neither response time nor status
+// tells whether a message went out; delivery errors, and messages dropped
+// because size are already waiting, are logged instead.
+func NewQueue(next Mailer, size int) Mailer {
+	q := &queueMailer{
+		next: next,
+		msgs: make(chan Message, size),
+		done: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *queueMailer) Send(ctx context.Context, msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+	select {
+	case q.msgs <- msg:
+	default:
+		log.Printf("mail: queue full, dropped %q to %s", msg.Subject, msg.To)
+	}
+	return nil
+}
+
+func (q *queueMailer) run() {
+	defer close(q.done)
+	for msg := range q.msgs {
+		// The request that queued the message may be long gone.
+		if err := q.next.Send(context.Background(), msg); err != nil {
+			log.Printf("mail: send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}
+}
+
+// close stops accepting messages and waits for the queued ones.
+func (q *queueMailer) close() {
+	close(q.msgs)
+	<-q.done
+}
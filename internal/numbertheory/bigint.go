@@ -0,0 +1,89 @@
+// internal/numbertheory/bigint.go
+package numbertheory
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// maxOperandBits bounds the size of any operand or intermediate result.
+const maxOperandBits = 16384
+
+// parseInt reads a decimal or 0x-prefixed hexadecimal integer. Unlike
+// big.Int.SetString with base 0, a leading zero does not switch to octal.
+func parseInt(s string) (*big.Int, error) {
+	t := strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(t, "-") || strings.HasPrefix(t, "+") {
+		neg = t[0] == '-'
+		t = t[1:]
+	}
+
+	base := 10
+	if strings.HasPrefix(t, "0x") || strings.HasPrefix(t, "0X") {
+		base = 16
+		t = t[2:]
+	}
+
+	v, ok := new(big.Int).SetString(t, base)
+	if !ok || t == "" || strings.ContainsAny(t, "+-_") {
+		return nil, fmt.Errorf("%w: %q is not a decimal or hex integer", ErrInvalidArgument, s)
+	}
+	if v.BitLen() > maxOperandBits {
+		return nil, fmt.Errorf("%w: operands are limited to %d bits", ErrTooLarge, maxOperandBits)
+	}
+	if neg {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+// formatInt writes v in the requested output base.
+func formatInt(v *big.Int, out Output) string {
+	if out != OutputHex {
+		return v.String()
+	}
+	if v.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(v).Text(16)
+	}
+	return "0x" + v.Text(16)
+}
+
+// smallInt returns v as an int64 within [0, max].
+func smallInt(v *big.Int, name string, max int64) (int64, error) {
+	if v.Sign() < 0 || !v.IsInt64() || v.Int64() > max {
+		return 0, fmt.Errorf("%w: %s must be between 0 and %d", ErrInvalidArgument, name, max)
+	}
+	return v.Int64(), nil
+}
+
+// Fibonacci returns F(n) exactly (F(0) = 0, F(1) = 1) using fast doubling.
+func Fibonacci(n int64) *big.Int {
+	f, _ := fibPair(n)
+	return f
+}
+
+// Lucas returns L(n) exactly (L(0) = 2, L(1) = 1), using L(n) = 2F(n+1) - F(n).
+func Lucas(n int64) *big.Int {
+	f, f1 := fibPair(n)
+	l := new(big.Int).Lsh(f1, 1)
+	return l.Sub(l, f)
+}
+
+// fibPair returns F(n) and F(n+1).
+func fibPair(n int64) (*big.Int, *big.Int) {
+	a, b := big.NewInt(0), big.NewInt(1)
+	for bit := 62; bit >= 0; bit-- {
+		// F(2k) = F(k) * (2F(k+1) - F(k)), F(2k+1) = F(k)² + F(k+1)²
+		t := new(big.Int).Lsh(b, 1)
+		t.Sub(t, a).Mul(t, a)
+		u := new(big.Int).Mul(a, a)
+		u.Add(u, new(big.Int).Mul(b, b))
+		a, b = t, u
+		if n>>uint(bit)&1 == 1 {
+			a, b = b, a.Add(a, b)
+		}
+	}
+	return a, b
+}
@@ -0,0 +1,148 @@
+// internal/numbertheory/factor.go
+package numbertheory
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+const (
+	// maxFactorBits is the "modest size" limit for FACTORIZE.
+	maxFactorBits = 128
+	// trialDivisionLimit is the largest prime tried by trial division.
+	trialDivisionLimit = 10000
+	// rhoIterations bounds the work of a single Pollard rho attempt.
+	rhoIterations = 2_000_000
+	// millerRabinRounds is passed to big.Int.ProbablyPrime, which runs that
+	// many Miller–Rabin rounds followed by a Baillie-PSW test.
+	millerRabinRounds = 20
+)
+
+var (
+	bigOne = big.NewInt(1)
+	bigTwo = big.NewInt(2)
+)
+
+func isPrime(n *big.Int) bool {
+	return n.ProbablyPrime(millerRabinRounds)
+}
+
+// factorize returns the prime factors of n (n >= 2) in ascending order,
+// with repetition.
+func factorize(n *big.Int) ([]*big.Int, error) {
+	if n.BitLen() > maxFactorBits {
+		return nil, fmt.Errorf("%w: factorisation is limited to %d-bit numbers", ErrTooLarge, maxFactorBits)
+	}
+
+	var factors []*big.Int
+	rest := new(big.Int).Set(n)
+
+	// Small primes first: cheap and removes most of the work.
+	p := new(big.Int)
+	mod := new(big.Int)
+	for d := int64(2); d <= trialDivisionLimit; d++ {
+		p.SetInt64(d)
+		if new(big.Int).Mul(p, p).Cmp(rest) > 0 {
+			break
+		}
+		for mod.Mod(rest, p).Sign() == 0 {
+			factors = append(factors, new(big.Int).Set(p))
+			rest.Quo(rest, p)
+		}
+	}
+
+	if rest.Cmp(bigOne) > 0 {
+		large, err := splitLarge(rest)
+		if err != nil {
+			return nil, err
+		}
+		factors = append(factors, large...)
+	}
+
+	sort.Slice(factors, func(i, j int) bool { return factors[i].Cmp(factors[j]) < 0 })
+	return factors, nil
+}
+
+// splitLarge recursively splits n with Pollard's rho until all parts are prime.
+func splitLarge(n *big.Int) ([]*big.Int, error) {
+	if n.Cmp(bigOne) == 0 {
+		return nil, nil
+	}
+	if isPrime(n) {
+		return []*big.Int{new(big.Int).Set(n)}, nil
+	}
+
+	d := pollardRho(n)
+	if d == nil {
+		return nil, fmt.Errorf("%w: could not factor %s within the iteration limit", ErrTooLarge, n)
+	}
+
+	left, err := splitLarge(d)
+	if err != nil {
+		return nil, err
+	}
+	right, err := splitLarge(new(big.Int).Quo(n, d))
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+// pollardRho finds a non-trivial divisor of the composite n using Brent's
+// variant, trying a few polynomial constants. It returns nil on failure.
+func pollardRho(n *big.Int) *big.Int {
+	if new(big.Int).Mod(n, bigTwo).Sign() == 0 {
+		return big.NewInt(2)
+	}
+
+	budget := rhoIterations
+	for c := int64(1); c <= 20 && budget > 0; c++ {
+		cc := big.NewInt(c)
+		f := func(x *big.Int) *big.Int {
+			x.Mul(x, x).Add(x, cc).Mod(x, n)
+			return x
+		}
+
+		y := big.NewInt(2)
+		x := new(big.Int)
+		ys := new(big.Int)
+		q := big.NewInt(1)
+		g := big.NewInt(1)
+		diff := new(big.Int)
+		const m = 128
+
+		for r := 1; g.Cmp(bigOne) == 0 && budget > 0; r *= 2 {
+			x.Set(y)
+			for i := 0; i < r; i++ {
+				f(y)
+			}
+			for k := 0; k < r && g.Cmp(bigOne) == 0; k += m {
+				ys.Set(y)
+				for i := 0; i < m && i < r-k; i++ {
+					f(y)
+					diff.Sub(x, y).Abs(diff)
+					q.Mul(q, diff).Mod(q, n)
+					budget--
+				}
+				g.GCD(nil, nil, q, n)
+			}
+		}
+
+		if g.Cmp(n) == 0 {
+			// Overshot: step back one at a time from the saved point.
+			for {
+				f(ys)
+				diff.Sub(x, ys).Abs(diff)
+				g.GCD(nil, nil, diff, n)
+				if g.Cmp(bigOne) > 0 {
+					break
+				}
+			}
+		}
+		if g.Cmp(bigOne) > 0 && g.Cmp(n) < 0 {
+			return g
+		}
+	}
+	return nil
+}
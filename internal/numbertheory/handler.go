@@ -0,0 +1,51 @@
+// internal/numbertheory/handler.go
+package numbertheory
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+)
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// Compute handles POST /api/v1/bigint.
+func (h *Handler) Compute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.Compute(r.Context(), userID, req)
+	if err != nil {
+		status, msg := http.StatusInternalServerError, "internal error"
+		switch {
+		case errors.Is(err, ErrInvalidOperation), errors.Is(err, ErrInvalidArgument),
+			errors.Is(err, ErrDivisionByZero), errors.Is(err, ErrNotInvertible), errors.Is(err, ErrTooLarge):
+			status, msg = http.StatusBadRequest, err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
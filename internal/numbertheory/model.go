@@ -0,0 +1,53 @@
+// internal/numbertheory/model.go
+package numbertheory
+
+type Operation string
+
+const (
+	OpAdd       Operation = "ADD"
+	OpSubtract  Operation = "SUBTRACT"
+	OpMultiply  Operation = "MULTIPLY"
+	OpDivide    Operation = "DIVIDE" // truncated quotient, see Remainder in the result; history keeps "q r m"
+	OpMod       Operation = "MOD"    // Euclidean modulus, always >= 0
+	OpModPow    Operation = "MODPOW" // args: base, exponent, modulus
+	OpModInv    Operation = "MODINV" // args: value, modulus
+	OpGCD       Operation = "GCD"
+	OpLCM       Operation = "LCM"
+	OpIsPrime   Operation = "IS_PRIME"
+	OpFactorize Operation = "FACTORIZE"
+	OpFactorial Operation = "FACTORIAL"
+	OpBinomial  Operation = "BINOMIAL" // args: n, k
+	OpFibonacci Operation = "FIBONACCI"
+	OpLucas     Operation = "LUCAS"
+)
+
+// Output selects how integers are written in the response.
+type Output string
+
+const (
+	OutputDecimal Output = "decimal"
+	OutputHex     Output = "hex"
+)
+
+// Request carries operands as strings, decimal ("12345", "-7") or
+// hexadecimal ("0xff", "-0x1F"), so they never pass through float64.
+type Request struct {
+	Operation Operation `json:"operation"`
+	Args      []string  `json:"args"`
+	Output    Output    `json:"output,omitempty"`
+}
+
+// Result holds the exact value as a string in the requested Output.
+// Factors and IsPrime are only set by FACTORIZE and IS_PRIME.
+type Result struct {
+	Expression string   `json:"expression"`
+	Result     string   `json:"result"`
+	Remainder  string   `json:"remainder,omitempty"`
+	IsPrime    *bool    `json:"isPrime,omitempty"`
+	Factors    []string `json:"factors,omitempty"`
+}
+
+// Handler wires HTTP requests to the number theory Service.
+type Handler struct {
+	svc Service
+}
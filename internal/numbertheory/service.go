@@ -0,0 +1,235 @@
+// internal/numbertheory/service.go
+package numbertheory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+)
+
+var (
+	ErrInvalidOperation = errors.New("invalid operation")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrDivisionByZero   = errors.New("division by zero")
+	ErrNotInvertible    = errors.New("value is not invertible modulo m")
+	ErrTooLarge         = errors.New("operand too large")
+)
+
+// maxFactorialN is the largest n whose factorial fits in maxOperandBits
+// (1754! has 16382 bits).
+const maxFactorialN = 1754
+
+// maxBinomialN keeps BINOMIAL results within maxOperandBits, since
+// C(n, k) < 2^n.
+const maxBinomialN = maxOperandBits
+
+// maxFibonacciN keeps FIBONACCI and LUCAS results below maxOperandBits
+// (F(n) has about 0.694n bits).
+const maxFibonacciN = 23000
+
+type Service interface {
+	Compute(ctx context.Context, userID string, req Request) (Result, error)
+}
+
+type service struct {
+	historySvc history.Service
+}
+
+func NewService(historySvc history.Service) Service {
+	return &service{historySvc: historySvc}
+}
+
+// arity is the number of arguments each operation expects.
+var arity = map[Operation]int{
+	OpAdd:       2,
+	OpSubtract:  2,
+	OpMultiply:  2,
+	OpDivide:    2,
+	OpMod:       2,
+	OpModPow:    3,
+	OpModInv:    2,
+	OpGCD:       2,
+	OpLCM:       2,
+	OpIsPrime:   1,
+	OpFactorize: 1,
+	OpFactorial: 1,
+	OpBinomial:  2,
+	OpFibonacci: 1,
+	OpLucas:     1,
+}
+
+func (s *service) Compute(ctx context.Context, userID string, req Request) (Result, error) {
+	want, ok := arity[req.Operation]
+	if !ok {
+		return Result{}, ErrInvalidOperation
+	}
+	if len(req.Args) != want {
+		return Result{}, fmt.Errorf("%w: %s takes %d arguments", ErrInvalidArgument, req.Operation, want)
+	}
+	switch req.Output {
+	case "", OutputDecimal, OutputHex:
+	default:
+		return Result{}, fmt.Errorf("%w: output must be %q or %q", ErrInvalidArgument, OutputDecimal, OutputHex)
+	}
+
+	args := make([]*big.Int, len(req.Args))
+	for i, a := range req.Args {
+		v, err := parseInt(a)
+		if err != nil {
+			return Result{}, err
+		}
+		args[i] = v
+	}
+
+	res, err := compute(req.Operation, args, req.Output)
+	if err != nil {
+		return Result{}, err
+	}
+
+	exact := res.Result
+	if res.Remainder != "" && res.Remainder != formatInt(new(big.Int), req.Output) {
+		// The quotient alone would misstate an inexact division: 7 / 2 is
+		// stored as "3 r 1".
+		exact += " r " + res.Remainder
+	}
+	entry := &history.HistoryEntry{
+		UserID:      userID,
+		Expression:  res.Expression,
+		ExactResult: exact,
+		Metadata:    map[string]any{"tool": "bigint"},
+	}
+	if res.Factors != nil {
+		entry.Metadata["factors"] = res.Factors
+	}
+	if err := s.historySvc.Record(ctx, entry); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// compute runs a single operation on already parsed operands.
+func compute(op Operation, args []*big.Int, out Output) (Result, error) {
+	f := func(v *big.Int) string { return formatInt(v, out) }
+	z := new(big.Int)
+
+	var (
+		res Result
+		err error
+	)
+	switch op {
+	case OpAdd:
+		z.Add(args[0], args[1])
+		res.Expression = fmt.Sprintf("%s + %s", f(args[0]), f(args[1]))
+	case OpSubtract:
+		z.Sub(args[0], args[1])
+		res.Expression = fmt.Sprintf("%s - %s", f(args[0]), f(args[1]))
+	case OpMultiply:
+		if args[0].BitLen()+args[1].BitLen() > maxOperandBits {
+			return Result{}, fmt.Errorf("%w: product would exceed %d bits", ErrTooLarge, maxOperandBits)
+		}
+		z.Mul(args[0], args[1])
+		res.Expression = fmt.Sprintf("%s * %s", f(args[0]), f(args[1]))
+	case OpDivide:
+		if args[1].Sign() == 0 {
+			return Result{}, ErrDivisionByZero
+		}
+		rem := new(big.Int)
+		z.QuoRem(args[0], args[1], rem)
+		res.Remainder = f(rem)
+		res.Expression = fmt.Sprintf("%s / %s", f(args[0]), f(args[1]))
+	case OpMod:
+		if args[1].Sign() == 0 {
+			return Result{}, ErrDivisionByZero
+		}
+		z.Mod(args[0], args[1])
+		res.Expression = fmt.Sprintf("%s mod %s", f(args[0]), f(args[1]))
+	case OpModPow:
+		if args[2].Sign() <= 0 {
+			return Result{}, fmt.Errorf("%w: modulus must be positive", ErrInvalidArgument)
+		}
+		// A negative exponent uses the modular inverse of the base.
+		if z.Exp(args[0], args[1], args[2]) == nil {
+			return Result{}, ErrNotInvertible
+		}
+		res.Expression = fmt.Sprintf("%s ^ %s mod %s", f(args[0]), f(args[1]), f(args[2]))
+	case OpModInv:
+		if args[1].Sign() <= 0 {
+			return Result{}, fmt.Errorf("%w: modulus must be positive", ErrInvalidArgument)
+		}
+		if args[1].Cmp(bigOne) == 0 || z.ModInverse(args[0], args[1]) == nil {
+			return Result{}, ErrNotInvertible
+		}
+		res.Expression = fmt.Sprintf("%s ^ -1 mod %s", f(args[0]), f(args[1]))
+	case OpGCD:
+		a, b := new(big.Int).Abs(args[0]), new(big.Int).Abs(args[1])
+		z.GCD(nil, nil, a, b)
+		res.Expression = fmt.Sprintf("gcd(%s, %s)", f(args[0]), f(args[1]))
+	case OpLCM:
+		res.Expression = fmt.Sprintf("lcm(%s, %s)", f(args[0]), f(args[1]))
+		if args[0].Sign() != 0 && args[1].Sign() != 0 {
+			a, b := new(big.Int).Abs(args[0]), new(big.Int).Abs(args[1])
+			g := new(big.Int).GCD(nil, nil, a, b)
+			z.Quo(a, g).Mul(z, b)
+		}
+	case OpIsPrime:
+		prime := args[0].Sign() > 0 && isPrime(args[0])
+		res.IsPrime = &prime
+		res.Expression = fmt.Sprintf("isPrime(%s)", f(args[0]))
+		res.Result = fmt.Sprint(prime)
+		return res, nil
+	case OpFactorize:
+		if args[0].Cmp(bigTwo) < 0 {
+			return Result{}, fmt.Errorf("%w: only integers >= 2 can be factorised", ErrInvalidArgument)
+		}
+		var factors []*big.Int
+		if factors, err = factorize(args[0]); err != nil {
+			return Result{}, err
+		}
+		parts := make([]string, len(factors))
+		for i, p := range factors {
+			parts[i] = f(p)
+		}
+		res.Factors = parts
+		res.Expression = fmt.Sprintf("factor(%s)", f(args[0]))
+		res.Result = strings.Join(parts, " * ")
+		return res, nil
+	case OpFactorial:
+		var n int64
+		if n, err = smallInt(args[0], "n", maxFactorialN); err != nil {
+			return Result{}, err
+		}
+		z.MulRange(1, n)
+		res.Expression = fmt.Sprintf("%d!", n)
+	case OpBinomial:
+		var n, k int64
+		if n, err = smallInt(args[0], "n", maxBinomialN); err != nil {
+			return Result{}, err
+		}
+		if k, err = smallInt(args[1], "k", n); err != nil {
+			return Result{}, err
+		}
+		z.Binomial(n, k)
+		res.Expression = fmt.Sprintf("C(%d, %d)", n, k)
+	case OpFibonacci, OpLucas:
+		var n int64
+		if n, err = smallInt(args[0], "n", maxFibonacciN); err != nil {
+			return Result{}, err
+		}
+		if op == OpFibonacci {
+			z = Fibonacci(n)
+			res.Expression = fmt.Sprintf("fib(%d)", n)
+		} else {
+			z = Lucas(n)
+			res.Expression = fmt.Sprintf("lucas(%d)", n)
+		}
+	default:
+		return Result{}, ErrInvalidOperation
+	}
+
+	res.Result = f(z)
+	return res, nil
+}
@@ -0,0 +1,172 @@
+package numbertheory
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+)
+
+//
+// Test fakes
+//
+
+// fakeHistoryService records entries so tests can inspect them.
+type fakeHistoryService struct {
+	recordedEntries []*history.HistoryEntry
+}
+
+func (f *fakeHistoryService) GetLatestResult(ctx context.Context, userID string) (float64, error) {
+	return 0, nil
+}
+
+func (f *fakeHistoryService) Record(ctx context.Context, entry *history.HistoryEntry) error {
+	f.recordedEntries = append(f.recordedEntries, entry)
+	return nil
+}
+
+func (f *fakeHistoryService) List(ctx context.Context, userID string, limit, offset int) ([]history.HistoryEntry, error) {
+	return nil, nil
+}
+
+func mustCompute(t *testing.T, op Operation, args ...string) Result {
+	t.Helper()
+	res, err := NewService(&fakeHistoryService{}).Compute(context.Background(), "user-123", Request{Operation: op, Args: args})
+	require.NoError(t, err, op)
+	return res
+}
+
+//
+// Tests
+//
+
+// Results are exact and stored as text, never as float64.
+func TestCompute_ExactResultInHistory(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := NewService(fh)
+
+	res, err := svc.Compute(context.Background(), "user-123", Request{
+		Operation: OpMultiply,
+		Args:      []string{"9007199254740993", "9007199254740993"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "81129638414606699710187514626049", res.Result)
+
+	require.Len(t, fh.recordedEntries, 1)
+	assert.Equal(t, res.Result, fh.recordedEntries[0].ExactResult)
+	assert.Zero(t, fh.recordedEntries[0].Result)
+
+	// An inexact division keeps its remainder; an exact one needs none.
+	for args, want := range map[[2]string]string{{"-7", "2"}: "-3 r -1", {"8", "2"}: "4"} {
+		_, err = svc.Compute(context.Background(), "user-123", Request{Operation: OpDivide, Args: args[:]})
+		require.NoError(t, err)
+		last := fh.recordedEntries[len(fh.recordedEntries)-1]
+		assert.Equal(t, want, last.ExactResult, last.Expression)
+	}
+}
+
+func TestCompute_ModularArithmetic(t *testing.T) {
+	assert.Equal(t, "445", mustCompute(t, OpModPow, "4", "13", "497").Result)
+	assert.Equal(t, "4", mustCompute(t, OpModInv, "3", "11").Result)
+	assert.Equal(t, "9", mustCompute(t, OpModPow, "3", "-1", "26").Result) // 3 * 9 = 27 ≡ 1
+	assert.Equal(t, "2", mustCompute(t, OpMod, "-7", "3").Result)
+
+	_, err := NewService(&fakeHistoryService{}).Compute(context.Background(), "user-123",
+		Request{Operation: OpModInv, Args: []string{"6", "9"}})
+	assert.ErrorIs(t, err, ErrNotInvertible)
+}
+
+func TestCompute_HexInAndOut(t *testing.T) {
+	res, err := NewService(&fakeHistoryService{}).Compute(context.Background(), "user-123", Request{
+		Operation: OpAdd,
+		Args:      []string{"0xff", "1"},
+		Output:    OutputHex,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0x100", res.Result)
+	assert.Equal(t, "0xff + 0x1", res.Expression)
+
+	// a leading zero is still decimal
+	assert.Equal(t, "11", mustCompute(t, OpAdd, "010", "1").Result)
+}
+
+func TestCompute_GCDAndLCM(t *testing.T) {
+	assert.Equal(t, "6", mustCompute(t, OpGCD, "-48", "18").Result)
+	assert.Equal(t, "144", mustCompute(t, OpLCM, "48", "-18").Result)
+	assert.Equal(t, "0", mustCompute(t, OpLCM, "0", "5").Result)
+}
+
+func TestCompute_Primality(t *testing.T) {
+	// 2^127 - 1 is a Mersenne prime
+	res := mustCompute(t, OpIsPrime, "170141183460469231731687303715884105727")
+	require.NotNil(t, res.IsPrime)
+	assert.True(t, *res.IsPrime)
+
+	res = mustCompute(t, OpIsPrime, "561") // Carmichael number
+	assert.False(t, *res.IsPrime)
+}
+
+func TestCompute_Factorize(t *testing.T) {
+	res := mustCompute(t, OpFactorize, "360")
+	assert.Equal(t, []string{"2", "2", "2", "3", "3", "5"}, res.Factors)
+	assert.Equal(t, "2 * 2 * 2 * 3 * 3 * 5", res.Result)
+
+	// product of two ~31-bit primes needs Pollard rho
+	res = mustCompute(t, OpFactorize, "4611686014132420609") // (2^31 - 1)^2
+	assert.Equal(t, []string{"2147483647", "2147483647"}, res.Factors)
+
+	res = mustCompute(t, OpFactorize, "1000000016000000063") // 1000000007 * 1000000009
+	assert.Equal(t, []string{"1000000007", "1000000009"}, res.Factors)
+}
+
+func TestCompute_FactorialAndBinomial(t *testing.T) {
+	assert.Equal(t, "2432902008176640000", mustCompute(t, OpFactorial, "20").Result)
+	assert.Len(t, mustCompute(t, OpFactorial, "1000").Result, 2568)
+	assert.Equal(t, "100891344545564193334812497256", mustCompute(t, OpBinomial, "100", "50").Result)
+
+	// The largest results still fit in an operand.
+	for _, r := range []Result{
+		mustCompute(t, OpFactorial, strconv.Itoa(maxFactorialN)),
+		mustCompute(t, OpBinomial, strconv.Itoa(maxBinomialN), strconv.Itoa(maxBinomialN/2)),
+	} {
+		v, err := parseInt(r.Result)
+		require.NoError(t, err, r.Expression)
+		assert.LessOrEqual(t, v.BitLen(), maxOperandBits, r.Expression)
+	}
+	_, err := NewService(&fakeHistoryService{}).Compute(context.Background(), "user-123",
+		Request{Operation: OpFactorial, Args: []string{strconv.Itoa(maxFactorialN + 1)}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestCompute_FibonacciAndLucas(t *testing.T) {
+	assert.Equal(t, "0", mustCompute(t, OpFibonacci, "0").Result)
+	assert.Equal(t, "55", mustCompute(t, OpFibonacci, "10").Result)
+	assert.Equal(t, "354224848179261915075", mustCompute(t, OpFibonacci, "100").Result)
+	assert.Equal(t, "2", mustCompute(t, OpLucas, "0").Result)
+	assert.Equal(t, "123", mustCompute(t, OpLucas, "10").Result)
+	assert.Equal(t, "fib(100)", mustCompute(t, OpFibonacci, "100").Expression)
+}
+
+func TestCompute_InvalidInput(t *testing.T) {
+	svc := NewService(&fakeHistoryService{})
+	ctx := context.Background()
+
+	_, err := svc.Compute(ctx, "user-123", Request{Operation: "SQRT", Args: []string{"4"}})
+	assert.ErrorIs(t, err, ErrInvalidOperation)
+
+	_, err = svc.Compute(ctx, "user-123", Request{Operation: OpAdd, Args: []string{"1.5", "2"}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, err = svc.Compute(ctx, "user-123", Request{Operation: OpAdd, Args: []string{"1"}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, err = svc.Compute(ctx, "user-123", Request{Operation: OpDivide, Args: []string{"1", "0"}})
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+
+	_, err = svc.Compute(ctx, "user-123", Request{Operation: OpFactorial, Args: []string{"100000"}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
@@ -0,0 +1,125 @@
+// internal/numeric/angle.go
+package numeric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidAngleMode = errors.New("invalid angle mode")
+
+// AngleMode is the unit in which angles are read and written.
+// The empty value means radians.
+type AngleMode string
+
+const (
+	AngleRadians  AngleMode = "rad"
+	AngleDegrees  AngleMode = "deg"
+	AngleGradians AngleMode = "grad"
+)
+
+// Validate accepts the empty value and the three known modes.
+func (m AngleMode) Validate() error {
+	switch m {
+	case "", AngleRadians, AngleDegrees, AngleGradians:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q (use %q, %q or %q)", ErrInvalidAngleMode, string(m), AngleRadians, AngleDegrees, AngleGradians)
+	}
+}
+
+// OrDefault returns m, or AngleRadians if m is empty.
+func (m AngleMode) OrDefault() AngleMode {
+	if m == "" {
+		return AngleRadians
+	}
+	return m
+}
+
+// Merge returns override if it is set, m otherwise.
+func (m AngleMode) Merge(override *AngleMode) AngleMode {
+	if override != nil && *override != "" {
+		return *override
+	}
+	return m
+}
+
+// turn is the size of a full circle in this unit.
+func (m AngleMode) turn() float64 {
+	switch m {
+	case AngleDegrees:
+		return 360
+	case AngleGradians:
+		return 400
+	default:
+		return 2 * math.Pi
+	}
+}
+
+// ToRadians converts an angle in this unit to radians.
+func (m AngleMode) ToRadians(v float64) float64 {
+	if m.OrDefault() == AngleRadians {
+		return v
+	}
+	return v / m.turn() * 2 * math.Pi
+}
+
+// FromRadians converts an angle in radians to this unit.
+func (m AngleMode) FromRadians(v float64) float64 {
+	if m.OrDefault() == AngleRadians {
+		return v
+	}
+	return v / (2 * math.Pi) * m.turn()
+}
+
+// Symbol is the unit suffix used in explanations.
+func (m AngleMode) Symbol() string {
+	switch m {
+	case AngleDegrees:
+		return "°"
+	case AngleGradians:
+		return " grad"
+	default:
+		return " rad"
+	}
+}
+
+// Sin returns the sine of an angle in this unit. In degrees and gradians,
+// multiples of a quarter turn give exact results (sin 180° = 0, not 1.2e-16).
+func (m AngleMode) Sin(v float64) float64 {
+	if q, ok := m.quarterTurns(v); ok {
+		return [4]float64{0, 1, 0, -1}[q]
+	}
+	return math.Sin(m.ToRadians(v))
+}
+
+// Cos returns the cosine of an angle in this unit, see Sin.
+func (m AngleMode) Cos(v float64) float64 {
+	if q, ok := m.quarterTurns(v); ok {
+		return [4]float64{1, 0, -1, 0}[q]
+	}
+	return math.Cos(m.ToRadians(v))
+}
+
+// Tan returns the tangent of an angle in this unit, see Sin. Odd quarter
+// turns return ±Inf, which the special value policy then handles.
+func (m AngleMode) Tan(v float64) float64 {
+	if q, ok := m.quarterTurns(v); ok {
+		return [4]float64{0, math.Inf(1), 0, math.Inf(-1)}[q]
+	}
+	return math.Tan(m.ToRadians(v))
+}
+
+// quarterTurns reports whether v is a whole number of quarter turns in a
+// unit where that is exactly representable, and which quadrant it lands on.
+func (m AngleMode) quarterTurns(v float64) (int, bool) {
+	if m != AngleDegrees && m != AngleGradians {
+		return 0, false
+	}
+	q := v / (m.turn() / 4)
+	if q != math.Trunc(q) || math.IsInf(q, 0) {
+		return 0, false
+	}
+	return int(math.Mod(math.Mod(q, 4)+4, 4)), true
+}
@@ -0,0 +1,35 @@
+package numeric
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAngleMode_Conversions(t *testing.T) {
+	assert.InDelta(t, math.Pi, AngleDegrees.ToRadians(180), 1e-15)
+	assert.InDelta(t, math.Pi/2, AngleGradians.ToRadians(100), 1e-15)
+	assert.Equal(t, 1.5, AngleMode("").ToRadians(1.5))
+	assert.InDelta(t, 90, AngleDegrees.FromRadians(math.Pi/2), 1e-12)
+	assert.InDelta(t, 200, AngleGradians.FromRadians(math.Pi), 1e-12)
+}
+
+func TestAngleMode_ExactQuarterTurns(t *testing.T) {
+	assert.Equal(t, 0.0, AngleDegrees.Sin(180))
+	assert.Equal(t, -1.0, AngleDegrees.Sin(-90))
+	assert.Equal(t, 0.0, AngleDegrees.Cos(450))
+	assert.Equal(t, -1.0, AngleGradians.Cos(200))
+	assert.True(t, math.IsInf(AngleDegrees.Tan(90), 1))
+	assert.InDelta(t, 0.5, AngleDegrees.Sin(30), 1e-15)
+
+	// radians use math.Sin directly
+	assert.InDelta(t, 0, AngleRadians.Sin(math.Pi), 1e-15)
+}
+
+func TestAngleMode_Validate(t *testing.T) {
+	for _, m := range []AngleMode{"", AngleRadians, AngleDegrees, AngleGradians} {
+		assert.NoError(t, m.Validate())
+	}
+	assert.ErrorIs(t, AngleMode("turns").Validate(), ErrInvalidAngleMode)
+}
@@ -0,0 +1,148 @@
+// internal/numeric/decimal.go
+package numeric
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// decimal is the shortest round-tripping decimal form of a float64,
+// value = 0.d1d2d3... × 10^exp. Rounding on these digits (instead of on the
+// binary value) gives the results people expect, e.g. 1.005 → 1.01 half-up.
+type decimal struct {
+	neg    bool
+	digits []byte
+	exp    int
+}
+
+func newDecimal(v float64) decimal {
+	d := decimal{neg: math.Signbit(v)}
+	if v == 0 {
+		return d
+	}
+
+	// "d.dddde±XX"
+	s := strconv.FormatFloat(math.Abs(v), 'e', -1, 64)
+	mant, expStr, _ := strings.Cut(s, "e")
+	exp, _ := strconv.Atoi(expStr)
+
+	d.digits = []byte(strings.Replace(mant, ".", "", 1))
+	d.exp = exp + 1
+	d.trim()
+	return d
+}
+
+func (d *decimal) isZero() bool { return len(d.digits) == 0 }
+
+func (d *decimal) trim() {
+	for len(d.digits) > 0 && d.digits[len(d.digits)-1] == '0' {
+		d.digits = d.digits[:len(d.digits)-1]
+	}
+}
+
+// round keeps the first nd digits using the given mode. nd may be zero
+// or negative when the value is smaller than the requested precision.
+func (d *decimal) round(nd int, mode RoundingMode) {
+	if nd >= len(d.digits) {
+		return
+	}
+	if nd < 0 {
+		d.digits = d.digits[:0]
+		return
+	}
+
+	if d.shouldRoundUp(nd, mode) {
+		d.digits = d.digits[:nd]
+		i := nd - 1
+		for ; i >= 0; i-- {
+			if d.digits[i] < '9' {
+				d.digits[i]++
+				break
+			}
+			d.digits[i] = '0'
+		}
+		if i < 0 {
+			// carried past the first digit: 999 → 1000
+			d.digits = append([]byte{'1'}, d.digits...)
+			d.exp++
+		}
+	} else {
+		d.digits = d.digits[:nd]
+	}
+	d.trim()
+}
+
+func (d *decimal) shouldRoundUp(nd int, mode RoundingMode) bool {
+	switch mode {
+	case RoundTruncate:
+		return false
+	case RoundHalfUp:
+		return d.digits[nd] >= '5'
+	default: // half-even
+		if d.digits[nd] != '5' {
+			return d.digits[nd] > '5'
+		}
+		if nd+1 < len(d.digits) {
+			// more than exactly half
+			return true
+		}
+		return nd > 0 && (d.digits[nd-1]-'0')%2 == 1
+	}
+}
+
+// digit returns the i-th digit, padding with zeros.
+func (d *decimal) digit(i int) byte {
+	if i >= 0 && i < len(d.digits) {
+		return d.digits[i]
+	}
+	return '0'
+}
+
+// fixed renders the unsigned value with exactly `decimals` fraction digits.
+func (d *decimal) fixed(decimals int) string {
+	var b strings.Builder
+	if d.exp <= 0 || d.isZero() {
+		b.WriteByte('0')
+	} else {
+		for i := 0; i < d.exp; i++ {
+			b.WriteByte(d.digit(i))
+		}
+	}
+	if decimals > 0 {
+		b.WriteByte('.')
+		for i := 0; i < decimals; i++ {
+			b.WriteByte(d.digit(d.exp + i))
+		}
+	}
+	return b.String()
+}
+
+// scientific renders the unsigned value with `shift` digits before the
+// decimal point, returning mantissa and exponent ("e+03") separately.
+func (d *decimal) scientific(shift int) (string, string) {
+	if d.isZero() {
+		return "0", "e+00"
+	}
+
+	var b strings.Builder
+	for i := 0; i < shift; i++ {
+		b.WriteByte(d.digit(i))
+	}
+	if len(d.digits) > shift {
+		b.WriteByte('.')
+		b.Write(d.digits[shift:])
+	}
+
+	exp := d.exp - shift
+	sign := byte('+')
+	if exp < 0 {
+		sign = '-'
+		exp = -exp
+	}
+	expStr := strconv.Itoa(exp)
+	if len(expStr) < 2 {
+		expStr = "0" + expStr
+	}
+	return b.String(), "e" + string(sign) + expStr
+}
@@ -0,0 +1,242 @@
+// internal/numeric/format.go
+package numeric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidFormat = errors.New("invalid number format")
+
+// Notation selects how a number is laid out.
+type Notation string
+
+const (
+	NotationAuto        Notation = "auto"        // like %g: plain, switching to exponent for very large/small values
+	NotationFixed       Notation = "fixed"       // fixed number of decimals
+	NotationScientific  Notation = "scientific"  // d.ddde±XX
+	NotationEngineering Notation = "engineering" // exponent is a multiple of 3
+)
+
+// RoundingMode selects how digits are dropped.
+type RoundingMode string
+
+const (
+	RoundHalfEven RoundingMode = "half-even"
+	RoundHalfUp   RoundingMode = "half-up"
+	RoundTruncate RoundingMode = "truncate"
+)
+
+const maxDigits = 17
+
+// NumberFormat describes how a value is displayed. Every field is optional;
+// unset fields fall back to the defaults, which reproduce Go's %g output.
+type NumberFormat struct {
+	Notation          Notation     `json:"notation,omitempty"`
+	SignificantDigits *int         `json:"significantDigits,omitempty"`
+	Decimals          *int         `json:"decimals,omitempty"`
+	Rounding          RoundingMode `json:"rounding,omitempty"`
+	Locale            string       `json:"locale,omitempty"`
+	Grouping          *bool        `json:"grouping,omitempty"`
+}
+
+// Merge returns f with every field that is set in override replaced.
+func (f NumberFormat) Merge(override *NumberFormat) NumberFormat {
+	if override == nil {
+		return f
+	}
+	if override.Notation != "" {
+		f.Notation = override.Notation
+	}
+	if override.SignificantDigits != nil {
+		f.SignificantDigits = override.SignificantDigits
+	}
+	if override.Decimals != nil {
+		f.Decimals = override.Decimals
+	}
+	if override.Rounding != "" {
+		f.Rounding = override.Rounding
+	}
+	if override.Locale != "" {
+		f.Locale = override.Locale
+	}
+	if override.Grouping != nil {
+		f.Grouping = override.Grouping
+	}
+	return f
+}
+
+// Validate checks that every set field has a supported value.
+func (f NumberFormat) Validate() error {
+	switch f.Notation {
+	case "", NotationAuto, NotationFixed, NotationScientific, NotationEngineering:
+	default:
+		return fmt.Errorf("%w: unknown notation %q", ErrInvalidFormat, f.Notation)
+	}
+	switch f.Rounding {
+	case "", RoundHalfEven, RoundHalfUp, RoundTruncate:
+	default:
+		return fmt.Errorf("%w: unknown rounding mode %q", ErrInvalidFormat, f.Rounding)
+	}
+	if f.SignificantDigits != nil && (*f.SignificantDigits < 1 || *f.SignificantDigits > maxDigits) {
+		return fmt.Errorf("%w: significantDigits must be between 1 and %d", ErrInvalidFormat, maxDigits)
+	}
+	if f.Decimals != nil && (*f.Decimals < 0 || *f.Decimals > maxDigits) {
+		return fmt.Errorf("%w: decimals must be between 0 and %d", ErrInvalidFormat, maxDigits)
+	}
+	if f.Locale != "" {
+		if _, ok := lookupLocale(f.Locale); !ok {
+			return fmt.Errorf("%w: unsupported locale %q", ErrInvalidFormat, f.Locale)
+		}
+	}
+	return nil
+}
+
+// Format renders v according to f. The value itself is never modified;
+// rounding only affects the returned text.
+func (f NumberFormat) Format(v float64) string {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	mode := f.Rounding
+	if mode == "" {
+		mode = RoundHalfEven
+	}
+
+	d := newDecimal(v)
+	var mantissa, exponent string
+	switch f.Notation {
+	case NotationFixed:
+		decimals := 2
+		if f.Decimals != nil {
+			decimals = *f.Decimals
+		}
+		d.round(d.exp+decimals, mode)
+		mantissa = d.fixed(decimals)
+	case NotationScientific, NotationEngineering:
+		if f.SignificantDigits != nil {
+			d.round(*f.SignificantDigits, mode)
+		}
+		// shift is how many digits end up before the decimal point.
+		shift := 1
+		if f.Notation == NotationEngineering && !d.isZero() {
+			shift = ((d.exp-1)%3+3)%3 + 1
+		}
+		mantissa, exponent = d.scientific(shift)
+	default:
+		if f.SignificantDigits == nil {
+			// Shortest representation, identical to %g.
+			mantissa, exponent = splitExponent(strconv.FormatFloat(math.Abs(v), 'g', -1, 64))
+			break
+		}
+		digits := *f.SignificantDigits
+		d.round(digits, mode)
+		// Same switch-over rule as %g with an explicit precision.
+		if x := d.exp - 1; !d.isZero() && (x < -4 || x >= digits) {
+			mantissa, exponent = d.scientific(1)
+		} else {
+			mantissa = d.fixed(max(0, digits-d.exp))
+			mantissa = trimFraction(mantissa)
+		}
+	}
+
+	out := f.localize(mantissa) + exponent
+	if d.neg && !d.isZero() {
+		out = "-" + out
+	}
+	return out
+}
+
+// localize applies grouping and the locale's decimal separator to an
+// unsigned plain number such as "12345.67".
+func (f NumberFormat) localize(s string) string {
+	loc, _ := lookupLocale(f.Locale)
+
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	if f.Grouping != nil && *f.Grouping && len(intPart) > 3 {
+		var b strings.Builder
+		lead := len(intPart) % 3
+		if lead > 0 {
+			b.WriteString(intPart[:lead])
+		}
+		for i := lead; i < len(intPart); i += 3 {
+			if b.Len() > 0 {
+				b.WriteString(loc.group)
+			}
+			b.WriteString(intPart[i : i+3])
+		}
+		intPart = b.String()
+	}
+	if !hasFrac {
+		return intPart
+	}
+	return intPart + loc.decimal + frac
+}
+
+// splitExponent splits "1.5e+21" into "1.5" and "e+21".
+func splitExponent(s string) (string, string) {
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+func trimFraction(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+//
+// Locales
+//
+
+type locale struct {
+	decimal string
+	group   string
+}
+
+var locales = map[string]locale{
+	"en": {decimal: ".", group: ","},
+	"de": {decimal: ",", group: "."},
+	"es": {decimal: ",", group: "."},
+	"it": {decimal: ",", group: "."},
+	"nl": {decimal: ",", group: "."},
+	"pt": {decimal: ",", group: "."},
+	"fr": {decimal: ",", group: " "},
+	"ru": {decimal: ",", group: " "},
+	"pl": {decimal: ",", group: " "},
+	"ch": {decimal: ".", group: "'"},
+	"ja": {decimal: ".", group: ","},
+	"zh": {decimal: ".", group: ","},
+}
+
+// regional overrides where a region differs from its language default.
+var regionalLocales = map[string]locale{
+	"de-ch": {decimal: ".", group: "'"},
+	"fr-ch": {decimal: ".", group: "'"},
+	"it-ch": {decimal: ".", group: "'"},
+	"pt-br": {decimal: ",", group: "."},
+	"en-in": {decimal: ".", group: ","},
+}
+
+// lookupLocale accepts BCP 47-ish tags ("de", "de-CH", "de_CH").
+// The empty tag is "en".
+func lookupLocale(tag string) (locale, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" {
+		return locales["en"], true
+	}
+	if loc, ok := regionalLocales[tag]; ok {
+		return loc, true
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	loc, ok := locales[lang]
+	return loc, ok
+}
@@ -0,0 +1,82 @@
+package numeric
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
+
+// The zero NumberFormat must keep the historical %g output.
+func TestFormat_DefaultMatchesG(t *testing.T) {
+	for _, v := range []float64{0, 1, -3, 0.1, 1.0 / 3, 1e21, 1e-7, 123456789, -0.000015} {
+		assert.Equal(t, fmt.Sprintf("%g", v), NumberFormat{}.Format(v))
+	}
+}
+
+func TestFormat_RoundingModes(t *testing.T) {
+	cases := []struct {
+		value    float64
+		decimals int
+		mode     RoundingMode
+		want     string
+	}{
+		{1.005, 2, RoundHalfUp, "1.01"},
+		{1.005, 2, RoundHalfEven, "1.00"},
+		{1.015, 2, RoundHalfEven, "1.02"},
+		{1.019, 2, RoundTruncate, "1.01"},
+		{2.5, 0, RoundHalfEven, "2"},
+		{2.5, 0, RoundHalfUp, "3"},
+		{9.999, 2, RoundHalfUp, "10.00"},
+		{0.004, 2, RoundHalfUp, "0.00"},
+		{-1.25, 1, RoundHalfEven, "-1.2"},
+	}
+	for _, c := range cases {
+		f := NumberFormat{Notation: NotationFixed, Decimals: intPtr(c.decimals), Rounding: c.mode}
+		assert.Equal(t, c.want, f.Format(c.value), "%v %s", c.value, c.mode)
+	}
+}
+
+func TestFormat_Notations(t *testing.T) {
+	sig3 := intPtr(3)
+
+	assert.Equal(t, "1.23e+05", NumberFormat{Notation: NotationScientific, SignificantDigits: sig3}.Format(123456))
+	assert.Equal(t, "123e+03", NumberFormat{Notation: NotationEngineering, SignificantDigits: sig3}.Format(123456))
+	assert.Equal(t, "12.3e-06", NumberFormat{Notation: NotationEngineering}.Format(0.0000123))
+	assert.Equal(t, "3.33", NumberFormat{SignificantDigits: sig3}.Format(10.0/3))
+	assert.Equal(t, "1.23e+06", NumberFormat{SignificantDigits: sig3}.Format(1234567))
+}
+
+func TestFormat_Locale(t *testing.T) {
+	de := NumberFormat{Notation: NotationFixed, Locale: "de-DE", Grouping: boolPtr(true)}
+	assert.Equal(t, "1.234.567,89", de.Format(1234567.891))
+
+	ch := NumberFormat{Locale: "de-CH", Grouping: boolPtr(true)}
+	assert.Equal(t, "-12'345.5", ch.Format(-12345.5))
+
+	fr := NumberFormat{Locale: "fr"}
+	assert.Equal(t, "0,25", fr.Format(0.25))
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, NumberFormat{Notation: NotationFixed, Decimals: intPtr(0)}.Validate())
+
+	assert.ErrorIs(t, NumberFormat{Notation: "roman"}.Validate(), ErrInvalidFormat)
+	assert.ErrorIs(t, NumberFormat{Rounding: "ceil"}.Validate(), ErrInvalidFormat)
+	assert.ErrorIs(t, NumberFormat{SignificantDigits: intPtr(0)}.Validate(), ErrInvalidFormat)
+	assert.ErrorIs(t, NumberFormat{Locale: "xx"}.Validate(), ErrInvalidFormat)
+}
+
+func TestMerge(t *testing.T) {
+	base := NumberFormat{Notation: NotationFixed, Decimals: intPtr(4), Locale: "de"}
+	got := base.Merge(&NumberFormat{Decimals: intPtr(1)})
+
+	assert.Equal(t, NotationFixed, got.Notation)
+	assert.Equal(t, 1, *got.Decimals)
+	assert.Equal(t, "de", got.Locale)
+	assert.Equal(t, base, base.Merge(nil))
+}
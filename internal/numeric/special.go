@@ -0,0 +1,105 @@
+// internal/numeric/special.go
+package numeric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrOverflow   = errors.New("result overflows the floating-point range")
+	ErrNotANumber = errors.New("result is not a number")
+)
+
+// SpecialValuePolicy decides what happens when a computation produces
+// +Inf, -Inf or NaN.
+type SpecialValuePolicy string
+
+const (
+	// SpecialValuesReject fails the operation with ErrOverflow or ErrNotANumber.
+	SpecialValuesReject SpecialValuePolicy = "reject"
+	// SpecialValuesString keeps the value and encodes it in JSON as
+	// "Infinity", "-Infinity" or "NaN".
+	SpecialValuesString SpecialValuePolicy = "string"
+)
+
+// ParseSpecialValuePolicy reads a policy from configuration.
+// The empty string selects SpecialValuesReject.
+func ParseSpecialValuePolicy(s string) (SpecialValuePolicy, error) {
+	switch SpecialValuePolicy(s) {
+	case "", SpecialValuesReject:
+		return SpecialValuesReject, nil
+	case SpecialValuesString:
+		return SpecialValuesString, nil
+	default:
+		return "", fmt.Errorf("unknown special value policy %q", s)
+	}
+}
+
+// Check returns a typed error for non-finite values under the reject
+// policy (the zero value behaves like reject). It always accepts finite values.
+func (p SpecialValuePolicy) Check(v float64) error {
+	if p == SpecialValuesString {
+		return nil
+	}
+	switch {
+	case math.IsNaN(v):
+		return ErrNotANumber
+	case math.IsInf(v, 0):
+		return ErrOverflow
+	default:
+		return nil
+	}
+}
+
+// SpecialString returns the textual name of a non-finite value, using the
+// spelling understood by both JavaScript and PostgreSQL.
+func SpecialString(v float64) (string, bool) {
+	switch {
+	case math.IsNaN(v):
+		return "NaN", true
+	case math.IsInf(v, 1):
+		return "Infinity", true
+	case math.IsInf(v, -1):
+		return "-Infinity", true
+	default:
+		return "", false
+	}
+}
+
+// Float is a float64 that can always be encoded as JSON: non-finite values,
+// which encoding/json refuses, are written as strings.
+type Float float64
+
+func (f Float) MarshalJSON() ([]byte, error) {
+	if s, ok := SpecialString(float64(f)); ok {
+		return json.Marshal(s)
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *Float) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		switch s {
+		case "NaN":
+			*f = Float(math.NaN())
+		case "Infinity":
+			*f = Float(math.Inf(1))
+		case "-Infinity":
+			*f = Float(math.Inf(-1))
+		default:
+			return fmt.Errorf("invalid number %q", s)
+		}
+		return nil
+	}
+
+	var v float64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*f = Float(v)
+	return nil
+}
@@ -0,0 +1,52 @@
+package numeric
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecialValuePolicy_Check(t *testing.T) {
+	var zero SpecialValuePolicy // unset behaves like reject
+
+	for _, p := range []SpecialValuePolicy{zero, SpecialValuesReject} {
+		assert.NoError(t, p.Check(1.5))
+		assert.ErrorIs(t, p.Check(math.Inf(1)), ErrOverflow)
+		assert.ErrorIs(t, p.Check(math.Inf(-1)), ErrOverflow)
+		assert.ErrorIs(t, p.Check(math.NaN()), ErrNotANumber)
+	}
+
+	assert.NoError(t, SpecialValuesString.Check(math.Inf(1)))
+	assert.NoError(t, SpecialValuesString.Check(math.NaN()))
+}
+
+func TestParseSpecialValuePolicy(t *testing.T) {
+	p, err := ParseSpecialValuePolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, SpecialValuesReject, p)
+
+	p, err = ParseSpecialValuePolicy("string")
+	require.NoError(t, err)
+	assert.Equal(t, SpecialValuesString, p)
+
+	_, err = ParseSpecialValuePolicy("clamp")
+	assert.Error(t, err)
+}
+
+func TestFloat_JSONRoundTrip(t *testing.T) {
+	in := []Float{1.25, Float(math.Inf(1)), Float(math.Inf(-1)), Float(math.NaN())}
+
+	b, err := json.Marshal(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[1.25, "Infinity", "-Infinity", "NaN"]`, string(b))
+
+	var out []Float
+	require.NoError(t, json.Unmarshal(b, &out))
+	assert.Equal(t, 1.25, float64(out[0]))
+	assert.True(t, math.IsInf(float64(out[1]), 1))
+	assert.True(t, math.IsInf(float64(out[2]), -1))
+	assert.True(t, math.IsNaN(float64(out[3])))
+}
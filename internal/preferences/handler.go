@@ -0,0 +1,132 @@
+// internal/preferences/handler.go
+package preferences
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// NewHandler constructs a new Preferences HTTP handler.
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// Preferences handles GET and PUT /api/v1/preferences.
+//
+// GET returns the current settings (defaults if none were saved).
+// PUT replaces the sections present in the body and returns the result.
+func (h *Handler) Preferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, _, ok := auth.UserFromContext(ctx)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	prefs, err := h.svc.Get(ctx, userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not load preferences"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, prefs)
+
+	case http.MethodPut:
+		var req updateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+		if req.NumberFormat != nil {
+			prefs.NumberFormat = *req.NumberFormat
+		}
+		if req.AngleMode != nil {
+			prefs.AngleMode = *req.AngleMode
+		}
+
+		if err := h.svc.Update(ctx, &prefs); err != nil {
+			if errors.Is(err, numeric.ErrInvalidFormat) || errors.Is(err, numeric.ErrInvalidAngleMode) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not save preferences"})
+			return
+		}
+		writeJSON(w, http.StatusOK, prefs)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// Profile handles GET and PUT /api/v1/profile.
+//
+// GET returns the profile (defaults if none was saved). PUT changes the
+// fields present in the body and returns the result. The number format
+// is the same one /api/v1/preferences manages.
+func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, _, ok := auth.UserFromContext(ctx)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	profile, err := h.svc.GetProfile(ctx, userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not load profile"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, profile)
+
+	case http.MethodPut:
+		var req updateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+			return
+		}
+		if req.DisplayName != nil {
+			profile.DisplayName = *req.DisplayName
+		}
+		if req.TimeZone != nil {
+			profile.TimeZone = *req.TimeZone
+		}
+		if req.Locale != nil {
+			profile.Locale = *req.Locale
+		}
+		if req.NumberFormat != nil {
+			profile.NumberFormat = *req.NumberFormat
+		}
+
+		if err := h.svc.UpdateProfile(ctx, &profile); err != nil {
+			if errors.Is(err, ErrInvalidDisplayName) || errors.Is(err, ErrInvalidTimeZone) ||
+				errors.Is(err, ErrInvalidLocale) || errors.Is(err, numeric.ErrInvalidFormat) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not save profile"})
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,50 @@
+// internal/preferences/model.go
+package preferences
+
+import (
+	"time"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+// Preferences holds per-user display settings. AngleMode is the unit every
+// trigonometric function and geometry helper reads and writes angles in.
+type Preferences struct {
+	UserID       string               `json:"-"`
+	NumberFormat numeric.NumberFormat `json:"numberFormat"`
+	AngleMode    numeric.AngleMode    `json:"angleMode"`
+	UpdatedAt    time.Time            `json:"updatedAt"`
+}
+
+// Profile is how the user appears and how their results are shown: a
+// display name, the time zone and locale of their client, and the number
+// format shared with Preferences.
+type Profile struct {
+	UserID       string               `json:"-"`
+	DisplayName  string               `json:"displayName"`
+	TimeZone     string               `json:"timeZone"`
+	Locale       string               `json:"locale"`
+	NumberFormat numeric.NumberFormat `json:"numberFormat"`
+	UpdatedAt    time.Time            `json:"updatedAt"`
+}
+
+// Handler wires HTTP requests to the Preferences service.
+type Handler struct {
+	svc Service
+}
+
+// updateRequest is the body accepted by PUT /api/v1/preferences.
+// Omitted sections are left unchanged.
+type updateRequest struct {
+	NumberFormat *numeric.NumberFormat `json:"numberFormat"`
+	AngleMode    *numeric.AngleMode    `json:"angleMode"`
+}
+
+// updateProfileRequest is the body accepted by PUT /api/v1/profile.
+// Omitted fields are left unchanged.
+type updateProfileRequest struct {
+	DisplayName  *string               `json:"displayName"`
+	TimeZone     *string               `json:"timeZone"`
+	Locale       *string               `json:"locale"`
+	NumberFormat *numeric.NumberFormat `json:"numberFormat"`
+}
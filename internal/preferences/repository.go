@@ -0,0 +1,116 @@
+// internal/preferences/repository.go
+package preferences
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+var ErrNotFound = errors.New("preferences not found")
+
+type Repository interface {
+	Get(ctx context.Context, userID string) (Preferences, error)
+	Upsert(ctx context.Context, prefs *Preferences) error
+	GetProfile(ctx context.Context, userID string) (Profile, error)
+	// UpsertProfile saves the profile fields, number format included,
+	// and leaves the angle mode alone.
+	UpsertProfile(ctx context.Context, profile *Profile) error
+}
+
+type PostgresRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{DB: db}
+}
+
+func (r *PostgresRepository) Get(ctx context.Context, userID string) (Preferences, error) {
+	row := r.DB.QueryRowContext(ctx,
+		`SELECT user_id, number_format, angle_mode, updated_at
+         FROM user_preferences
+         WHERE user_id = $1`,
+		userID,
+	)
+
+	var (
+		p      Preferences
+		format []byte
+	)
+	if err := row.Scan(&p.UserID, &format, &p.AngleMode, &p.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Preferences{}, ErrNotFound
+		}
+		return Preferences{}, err
+	}
+	if err := json.Unmarshal(format, &p.NumberFormat); err != nil {
+		return Preferences{}, err
+	}
+	return p, nil
+}
+
+func (r *PostgresRepository) Upsert(ctx context.Context, p *Preferences) error {
+	format, err := json.Marshal(p.NumberFormat)
+	if err != nil {
+		return err
+	}
+
+	row := r.DB.QueryRowContext(ctx,
+		`INSERT INTO user_preferences (user_id, number_format, angle_mode, updated_at)
+         VALUES ($1, $2, $3, NOW())
+         ON CONFLICT (user_id) DO UPDATE
+             SET number_format = EXCLUDED.number_format,
+                 angle_mode    = EXCLUDED.angle_mode,
+                 updated_at    = EXCLUDED.updated_at
+         RETURNING updated_at`,
+		p.UserID, format, string(p.AngleMode),
+	)
+	return row.Scan(&p.UpdatedAt)
+}
+
+func (r *PostgresRepository) GetProfile(ctx context.Context, userID string) (Profile, error) {
+	row := r.DB.QueryRowContext(ctx,
+		`SELECT user_id, display_name, time_zone, locale, number_format, updated_at
+         FROM user_preferences
+         WHERE user_id = $1`,
+		userID,
+	)
+
+	var (
+		p      Profile
+		format []byte
+	)
+	if err := row.Scan(&p.UserID, &p.DisplayName, &p.TimeZone, &p.Locale, &format, &p.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Profile{}, ErrNotFound
+		}
+		return Profile{}, err
+	}
+	if err := json.Unmarshal(format, &p.NumberFormat); err != nil {
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+func (r *PostgresRepository) UpsertProfile(ctx context.Context, p *Profile) error {
+	format, err := json.Marshal(p.NumberFormat)
+	if err != nil {
+		return err
+	}
+
+	row := r.DB.QueryRowContext(ctx,
+		`INSERT INTO user_preferences (user_id, display_name, time_zone, locale, number_format, updated_at)
+         VALUES ($1, $2, $3, $4, $5, NOW())
+         ON CONFLICT (user_id) DO UPDATE
+             SET display_name  = EXCLUDED.display_name,
+                 time_zone     = EXCLUDED.time_zone,
+                 locale        = EXCLUDED.locale,
+                 number_format = EXCLUDED.number_format,
+                 updated_at    = EXCLUDED.updated_at
+         RETURNING updated_at`,
+		p.UserID, p.DisplayName, p.TimeZone, p.Locale, format,
+	)
+	return row.Scan(&p.UpdatedAt)
+}
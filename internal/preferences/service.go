@@ -0,0 +1,107 @@
+// internal/preferences/service.go
+package preferences
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+var (
+	ErrInvalidDisplayName = errors.New("display name must be at most 64 characters without control characters")
+	ErrInvalidTimeZone    = errors.New("time zone must be an IANA name such as Europe/Berlin")
+	ErrInvalidLocale      = errors.New("locale must be a language tag such as en or de-CH")
+)
+
+const (
+	DefaultTimeZone = "UTC"
+	DefaultLocale   = "en"
+	// maxDisplayNameLen is in characters, not bytes.
+	maxDisplayNameLen = 64
+)
+
+// localeTag is the shape of a BCP 47 tag: a language, then optional
+// script, region or variant subtags.
+var localeTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+type Service interface {
+	// Get returns the stored preferences, or the defaults if the user
+	// never saved any.
+	Get(ctx context.Context, userID string) (Preferences, error)
+	Update(ctx context.Context, prefs *Preferences) error
+	// GetProfile returns the stored profile, or the defaults if the user
+	// never saved one.
+	GetProfile(ctx context.Context, userID string) (Profile, error)
+	// UpdateProfile validates and normalises the profile, then saves it.
+	UpdateProfile(ctx context.Context, profile *Profile) error
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) Get(ctx context.Context, userID string) (Preferences, error) {
+	p, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return Preferences{UserID: userID, AngleMode: numeric.AngleRadians}, nil
+	}
+	return p, err
+}
+
+func (s *service) Update(ctx context.Context, prefs *Preferences) error {
+	if err := prefs.NumberFormat.Validate(); err != nil {
+		return err
+	}
+	if err := prefs.AngleMode.Validate(); err != nil {
+		return err
+	}
+	prefs.AngleMode = prefs.AngleMode.OrDefault()
+	return s.repo.Upsert(ctx, prefs)
+}
+
+func (s *service) GetProfile(ctx context.Context, userID string) (Profile, error) {
+	p, err := s.repo.GetProfile(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return Profile{UserID: userID, TimeZone: DefaultTimeZone, Locale: DefaultLocale}, nil
+	}
+	return p, err
+}
+
+func (s *service) UpdateProfile(ctx context.Context, profile *Profile) error {
+	name := strings.TrimSpace(profile.DisplayName)
+	if utf8.RuneCountInString(name) > maxDisplayNameLen || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return ErrInvalidDisplayName
+	}
+	profile.DisplayName = name
+
+	if profile.TimeZone == "" {
+		profile.TimeZone = DefaultTimeZone
+	}
+	// "Local" would mean the server's zone, not the user's.
+	if _, err := time.LoadLocation(profile.TimeZone); err != nil || profile.TimeZone == "Local" {
+		return ErrInvalidTimeZone
+	}
+
+	if profile.Locale == "" {
+		profile.Locale = DefaultLocale
+	}
+	profile.Locale = strings.ReplaceAll(profile.Locale, "_", "-")
+	if !localeTag.MatchString(profile.Locale) {
+		return ErrInvalidLocale
+	}
+
+	if err := profile.NumberFormat.Validate(); err != nil {
+		return err
+	}
+	return s.repo.UpsertProfile(ctx, profile)
+}
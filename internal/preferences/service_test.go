@@ -0,0 +1,225 @@
+package preferences
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/auth"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/numeric"
+)
+
+//
+// Test fakes
+//
+
+// fakeRepository implements Repository in memory. Like the Postgres
+// repository, saving a profile keeps the stored angle mode.
+type fakeRepository struct {
+	prefs    map[string]Preferences
+	profiles map[string]Profile
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{prefs: map[string]Preferences{}, profiles: map[string]Profile{}}
+}
+
+func (f *fakeRepository) Get(ctx context.Context, userID string) (Preferences, error) {
+	p, ok := f.prefs[userID]
+	if !ok {
+		return Preferences{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (f *fakeRepository) Upsert(ctx context.Context, prefs *Preferences) error {
+	f.prefs[prefs.UserID] = *prefs
+	return nil
+}
+
+func (f *fakeRepository) GetProfile(ctx context.Context, userID string) (Profile, error) {
+	p, ok := f.profiles[userID]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (f *fakeRepository) UpsertProfile(ctx context.Context, profile *Profile) error {
+	f.profiles[profile.UserID] = *profile
+	return nil
+}
+
+func intPtr(v int) *int { return &v }
+
+// put sends body to the handler as a PUT from user-123 and returns the
+// recorded response.
+func put(t *testing.T, handler http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req = req.WithContext(auth.ContextWithUser(req.Context(), "user-123", "user@example.com"))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+//
+// Tests
+//
+
+// Test Update validates the number format and angle mode before saving,
+// and stores the default angle mode when none is given.
+func TestUpdate_Validates(t *testing.T) {
+	repo := newFakeRepository()
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	err := svc.Update(ctx, &Preferences{UserID: "user-123", NumberFormat: numeric.NumberFormat{Decimals: intPtr(40)}})
+	assert.ErrorIs(t, err, numeric.ErrInvalidFormat)
+	err = svc.Update(ctx, &Preferences{UserID: "user-123", NumberFormat: numeric.NumberFormat{Locale: "xx"}})
+	assert.ErrorIs(t, err, numeric.ErrInvalidFormat)
+	err = svc.Update(ctx, &Preferences{UserID: "user-123", AngleMode: "turns"})
+	assert.ErrorIs(t, err, numeric.ErrInvalidAngleMode)
+	assert.Empty(t, repo.prefs)
+
+	require.NoError(t, svc.Update(ctx, &Preferences{UserID: "user-123"}))
+	assert.Equal(t, numeric.AngleRadians, repo.prefs["user-123"].AngleMode)
+}
+
+// Test PUT /api/v1/preferences changes only the sections in the body.
+func TestPreferencesHandler_PutKeepsOmittedSections(t *testing.T) {
+	repo := newFakeRepository()
+	repo.prefs["user-123"] = Preferences{
+		UserID:       "user-123",
+		NumberFormat: numeric.NumberFormat{Notation: numeric.NotationFixed, Decimals: intPtr(2)},
+		AngleMode:    numeric.AngleDegrees,
+	}
+	h := NewHandler(NewService(repo))
+
+	rec := put(t, h.Preferences, "/api/v1/preferences", `{"angleMode": "grad"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, numeric.AngleGradians, repo.prefs["user-123"].AngleMode)
+	assert.Equal(t, numeric.NotationFixed, repo.prefs["user-123"].NumberFormat.Notation)
+
+	rec = put(t, h.Preferences, "/api/v1/preferences", `{"numberFormat": {"notation": "scientific"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, numeric.AngleGradians, repo.prefs["user-123"].AngleMode)
+	assert.Equal(t, numeric.NotationScientific, repo.prefs["user-123"].NumberFormat.Notation)
+
+	rec = put(t, h.Preferences, "/api/v1/preferences", `{"numberFormat": {"rounding": "bankers"}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, numeric.NotationScientific, repo.prefs["user-123"].NumberFormat.Notation)
+}
+
+// Test UpdateProfile counts the display name in characters and refuses
+// control characters.
+func TestUpdateProfile_DisplayName(t *testing.T) {
+	repo := newFakeRepository()
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	// 64 two-byte characters fit, although they are 128 bytes.
+	name := strings.Repeat("é", maxDisplayNameLen)
+	p := &Profile{UserID: "user-123", DisplayName: "  " + name + " "}
+	require.NoError(t, svc.UpdateProfile(ctx, p))
+	assert.Equal(t, name, repo.profiles["user-123"].DisplayName)
+
+	err := svc.UpdateProfile(ctx, &Profile{UserID: "user-123", DisplayName: name + "é"})
+	assert.ErrorIs(t, err, ErrInvalidDisplayName)
+	err = svc.UpdateProfile(ctx, &Profile{UserID: "user-123", DisplayName: "Ada\nLovelace"})
+	assert.ErrorIs(t, err, ErrInvalidDisplayName)
+	assert.Equal(t, name, repo.profiles["user-123"].DisplayName)
+}
+
+// Test an empty time zone defaults to UTC, and "Local" is not accepted
+// as a zone.
+func TestUpdateProfile_TimeZone(t *testing.T) {
+	repo := newFakeRepository()
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	p := &Profile{UserID: "user-123"}
+	require.NoError(t, svc.UpdateProfile(ctx, p))
+	assert.Equal(t, DefaultTimeZone, p.TimeZone)
+
+	p = &Profile{UserID: "user-123", TimeZone: "Europe/Berlin"}
+	require.NoError(t, svc.UpdateProfile(ctx, p))
+	assert.Equal(t, "Europe/Berlin", repo.profiles["user-123"].TimeZone)
+
+	for _, zone := range []string{"Local", "Mars/Olympus_Mons"} {
+		err := svc.UpdateProfile(ctx, &Profile{UserID: "user-123", TimeZone: zone})
+		assert.ErrorIs(t, err, ErrInvalidTimeZone, zone)
+	}
+}
+
+// Test locales are normalised to language tags and malformed ones are
+// rejected.
+func TestUpdateProfile_Locale(t *testing.T) {
+	svc := NewService(newFakeRepository())
+	ctx := context.Background()
+
+	p := &Profile{UserID: "user-123"}
+	require.NoError(t, svc.UpdateProfile(ctx, p))
+	assert.Equal(t, DefaultLocale, p.Locale)
+
+	p = &Profile{UserID: "user-123", Locale: "de_CH"}
+	require.NoError(t, svc.UpdateProfile(ctx, p))
+	assert.Equal(t, "de-CH", p.Locale)
+
+	for _, locale := range []string{"d", "german", "de-", "de CH"} {
+		err := svc.UpdateProfile(ctx, &Profile{UserID: "user-123", Locale: locale})
+		assert.ErrorIs(t, err, ErrInvalidLocale, locale)
+	}
+}
+
+// Test the profile's number format is validated like the preferences'.
+func TestUpdateProfile_Format(t *testing.T) {
+	repo := newFakeRepository()
+	svc := NewService(repo)
+
+	err := svc.UpdateProfile(context.Background(), &Profile{
+		UserID:       "user-123",
+		NumberFormat: numeric.NumberFormat{Notation: "roman"},
+	})
+	assert.ErrorIs(t, err, numeric.ErrInvalidFormat)
+	assert.Empty(t, repo.profiles)
+}
+
+// Test PUT /api/v1/profile changes only the fields in the body.
+func TestProfileHandler_PutKeepsOmittedFields(t *testing.T) {
+	repo := newFakeRepository()
+	repo.profiles["user-123"] = Profile{
+		UserID:       "user-123",
+		DisplayName:  "Ada",
+		TimeZone:     "Europe/London",
+		Locale:       "en-GB",
+		NumberFormat: numeric.NumberFormat{Notation: numeric.NotationEngineering},
+	}
+	h := NewHandler(NewService(repo))
+
+	rec := put(t, h.Profile, "/api/v1/profile", `{"timeZone": "Europe/Berlin"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, Profile{
+		UserID:       "user-123",
+		DisplayName:  "Ada",
+		TimeZone:     "Europe/Berlin",
+		Locale:       "en-GB",
+		NumberFormat: numeric.NumberFormat{Notation: numeric.NotationEngineering},
+	}, repo.profiles["user-123"])
+
+	rec = put(t, h.Profile, "/api/v1/profile", `{"displayName": "Ada Lovelace", "locale": "de_CH"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "Ada Lovelace", repo.profiles["user-123"].DisplayName)
+	assert.Equal(t, "de-CH", repo.profiles["user-123"].Locale)
+	assert.Equal(t, "Europe/Berlin", repo.profiles["user-123"].TimeZone)
+	assert.Equal(t, numeric.NotationEngineering, repo.profiles["user-123"].NumberFormat.Notation)
+
+	rec = put(t, h.Profile, "/api/v1/profile", `{"timeZone": "Local"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "Europe/Berlin", repo.profiles["user-123"].TimeZone)
+}
@@ -0,0 +1,43 @@
+// internal/probability/combinatorics.go
+package probability
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// maxCombinatoricsN bounds n so a request stays cheap; 100000! already has
+// about 456000 digits.
+const maxCombinatoricsN = 100_000
+
+func checkNK(n, k int64) error {
+	if n < 0 || k < 0 {
+		return fmt.Errorf("%w: n and k must be non-negative", ErrInvalidArgument)
+	}
+	if k > n {
+		return fmt.Errorf("%w: k must not exceed n", ErrInvalidArgument)
+	}
+	if n > maxCombinatoricsN {
+		return fmt.Errorf("%w: n must be at most %d", ErrInvalidArgument, maxCombinatoricsN)
+	}
+	return nil
+}
+
+// combinations returns n choose k.
+func combinations(n, k int64) (*big.Int, error) {
+	if err := checkNK(n, k); err != nil {
+		return nil, err
+	}
+	return new(big.Int).Binomial(n, k), nil
+}
+
+// permutations returns n! / (n-k)!.
+func permutations(n, k int64) (*big.Int, error) {
+	if err := checkNK(n, k); err != nil {
+		return nil, err
+	}
+	if k == 0 {
+		return big.NewInt(1), nil
+	}
+	return new(big.Int).MulRange(n-k+1, n), nil
+}
@@ -0,0 +1,114 @@
+// internal/probability/dice.go
+package probability
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxDice      = 1000
+	maxDiceSides = 1_000_000
+	// maxDiceModifier bounds the constant terms together, so with the
+	// dice themselves (at most 10^9) a roll always fits in an int64.
+	maxDiceModifier = 1_000_000_000
+)
+
+// diceTerm is one "NdM" group or a constant modifier of a dice expression.
+type diceTerm struct {
+	sign  int64
+	count int64 // 0 for a constant modifier
+	sides int64 // or the modifier value
+}
+
+// parseDice parses notation such as "3d6+2", "d20", "2d8 - 1d4 + 3".
+func parseDice(notation string) ([]diceTerm, error) {
+	s := strings.ToLower(strings.ReplaceAll(notation, " ", ""))
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty dice notation", ErrInvalidDice)
+	}
+
+	var (
+		terms     []diceTerm
+		total     int64
+		modifiers int64
+	)
+	for s != "" {
+		sign := int64(1)
+		switch {
+		case s[0] == '+':
+			s = s[1:]
+		case s[0] == '-':
+			sign = -1
+			s = s[1:]
+		case len(terms) > 0:
+			return nil, fmt.Errorf("%w: expected '+' or '-' in %q", ErrInvalidDice, notation)
+		}
+
+		end := strings.IndexAny(s, "+-")
+		if end < 0 {
+			end = len(s)
+		}
+		part := s[:end]
+		s = s[end:]
+
+		countStr, sidesStr, isDice := strings.Cut(part, "d")
+		if !isDice {
+			v, err := strconv.ParseInt(part, 10, 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("%w: invalid modifier %q", ErrInvalidDice, part)
+			}
+			modifiers += v
+			if v > maxDiceModifier || modifiers > maxDiceModifier {
+				return nil, fmt.Errorf("%w: modifiers may add up to at most %d", ErrInvalidDice, maxDiceModifier)
+			}
+			terms = append(terms, diceTerm{sign: sign, sides: v})
+			continue
+		}
+
+		count := int64(1)
+		if countStr != "" {
+			v, err := strconv.ParseInt(countStr, 10, 64)
+			if err != nil || v < 1 {
+				return nil, fmt.Errorf("%w: invalid dice count %q", ErrInvalidDice, countStr)
+			}
+			count = v
+		}
+		sides, err := strconv.ParseInt(sidesStr, 10, 64)
+		if err != nil || sides < 1 || sides > maxDiceSides {
+			return nil, fmt.Errorf("%w: dice must have between 1 and %d sides", ErrInvalidDice, maxDiceSides)
+		}
+
+		total += count
+		if total > maxDice {
+			return nil, fmt.Errorf("%w: at most %d dice per roll", ErrInvalidDice, maxDice)
+		}
+		terms = append(terms, diceTerm{sign: sign, count: count, sides: sides})
+	}
+	return terms, nil
+}
+
+func (t diceTerm) String() string {
+	if t.count == 0 {
+		return strconv.FormatInt(t.sides, 10)
+	}
+	return fmt.Sprintf("%dd%d", t.count, t.sides)
+}
+
+// canonicalDice renders terms back as "3d6 + 2".
+func canonicalDice(terms []diceTerm) string {
+	var b strings.Builder
+	for i, t := range terms {
+		switch {
+		case i == 0 && t.sign < 0:
+			b.WriteString("-")
+		case i > 0 && t.sign < 0:
+			b.WriteString(" - ")
+		case i > 0:
+			b.WriteString(" + ")
+		}
+		b.WriteString(t.String())
+	}
+	return b.String()
+}
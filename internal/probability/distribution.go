@@ -0,0 +1,162 @@
+// internal/probability/distribution.go
+package probability
+
+import (
+	"fmt"
+	"math"
+)
+
+// pdf returns the density (or mass, for discrete distributions) at x.
+func pdf(req DistributionRequest) (float64, error) {
+	x := req.X
+	switch req.Distribution {
+	case DistNormal:
+		z := (x - req.Mean) / req.StdDev
+		return math.Exp(-z*z/2) / (req.StdDev * math.Sqrt(2*math.Pi)), nil
+	case DistUniform:
+		if x < req.Min || x > req.Max {
+			return 0, nil
+		}
+		return 1 / (req.Max - req.Min), nil
+	case DistExponential:
+		if x < 0 {
+			return 0, nil
+		}
+		return req.Rate * math.Exp(-req.Rate*x), nil
+	case DistBinomial:
+		k, ok := asCount(x)
+		if !ok || k > req.N {
+			return 0, nil
+		}
+		// degenerate cases would otherwise hit 0 * log(0)
+		if req.P == 0 || req.P == 1 {
+			if (req.P == 0 && k == 0) || (req.P == 1 && k == req.N) {
+				return 1, nil
+			}
+			return 0, nil
+		}
+		return math.Exp(logBinomial(req.N, k) + float64(k)*math.Log(req.P) + float64(req.N-k)*math.Log1p(-req.P)), nil
+	case DistPoisson:
+		k, ok := asCount(x)
+		if !ok {
+			return 0, nil
+		}
+		lg, _ := math.Lgamma(float64(k) + 1)
+		return math.Exp(float64(k)*math.Log(req.Lambda) - req.Lambda - lg), nil
+	default:
+		return 0, fmt.Errorf("%w: unknown distribution %q", ErrInvalidArgument, req.Distribution)
+	}
+}
+
+// cdf returns P(X <= x).
+func cdf(req DistributionRequest) (float64, error) {
+	x := req.X
+	switch req.Distribution {
+	case DistNormal:
+		return 0.5 * math.Erfc(-(x-req.Mean)/(req.StdDev*math.Sqrt2)), nil
+	case DistUniform:
+		switch {
+		case x < req.Min:
+			return 0, nil
+		case x > req.Max:
+			return 1, nil
+		default:
+			return (x - req.Min) / (req.Max - req.Min), nil
+		}
+	case DistExponential:
+		if x < 0 {
+			return 0, nil
+		}
+		return -math.Expm1(-req.Rate * x), nil
+	case DistBinomial, DistPoisson:
+		if x < 0 {
+			return 0, nil
+		}
+		upper := int64(math.Floor(x))
+		if req.Distribution == DistBinomial && upper >= req.N {
+			return 1, nil
+		}
+		if upper > maxDiscreteTerms {
+			return 0, fmt.Errorf("%w: x must be at most %d for discrete CDFs", ErrInvalidArgument, maxDiscreteTerms)
+		}
+		var sum float64
+		for k := int64(0); k <= upper; k++ {
+			term := req
+			term.X = float64(k)
+			p, err := pdf(term)
+			if err != nil {
+				return 0, err
+			}
+			sum += p
+		}
+		return math.Min(sum, 1), nil
+	default:
+		return 0, fmt.Errorf("%w: unknown distribution %q", ErrInvalidArgument, req.Distribution)
+	}
+}
+
+// maxDiscreteTerms bounds the summation in discrete CDFs.
+const maxDiscreteTerms = 1_000_000
+
+// validateDistribution checks the parameters needed by the distribution.
+func validateDistribution(req DistributionRequest) error {
+	switch req.Distribution {
+	case DistNormal:
+		if req.StdDev <= 0 {
+			return fmt.Errorf("%w: stdDev must be positive", ErrInvalidArgument)
+		}
+	case DistUniform:
+		if req.Max <= req.Min {
+			return fmt.Errorf("%w: max must be greater than min", ErrInvalidArgument)
+		}
+	case DistExponential:
+		if req.Rate <= 0 {
+			return fmt.Errorf("%w: rate must be positive", ErrInvalidArgument)
+		}
+	case DistBinomial:
+		if req.N < 0 || req.N > maxDiscreteTerms || req.P < 0 || req.P > 1 {
+			return fmt.Errorf("%w: binomial needs 0 <= n <= %d and 0 <= p <= 1", ErrInvalidArgument, maxDiscreteTerms)
+		}
+	case DistPoisson:
+		if req.Lambda <= 0 {
+			return fmt.Errorf("%w: lambda must be positive", ErrInvalidArgument)
+		}
+	default:
+		return fmt.Errorf("%w: unknown distribution %q", ErrInvalidArgument, req.Distribution)
+	}
+	return nil
+}
+
+// describeDistribution renders the distribution and its parameters.
+func describeDistribution(req DistributionRequest) string {
+	switch req.Distribution {
+	case DistNormal:
+		return fmt.Sprintf("normal(mean=%g, stdDev=%g)", req.Mean, req.StdDev)
+	case DistUniform:
+		return fmt.Sprintf("uniform(min=%g, max=%g)", req.Min, req.Max)
+	case DistExponential:
+		return fmt.Sprintf("exponential(rate=%g)", req.Rate)
+	case DistBinomial:
+		return fmt.Sprintf("binomial(n=%d, p=%g)", req.N, req.P)
+	case DistPoisson:
+		return fmt.Sprintf("poisson(lambda=%g)", req.Lambda)
+	default:
+		return string(req.Distribution)
+	}
+}
+
+// asCount converts x to a non-negative integer if it is one.
+func asCount(x float64) (int64, bool) {
+	if x < 0 || x != math.Trunc(x) || x > math.MaxInt32 {
+		return 0, false
+	}
+	return int64(x), true
+}
+
+// logBinomial returns ln(n choose k).
+func logBinomial(n, k int64) float64 {
+	a, _ := math.Lgamma(float64(n) + 1)
+	b, _ := math.Lgamma(float64(k) + 1)
+	c, _ := math.Lgamma(float64(n-k) + 1)
+	return a - b - c
+}
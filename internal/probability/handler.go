@@ -0,0 +1,35 @@
+// internal/probability/handler.go
+package probability
+
+import (
+	"net/http"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/jsonapi"
+)
+
+// clientErrors are the service errors answered with 400.
+var clientErrors = []error{ErrInvalidArgument, ErrInvalidDice}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+// Random handles POST /api/v1/probability/random.
+func (h *Handler) Random(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.Random, clientErrors...)
+}
+
+// Dice handles POST /api/v1/probability/dice.
+func (h *Handler) Dice(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.RollDice, clientErrors...)
+}
+
+// Combinatorics handles POST /api/v1/probability/combinatorics.
+func (h *Handler) Combinatorics(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.Combinatorics, clientErrors...)
+}
+
+// Distribution handles POST /api/v1/probability/distribution.
+func (h *Handler) Distribution(w http.ResponseWriter, r *http.Request) {
+	jsonapi.Serve(w, r, h.svc.Distribution, clientErrors...)
+}
@@ -0,0 +1,111 @@
+// internal/probability/model.go
+package probability
+
+// Distribution names accepted by the random and distribution endpoints.
+type Distribution string
+
+const (
+	DistUniform     Distribution = "uniform"
+	DistNormal      Distribution = "normal"
+	DistInteger     Distribution = "integer" // random draws only
+	DistExponential Distribution = "exponential"
+	DistBinomial    Distribution = "binomial"
+	DistPoisson     Distribution = "poisson"
+)
+
+// RandomRequest draws Count values (default 1). Uniform uses [Min, Max),
+// integer uses [Min, Max] inclusive, normal uses Mean and StdDev.
+// When Seed is omitted a fresh one is generated and returned.
+type RandomRequest struct {
+	Distribution Distribution `json:"distribution"`
+	Min          float64      `json:"min"`
+	Max          float64      `json:"max"`
+	Mean         float64      `json:"mean"`
+	StdDev       float64      `json:"stdDev"`
+	Count        int          `json:"count"`
+	Seed         *uint64      `json:"seed,omitempty"`
+}
+
+// RandomResult holds the drawn values; Result is their sum.
+type RandomResult struct {
+	Expression string    `json:"expression"`
+	Values     []float64 `json:"values"`
+	Result     float64   `json:"result"`
+	Seed       uint64    `json:"seed"`
+}
+
+// DiceRequest rolls dice notation such as "3d6+2".
+type DiceRequest struct {
+	Notation string  `json:"notation"`
+	Seed     *uint64 `json:"seed,omitempty"`
+}
+
+// DiceRoll is the outcome of one "NdM" group.
+type DiceRoll struct {
+	Dice   string  `json:"dice"`
+	Sign   int64   `json:"sign"`
+	Values []int64 `json:"values"`
+}
+
+type DiceResult struct {
+	Expression string     `json:"expression"`
+	Rolls      []DiceRoll `json:"rolls"`
+	Modifier   int64      `json:"modifier"`
+	Result     int64      `json:"result"`
+	Seed       uint64     `json:"seed"`
+}
+
+// CombinatoricsKind selects between nCr and nPr.
+type CombinatoricsKind string
+
+const (
+	KindCombinations CombinatoricsKind = "nCr"
+	KindPermutations CombinatoricsKind = "nPr"
+)
+
+type CombinatoricsRequest struct {
+	Kind CombinatoricsKind `json:"kind"`
+	N    int64             `json:"n"`
+	K    int64             `json:"k"`
+}
+
+// CombinatoricsResult carries the exact value as a decimal string.
+type CombinatoricsResult struct {
+	Expression string `json:"expression"`
+	Result     string `json:"result"`
+}
+
+// DistributionFunction selects PDF (PMF for discrete distributions) or CDF.
+type DistributionFunction string
+
+const (
+	FuncPDF DistributionFunction = "pdf"
+	FuncCDF DistributionFunction = "cdf"
+)
+
+// DistributionRequest evaluates a PDF/CDF at X. Only the parameters of the
+// chosen distribution are used: normal (Mean, StdDev), uniform (Min, Max),
+// exponential (Rate), binomial (N, P), poisson (Lambda).
+type DistributionRequest struct {
+	Distribution Distribution         `json:"distribution"`
+	Function     DistributionFunction `json:"function"`
+	X            float64              `json:"x"`
+	Mean         float64              `json:"mean"`
+	StdDev       float64              `json:"stdDev"`
+	Min          float64              `json:"min"`
+	Max          float64              `json:"max"`
+	Rate         float64              `json:"rate"`
+	N            int64                `json:"n"`
+	P            float64              `json:"p"`
+	Lambda       float64              `json:"lambda"`
+}
+
+type DistributionResult struct {
+	Expression string  `json:"expression"`
+	Result     float64 `json:"result"`
+}
+
+// Handler wires HTTP requests to the probability Service.
+type Handler struct {
+	svc Service
+}
@@ -0,0 +1,68 @@
+// internal/probability/rng.go
+package probability
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+)
+
+// maxSeed keeps generated seeds within the integer range JSON clients
+// (JavaScript in particular) can represent exactly.
+const maxSeed = 1<<53 - 1
+
+// rng is a seeded generator. Only the raw PCG stream is taken from the
+// standard library; uniform, integer and normal draws are derived here so
+// a stored seed replays the same values regardless of Go version.
+type rng struct {
+	src *rand.PCG
+}
+
+func newRNG(seed uint64) *rng {
+	return &rng{src: rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)}
+}
+
+// newSeed returns a fresh random seed.
+func newSeed() uint64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return binary.LittleEndian.Uint64(b[:]) & maxSeed
+}
+
+// float64 returns a uniform value in [0, 1).
+func (r *rng) float64() float64 {
+	return float64(r.src.Uint64()>>11) / (1 << 53)
+}
+
+// uniform returns a value in [min, max).
+func (r *rng) uniform(min, max float64) float64 {
+	return min + (max-min)*r.float64()
+}
+
+// intRange returns an integer in [min, max] without modulo bias.
+func (r *rng) intRange(min, max int64) int64 {
+	span := uint64(max-min) + 1
+	if span == 0 {
+		// full 64-bit range
+		return int64(r.src.Uint64())
+	}
+	limit := math.MaxUint64 - math.MaxUint64%span
+	for {
+		v := r.src.Uint64()
+		if v < limit {
+			return min + int64(v%span)
+		}
+	}
+}
+
+// normal returns a draw from N(mean, stddev²) using the Box–Muller transform.
+func (r *rng) normal(mean, stddev float64) float64 {
+	u1 := 1 - r.float64() // (0, 1], keeps log finite
+	u2 := r.float64()
+	z := math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+	return mean + stddev*z
+}
@@ -0,0 +1,204 @@
+// internal/probability/service.go
+package probability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/jsonapi"
+)
+
+var (
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrInvalidDice     = errors.New("invalid dice notation")
+)
+
+// maxDraws bounds the number of values a single random request may return.
+const maxDraws = 1000
+
+type Service interface {
+	Random(ctx context.Context, userID string, req RandomRequest) (RandomResult, error)
+	RollDice(ctx context.Context, userID string, req DiceRequest) (DiceResult, error)
+	Combinatorics(ctx context.Context, userID string, req CombinatoricsRequest) (CombinatoricsResult, error)
+	Distribution(ctx context.Context, userID string, req DistributionRequest) (DistributionResult, error)
+}
+
+type service struct {
+	historySvc history.Service
+}
+
+func NewService(historySvc history.Service) Service {
+	return &service{historySvc: historySvc}
+}
+
+// seedOf returns the requested seed or a freshly generated one.
+func seedOf(seed *uint64) uint64 {
+	if seed != nil {
+		return *seed
+	}
+	return newSeed()
+}
+
+func (s *service) Random(ctx context.Context, userID string, req RandomRequest) (RandomResult, error) {
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > maxDraws {
+		return RandomResult{}, fmt.Errorf("%w: count must be between 1 and %d", ErrInvalidArgument, maxDraws)
+	}
+
+	var (
+		draw func(r *rng) float64
+		desc string
+	)
+	switch req.Distribution {
+	case DistUniform:
+		if req.Max <= req.Min {
+			return RandomResult{}, fmt.Errorf("%w: max must be greater than min", ErrInvalidArgument)
+		}
+		if math.IsInf(req.Max-req.Min, 0) {
+			return RandomResult{}, fmt.Errorf("%w: min and max are too far apart", ErrInvalidArgument)
+		}
+		draw = func(r *rng) float64 { return r.uniform(req.Min, req.Max) }
+		desc = fmt.Sprintf("uniform(%g, %g)", req.Min, req.Max)
+	case DistInteger:
+		lo, hi := req.Min, req.Max
+		if lo != math.Trunc(lo) || hi != math.Trunc(hi) || hi < lo ||
+			math.Abs(lo) > 1<<53 || math.Abs(hi) > 1<<53 {
+			return RandomResult{}, fmt.Errorf("%w: integer draws need whole numbers min <= max within ±2^53", ErrInvalidArgument)
+		}
+		draw = func(r *rng) float64 { return float64(r.intRange(int64(lo), int64(hi))) }
+		desc = fmt.Sprintf("integer(%g..%g)", lo, hi)
+	case DistNormal:
+		if req.StdDev <= 0 {
+			return RandomResult{}, fmt.Errorf("%w: stdDev must be positive", ErrInvalidArgument)
+		}
+		draw = func(r *rng) float64 { return r.normal(req.Mean, req.StdDev) }
+		desc = fmt.Sprintf("normal(%g, %g)", req.Mean, req.StdDev)
+	default:
+		return RandomResult{}, fmt.Errorf("%w: unknown distribution %q", ErrInvalidArgument, req.Distribution)
+	}
+
+	seed := seedOf(req.Seed)
+	r := newRNG(seed)
+
+	res := RandomResult{Values: make([]float64, count), Seed: seed}
+	for i := range res.Values {
+		res.Values[i] = draw(r)
+		res.Result += res.Values[i]
+	}
+	if err := jsonapi.CheckFinite(res.Result); err != nil {
+		return RandomResult{}, err
+	}
+	res.Expression = desc
+	if count > 1 {
+		res.Expression = fmt.Sprintf("sum of %d × %s", count, desc)
+	}
+
+	err := jsonapi.Record(ctx, s.historySvc, userID, res.Expression, res.Result, map[string]any{
+		"tool":   "random",
+		"seed":   seed,
+		"values": res.Values,
+	})
+	return res, err
+}
+
+func (s *service) RollDice(ctx context.Context, userID string, req DiceRequest) (DiceResult, error) {
+	terms, err := parseDice(req.Notation)
+	if err != nil {
+		return DiceResult{}, err
+	}
+
+	seed := seedOf(req.Seed)
+	r := newRNG(seed)
+
+	res := DiceResult{Seed: seed}
+	for _, t := range terms {
+		if t.count == 0 {
+			res.Modifier += t.sign * t.sides
+			continue
+		}
+		roll := DiceRoll{Dice: t.String(), Sign: t.sign, Values: make([]int64, t.count)}
+		for i := range roll.Values {
+			roll.Values[i] = r.intRange(1, t.sides)
+			res.Result += t.sign * roll.Values[i]
+		}
+		res.Rolls = append(res.Rolls, roll)
+	}
+	res.Result += res.Modifier
+	res.Expression = canonicalDice(terms)
+
+	err = jsonapi.Record(ctx, s.historySvc, userID, res.Expression, float64(res.Result), map[string]any{
+		"tool":  "dice",
+		"seed":  seed,
+		"rolls": res.Rolls,
+	})
+	return res, err
+}
+
+func (s *service) Combinatorics(ctx context.Context, userID string, req CombinatoricsRequest) (CombinatoricsResult, error) {
+	var (
+		v    *big.Int
+		err  error
+		expr string
+	)
+	switch req.Kind {
+	case KindCombinations:
+		v, err = combinations(req.N, req.K)
+		expr = fmt.Sprintf("C(%d, %d)", req.N, req.K)
+	case KindPermutations:
+		v, err = permutations(req.N, req.K)
+		expr = fmt.Sprintf("P(%d, %d)", req.N, req.K)
+	default:
+		return CombinatoricsResult{}, fmt.Errorf("%w: kind must be %q or %q", ErrInvalidArgument, KindCombinations, KindPermutations)
+	}
+	if err != nil {
+		return CombinatoricsResult{}, err
+	}
+
+	res := CombinatoricsResult{Expression: expr, Result: v.String()}
+	err = s.historySvc.Record(ctx, &history.HistoryEntry{
+		UserID:      userID,
+		Expression:  expr,
+		ExactResult: res.Result,
+		Metadata:    map[string]any{"tool": "combinatorics"},
+	})
+	return res, err
+}
+
+func (s *service) Distribution(ctx context.Context, userID string, req DistributionRequest) (DistributionResult, error) {
+	if err := validateDistribution(req); err != nil {
+		return DistributionResult{}, err
+	}
+
+	var (
+		v   float64
+		err error
+	)
+	switch req.Function {
+	case FuncPDF:
+		v, err = pdf(req)
+	case FuncCDF:
+		v, err = cdf(req)
+	default:
+		return DistributionResult{}, fmt.Errorf("%w: function must be %q or %q", ErrInvalidArgument, FuncPDF, FuncCDF)
+	}
+	if err != nil {
+		return DistributionResult{}, err
+	}
+	if err := jsonapi.CheckFinite(v); err != nil {
+		return DistributionResult{}, err
+	}
+
+	res := DistributionResult{
+		Expression: fmt.Sprintf("%s.%s(%g)", describeDistribution(req), req.Function, req.X),
+		Result:     v,
+	}
+	err = jsonapi.Record(ctx, s.historySvc, userID, res.Expression, v, map[string]any{"tool": "distribution"})
+	return res, err
+}
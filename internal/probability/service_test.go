@@ -0,0 +1,167 @@
+package probability
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/whiterabbit0809/overengineered-calculator/internal/history"
+	"github.com/whiterabbit0809/overengineered-calculator/internal/jsonapi"
+)
+
+//
+// Test fakes
+//
+
+// fakeHistoryService records entries so tests can inspect them.
+type fakeHistoryService struct {
+	recordedEntries []*history.HistoryEntry
+}
+
+func (f *fakeHistoryService) GetLatestResult(ctx context.Context, userID string) (float64, error) {
+	return 0, nil
+}
+
+func (f *fakeHistoryService) Record(ctx context.Context, entry *history.HistoryEntry) error {
+	f.recordedEntries = append(f.recordedEntries, entry)
+	return nil
+}
+
+func (f *fakeHistoryService) List(ctx context.Context, userID string, limit, offset int) ([]history.HistoryEntry, error) {
+	return nil, nil
+}
+
+func seed(v uint64) *uint64 { return &v }
+
+//
+// Tests
+//
+
+// The same seed must replay the same draws, and the seed is stored.
+func TestRandom_SeedIsReproducible(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := NewService(fh)
+
+	req := RandomRequest{Distribution: DistNormal, Mean: 10, StdDev: 2, Count: 5, Seed: seed(42)}
+	a, err := svc.Random(context.Background(), "user-123", req)
+	require.NoError(t, err)
+	b, err := svc.Random(context.Background(), "user-123", req)
+	require.NoError(t, err)
+
+	assert.Equal(t, a.Values, b.Values)
+	assert.Equal(t, uint64(42), a.Seed)
+	require.Len(t, fh.recordedEntries, 2)
+	assert.Equal(t, uint64(42), fh.recordedEntries[0].Metadata["seed"])
+}
+
+// Without a seed one is generated, returned, and replays the draw.
+func TestRandom_GeneratedSeedReplays(t *testing.T) {
+	svc := NewService(&fakeHistoryService{})
+
+	first, err := svc.Random(context.Background(), "user-123", RandomRequest{Distribution: DistInteger, Min: 1, Max: 100, Count: 3})
+	require.NoError(t, err)
+	for _, v := range first.Values {
+		assert.True(t, v >= 1 && v <= 100 && v == math.Trunc(v))
+	}
+
+	replay, err := svc.Random(context.Background(), "user-123", RandomRequest{Distribution: DistInteger, Min: 1, Max: 100, Count: 3, Seed: seed(first.Seed)})
+	require.NoError(t, err)
+	assert.Equal(t, first.Values, replay.Values)
+}
+
+func TestRandom_InvalidArguments(t *testing.T) {
+	svc := NewService(&fakeHistoryService{})
+
+	for _, req := range []RandomRequest{
+		{Distribution: DistUniform, Min: 1, Max: 1},
+		{Distribution: DistNormal, StdDev: 0},
+		{Distribution: DistInteger, Min: 1.5, Max: 3},
+		{Distribution: "cauchy"},
+		{Distribution: DistUniform, Max: 1, Count: maxDraws + 1},
+		{Distribution: DistUniform, Min: -math.MaxFloat64, Max: math.MaxFloat64},
+	} {
+		_, err := svc.Random(context.Background(), "user-123", req)
+		assert.ErrorIs(t, err, ErrInvalidArgument, req)
+	}
+
+	// A sum beyond float64 is refused rather than stored.
+	_, err := svc.Random(context.Background(), "user-123", RandomRequest{Distribution: DistNormal, Mean: math.MaxFloat64, StdDev: 1, Count: 2})
+	assert.ErrorIs(t, err, jsonapi.ErrNotFinite)
+}
+
+func TestRollDice(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := NewService(fh)
+
+	res, err := svc.RollDice(context.Background(), "user-123", DiceRequest{Notation: "3d6+2", Seed: seed(7)})
+	require.NoError(t, err)
+
+	assert.Equal(t, "3d6 + 2", res.Expression)
+	require.Len(t, res.Rolls, 1)
+	require.Len(t, res.Rolls[0].Values, 3)
+	sum := int64(2)
+	for _, v := range res.Rolls[0].Values {
+		assert.True(t, v >= 1 && v <= 6)
+		sum += v
+	}
+	assert.Equal(t, sum, res.Result)
+	assert.Equal(t, float64(sum), fh.recordedEntries[0].Result)
+
+	again, err := svc.RollDice(context.Background(), "user-123", DiceRequest{Notation: "3d6 + 2", Seed: seed(7)})
+	require.NoError(t, err)
+	assert.Equal(t, res.Rolls, again.Rolls)
+}
+
+func TestParseDice(t *testing.T) {
+	terms, err := parseDice("d20 - 1d4 + 3")
+	require.NoError(t, err)
+	assert.Equal(t, "1d20 - 1d4 + 3", canonicalDice(terms))
+
+	for _, bad := range []string{"", "3d", "0d6", "2d6x", "1001d6", "d0", "9223372036854775807", "d6+600000000+600000000"} {
+		_, err := parseDice(bad)
+		assert.ErrorIs(t, err, ErrInvalidDice, bad)
+	}
+}
+
+func TestCombinatorics_BigIntegers(t *testing.T) {
+	fh := &fakeHistoryService{}
+	svc := NewService(fh)
+
+	res, err := svc.Combinatorics(context.Background(), "user-123", CombinatoricsRequest{Kind: KindCombinations, N: 52, K: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "2598960", res.Result)
+
+	res, err = svc.Combinatorics(context.Background(), "user-123", CombinatoricsRequest{Kind: KindPermutations, N: 30, K: 30})
+	require.NoError(t, err)
+	assert.Equal(t, "265252859812191058636308480000000", res.Result) // 30!
+
+	_, err = svc.Combinatorics(context.Background(), "user-123", CombinatoricsRequest{Kind: KindCombinations, N: 3, K: 4})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestDistribution(t *testing.T) {
+	svc := NewService(&fakeHistoryService{})
+	ctx := context.Background()
+
+	res, err := svc.Distribution(ctx, "user-123", DistributionRequest{Distribution: DistNormal, Function: FuncCDF, X: 1.96, StdDev: 1})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.975, res.Result, 1e-3)
+
+	res, err = svc.Distribution(ctx, "user-123", DistributionRequest{Distribution: DistBinomial, Function: FuncPDF, X: 2, N: 4, P: 0.5})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.375, res.Result, 1e-12)
+
+	res, err = svc.Distribution(ctx, "user-123", DistributionRequest{Distribution: DistPoisson, Function: FuncCDF, X: 1, Lambda: 2})
+	require.NoError(t, err)
+	assert.InDelta(t, 3*math.Exp(-2), res.Result, 1e-12)
+
+	_, err = svc.Distribution(ctx, "user-123", DistributionRequest{Distribution: DistExponential, Function: FuncPDF, Rate: -1})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// A density too large for float64 is refused rather than stored.
+	_, err = svc.Distribution(ctx, "user-123", DistributionRequest{Distribution: DistNormal, Function: FuncPDF, StdDev: 1e-320})
+	assert.ErrorIs(t, err, jsonapi.ErrNotFinite)
+}
@@ -21,14 +21,310 @@ CREATE TABLE IF NOT EXISTS users (
 const createHistoryTable = `
 CREATE TABLE IF NOT EXISTS calc_history (
     id          SERIAL PRIMARY KEY,
-    user_id     UUID        NOT NULL REFERENCES users(id),
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     expression  TEXT        NOT NULL,
     result      DOUBLE PRECISION NOT NULL,
     created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+`
+const createPreferencesTable = `
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id       UUID        PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    number_format JSONB       NOT NULL DEFAULT '{}',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+`
+const addPreferencesAngleModeColumn = `
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS angle_mode TEXT NOT NULL DEFAULT 'rad';
+`
+const addHistoryMetadataColumn = `
+ALTER TABLE calc_history ADD COLUMN IF NOT EXISTS metadata JSONB;
+`
+const addHistoryExactResultColumn = `
+ALTER TABLE calc_history ADD COLUMN IF NOT EXISTS exact_result TEXT;
+ALTER TABLE calc_history ALTER COLUMN result DROP NOT NULL;
+`
+const createRefreshTokensTable = `
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id          UUID        PRIMARY KEY,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id   UUID        NOT NULL,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    rotated_at  TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+`
+const addUsersTokenVersionColumn = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
+`
+const createRevokedTokensTable = `
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti         TEXT        PRIMARY KEY,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+`
+const createSessionsTable = `
+CREATE TABLE IF NOT EXISTS sessions (
+    id           UUID        PRIMARY KEY,
+    user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent   TEXT        NOT NULL,
+    ip           TEXT        NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+`
+const createPasswordResetTokensTable = `
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id          UUID        PRIMARY KEY,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ
+);
 `
 
+// Accounts that existed before verification are treated as verified; new
+// ones start unverified.
+const addUsersEmailVerifiedColumn = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE;
+`
+const createEmailVerificationsTable = `
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id          UUID        PRIMARY KEY,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email       TEXT        NOT NULL,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    code_hash   TEXT        NOT NULL,
+    attempts    INT         NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS email_verifications_user_id_idx ON email_verifications (user_id, created_at);
+`
+const createUserMFATable = `
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id        UUID        PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret         TEXT        NOT NULL,
+    enabled        BOOLEAN     NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT      NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL,
+    confirmed_at   TIMESTAMPTZ
+);
+`
+const createMFARecoveryCodesTable = `
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  TEXT        NOT NULL,
+    used_at    TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
+`
+const createMFAChallengesTable = `
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    id          UUID        PRIMARY KEY,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    attempts    INT         NOT NULL DEFAULT 0,
+    used_at     TIMESTAMPTZ
+);
+`
+const createLoginFailuresTable = `
+CREATE TABLE IF NOT EXISTS login_failures (
+    scope           TEXT        NOT NULL,
+    key             TEXT        NOT NULL,
+    failures        INT         NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until    TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
+`
+const createLockoutEventsTable = `
+CREATE TABLE IF NOT EXISTS lockout_events (
+    id           UUID        PRIMARY KEY,
+    scope        TEXT        NOT NULL,
+    key          TEXT        NOT NULL,
+    locked_at    TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    unlocked_at  TIMESTAMPTZ,
+    unlocked_by  TEXT
+);
+CREATE INDEX IF NOT EXISTS lockout_events_key_idx ON lockout_events (scope, key, locked_at);
+`
+const addUsersRoleColumns = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+`
+const createAPIKeysTable = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           UUID        PRIMARY KEY,
+    user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT        NOT NULL,
+    prefix       TEXT        NOT NULL UNIQUE,
+    key_hash     TEXT        NOT NULL,
+    scopes       TEXT[]      NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+`
+const createOIDCStatesTable = `
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state_hash    TEXT        PRIMARY KEY,
+    provider      TEXT        NOT NULL,
+    nonce_hash    TEXT        NOT NULL,
+    code_verifier TEXT        NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS oidc_states_expires_at_idx ON oidc_states (expires_at);
+`
+const createUserIdentitiesTable = `
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider   TEXT        NOT NULL,
+    subject    TEXT        NOT NULL,
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email      TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+`
+const createOAuthClientsTable = `
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id            UUID        PRIMARY KEY,
+    owner_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          TEXT        NOT NULL,
+    secret_hash   TEXT        NOT NULL,
+    redirect_uris TEXT[]      NOT NULL,
+    scopes        TEXT[]      NOT NULL,
+    confidential  BOOLEAN     NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    revoked_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS oauth_clients_owner_id_idx ON oauth_clients (owner_id);
+`
+const createOAuthCodesTable = `
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    code_hash      TEXT        PRIMARY KEY,
+    client_id      UUID        NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id        UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri   TEXT        NOT NULL,
+    scopes         TEXT[]      NOT NULL,
+    code_challenge TEXT        NOT NULL,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    used_at        TIMESTAMPTZ,
+    grant_id       UUID
+);
+CREATE INDEX IF NOT EXISTS oauth_codes_expires_at_idx ON oauth_codes (expires_at);
+`
+const createOAuthGrantsTable = `
+CREATE TABLE IF NOT EXISTS oauth_grants (
+    id                    UUID        PRIMARY KEY,
+    client_id             UUID        NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id               UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id            UUID        NOT NULL,
+    scopes                TEXT[]      NOT NULL,
+    refresh_hash          TEXT        NOT NULL UNIQUE,
+    previous_refresh_hash TEXT,
+    refresh_expires_at    TIMESTAMPTZ NOT NULL,
+    created_at            TIMESTAMPTZ NOT NULL,
+    revoked_at            TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS oauth_grants_client_id_idx ON oauth_grants (client_id);
+CREATE INDEX IF NOT EXISTS oauth_grants_previous_refresh_hash_idx ON oauth_grants (previous_refresh_hash);
+`
+const addUsersDeletionRequestedColumn = `
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS users_deletion_requested_at_idx ON users (deletion_requested_at)
+    WHERE deletion_requested_at IS NOT NULL;
+`
+
+// calc_history was created without ON DELETE behaviour, which blocks
+// deleting an account; history now goes with the user. The constraint is
+// only replaced while it does not cascade yet (confdeltype 'c'), so later
+// boots neither lock the table nor re-check every row.
+const cascadeHistoryUserDelete = `
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'calc_history'::regclass
+          AND conname = 'calc_history_user_id_fkey'
+          AND confdeltype = 'c'
+    ) THEN
+        ALTER TABLE calc_history DROP CONSTRAINT IF EXISTS calc_history_user_id_fkey;
+        ALTER TABLE calc_history ADD CONSTRAINT calc_history_user_id_fkey
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+    END IF;
+END
+$$;
+`
+const addPreferencesProfileColumns = `
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT 'en';
+`
+const createEmailChangesTable = `
+CREATE TABLE IF NOT EXISTS email_changes (
+    id          UUID        PRIMARY KEY,
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email   TEXT        NOT NULL,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    used_at     TIMESTAMPTZ
+);
+`
+
+// schema lists the statements run at startup, in order. Each one must be
+// idempotent since it runs on every boot.
+var schema = []struct {
+	name  string
+	query string
+}{
+	{"users table", createUsersTableQuery},
+	{"calc_history table", createHistoryTable},
+	{"user_preferences table", createPreferencesTable},
+	{"calc_history.metadata column", addHistoryMetadataColumn},
+	{"calc_history.exact_result column", addHistoryExactResultColumn},
+	{"user_preferences.angle_mode column", addPreferencesAngleModeColumn},
+	{"refresh_tokens table", createRefreshTokensTable},
+	{"users.token_version column", addUsersTokenVersionColumn},
+	{"revoked_tokens table", createRevokedTokensTable},
+	{"sessions table", createSessionsTable},
+	{"password_reset_tokens table", createPasswordResetTokensTable},
+	{"users.email_verified column", addUsersEmailVerifiedColumn},
+	{"email_verifications table", createEmailVerificationsTable},
+	{"user_mfa table", createUserMFATable},
+	{"mfa_recovery_codes table", createMFARecoveryCodesTable},
+	{"mfa_challenges table", createMFAChallengesTable},
+	{"login_failures table", createLoginFailuresTable},
+	{"lockout_events table", createLockoutEventsTable},
+	{"users.role and users.disabled_at columns", addUsersRoleColumns},
+	{"api_keys table", createAPIKeysTable},
+	{"oidc_states table", createOIDCStatesTable},
+	{"user_identities table", createUserIdentitiesTable},
+	{"oauth_clients table", createOAuthClientsTable},
+	{"oauth_codes table", createOAuthCodesTable},
+	{"oauth_grants table", createOAuthGrantsTable},
+	{"users.deletion_requested_at column", addUsersDeletionRequestedColumn},
+	{"calc_history.user_id cascade", cascadeHistoryUserDelete},
+	{"email_changes table", createEmailChangesTable},
+	{"user_preferences profile columns", addPreferencesProfileColumns},
+}
+
 func NewPostgresDB() (*sql.DB, error) {
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
@@ -54,13 +350,11 @@ func NewPostgresDB() (*sql.DB, error) {
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
 
-	// Auto-create users table
-	if _, err := db.Exec(createUsersTableQuery); err != nil {
-		return nil, fmt.Errorf("create users table: %w", err)
-	}
-	// Auto-create calc_history table
-	if _, err := db.Exec(createHistoryTable); err != nil {
-		return nil, fmt.Errorf("create calc_history table: %w", err)
+	// Auto-create / migrate tables
+	for _, s := range schema {
+		if _, err := db.Exec(s.query); err != nil {
+			return nil, fmt.Errorf("create %s: %w", s.name, err)
+		}
 	}
 
 	return db, nil